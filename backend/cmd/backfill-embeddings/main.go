@@ -0,0 +1,63 @@
+// cmd/backfill-embeddings/main.go
+//
+// Generates the embeddings of items that ingestion loaded without a vector because the embedding
+// service kept failing. Run it once the service is healthy again; it is safe to re-run.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/connections"
+	"github.com/jjckrbbt/catalyst/backend/internal/embedding"
+	"github.com/jjckrbbt/catalyst/backend/internal/logger"
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	serviceURL := flag.String("embedding-url", "", "embedding service endpoint (defaults to EMBEDDING_SERVICE_URL)")
+	batchSize := flag.Int("batch-size", processing.DefaultBatchSize, "pending items to read per query")
+	maxAttempts := flag.Int("max-attempts", 10, "skip items that have already failed this many times")
+	rateLimit := flag.Float64("rate-limit", 0, "embedding requests per second; 0 means unlimited")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		fmt.Fprintln(os.Stderr, "FATAL: DATABASE_URL environment variable not set")
+		os.Exit(1)
+	}
+	if *serviceURL == "" {
+		*serviceURL = os.Getenv("EMBEDDING_SERVICE_URL")
+	}
+
+	logger.InitLogger("development")
+	appLogger := logger.L().With("component", "backfill_embeddings")
+
+	dbClient, err := connections.ConnectDB(dbURL, appLogger.With("component", "database_connector"))
+	if err != nil {
+		appLogger.Error("Failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer dbClient.Close()
+
+	ctx := context.Background()
+	queries := repository.New(dbClient.Pool)
+	client := embedding.NewClient(*serviceURL)
+
+	result, err := processing.BackfillEmbeddings(ctx, queries, client.EmbedBatch, processing.EmbeddingOptions{RateLimit: *rateLimit}, *batchSize, *maxAttempts, appLogger)
+	if err != nil {
+		appLogger.Error("Backfill failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	appLogger.Info("Backfill finished",
+		"items_attempted", result.ItemsAttempted,
+		"items_embedded", result.ItemsEmbedded,
+		"items_failed", result.ItemsFailed,
+	)
+}
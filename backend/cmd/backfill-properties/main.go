@@ -0,0 +1,81 @@
+// cmd/backfill-properties/main.go
+//
+// Rewrites the custom_properties of existing items so that values ingested under flat dotted
+// keys (e.g. "metadata.section") move into the nested objects the ingestion configs describe.
+// Run it once after upgrading; it is safe to re-run.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/connections"
+	"github.com/jjckrbbt/catalyst/backend/internal/logger"
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	configPath := flag.String("configs", "./backend/configs", "directory containing the ingestion configs")
+	reportType := flag.String("report-type", "", "only backfill items for this report type's config")
+	batchSize := flag.Int("batch-size", processing.DefaultBatchSize, "items to read per query")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		fmt.Fprintln(os.Stderr, "FATAL: DATABASE_URL environment variable not set")
+		os.Exit(1)
+	}
+
+	logger.InitLogger("development")
+	appLogger := logger.L().With("component", "backfill_properties")
+
+	configLoader, err := processing.NewConfigLoader(*configPath)
+	if err != nil {
+		appLogger.Error("Failed to load configs", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	var configs []processing.IngestionConfig
+	if *reportType != "" {
+		config, ok := configLoader.GetConfig(*reportType)
+		if !ok {
+			appLogger.Error("No config found for report type", "report_type", *reportType)
+			os.Exit(1)
+		}
+		configs = append(configs, config)
+	} else {
+		configs = configLoader.Configs()
+	}
+
+	dbClient, err := connections.ConnectDB(dbURL, appLogger.With("component", "database_connector"))
+	if err != nil {
+		appLogger.Error("Failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer dbClient.Close()
+
+	ctx := context.Background()
+	queries := repository.New(dbClient.Pool)
+
+	for _, config := range configs {
+		result, err := processing.BackfillNestedProperties(ctx, queries, config, *batchSize, *dryRun, appLogger.With("report_type", config.ReportType))
+		if err != nil {
+			appLogger.Error("Backfill failed", "report_type", config.ReportType, slog.Any("error", err))
+			os.Exit(1)
+		}
+		appLogger.Info("Backfill finished",
+			"report_type", config.ReportType,
+			"item_type", config.ItemType,
+			"items_scanned", result.ItemsScanned,
+			"items_rewritten", result.ItemsRewritten,
+			"dry_run", *dryRun,
+		)
+	}
+}
@@ -0,0 +1,185 @@
+// cmd/gen-views/main.go
+//
+// Generates the typed SQL view for an ingestion config's items as a goose migration in its app's
+// migrations directory, with column types inferred from the config's transforms. With -check it
+// instead compares the views the migrations define with the configs that declare a view and exits
+// with status 1 if any have drifted.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+)
+
+func main() {
+	configPath := flag.String("configs", "./backend/configs", "directory containing the ingestion configs")
+	reportType := flag.String("report-type", "", "the config to generate a view for; with -check, the only config to check")
+	migrationsDir := flag.String("migrations", "", "migrations directory to read and write; defaults to the config's app migrations")
+	check := flag.Bool("check", false, "report views that no longer match their configs instead of generating one")
+	asJSON := flag.Bool("json", false, "with -check, print the drift as a JSON array")
+	toStdout := flag.Bool("stdout", false, "print the migration instead of writing it")
+	flag.Parse()
+
+	configLoader, err := processing.NewConfigLoader(*configPath)
+	if err != nil {
+		fatal("failed to load configs: %v", err)
+	}
+
+	if *check {
+		os.Exit(runCheck(configLoader, *configPath, *reportType, *migrationsDir, *asJSON))
+	}
+	if *reportType == "" {
+		fatal("-report-type is required unless -check is given")
+	}
+	config, ok := configLoader.GetConfig(*reportType)
+	if !ok {
+		fatal("no config found for report type '%s'", *reportType)
+	}
+	dir := *migrationsDir
+	if dir == "" {
+		if dir, err = appMigrationsDir(*configPath, sourceFile(configLoader, *reportType)); err != nil {
+			fatal("%v", err)
+		}
+	}
+
+	view, err := processing.BuildView(config)
+	if err != nil {
+		fatal("%s: %v", *reportType, err)
+	}
+	existing, err := processing.ReadViewDefinitions(dir)
+	if err != nil {
+		fatal("%v", err)
+	}
+	var previous *processing.ExistingView
+	if current, ok := existing[view.Name]; ok {
+		previous = &current
+		drift, err := processing.CheckView(config, current)
+		if err != nil {
+			fatal("%s: %v", *reportType, err)
+		}
+		if len(drift) == 0 && !*toStdout {
+			fmt.Fprintf(os.Stderr, "%s already matches the %s config (%s)\n", view.Name, *reportType, current.File)
+			return
+		}
+	}
+
+	migration := processing.RenderViewMigration(view, previous)
+	if *toStdout {
+		fmt.Print(migration)
+		return
+	}
+	version, err := processing.NextMigrationVersion(dir, time.Now())
+	if err != nil {
+		fatal("%v", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d_generate_%s.sql", version, view.Name))
+	if err := os.WriteFile(path, []byte(migration), 0o644); err != nil {
+		fatal("failed to write migration: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+}
+
+// runCheck compares each config that declares a view, or just the one given, with the view its
+// migrations define, and returns the exit status.
+func runCheck(configLoader *processing.ConfigLoader, configPath, reportType, migrationsDir string, asJSON bool) int {
+	var configs []processing.IngestionConfig
+	if reportType != "" {
+		config, ok := configLoader.GetConfig(reportType)
+		if !ok {
+			fatal("no config found for report type '%s'", reportType)
+		}
+		configs = append(configs, config)
+	} else {
+		for _, config := range configLoader.Configs() {
+			if config.View != nil {
+				configs = append(configs, config)
+			}
+		}
+	}
+
+	drift := []processing.ViewDrift{}
+	viewsByDir := make(map[string]map[string]processing.ExistingView)
+	for _, config := range configs {
+		dir := migrationsDir
+		if dir == "" {
+			var err error
+			if dir, err = appMigrationsDir(configPath, sourceFile(configLoader, config.ReportType)); err != nil {
+				fatal("%v", err)
+			}
+		}
+		views, ok := viewsByDir[dir]
+		if !ok {
+			var err error
+			if views, err = processing.ReadViewDefinitions(dir); err != nil {
+				fatal("%v", err)
+			}
+			viewsByDir[dir] = views
+		}
+
+		name := processing.ViewName(config)
+		existing, ok := views[name]
+		if !ok {
+			drift = append(drift, processing.ViewDrift{View: name, Message: fmt.Sprintf("is not defined by any migration in %s", dir)})
+			continue
+		}
+		viewDrift, err := processing.CheckView(config, existing)
+		if err != nil {
+			fatal("%s: %v", config.ReportType, err)
+		}
+		drift = append(drift, viewDrift...)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(drift); err != nil {
+			fatal("failed to write results: %v", err)
+		}
+	} else {
+		for _, d := range drift {
+			fmt.Println(d)
+		}
+	}
+	if len(drift) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems found; regenerate the views with -report-type\n", len(drift))
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d views match their configs\n", len(configs))
+	return 0
+}
+
+// sourceFile returns the file the report type's config was loaded from.
+func sourceFile(configLoader *processing.ConfigLoader, reportType string) string {
+	for _, loaded := range configLoader.Loaded() {
+		if loaded.ReportType == reportType {
+			return loaded.File
+		}
+	}
+	return ""
+}
+
+// appMigrationsDir maps a config under configs/apps/<app>/ to the app's migrations directory,
+// sql/apps/<app>/migrations, next to the configs directory.
+func appMigrationsDir(configPath, file string) (string, error) {
+	rel, err := filepath.Rel(configPath, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate %s: %w", file, err)
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 3 || parts[0] != "apps" {
+		return "", fmt.Errorf("%s is not under %s/apps/<app>; give the migrations directory with -migrations", file, configPath)
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(configPath)), "sql", "apps", parts[1], "migrations"), nil
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "FATAL: "+format+"\n", args...)
+	os.Exit(2)
+}
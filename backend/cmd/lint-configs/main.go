@@ -0,0 +1,75 @@
+// cmd/lint-configs/main.go
+//
+// Checks ingestion configs the way the server does when it loads them and reports every problem
+// with its file and line, so configs can be linted before they are deployed. Give config files as
+// arguments, or a directory with -configs; item types are checked against the item_types.yaml
+// files in the -configs directory either way. Exits with status 1 if any config has a problem.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+)
+
+func main() {
+	configPath := flag.String("configs", "./backend/configs", "directory containing the ingestion configs, used when no files are given")
+	asJSON := flag.Bool("json", false, "print the problems as a JSON array")
+	flag.Parse()
+
+	var issues processing.ConfigIssues
+	checked := 0
+	if flag.NArg() > 0 {
+		// Files given on their own are checked against the item types declared in the configs directory
+		itemTypes, err := processing.LoadItemTypes(*configPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "FATAL: %v\n", err)
+			os.Exit(2)
+		}
+		for _, path := range flag.Args() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "FATAL: failed to read config file: %v\n", err)
+				os.Exit(2)
+			}
+			_, fileIssues := processing.LintConfig(path, data, processing.LintOptions{ItemTypes: itemTypes})
+			issues = append(issues, fileIssues...)
+			checked++
+		}
+	} else {
+		configs, dirIssues, err := processing.LintConfigDir(*configPath, processing.LintOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FATAL: %v\n", err)
+			os.Exit(2)
+		}
+		issues = dirIssues
+		checked = len(configs)
+	}
+
+	if *asJSON {
+		if issues == nil {
+			issues = processing.ConfigIssues{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			fmt.Fprintf(os.Stderr, "FATAL: failed to write results: %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+
+	if len(issues) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problems found\n", len(issues))
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%d configs OK\n", checked)
+}
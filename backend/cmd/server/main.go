@@ -8,13 +8,16 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"runtime/debug"
 
-	"cloud.google.com/go/storage"
 	"github.com/jjckrbbt/catalyst/backend/internal/api"
+	"github.com/jjckrbbt/catalyst/backend/internal/blobstore"
 	"github.com/jjckrbbt/catalyst/backend/internal/config"
 	"github.com/jjckrbbt/catalyst/backend/internal/connections"
+	"github.com/jjckrbbt/catalyst/backend/internal/embedding"
 	"github.com/jjckrbbt/catalyst/backend/internal/ingestion"
 	"github.com/jjckrbbt/catalyst/backend/internal/logger"
 	"github.com/jjckrbbt/catalyst/backend/internal/processing"
@@ -87,12 +90,12 @@ func main() {
 	appLogger.Info("Database connection established.")
 
 	ctx := context.Background()
-	gcsClient, err := storage.NewClient(ctx)
+	blobStore, err := blobstore.New(ctx, cfg)
 	if err != nil {
-		appLogger.Error("Failed to create GCS client on startup", slog.Any("error", err))
+		appLogger.Error("Failed to create blob store on startup", slog.Any("error", err))
 		os.Exit(1)
 	}
-	appLogger.Info("GCS client initialized.")
+	appLogger.Info("Blob store initialized.", "backend", cfg.BlobStore)
 
 	// 5. Initialize Core Application Components.
 	platformQuerier := repository.New(dbClient.Pool)
@@ -101,7 +104,7 @@ func main() {
 
 	apiLogger := appLogger.With("service", "api_handlers")
 
-	ingestionService, err := ingestion.NewService(platformQuerier, gcsClient, cfg, apiLogger)
+	ingestionService, err := ingestion.NewService(platformQuerier, blobStore, cfg, apiLogger, dbClient.Pool)
 	if err != nil {
 		appLogger.Error("Failed to initialize ingestion service", slog.Any("error", err))
 		os.Exit(1)
@@ -115,10 +118,28 @@ func main() {
 	}
 	appLogger.Info("catalyst Config Loader initialized.")
 
+	// Item types declared next to the configs are registered before any config can load into them
+	if err := processing.RegisterItemTypes(ctx, platformQuerier, configLoader.ItemTypes()); err != nil {
+		appLogger.Error("Failed to register item types", slog.Any("error", err))
+		os.Exit(1)
+	}
+	appLogger.Info("Item types registered.", "count", len(configLoader.ItemTypes()))
+
 	processorLogger := appLogger.With("service", "catalyst_data_processor")
-	processingService := processing.NewService(ingestionService, configLoader, platformQuerier, gcsClient, processorLogger, cfg, dbClient.Pool)
+	embeddingClient := embedding.NewClient(cfg.EmbeddingServiceURL)
+	processingService := processing.NewService(ingestionService, configLoader, platformQuerier, blobStore, processorLogger, cfg, dbClient.Pool, embeddingClient.EmbedBatch)
 	appLogger.Info("Processing service initialized.")
 
+	// Jobs are picked up from ingestion_jobs by this process and any other replica.
+	jobQueue := ingestion.NewQueue(platformQuerier, processingService.RunJob, ingestion.QueueOptions{
+		Concurrency: cfg.IngestionQueueConcurrency,
+		StaleAfter:  time.Duration(cfg.IngestionJobStaleSeconds) * time.Second,
+	}, processorLogger)
+	appLogger.Info("Ingestion queue initialized.")
+
+	// Files from the directories declared in ingestion configs become jobs on their schedules.
+	sourceWatcher := processing.NewSourceWatcher(configLoader, ingestionService, platformQuerier, jobQueue.Notify, processorLogger)
+
 	fetcherRegistry := api.NewFetcherRegistry()
 
 	// Initialize your HTTP API handlers.
@@ -130,7 +151,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	uploadHandler := api.NewUploadHandler(ingestionService, processingService, demoHandler, configLoader, apiLogger)
+	uploadHandler := api.NewUploadHandler(ingestionService, processingService, jobQueue, configLoader, apiLogger)
+	jobHandler := api.NewJobHandler(platformQuerier, ingestionService, processingService, jobQueue, configLoader, apiLogger)
+	configHandler := api.NewConfigHandler(platformQuerier, configLoader, apiLogger)
+	itemTypeHandler := api.NewItemTypeHandler(platformQuerier, apiLogger)
 	insuranceHandler, err := api.NewInsuranceHandler(insuranceQuerier, platformQuerier, cfg.OpenAIAPIKey, apiLogger)
 	if err != nil {
 		appLogger.Error("Failed to initialize insurance handler", "error", err)
@@ -249,6 +273,7 @@ func main() {
 
 	//Upload group
 	apiGroup.POST("/upload/:reportType", uploadHandler.HandleUpload)
+	apiGroup.POST("/upload/:reportType/preview", uploadHandler.HandlePreview)
 
 	// RAG DEMO
 	apiGroup.POST("/demo/query", demoHandler.HandleHybridQuery)
@@ -266,15 +291,40 @@ func main() {
 	
 
 	//Upload Reporting Group
-//	uploadRoutes := apiGroup.Group("/uploads")
-//	uploadRoutes.GET("", uploadHandler.HandleGetUploads)
-//	uploadRoutes.GET("/removed_rows/:id", uploadHandler.HandleGetRemovedRows)
+	uploadRoutes := apiGroup.Group("/uploads")
+	uploadRoutes.GET("", jobHandler.HandleListJobs)
+	uploadRoutes.GET("/:id", jobHandler.HandleGetJob)
+	uploadRoutes.POST("/:id/cancel", jobHandler.HandleCancelJob)
+	uploadRoutes.POST("/:id/retry", jobHandler.HandleRetryJob)
+	uploadRoutes.POST("/:id/rollback", jobHandler.HandleRollbackJob)
+	uploadRoutes.GET("/:id/attempts", jobHandler.HandleListJobAttempts)
+	uploadRoutes.GET("/:id/changes", jobHandler.HandleListJobChanges)
+	uploadRoutes.GET("/:id/errors", jobHandler.HandleListJobErrors)
+	uploadRoutes.GET("/:id/errors/download", jobHandler.HandleDownloadJobErrors)
+	uploadRoutes.PATCH("/:id/errors", jobHandler.HandleSetJobErrorsResolution)
+	uploadRoutes.POST("/:id/errors/resubmit", jobHandler.HandleResubmitJobErrors)
+
+	// Ingestion config inspection
+	configRoutes := apiGroup.Group("/admin/configs")
+	configRoutes.GET("", configHandler.HandleListConfigs)
+	configRoutes.GET("/status", configHandler.HandleGetConfigStatus)
+	configRoutes.POST("/reload", configHandler.HandleReloadConfigs)
+	configRoutes.GET("/:reportType", configHandler.HandleGetConfig)
+	configRoutes.GET("/:reportType/revisions", configHandler.HandleListConfigRevisions)
+	configRoutes.GET("/:reportType/revisions/:revision", configHandler.HandleGetConfigRevision)
+	configRoutes.GET("/:reportType/diff", configHandler.HandleDiffConfigRevisions)
+
+	// Item type registry
+	itemTypeRoutes := apiGroup.Group("/admin/item-types")
+	itemTypeRoutes.GET("", itemTypeHandler.HandleListItemTypes)
+	itemTypeRoutes.GET("/:name", itemTypeHandler.HandleGetItemType)
 
 	//Items group
 	itemRoutes := apiGroup.Group("/items")
 	itemRoutes.GET("", itemHandler.HandleGetItems)
 	itemRoutes.GET("/:id", itemHandler.HandleGetItems)
 	itemRoutes.GET("/history/:id", itemHandler.HandleGetHistory)
+	itemRoutes.GET("/:id/lineage", itemHandler.HandleGetLineage)
 	itemRoutes.POST("", itemHandler.HandleCreateItem)
 	itemRoutes.PATCH("/:id", itemHandler.HandleUpdateItem)
 
@@ -299,6 +349,42 @@ func main() {
 
 	address := fmt.Sprintf("0.0.0.0:%s", port)
 
+	// 10. Start the ingestion workers. On SIGINT/SIGTERM the server stops accepting requests and
+	// running jobs are requeued so another worker can pick them up.
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		jobQueue.Run(shutdownCtx)
+	}()
+	go sourceWatcher.Run(shutdownCtx)
+	// Every config revision that gets loaded is stored, so the mapping behind a job stays known
+	recordConfigRevisions := func() {
+		if err := processingService.RecordConfigRevisions(shutdownCtx); err != nil {
+			appLogger.Error("Failed to store config revisions", slog.Any("error", err))
+		}
+	}
+	// Item types added to the item_types.yaml files are registered when the configs reload
+	configLoader.OnReload(func() {
+		if err := processing.RegisterItemTypes(shutdownCtx, platformQuerier, configLoader.ItemTypes()); err != nil {
+			appLogger.Error("Failed to register item types", slog.Any("error", err))
+		}
+	})
+	configLoader.OnReload(recordConfigRevisions)
+	go recordConfigRevisions()
+	go configLoader.Watch(shutdownCtx, time.Duration(cfg.IngestionConfigReloadSeconds)*time.Second, processorLogger)
+
+	go func() {
+		<-shutdownCtx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := e.Shutdown(ctx); err != nil {
+			appLogger.Error("HTTP Server shutdown failed", slog.Any("error", err))
+		}
+	}()
+
 	appLogger.Info("HTTP Server starting on port", "port", port)
 
 	// e.Start blocks until the server is shut down or an error occurs.
@@ -309,4 +395,7 @@ func main() {
 	}
 	// This message would appear after a graceful shutdown.
 	appLogger.Info("HTTP Server stopped gracefully.")
+
+	stop()
+	<-queueDone
 }
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// ConfigHandler lets administrators inspect and reload the ingestion configs and compare the
+// revisions of them that jobs ran with.
+type ConfigHandler struct {
+	queries      repository.Querier
+	configLoader *processing.ConfigLoader
+	logger       *slog.Logger
+}
+
+// NewConfigHandler creates a new instance of the ConfigHandler.
+func NewConfigHandler(q repository.Querier, cl *processing.ConfigLoader, logger *slog.Logger) *ConfigHandler {
+	return &ConfigHandler{
+		queries:      q,
+		configLoader: cl,
+		logger:       logger.With("component", "config_handler"),
+	}
+}
+
+// ConfigDetailResponse is a loaded config with the settings in effect, after defaults and
+// validation, keyed by their YAML names.
+type ConfigDetailResponse struct {
+	processing.LoadedConfig
+	Config map[string]any `json:"config"`
+}
+
+// ConfigRevisionResponse is a stored config revision with its content as JSON.
+type ConfigRevisionResponse struct {
+	repository.IngestionConfigRevision
+	Content json.RawMessage `json:"content"`
+}
+
+// ConfigDiffResponse lists what changed between two revisions of a report type's config.
+type ConfigDiffResponse struct {
+	ReportType   string                    `json:"report_type"`
+	FromRevision int32                     `json:"from_revision"`
+	ToRevision   int32                     `json:"to_revision"`
+	Changes      []processing.ConfigChange `json:"changes"`
+}
+
+// HandleListConfigs lists the loaded report types and the files they came from.
+func (h *ConfigHandler) HandleListConfigs(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.configLoader.Loaded())
+}
+
+// HandleGetConfig returns the config in effect for a report type.
+func (h *ConfigHandler) HandleGetConfig(c echo.Context) error {
+	reportType := c.Param("reportType")
+	config, ok := h.configLoader.GetConfig(reportType)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Config not found")
+	}
+	var loaded processing.LoadedConfig
+	for _, lc := range h.configLoader.Loaded() {
+		if lc.ReportType == reportType {
+			loaded = lc
+			break
+		}
+	}
+
+	doc, err := processing.ConfigDocument(config)
+	if err != nil {
+		h.logger.ErrorContext(c.Request().Context(), "Failed to render config", "error", err, "report_type", reportType)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve config")
+	}
+	return c.JSON(http.StatusOK, ConfigDetailResponse{LoadedConfig: loaded, Config: doc})
+}
+
+// HandleGetConfigStatus reports when the configs were last reloaded and which files failed.
+func (h *ConfigHandler) HandleGetConfigStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.configLoader.Status())
+}
+
+// HandleReloadConfigs reloads the configs now rather than waiting for the watcher. Files that
+// fail keep their last good version and are listed in the returned status.
+func (h *ConfigHandler) HandleReloadConfigs(c echo.Context) error {
+	if err := h.configLoader.Reload(); err != nil {
+		h.logger.WarnContext(c.Request().Context(), "Ingestion configs reloaded with errors", "error", err)
+	}
+	return c.JSON(http.StatusOK, h.configLoader.Status())
+}
+
+// HandleListConfigRevisions lists the stored revisions of a report type's config, newest first.
+func (h *ConfigHandler) HandleListConfigRevisions(c echo.Context) error {
+	ctx := c.Request().Context()
+	revisions, err := h.queries.ListIngestionConfigRevisions(ctx, c.Param("reportType"))
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list config revisions", "error", err, "report_type", c.Param("reportType"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve config revisions")
+	}
+	if revisions == nil {
+		revisions = []repository.ListIngestionConfigRevisionsRow{}
+	}
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// HandleGetConfigRevision returns one stored revision of a report type's config.
+func (h *ConfigHandler) HandleGetConfigRevision(c echo.Context) error {
+	revision, err := strconv.ParseInt(c.Param("revision"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid revision")
+	}
+	stored, err := h.loadRevision(c, int32(revision))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, ConfigRevisionResponse{IngestionConfigRevision: stored, Content: stored.Content})
+}
+
+// HandleDiffConfigRevisions compares two revisions of a report type's config, given as the from
+// and to query parameters. to defaults to the latest revision and from to the one before to.
+func (h *ConfigHandler) HandleDiffConfigRevisions(c echo.Context) error {
+	ctx := c.Request().Context()
+	reportType := c.Param("reportType")
+
+	var to repository.IngestionConfigRevision
+	if raw := c.QueryParam("to"); raw != "" {
+		revision, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid to")
+		}
+		if to, err = h.loadRevision(c, int32(revision)); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		to, err = h.queries.GetLatestIngestionConfigRevision(ctx, reportType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "No config revisions found")
+		}
+		if err != nil {
+			h.logger.ErrorContext(ctx, "Failed to get latest config revision", "error", err, "report_type", reportType)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve config revision")
+		}
+	}
+
+	fromRevision := to.Revision - 1
+	if raw := c.QueryParam("from"); raw != "" {
+		revision, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid from")
+		}
+		fromRevision = int32(revision)
+	}
+	if fromRevision < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "No earlier revision to compare with")
+	}
+	from, err := h.loadRevision(c, fromRevision)
+	if err != nil {
+		return err
+	}
+
+	changes, err := processing.DiffConfigContent(from.Content, to.Content)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to diff config revisions", "error", err, "report_type", reportType)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compare config revisions")
+	}
+	return c.JSON(http.StatusOK, ConfigDiffResponse{
+		ReportType:   reportType,
+		FromRevision: from.Revision,
+		ToRevision:   to.Revision,
+		Changes:      changes,
+	})
+}
+
+// loadRevision fetches a revision of the report type in the :reportType path parameter, answering
+// 404 if there is none.
+func (h *ConfigHandler) loadRevision(c echo.Context, revision int32) (repository.IngestionConfigRevision, error) {
+	ctx := c.Request().Context()
+	stored, err := h.queries.GetIngestionConfigRevision(ctx, repository.GetIngestionConfigRevisionParams{
+		ReportType: c.Param("reportType"),
+		Revision:   revision,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return stored, echo.NewHTTPError(http.StatusNotFound, "Config revision not found")
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get config revision", "error", err, "report_type", c.Param("reportType"), "revision", revision)
+		return stored, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve config revision")
+	}
+	return stored, nil
+}
@@ -331,7 +331,7 @@ func (h *InsuranceHandler) HandleUpdateClaim(c echo.Context) error {
 		ItemID:    id,
 		EventType: "CLAIM_STATUS_CHANGED",
 		EventData: eventDataJSON,
-		CreatedBy: userID,
+		CreatedBy: pgtype.Int8{Int64: userID, Valid: true},
 	}
 	_, err = h.platformQuerier.CreateItemEvent(ctx, eventParams)
 	if err != nil {
@@ -389,6 +389,27 @@ func (h *InsuranceHandler) HandleCreateComment(c echo.Context) error {
 	}
 	return c.JSON(http.StatusCreated, newComment)
 }
+// metadataMap decodes a structured_metadata column. Chunks ingested with parse_json hold an object,
+// which arrives already decoded; older chunks hold the same document as a JSON string.
+func metadataMap(value interface{}) map[string]interface{} {
+	var raw []byte
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return nil
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
+
 func (h *InsuranceHandler) getEmbedding(ctx context.Context, textToEmbed string) ([]float32, error) {
 	reqBody, err := json.Marshal(EmbeddingRequest{Text: textToEmbed})
 	if err != nil {
@@ -642,10 +663,7 @@ func (h *InsuranceHandler) getContextFromPlan(ctx context.Context, plan []ToolCa
 				sourceText, _ := chunk.Source.(string)
 				textValue, _ := chunk.Text.(string)
 				score, _ := chunk.SimilarityScore.(float64)
-				var metadata map[string]interface{}
-				if rawJSON, ok := chunk.StructuredMetadata.([]byte); ok && rawJSON != nil {
-					_ = json.Unmarshal(rawJSON, &metadata)
-				}
+				metadata := metadataMap(chunk.StructuredMetadata)
 
 				enrichedResult := SearchResult{
 					Source:          sourceText,
@@ -660,19 +678,10 @@ func (h *InsuranceHandler) getContextFromPlan(ctx context.Context, plan []ToolCa
 						headerMetadataJSON, err := h.queries.GetDocumentHeader(ctx, docID)
 						if err != nil {
 							reqLogger.WarnContext(ctx, "Could not fetch document header", "doc_id", docID, "error", err)
-						} else if headerMetadataJSON != nil {
-							if rawJSON, ok := headerMetadataJSON.([]byte); ok {
-								var headerMetadata map[string]interface{}
-								if err := json.Unmarshal(rawJSON, &headerMetadata); err == nil {
-									// Ensure metadata map is initialized
-									if enrichedResult.Metadata == nil {
-										enrichedResult.Metadata = make(map[string]interface{})
-									}
-									// Merge header properties into the chunk's metadata
-									for key, value := range headerMetadata {
-										enrichedResult.Metadata[key] = value
-									}
-								}
+						} else if headerMetadata := metadataMap(headerMetadataJSON); headerMetadata != nil {
+							// Merge header properties into the chunk's metadata
+							for key, value := range headerMetadata {
+								enrichedResult.Metadata[key] = value
 							}
 						}
 					}
@@ -117,8 +117,17 @@ func (h *ItemHandler) HandleCreateItem(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
 	}
 
+	itemType := repository.ItemType(req.ItemType)
+	if err := itemType.Validate(ctx, h.queries); err != nil {
+		if errors.Is(err, repository.ErrUnknownItemType) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unknown 'item_type' "+req.ItemType)
+		}
+		h.logger.ErrorContext(ctx, "Failed to look up item type", "error", err, "item_type", req.ItemType)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create item")
+	}
+
 	params := repository.CreateItemParams{
-		ItemType:         repository.ItemType(req.ItemType),
+		ItemType:         itemType,
 		Scope:            pgtype.Text{String: req.Scope, Valid: req.Scope != ""},
 		BusinessKey:      pgtype.Text{String: req.BusinessKey, Valid: req.BusinessKey != ""},
 		Status:           repository.ItemStatus(req.Status),
@@ -188,6 +197,38 @@ func (h *ItemHandler) HandleUpdateItem(c echo.Context) error {
 	return c.JSON(http.StatusOK, updatedItem)
 }
 
+// HandleGetLineage lists every ingestion job and source row that wrote an item, newest first,
+// with the version of the config that mapped it. It accepts page and limit.
+func (h *ItemHandler) HandleGetLineage(c echo.Context) error {
+	ctx := c.Request().Context()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.logger.WarnContext(ctx, "Invalid item ID format for lineage lookup", "error", err, "id_param", c.Param("id"))
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid item ID format")
+	}
+	limit, offset := pageParams(c)
+
+	lineage, err := h.queries.ListItemLineage(ctx, repository.ListItemLineageParams{
+		ItemID: id,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to retrieve item lineage", "error", err, "item_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve item lineage")
+	}
+	totalCount, err := h.queries.CountItemLineage(ctx, id)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count item lineage", "error", err, "item_id", id)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve item lineage")
+	}
+
+	if lineage == nil {
+		lineage = []repository.ListItemLineageRow{}
+	}
+	return c.JSON(http.StatusOK, PaginatedItemsResponse{TotalCount: totalCount, Data: lineage})
+}
+
 // HandleGetHistory retrieves the event history for a specific item.
 func (h *ItemHandler) HandleGetHistory(c echo.Context) error {
 	ctx := c.Request().Context()
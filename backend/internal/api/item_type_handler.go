@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// ItemTypeHandler lets administrators see the item types apps have registered.
+type ItemTypeHandler struct {
+	queries repository.Querier
+	logger  *slog.Logger
+}
+
+// NewItemTypeHandler creates a new instance of the ItemTypeHandler.
+func NewItemTypeHandler(q repository.Querier, logger *slog.Logger) *ItemTypeHandler {
+	return &ItemTypeHandler{
+		queries: q,
+		logger:  logger.With("component", "item_type_handler"),
+	}
+}
+
+// HandleListItemTypes lists the registered item types with their metadata, ordered by name.
+func (h *ItemTypeHandler) HandleListItemTypes(c echo.Context) error {
+	ctx := c.Request().Context()
+	itemTypes, err := h.queries.ListItemTypes(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list item types", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve item types")
+	}
+	if itemTypes == nil {
+		itemTypes = []repository.ItemTypeRegistry{}
+	}
+	return c.JSON(http.StatusOK, itemTypes)
+}
+
+// HandleGetItemType returns one registered item type.
+func (h *ItemTypeHandler) HandleGetItemType(c echo.Context) error {
+	ctx := c.Request().Context()
+	itemType, err := h.queries.GetItemType(ctx, repository.ItemType(c.Param("name")))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "Item type not found")
+		}
+		h.logger.ErrorContext(ctx, "Failed to get item type", "error", err, "item_type", c.Param("name"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve item type")
+	}
+	return c.JSON(http.StatusOK, itemType)
+}
@@ -0,0 +1,615 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/ingestion"
+	"github.com/jjckrbbt/catalyst/backend/internal/processing"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// JobHandler serves the status of ingestion jobs and the rows they sent to triage.
+type JobHandler struct {
+	queries           repository.Querier
+	ingestionService  *ingestion.Service
+	processingService *processing.Service
+	jobQueue          *ingestion.Queue
+	configLoader      *processing.ConfigLoader
+	logger            *slog.Logger
+}
+
+// NewJobHandler creates a new instance of the JobHandler.
+func NewJobHandler(q repository.Querier, is *ingestion.Service, ps *processing.Service, jq *ingestion.Queue, cl *processing.ConfigLoader, logger *slog.Logger) *JobHandler {
+	return &JobHandler{
+		queries:           q,
+		ingestionService:  is,
+		processingService: ps,
+		jobQueue:          jq,
+		configLoader:      cl,
+		logger:            logger.With("component", "job_handler"),
+	}
+}
+
+// JobDetailResponse is a single job with its triage counters.
+type JobDetailResponse struct {
+	repository.IngestionJob
+	ErrorCount int64 `json:"error_count"`
+}
+
+// csvPageSize is how many triage rows are read per query when building a CSV download.
+const csvPageSize = 1000
+
+// HandleListJobs lists ingestion jobs, newest first. It accepts the optional filters report_type,
+// status, user_id, started_after and started_before (RFC 3339 or YYYY-MM-DD), plus page and limit.
+func (h *JobHandler) HandleListJobs(c echo.Context) error {
+	ctx := c.Request().Context()
+	limit, offset := pageParams(c)
+
+	filters := repository.CountIngestionJobsParams{
+		ReportType: textParam(c, "report_type"),
+		Status:     textParam(c, "status"),
+	}
+	if raw := c.QueryParam("user_id"); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id")
+		}
+		filters.UserID = pgtype.Int8{Int64: userID, Valid: true}
+	}
+	var err error
+	if filters.StartedAfter, err = timeParam(c, "started_after"); err != nil {
+		return err
+	}
+	if filters.StartedBefore, err = timeParam(c, "started_before"); err != nil {
+		return err
+	}
+
+	jobs, err := h.queries.ListIngestionJobs(ctx, repository.ListIngestionJobsParams{
+		ReportType:    filters.ReportType,
+		Status:        filters.Status,
+		UserID:        filters.UserID,
+		StartedAfter:  filters.StartedAfter,
+		StartedBefore: filters.StartedBefore,
+		Limit:         limit,
+		Offset:        offset,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list ingestion jobs", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve jobs")
+	}
+	totalCount, err := h.queries.CountIngestionJobs(ctx, filters)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count ingestion jobs", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve jobs")
+	}
+
+	if jobs == nil {
+		jobs = []repository.IngestionJob{}
+	}
+	return c.JSON(http.StatusOK, PaginatedItemsResponse{TotalCount: totalCount, Data: jobs})
+}
+
+// HandleGetJob returns a single ingestion job with the number of rows it sent to triage.
+func (h *JobHandler) HandleGetJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+
+	errorCount, err := h.queries.CountIngestionErrors(ctx, repository.CountIngestionErrorsParams{JobID: job.ID})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count ingestion errors", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve job")
+	}
+	return c.JSON(http.StatusOK, JobDetailResponse{IngestionJob: job, ErrorCount: errorCount})
+}
+
+// HandleCancelJob cancels a queued or running job. A running job stops at its next batch and is
+// left CANCELLED with nothing committed; the response reflects the job as the request left it.
+func (h *JobHandler) HandleCancelJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	jobID := uuid.UUID(job.ID.Bytes)
+
+	cancelled, err := h.ingestionService.CancelJob(ctx, jobID)
+	if errors.Is(err, ingestion.ErrJobNotCancellable) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Job is %s; %s", job.Status, err))
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to cancel ingestion job", "error", err, "job_id", jobID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to cancel job")
+	}
+	// Stop it now if this process runs it; other workers notice at their next heartbeat
+	h.jobQueue.Cancel(jobID)
+	return c.JSON(http.StatusAccepted, cancelled)
+}
+
+// HandleRetryJob queues a failed or cancelled job to run again from its stored file. By default it
+// reuses the config of its last run; use_current_config=true runs it with the current config.
+func (h *JobHandler) HandleRetryJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	jobID := uuid.UUID(job.ID.Bytes)
+
+	useCurrentConfig := false
+	if raw := c.QueryParam("use_current_config"); raw != "" {
+		if useCurrentConfig, err = strconv.ParseBool(raw); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid use_current_config")
+		}
+	}
+	if useCurrentConfig {
+		if _, found := h.configLoader.GetConfig(job.ReportType); !found {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("No config is loaded for report type %s", job.ReportType))
+		}
+	}
+
+	retried, err := h.ingestionService.RetryJob(ctx, jobID, useCurrentConfig)
+	if errors.Is(err, ingestion.ErrJobNotRetryable) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Job is %s; %s", job.Status, err))
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to retry ingestion job", "error", err, "job_id", jobID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retry job")
+	}
+	h.jobQueue.Notify()
+	return c.JSON(http.StatusAccepted, retried)
+}
+
+// RollbackConflictResponse lists the items users edited after the job, stopping a rollback, and
+// the later jobs that changed its items.
+type RollbackConflictResponse struct {
+	Message   string                        `json:"message"`
+	Conflicts []processing.RollbackConflict `json:"conflicts"`
+	LaterJobs []uuid.UUID                   `json:"later_jobs,omitempty"`
+}
+
+// HandleRollbackJob restores the items a completed job changed to their state before it and marks
+// the job ROLLED_BACK. force=true rolls back items users changed since the job as well, and
+// delete_inserted=true deletes the items the job inserted instead of deactivating them.
+func (h *JobHandler) HandleRollbackJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	jobID := uuid.UUID(job.ID.Bytes)
+
+	var opts processing.RollbackOptions
+	if raw := c.QueryParam("force"); raw != "" {
+		if opts.Force, err = strconv.ParseBool(raw); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid force")
+		}
+	}
+	if raw := c.QueryParam("delete_inserted"); raw != "" {
+		if opts.DeleteInserted, err = strconv.ParseBool(raw); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid delete_inserted")
+		}
+	}
+
+	result, err := h.processingService.RollbackJob(ctx, jobID, opts, requestUserID(c))
+	var conflictErr *processing.RollbackConflictError
+	switch {
+	case errors.As(err, &conflictErr):
+		return c.JSON(http.StatusConflict, RollbackConflictResponse{
+			Message:   fmt.Sprintf("%s; use force=true to roll them back too", conflictErr),
+			Conflicts: conflictErr.Conflicts,
+			LaterJobs: conflictErr.LaterJobs,
+		})
+	case errors.Is(err, processing.ErrJobNotRollbackable):
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Job is %s; %s", job.Status, err))
+	case errors.Is(err, processing.ErrNoChangeRecord), errors.Is(err, processing.ErrInsertedItemsReferenced):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		h.logger.ErrorContext(ctx, "Failed to roll back ingestion job", "error", err, "job_id", jobID)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to roll back job")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// HandleListJobAttempts returns every run of a job, including those before a retry, oldest first.
+func (h *JobHandler) HandleListJobAttempts(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+
+	attempts, err := h.queries.ListIngestionJobAttempts(ctx, job.ID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list ingestion job attempts", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve job attempts")
+	}
+	if attempts == nil {
+		attempts = []repository.IngestionJobAttempt{}
+	}
+	return c.JSON(http.StatusOK, attempts)
+}
+
+// JobChangesResponse is a page of a job's change report: the items it inserted, updated or
+// deactivated, with the totals of the whole job.
+type JobChangesResponse struct {
+	Counts     processing.ChangeCounts `json:"counts"`
+	TotalCount int64                   `json:"total_count"`
+	Data       []JobChange             `json:"data"`
+}
+
+// JobChange is the item event a job wrote for one item. Data holds the field-level diff of an
+// INGESTION_UPDATED event.
+type JobChange struct {
+	EventID     int64           `json:"event_id"`
+	ItemID      int64           `json:"item_id"`
+	BusinessKey string          `json:"business_key"`
+	EventType   string          `json:"event_type"`
+	Data        json.RawMessage `json:"data"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// HandleListJobChanges pages through a job's change report. The optional event_type parameter
+// limits it to INGESTION_CREATED, INGESTION_UPDATED or INGESTION_DEACTIVATED events.
+func (h *JobHandler) HandleListJobChanges(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	limit, offset := pageParams(c)
+	eventType := textParam(c, "event_type")
+
+	rows, err := h.queries.ListIngestionJobChanges(ctx, repository.ListIngestionJobChangesParams{
+		JobID:     job.ID,
+		EventType: eventType,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list ingestion job changes", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve job changes")
+	}
+	totalCount, err := h.queries.CountIngestionJobChanges(ctx, repository.CountIngestionJobChangesParams{
+		JobID:     job.ID,
+		EventType: eventType,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count ingestion job changes", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve job changes")
+	}
+
+	changes := make([]JobChange, len(rows))
+	for i, row := range rows {
+		changes[i] = JobChange{
+			EventID:     row.ID,
+			ItemID:      row.ItemID,
+			BusinessKey: row.BusinessKey.String,
+			EventType:   row.EventType,
+			Data:        row.EventData,
+			CreatedAt:   row.CreatedAt.Time,
+		}
+	}
+	return c.JSON(http.StatusOK, JobChangesResponse{
+		Counts: processing.ChangeCounts{
+			Inserted:    int64(job.ItemsInserted.Int32),
+			Updated:     int64(job.ItemsUpdated.Int32),
+			Unchanged:   int64(job.ItemsUnchanged.Int32),
+			Deactivated: int64(job.ItemsDeactivated.Int32),
+		},
+		TotalCount: totalCount,
+		Data:       changes,
+	})
+}
+
+// HandleListJobErrors pages through a job's triage rows in source order. The optional search
+// parameter matches the failure reason or any cell of the original row, and resolution_status
+// limits the rows to open, resolved or dismissed ones.
+func (h *JobHandler) HandleListJobErrors(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	limit, offset := pageParams(c)
+	search := textParam(c, "search")
+	resolutionStatus := textParam(c, "resolution_status")
+
+	rows, err := h.queries.ListIngestionErrors(ctx, repository.ListIngestionErrorsParams{
+		JobID:            job.ID,
+		Search:           search,
+		ResolutionStatus: resolutionStatus,
+		Limit:            limit,
+		Offset:           offset,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list ingestion errors", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve triage rows")
+	}
+	totalCount, err := h.queries.CountIngestionErrors(ctx, repository.CountIngestionErrorsParams{
+		JobID:            job.ID,
+		Search:           search,
+		ResolutionStatus: resolutionStatus,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count ingestion errors", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve triage rows")
+	}
+
+	if rows == nil {
+		rows = []repository.IngestionError{}
+	}
+	return c.JSON(http.StatusOK, PaginatedItemsResponse{TotalCount: totalCount, Data: rows})
+}
+
+// HandleDownloadJobErrors returns all of a job's triage rows as a CSV file: the row number,
+// location and failure reason, followed by the original columns in the config's order. The columns
+// are looked up first so the rows can be streamed a page at a time. Cells are written so that
+// spreadsheet programs don't run them as formulas.
+func (h *JobHandler) HandleDownloadJobErrors(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+	search := textParam(c, "search")
+	resolutionStatus := textParam(c, "resolution_status")
+
+	found, err := h.queries.ListIngestionErrorColumns(ctx, repository.ListIngestionErrorColumnsParams{
+		JobID:            job.ID,
+		Search:           search,
+		ResolutionStatus: resolutionStatus,
+	})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to list triage columns for download", "error", err, "job_id", c.Param("id"))
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve triage rows")
+	}
+	columns := h.triageColumns(job.ReportType, found)
+
+	filename := fmt.Sprintf("triage-%s.csv", uuid.UUID(job.ID.Bytes).String())
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	header := []string{"row_number", "source_location", "reason_for_failure"}
+	for _, column := range columns {
+		header = append(header, csvCell(column))
+	}
+	_ = w.Write(header)
+	for offset := int32(0); ; offset += csvPageSize {
+		page, err := h.queries.ListIngestionErrors(ctx, repository.ListIngestionErrorsParams{
+			JobID:            job.ID,
+			Search:           search,
+			ResolutionStatus: resolutionStatus,
+			Limit:            csvPageSize,
+			Offset:           offset,
+		})
+		if err != nil {
+			// The status is already sent, so the download ends short
+			h.logger.ErrorContext(ctx, "Failed to list ingestion errors for download", "error", err, "job_id", c.Param("id"))
+			return err
+		}
+		for _, row := range page {
+			var record map[string]string
+			if err := json.Unmarshal(row.OriginalRowData, &record); err != nil {
+				h.logger.WarnContext(ctx, "Triage row has unreadable original data", "error", err, "error_id", uuid.UUID(row.ID.Bytes).String())
+			}
+			rowNumber := ""
+			if row.RowNumber.Valid {
+				rowNumber = strconv.Itoa(int(row.RowNumber.Int32))
+			}
+			line := make([]string, 0, len(columns)+3)
+			line = append(line, rowNumber, csvCell(row.SourceLocation.String), csvCell(row.ReasonForFailure))
+			for _, column := range columns {
+				line = append(line, csvCell(record[column]))
+			}
+			if err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		if len(page) < csvPageSize {
+			return nil
+		}
+	}
+}
+
+// csvCell keeps a spreadsheet program from running a cell as a formula. Cells starting with a
+// character that begins a formula are prefixed with a quote, which the spreadsheet shows as text.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ResubmitTriageRequest is the body of HandleResubmitJobErrors.
+type ResubmitTriageRequest struct {
+	Rows []processing.TriageCorrection `json:"rows"`
+}
+
+// SetTriageResolutionRequest is the body of HandleSetJobErrorsResolution.
+type SetTriageResolutionRequest struct {
+	IDs              []uuid.UUID `json:"ids"`
+	ResolutionStatus string      `json:"resolution_status"`
+}
+
+// maxTriageRowsPerRequest bounds how many triage rows one resubmit or resolution request can touch.
+const maxTriageRowsPerRequest = 5000
+
+// HandleResubmitJobErrors applies corrections to open triage rows and reprocesses them with the
+// job's config. Rows that load are resolved; the response says which ones failed again and why.
+func (h *JobHandler) HandleResubmitJobErrors(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+
+	var req ResubmitTriageRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Rows) == 0 || len(req.Rows) > maxTriageRowsPerRequest {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Provide between 1 and %d rows", maxTriageRowsPerRequest))
+	}
+	seen := make(map[uuid.UUID]bool, len(req.Rows))
+	for _, row := range req.Rows {
+		if seen[row.ID] {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Triage row %s is listed more than once", row.ID))
+		}
+		seen[row.ID] = true
+	}
+
+	result, err := h.processingService.ResubmitTriage(ctx, job, req.Rows, requestUserID(c))
+	if err != nil {
+		return h.triageError(c, err, "Failed to resubmit triage rows")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// HandleSetJobErrorsResolution dismisses open triage rows, or reopens dismissed ones.
+func (h *JobHandler) HandleSetJobErrorsResolution(c echo.Context) error {
+	ctx := c.Request().Context()
+	job, err := h.loadJob(c)
+	if err != nil {
+		return err
+	}
+
+	var req SetTriageResolutionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxTriageRowsPerRequest {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Provide between 1 and %d ids", maxTriageRowsPerRequest))
+	}
+	if req.ResolutionStatus != processing.TriageDismissed && req.ResolutionStatus != processing.TriageOpen {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("resolution_status must be '%s' or '%s'", processing.TriageDismissed, processing.TriageOpen))
+	}
+
+	changed, err := h.processingService.SetTriageResolution(ctx, job, req.IDs, req.ResolutionStatus, requestUserID(c))
+	if err != nil {
+		return h.triageError(c, err, "Failed to update triage rows")
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"updated": changed})
+}
+
+// triageError maps the errors of triage changes to HTTP errors.
+func (h *JobHandler) triageError(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, processing.ErrTriageRowNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, processing.ErrTriageRowClosed), errors.Is(err, processing.ErrJobNotFinished):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	h.logger.ErrorContext(c.Request().Context(), message, "error", err, "job_id", c.Param("id"))
+	return echo.NewHTTPError(http.StatusInternalServerError, message)
+}
+
+// triageColumns orders the original columns found in the triage rows the way the report type's
+// config lists them, so the CSV reads like the source file. Unknown columns follow alphabetically.
+func (h *JobHandler) triageColumns(reportType string, found []string) []string {
+	position := make(map[string]int)
+	if config, found := h.configLoader.GetConfig(reportType); found {
+		for i, mapping := range config.ColumnMappings {
+			position[normalizeHeader(mapping.CSVHeader)] = i
+		}
+	}
+
+	columns := append([]string(nil), found...)
+	sort.SliceStable(columns, func(i, j int) bool {
+		pi, iKnown := position[normalizeHeader(columns[i])]
+		pj, jKnown := position[normalizeHeader(columns[j])]
+		switch {
+		case iKnown && jKnown:
+			return pi < pj
+		case iKnown != jKnown:
+			return iKnown
+		default:
+			return columns[i] < columns[j]
+		}
+	})
+	return columns
+}
+
+// loadJob fetches the job named by the :id path parameter, mapping failures to HTTP errors.
+func (h *JobHandler) loadJob(c echo.Context) (repository.IngestionJob, error) {
+	ctx := c.Request().Context()
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return repository.IngestionJob{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid job ID format")
+	}
+
+	job, err := h.queries.GetIngestionJob(ctx, pgtype.UUID{Bytes: jobID, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repository.IngestionJob{}, echo.NewHTTPError(http.StatusNotFound, "Job not found")
+		}
+		h.logger.ErrorContext(ctx, "Failed to retrieve ingestion job", "error", err, "job_id", jobID)
+		return repository.IngestionJob{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve job")
+	}
+	return job, nil
+}
+
+// requestUserID returns the authenticated user set on the request context, if any.
+func requestUserID(c echo.Context) pgtype.Int8 {
+	userID, ok := c.Request().Context().Value("userID").(int64)
+	return pgtype.Int8{Int64: userID, Valid: ok}
+}
+
+// pageParams reads the page and limit query parameters, defaulting to the first 50 rows.
+func pageParams(c echo.Context) (limit, offset int32) {
+	l, _ := strconv.Atoi(c.QueryParam("limit"))
+	if l <= 0 || l > 1000 {
+		l = 50
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page <= 0 {
+		page = 1
+	}
+	return int32(l), int32((page - 1) * l)
+}
+
+// textParam reads an optional query parameter; an empty value means no filter.
+func textParam(c echo.Context, name string) pgtype.Text {
+	value := c.QueryParam(name)
+	return pgtype.Text{String: value, Valid: value != ""}
+}
+
+// timeParam reads an optional RFC 3339 timestamp or YYYY-MM-DD date query parameter.
+func timeParam(c echo.Context, name string) (pgtype.Timestamptz, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return pgtype.Timestamptz{Time: t, Valid: true}, nil
+		}
+	}
+	return pgtype.Timestamptz{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid %s: use RFC 3339 or YYYY-MM-DD", name))
+}
+
+// normalizeHeader makes header names comparable the way the processor matches them to csv_header.
+func normalizeHeader(header string) string {
+	return strings.TrimSpace(header)
+}
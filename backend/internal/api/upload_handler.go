@@ -1,13 +1,12 @@
 package api
 
 import (
-	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 
-	"github.com/google/uuid"
 	"github.com/jjckrbbt/catalyst/backend/internal/ingestion"
-	"github.com/jjckrbbt/catalyst/backend/internal/interfaces"
 	"github.com/jjckrbbt/catalyst/backend/internal/processing"
 	"github.com/labstack/echo/v4"
 )
@@ -16,23 +15,25 @@ import (
 type UploadHandler struct {
 	ingestionService  *ingestion.Service
 	processingService *processing.Service
-	demoHandler       *DemoHandler // The handler that knows how to make embeddings
+	jobQueue          *ingestion.Queue
 	configLoader      *processing.ConfigLoader
 	logger            *slog.Logger
 }
 
 // NewUploadHandler creates a new instance of the UploadHandler.
-func NewUploadHandler(is *ingestion.Service, ps *processing.Service, dh *DemoHandler, cl *processing.ConfigLoader, logger *slog.Logger) *UploadHandler {
+func NewUploadHandler(is *ingestion.Service, ps *processing.Service, jq *ingestion.Queue, cl *processing.ConfigLoader, logger *slog.Logger) *UploadHandler {
 	return &UploadHandler{
 		ingestionService:  is,
 		processingService: ps,
-		demoHandler:       dh,
+		jobQueue:          jq,
 		configLoader:      cl,
 		logger:            logger,
 	}
 }
 
-// HandleUpload receives a file, starts an ingestion job, and triggers async processing.
+// HandleUpload receives a file, starts an ingestion job, and triggers async processing. A file
+// whose content was recently loaded for the report type is answered with the existing job and
+// 200 OK instead; force=true starts a new job anyway.
 func (h *UploadHandler) HandleUpload(c echo.Context) error {
 	ctx := c.Request().Context()
 	// NOTE: In a real app, you would get the user ID from the JWT in the context.
@@ -40,6 +41,14 @@ func (h *UploadHandler) HandleUpload(c echo.Context) error {
 	var userID int64 = 1 
 	reportType := c.Param("reportType")
 
+	force := false
+	if raw := c.QueryParam("force"); raw != "" {
+		var err error
+		if force, err = strconv.ParseBool(raw); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid force")
+		}
+	}
+
 	file, err := c.FormFile("report_file")
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "report_file is required")
@@ -52,33 +61,70 @@ func (h *UploadHandler) HandleUpload(c echo.Context) error {
 	defer src.Close()
 
 	// 1. Start the ingestion job (uploads to GCS, creates DB record)
-	job, err := h.ingestionService.StartJob(ctx, src, file.Filename, reportType, userID)
+	job, err := h.ingestionService.StartJob(ctx, src, file.Filename, reportType, userID, force)
+	var duplicate *ingestion.DuplicateUploadError
+	if errors.As(err, &duplicate) {
+		c.Response().Header().Set("Idempotent-Replayed", "true")
+		return c.JSON(http.StatusOK, duplicate.Job)
+	}
 	if err != nil {
 		h.logger.ErrorContext(ctx, "Failed to start ingestion job", "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Could not start file processing.")
 	}
-	h.logger.InfoContext(ctx, "Successfully started ingestion job, queueing for processing", "job_id", job.ID)
-	
-	// 2. Determine which embedding function (if any) to use for this job
-	var embedder interfaces.EmbedderFunc
-	config, found := h.configLoader.GetConfig(reportType)
-	if !found {
+	h.logger.InfoContext(ctx, "Successfully started ingestion job, queued for processing", "job_id", job.ID)
+
+	if _, found := h.configLoader.GetConfig(reportType); !found {
 		h.logger.WarnContext(ctx, "No ingestion config found for reportType, processing will likely fail", "reportType", reportType)
-	} else {
-		if config.EmbedContent != nil {
-			embedder = h.demoHandler.getEmbedding
-		}
 	}
 
-	// 3. Trigger the processing service in a background goroutine
-	go h.processingService.RunJob(
-		context.Background(),
-		uuid.UUID(job.ID.Bytes),
-		reportType,
-		job.SourceUri.String,
-		embedder,
-	)
+	// 2. Wake a local worker; workers in other processes pick the job up on their next poll
+	h.jobQueue.Notify()
 
-	// 4. Return an immediate success response
+	// 3. Return an immediate success response
 	return c.JSON(http.StatusAccepted, job)
 }
+
+// maxPreviewSampleSize caps the number of transformed items a preview returns.
+const maxPreviewSampleSize = 500
+
+// HandlePreview runs an uploaded file through its ingestion config and returns what a job would
+// load, without storing the file or writing to the database. The optional "sample" query
+// parameter sets how many transformed items are returned.
+func (h *UploadHandler) HandlePreview(c echo.Context) error {
+	ctx := c.Request().Context()
+	reportType := c.Param("reportType")
+
+	sampleSize := processing.DefaultPreviewSampleSize
+	if raw := c.QueryParam("sample"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "sample must be a non-negative integer")
+		}
+		if n > maxPreviewSampleSize {
+			n = maxPreviewSampleSize
+		}
+		sampleSize = n
+	}
+
+	if _, found := h.configLoader.GetConfig(reportType); !found {
+		return echo.NewHTTPError(http.StatusNotFound, "No ingestion config found for report type")
+	}
+
+	file, err := c.FormFile("report_file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "report_file is required")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to open uploaded file")
+	}
+	defer src.Close()
+
+	preview, err := h.processingService.Preview(ctx, reportType, src, sampleSize)
+	if err != nil {
+		h.logger.WarnContext(ctx, "Preview failed", "report_type", reportType, "error", err)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+	return c.JSON(http.StatusOK, preview)
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
 	"github.com/pgvector/pgvector-go"
 )
 
@@ -24,25 +25,25 @@ WHERE c.id = $1
 `
 
 type GetClaimDetailsRow struct {
-	ID                int64              `json:"id"`
-	ItemType          ItemType           `json:"item_type"`
-	ClaimID           pgtype.Text        `json:"claim_id"`
-	PolicyNumber      pgtype.Text        `json:"policy_number"`
-	SystemStatus      ItemStatus         `json:"system_status"`
-	CreatedAt         pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
-	PolicyholderID    string             `json:"policyholder_id"`
-	ClaimType         string             `json:"claim_type"`
-	DateOfLoss        pgtype.Date        `json:"date_of_loss"`
-	DescriptionOfLoss string             `json:"description_of_loss"`
-	ClaimAmount       pgtype.Numeric     `json:"claim_amount"`
-	BusinessStatus    string             `json:"business_status"`
-	AdjusterAssigned  string             `json:"adjuster_assigned"`
-	PolicyholderName  string             `json:"policyholder_name"`
-	City              string             `json:"city"`
-	State             pgtype.Text        `json:"state"`
-	CustomerSinceDate pgtype.Date        `json:"customer_since_date"`
-	CustomerLevel     string             `json:"customer_level"`
+	ID                int64               `json:"id"`
+	ItemType          repository.ItemType `json:"item_type"`
+	ClaimID           pgtype.Text         `json:"claim_id"`
+	PolicyNumber      pgtype.Text         `json:"policy_number"`
+	SystemStatus      ItemStatus          `json:"system_status"`
+	CreatedAt         pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz  `json:"updated_at"`
+	PolicyholderID    string              `json:"policyholder_id"`
+	ClaimType         string              `json:"claim_type"`
+	DateOfLoss        pgtype.Date         `json:"date_of_loss"`
+	DescriptionOfLoss string              `json:"description_of_loss"`
+	ClaimAmount       pgtype.Numeric      `json:"claim_amount"`
+	BusinessStatus    string              `json:"business_status"`
+	AdjusterAssigned  string              `json:"adjuster_assigned"`
+	PolicyholderName  string              `json:"policyholder_name"`
+	City              string              `json:"city"`
+	State             pgtype.Text         `json:"state"`
+	CustomerSinceDate pgtype.Date         `json:"customer_since_date"`
+	CustomerLevel     string              `json:"customer_level"`
 }
 
 // Fetches a single claim joined with its correspondng policyholder data
@@ -168,21 +169,21 @@ type ListClaimsWithVectorParams struct {
 }
 
 type ListClaimsWithVectorRow struct {
-	ID                int64              `json:"id"`
-	ItemType          ItemType           `json:"item_type"`
-	ClaimID           pgtype.Text        `json:"claim_id"`
-	PolicyNumber      pgtype.Text        `json:"policy_number"`
-	SystemStatus      ItemStatus         `json:"system_status"`
-	CreatedAt         pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
-	PolicyholderID    string             `json:"policyholder_id"`
-	ClaimType         string             `json:"claim_type"`
-	DateOfLoss        pgtype.Date        `json:"date_of_loss"`
-	DescriptionOfLoss string             `json:"description_of_loss"`
-	ClaimAmount       pgtype.Numeric     `json:"claim_amount"`
-	BusinessStatus    string             `json:"business_status"`
-	AdjusterAssigned  string             `json:"adjuster_assigned"`
-	SimilarityScore   interface{}        `json:"similarity_score"`
+	ID                int64               `json:"id"`
+	ItemType          repository.ItemType `json:"item_type"`
+	ClaimID           pgtype.Text         `json:"claim_id"`
+	PolicyNumber      pgtype.Text         `json:"policy_number"`
+	SystemStatus      ItemStatus          `json:"system_status"`
+	CreatedAt         pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz  `json:"updated_at"`
+	PolicyholderID    string              `json:"policyholder_id"`
+	ClaimType         string              `json:"claim_type"`
+	DateOfLoss        pgtype.Date         `json:"date_of_loss"`
+	DescriptionOfLoss string              `json:"description_of_loss"`
+	ClaimAmount       pgtype.Numeric      `json:"claim_amount"`
+	BusinessStatus    string              `json:"business_status"`
+	AdjusterAssigned  string              `json:"adjuster_assigned"`
+	SimilarityScore   interface{}         `json:"similarity_score"`
 }
 
 // Fetches and sorts claims by semantic similarity.
@@ -267,21 +268,21 @@ type ListClaimsWithoutVectorParams struct {
 }
 
 type ListClaimsWithoutVectorRow struct {
-	ID                int64              `json:"id"`
-	ItemType          ItemType           `json:"item_type"`
-	ClaimID           pgtype.Text        `json:"claim_id"`
-	PolicyNumber      pgtype.Text        `json:"policy_number"`
-	SystemStatus      ItemStatus         `json:"system_status"`
-	CreatedAt         pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
-	PolicyholderID    string             `json:"policyholder_id"`
-	ClaimType         string             `json:"claim_type"`
-	DateOfLoss        pgtype.Date        `json:"date_of_loss"`
-	DescriptionOfLoss string             `json:"description_of_loss"`
-	ClaimAmount       pgtype.Numeric     `json:"claim_amount"`
-	BusinessStatus    string             `json:"business_status"`
-	AdjusterAssigned  string             `json:"adjuster_assigned"`
-	SimilarityScore   pgtype.Float8      `json:"similarity_score"`
+	ID                int64               `json:"id"`
+	ItemType          repository.ItemType `json:"item_type"`
+	ClaimID           pgtype.Text         `json:"claim_id"`
+	PolicyNumber      pgtype.Text         `json:"policy_number"`
+	SystemStatus      ItemStatus          `json:"system_status"`
+	CreatedAt         pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz  `json:"updated_at"`
+	PolicyholderID    string              `json:"policyholder_id"`
+	ClaimType         string              `json:"claim_type"`
+	DateOfLoss        pgtype.Date         `json:"date_of_loss"`
+	DescriptionOfLoss string              `json:"description_of_loss"`
+	ClaimAmount       pgtype.Numeric      `json:"claim_amount"`
+	BusinessStatus    string              `json:"business_status"`
+	AdjusterAssigned  string              `json:"adjuster_assigned"`
+	SimilarityScore   pgtype.Float8       `json:"similarity_score"`
 }
 
 // Fetches a paginated and filtered list of insurance claims without vector search.
@@ -445,13 +446,13 @@ func (q *Queries) SearchComments(ctx context.Context, arg SearchCommentsParams)
 const searchKnowledgeChunks = `-- name: SearchKnowledgeChunks :many
 SELECT
     (
-    COALESCE(custom_properties->>'metadata.section', 'General Information') ||
+    COALESCE(custom_properties->'metadata'->>'section', 'General Information') ||
     ' from ' ||
-    COALESCE(custom_properties->>'metadata.document_name', 'Unknown Document')
+    COALESCE(custom_properties->'metadata'->>'document_name', 'Unknown Document')
     ) AS source,
     COALESCE((custom_properties->>'chunk_text')::TEXT, '') AS text,
     embedding <=> $1::vector AS similarity_score,
-    custom_properties->>'metadata.source_custom_properties' AS structured_metadata
+    custom_properties->'metadata'->>'source_custom_properties' AS structured_metadata
 FROM items
 WHERE
     item_type = 'KNOWLEDGE_CHUNK' AND embedding IS NOT NULL
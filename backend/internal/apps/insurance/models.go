@@ -9,6 +9,7 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
 	"github.com/pgvector/pgvector-go"
 )
 
@@ -55,59 +56,15 @@ func (ns NullItemStatus) Value() (driver.Value, error) {
 	return string(ns.ItemStatus), nil
 }
 
-type ItemType string
-
-const (
-	ItemTypeKNOWLEDGECHUNK ItemType = "KNOWLEDGE_CHUNK"
-	ItemTypePARKVISITATION ItemType = "PARK_VISITATION"
-	ItemTypeMISSIONFACTS   ItemType = "MISSION_FACTS"
-	ItemTypePOLICYHOLDER   ItemType = "POLICYHOLDER"
-	ItemTypeINSURANCECLAIM ItemType = "INSURANCE_CLAIM"
-)
-
-func (e *ItemType) Scan(src interface{}) error {
-	switch s := src.(type) {
-	case []byte:
-		*e = ItemType(s)
-	case string:
-		*e = ItemType(s)
-	default:
-		return fmt.Errorf("unsupported scan type for ItemType: %T", src)
-	}
-	return nil
-}
-
-type NullItemType struct {
-	ItemType ItemType `json:"item_type"`
-	Valid    bool     `json:"valid"` // Valid is true if ItemType is not NULL
-}
-
-// Scan implements the Scanner interface.
-func (ns *NullItemType) Scan(value interface{}) error {
-	if value == nil {
-		ns.ItemType, ns.Valid = "", false
-		return nil
-	}
-	ns.Valid = true
-	return ns.ItemType.Scan(value)
-}
-
-// Value implements the driver Valuer interface.
-func (ns NullItemType) Value() (driver.Value, error) {
-	if !ns.Valid {
-		return nil, nil
-	}
-	return string(ns.ItemType), nil
-}
-
 type AuditItemsChange struct {
-	AuditID   int64              `json:"audit_id"`
-	TargetID  int64              `json:"target_id"`
-	Operation string             `json:"operation"`
-	ChangedBy pgtype.Int8        `json:"changed_by"`
-	ChangedAt pgtype.Timestamptz `json:"changed_at"`
-	OldData   []byte             `json:"old_data"`
-	NewData   []byte             `json:"new_data"`
+	AuditID        int64              `json:"audit_id"`
+	TargetID       int64              `json:"target_id"`
+	Operation      string             `json:"operation"`
+	ChangedBy      pgtype.Int8        `json:"changed_by"`
+	ChangedAt      pgtype.Timestamptz `json:"changed_at"`
+	OldData        []byte             `json:"old_data"`
+	NewData        []byte             `json:"new_data"`
+	IngestionJobID pgtype.UUID        `json:"ingestion_job_id"`
 }
 
 type AuditUsersChange struct {
@@ -146,39 +103,82 @@ type Contact struct {
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 }
 
+type IngestionConfigRevision struct {
+	ID          int64              `json:"id"`
+	ReportType  string             `json:"report_type"`
+	Revision    int32              `json:"revision"`
+	Version     pgtype.Text        `json:"version"`
+	ContentHash string             `json:"content_hash"`
+	Content     []byte             `json:"content"`
+	SourceFile  pgtype.Text        `json:"source_file"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
 type IngestionError struct {
 	ID               pgtype.UUID        `json:"id"`
 	JobID            pgtype.UUID        `json:"job_id"`
 	Timestamp        pgtype.Timestamptz `json:"timestamp"`
 	OriginalRowData  []byte             `json:"original_row_data"`
 	ReasonForFailure string             `json:"reason_for_failure"`
+	RowNumber        pgtype.Int4        `json:"row_number"`
+	SourceLocation   pgtype.Text        `json:"source_location"`
+	ResolutionStatus string             `json:"resolution_status"`
+	ResolvedBy       pgtype.Int8        `json:"resolved_by"`
+	ResolvedAt       pgtype.Timestamptz `json:"resolved_at"`
 }
 
 type IngestionJob struct {
-	ID            pgtype.UUID        `json:"id"`
-	SourceType    string             `json:"source_type"`
-	SourceDetails []byte             `json:"source_details"`
-	ReportType    string             `json:"report_type"`
-	Status        string             `json:"status"`
-	StartedAt     pgtype.Timestamptz `json:"started_at"`
-	CompletedAt   pgtype.Timestamptz `json:"completed_at"`
-	ErrorDetails  pgtype.Text        `json:"error_details"`
-	UserID        pgtype.Int8        `json:"user_id"`
-	SourceUri     pgtype.Text        `json:"source_uri"`
-	RowsUpserted  pgtype.Int4        `json:"rows_upserted"`
-	RowsTriaged   pgtype.Int4        `json:"rows_triaged"`
+	ID                pgtype.UUID        `json:"id"`
+	SourceType        string             `json:"source_type"`
+	SourceDetails     []byte             `json:"source_details"`
+	ReportType        string             `json:"report_type"`
+	Status            string             `json:"status"`
+	StartedAt         pgtype.Timestamptz `json:"started_at"`
+	CompletedAt       pgtype.Timestamptz `json:"completed_at"`
+	ErrorDetails      pgtype.Text        `json:"error_details"`
+	UserID            pgtype.Int8        `json:"user_id"`
+	SourceUri         pgtype.Text        `json:"source_uri"`
+	RowsUpserted      pgtype.Int4        `json:"rows_upserted"`
+	RowsTriaged       pgtype.Int4        `json:"rows_triaged"`
+	Attempts          int32              `json:"attempts"`
+	MaxAttempts       int32              `json:"max_attempts"`
+	RunAfter          pgtype.Timestamptz `json:"run_after"`
+	LockedBy          pgtype.Text        `json:"locked_by"`
+	LockedAt          pgtype.Timestamptz `json:"locked_at"`
+	HeartbeatAt       pgtype.Timestamptz `json:"heartbeat_at"`
+	CancelRequestedAt pgtype.Timestamptz `json:"cancel_requested_at"`
+	ConfigSnapshot    []byte             `json:"config_snapshot"`
+	ItemsInserted     pgtype.Int4        `json:"items_inserted"`
+	ItemsUpdated      pgtype.Int4        `json:"items_updated"`
+	ItemsUnchanged    pgtype.Int4        `json:"items_unchanged"`
+	ItemsDeactivated  pgtype.Int4        `json:"items_deactivated"`
+	ContentHash       pgtype.Text        `json:"content_hash"`
+	ConfigRevisionID  pgtype.Int8        `json:"config_revision_id"`
+}
+
+type IngestionJobAttempt struct {
+	ID           int64              `json:"id"`
+	JobID        pgtype.UUID        `json:"job_id"`
+	Attempt      int32              `json:"attempt"`
+	WorkerID     pgtype.Text        `json:"worker_id"`
+	StartedAt    pgtype.Timestamptz `json:"started_at"`
+	FinishedAt   pgtype.Timestamptz `json:"finished_at"`
+	Status       string             `json:"status"`
+	ErrorDetails pgtype.Text        `json:"error_details"`
+	RowsUpserted pgtype.Int4        `json:"rows_upserted"`
+	RowsTriaged  pgtype.Int4        `json:"rows_triaged"`
 }
 
 type Item struct {
-	ID               int64              `json:"id"`
-	ItemType         ItemType           `json:"item_type"`
-	Scope            pgtype.Text        `json:"scope"`
-	BusinessKey      pgtype.Text        `json:"business_key"`
-	Status           ItemStatus         `json:"status"`
-	CustomProperties []byte             `json:"custom_properties"`
-	Embedding        pgvector.Vector    `json:"embedding"`
-	CreatedAt        pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt        pgtype.Timestamptz `json:"updated_at"`
+	ID               int64               `json:"id"`
+	ItemType         repository.ItemType `json:"item_type"`
+	Scope            pgtype.Text         `json:"scope"`
+	BusinessKey      pgtype.Text         `json:"business_key"`
+	Status           ItemStatus          `json:"status"`
+	CustomProperties []byte              `json:"custom_properties"`
+	Embedding        pgvector.Vector     `json:"embedding"`
+	CreatedAt        pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz  `json:"updated_at"`
 }
 
 type ItemAssignment struct {
@@ -197,13 +197,35 @@ type ItemContact struct {
 	AssociationType pgtype.Text `json:"association_type"`
 }
 
+type ItemLineage struct {
+	ID             int64              `json:"id"`
+	ItemID         int64              `json:"item_id"`
+	JobID          pgtype.UUID        `json:"job_id"`
+	SourceUri      pgtype.Text        `json:"source_uri"`
+	RowNumber      pgtype.Int4        `json:"row_number"`
+	SourceLocation pgtype.Text        `json:"source_location"`
+	ConfigVersion  pgtype.Text        `json:"config_version"`
+	RecordedAt     pgtype.Timestamptz `json:"recorded_at"`
+}
+
+type ItemTypeRegistry struct {
+	Name                repository.ItemType `json:"name"`
+	DisplayName         string              `json:"display_name"`
+	App                 pgtype.Text         `json:"app"`
+	EmbeddingDimensions pgtype.Int4         `json:"embedding_dimensions"`
+	RetentionDays       pgtype.Int4         `json:"retention_days"`
+	CreatedAt           pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz  `json:"updated_at"`
+}
+
 type ItemsEvent struct {
-	ID        int64              `json:"id"`
-	ItemID    int64              `json:"item_id"`
-	EventType string             `json:"event_type"`
-	EventData []byte             `json:"event_data"`
-	CreatedBy int64              `json:"created_by"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ID             int64              `json:"id"`
+	ItemID         int64              `json:"item_id"`
+	EventType      string             `json:"event_type"`
+	EventData      []byte             `json:"event_data"`
+	CreatedBy      pgtype.Int8        `json:"created_by"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	IngestionJobID pgtype.UUID        `json:"ingestion_job_id"`
 }
 
 type Notification struct {
@@ -216,6 +238,16 @@ type Notification struct {
 	CreatedAt        pgtype.Timestamptz `json:"created_at"`
 }
 
+type PendingItemEmbedding struct {
+	ItemID     int64              `json:"item_id"`
+	JobID      pgtype.UUID        `json:"job_id"`
+	SourceText string             `json:"source_text"`
+	LastError  pgtype.Text        `json:"last_error"`
+	Attempts   int32              `json:"attempts"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
 type Permission struct {
 	ID          int32       `json:"id"`
 	Action      string      `json:"action"`
@@ -264,34 +296,34 @@ type UserScopeAccess struct {
 }
 
 type VwInsuranceClaim struct {
-	ID                int64              `json:"id"`
-	ItemType          ItemType           `json:"item_type"`
-	ClaimID           pgtype.Text        `json:"claim_id"`
-	PolicyNumber      pgtype.Text        `json:"policy_number"`
-	SystemStatus      ItemStatus         `json:"system_status"`
-	Embedding         pgvector.Vector    `json:"embedding"`
-	CreatedAt         pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
-	PolicyholderID    string             `json:"policyholder_id"`
-	ClaimType         string             `json:"claim_type"`
-	DateOfLoss        pgtype.Date        `json:"date_of_loss"`
-	DescriptionOfLoss string             `json:"description_of_loss"`
-	ClaimAmount       pgtype.Numeric     `json:"claim_amount"`
-	BusinessStatus    string             `json:"business_status"`
-	AdjusterAssigned  string             `json:"adjuster_assigned"`
+	ID                int64               `json:"id"`
+	ItemType          repository.ItemType `json:"item_type"`
+	ClaimID           pgtype.Text         `json:"claim_id"`
+	PolicyNumber      pgtype.Text         `json:"policy_number"`
+	SystemStatus      ItemStatus          `json:"system_status"`
+	Embedding         pgvector.Vector     `json:"embedding"`
+	CreatedAt         pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz  `json:"updated_at"`
+	PolicyholderID    string              `json:"policyholder_id"`
+	ClaimType         string              `json:"claim_type"`
+	DateOfLoss        pgtype.Date         `json:"date_of_loss"`
+	DescriptionOfLoss string              `json:"description_of_loss"`
+	ClaimAmount       pgtype.Numeric      `json:"claim_amount"`
+	BusinessStatus    string              `json:"business_status"`
+	AdjusterAssigned  string              `json:"adjuster_assigned"`
 }
 
 type VwPolicyholder struct {
-	ID                int64              `json:"id"`
-	ItemType          ItemType           `json:"item_type"`
-	PolicyholderID    pgtype.Text        `json:"policyholder_id"`
-	State             pgtype.Text        `json:"state"`
-	Status            ItemStatus         `json:"status"`
-	CreatedAt         pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
-	PolicyholderName  string             `json:"policyholder_name"`
-	City              string             `json:"city"`
-	CustomerSinceDate pgtype.Date        `json:"customer_since_date"`
-	CustomerLevel     string             `json:"customer_level"`
-	ActivePolicies    []byte             `json:"active_policies"`
+	ID                int64               `json:"id"`
+	ItemType          repository.ItemType `json:"item_type"`
+	PolicyholderID    pgtype.Text         `json:"policyholder_id"`
+	State             pgtype.Text         `json:"state"`
+	Status            ItemStatus          `json:"status"`
+	CreatedAt         pgtype.Timestamptz  `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz  `json:"updated_at"`
+	PolicyholderName  string              `json:"policyholder_name"`
+	City              string              `json:"city"`
+	CustomerSinceDate pgtype.Date         `json:"customer_since_date"`
+	CustomerLevel     string              `json:"customer_level"`
+	ActivePolicies    []byte              `json:"active_policies"`
 }
@@ -0,0 +1,90 @@
+// Package blobstore stores the raw files ingestion jobs load. Files are addressed by key, e.g.
+// "raw-reports/CLAIMS/<job id>-/claims.csv", and jobs record them as backend-neutral URIs such as
+// "blob://raw-reports/CLAIMS/...", so the backend can change without rewriting ingestion_jobs.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/config"
+)
+
+// Supported values for config.Config.BlobStore
+const (
+	BackendGCS   = "gcs"
+	BackendLocal = "local"
+	BackendS3    = "s3" // AWS S3 or a compatible service such as MinIO
+)
+
+// Scheme prefixes the URIs of stored files.
+const Scheme = "blob://"
+
+// ErrNotFound is returned when no file is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores files by key. Implementations are safe for concurrent use.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any file already there.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the file stored under key. It returns ErrNotFound if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the blob store cfg selects.
+func New(ctx context.Context, cfg *config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case BackendGCS:
+		return NewGCSStore(ctx, cfg.GCSBucketName)
+	case BackendLocal:
+		return NewLocalStore(cfg.BlobLocalDir)
+	case BackendS3:
+		return NewS3Store(S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UsePathStyle:    cfg.S3UsePathStyle,
+		})
+	}
+	return nil, fmt.Errorf("unsupported blob store '%s'", cfg.BlobStore)
+}
+
+// URI returns the URI a file stored under key is recorded as.
+func URI(key string) string {
+	return Scheme + key
+}
+
+// KeyFromURI returns the key of a stored file's URI. Jobs created before URIs were backend-neutral
+// recorded a bare key or a gs://<bucket>/<key> URI; both are accepted.
+func KeyFromURI(uri string) (string, error) {
+	key := uri
+	switch {
+	case strings.HasPrefix(uri, Scheme):
+		key = strings.TrimPrefix(uri, Scheme)
+	case strings.HasPrefix(uri, "gs://"):
+		_, key, _ = strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	case strings.Contains(uri, "://"):
+		return "", fmt.Errorf("unsupported blob URI '%s'", uri)
+	}
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// validateKey rejects keys that are empty or could step outside the store, such as "../x".
+func validateKey(key string) error {
+	clean := path.Clean(key)
+	if key == "" || clean != key || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid blob key '%s'", key)
+	}
+	return nil
+}
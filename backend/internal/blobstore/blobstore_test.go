@@ -0,0 +1,50 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFromURI(t *testing.T) {
+	key := "raw-reports/CLAIMS/0b7c-/claims.csv"
+	for _, uri := range []string{URI(key), "gs://catalyst-uploads/" + key, key} {
+		got, err := KeyFromURI(uri)
+		assert.NoError(t, err, uri)
+		assert.Equal(t, key, got, uri)
+	}
+
+	for _, uri := range []string{"", "blob://", "s3://bucket/" + key, "blob://../etc/passwd", "/abs/path", "blob://a//b"} {
+		_, err := KeyFromURI(uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	key := "raw-reports/CLAIMS/job-/claims.csv"
+	require.NoError(t, store.Put(ctx, key, strings.NewReader("claim_id\n1\n")))
+	require.NoError(t, store.Put(ctx, key, strings.NewReader("claim_id\n2\n")))
+
+	reader, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "claim_id\n2\n", string(data))
+
+	require.NoError(t, store.Delete(ctx, key))
+	require.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.Error(t, store.Put(ctx, "../outside.csv", strings.NewReader("x")))
+}
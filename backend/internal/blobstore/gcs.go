@@ -0,0 +1,69 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSStore keeps files in a Google Cloud Storage bucket.
+type GCSStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSStore creates a store for bucket using the application default credentials.
+func NewGCSStore(ctx context.Context, bucket string) (*GCSStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("GCS blob store requires a bucket name")
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &GCSStore{client: client, bucket: bucket}, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	wc := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return fmt.Errorf("failed to upload file to GCS: %w", err)
+	}
+	// Close finalizes the upload
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close GCS writer: %w", err)
+	}
+	return nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	reader, err := s.client.Bucket(s.bucket).Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: gs://%s/%s", ErrNotFound, s.bucket, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from GCS: %w", err)
+	}
+	return reader, nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete file from GCS: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultS3Region is used when S3Options.Region is empty. MinIO accepts any region.
+const DefaultS3Region = "us-east-1"
+
+// S3Options configures an S3Store.
+type S3Options struct {
+	Endpoint        string // e.g. "http://minio:9000"; defaults to AWS S3 in Region
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool // address the bucket as <endpoint>/<bucket>, as MinIO expects, instead of <bucket>.<host>
+}
+
+// S3Store keeps files in an S3 bucket, or a bucket of an S3-compatible service such as MinIO. It
+// signs requests with AWS Signature Version 4.
+type S3Store struct {
+	opts       S3Options
+	base       *url.URL // the bucket's URL
+	httpClient *http.Client
+}
+
+// NewS3Store creates a store for the bucket opts names.
+func NewS3Store(opts S3Options) (*S3Store, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("S3 blob store requires a bucket name")
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 blob store requires an access key ID and secret access key")
+	}
+	if opts.Region == "" {
+		opts.Region = DefaultS3Region
+	}
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint '%s'", endpoint)
+	}
+	if opts.UsePathStyle {
+		base.Path += "/" + opts.Bucket
+	} else {
+		base.Host = opts.Bucket + "." + base.Host
+	}
+	return &S3Store{opts: opts, base: base, httpClient: newS3HTTPClient()}, nil
+}
+
+// newS3HTTPClient bounds connecting and waiting for response headers only. Bodies are streamed for
+// as long as the caller's context allows, so a whole-request timeout would cut off large downloads
+// mid-read.
+func newS3HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = time.Minute
+	return &http.Client{Transport: transport}
+}
+
+// Put needs the length and hash of the body up front, so a body that can't be rewound is first
+// copied to a temporary file.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		tmp, err := os.CreateTemp("", "blob-upload-*")
+		if err != nil {
+			return fmt.Errorf("failed to buffer upload: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, r); err != nil {
+			return fmt.Errorf("failed to buffer upload: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to buffer upload: %w", err)
+		}
+		body = tmp
+	}
+
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	if _, err := body.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, io.NopCloser(body), size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError("upload", key, resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: s3://%s/%s", ErrNotFound, s.opts.Bucket, key)
+	}
+	defer resp.Body.Close()
+	return nil, s.responseError("read", key, resp)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.responseError("delete", key, resp)
+	}
+	return nil
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3Store) do(ctx context.Context, method, key string, body io.ReadCloser, size int64, payloadHash string) (*http.Response, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	target := *s.base
+	target.Path = s.base.Path + "/" + key
+	target.RawPath = s3EscapePath(target.Path)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build S3 request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	signV4(req, payloadHash, s.opts.AccessKeyID, s.opts.SecretAccessKey, s.opts.Region, time.Now())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (s *S3Store) responseError(action, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("failed to %s s3://%s/%s: %s: %s", action, s.opts.Bucket, key, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req. It signs the host, the x-amz-* headers
+// and any Content-Type, Content-MD5 or Range header.
+func signV4(req *http.Request, payloadHash, accessKeyID, secretAccessKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for name, vals := range values {
+		for _, v := range vals {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3EscapePath escapes a path the way SigV4 expects: everything but unreserved characters and
+// the slashes between segments.
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv" // You'll need to run: go get github.com/joho/godotenv
 )
@@ -16,6 +17,42 @@ type Config struct {
 	GCSBucketName string
 	SentryDSN     string
 	OpenAIAPIKey  string
+
+	// EmbeddingServiceURL is the embedding service's single-text endpoint; the batch endpoint sits beside it.
+	EmbeddingServiceURL string
+
+	// BlobStore selects where uploaded files are kept: gcs (the default), local or s3. Only the
+	// settings of the selected backend are required.
+	BlobStore         string
+	BlobLocalDir      string // local: directory files are kept under
+	S3Endpoint        string // s3: e.g. http://minio:9000; empty means AWS S3
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3UsePathStyle    bool // s3: address the bucket in the path, as MinIO expects
+
+	// Ingestion tuning. Zero values fall back to the processing package defaults.
+	IngestionBatchSize       int
+	IngestionWorkers         int
+	IngestionEmbedBatchSize  int
+	IngestionEmbedWorkers    int
+	IngestionEmbedMaxRetries int
+	IngestionEmbedRateLimit  float64 // embedding requests per second; 0 means unlimited
+
+	// Ingestion job queue. Zero values fall back to the ingestion package defaults.
+	IngestionQueueConcurrency  int
+	IngestionJobMaxAttempts    int
+	IngestionJobStaleSeconds   int
+	IngestionJobTimeoutSeconds int // how long one attempt of a job may run
+
+	// IngestionDuplicateWindowMinutes is how long an upload's content blocks identical uploads for
+	// the same report type. Zero falls back to the ingestion package default.
+	IngestionDuplicateWindowMinutes int
+
+	// IngestionConfigReloadSeconds is how often the config directory is checked for changed files.
+	// Zero falls back to the processing package default.
+	IngestionConfigReloadSeconds int
 }
 
 // LoadConfig reads configuration from environment variables or a .env file.
@@ -40,9 +77,42 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("FATAL: AUTH0_AUDIENCE environment variable not set")
 	}
 
+	// BlobStore defaults to GCS, which was the only backend before it was configurable
+	blobStore := os.Getenv("BLOB_STORE")
+	if blobStore == "" {
+		blobStore = "gcs"
+	}
 	gcsBucketName := os.Getenv("GCS_BUCKET_NAME")
-	if gcsBucketName == "" {
-		return nil, fmt.Errorf("FATAL: GCS_BUCKET_NAME environment variable not set")
+	blobLocalDir := os.Getenv("BLOB_LOCAL_DIR")
+	s3Bucket := os.Getenv("S3_BUCKET")
+	s3UsePathStyle := false
+	switch blobStore {
+	case "gcs":
+		if gcsBucketName == "" {
+			return nil, fmt.Errorf("FATAL: GCS_BUCKET_NAME environment variable not set")
+		}
+	case "local":
+		if blobLocalDir == "" {
+			blobLocalDir = "./data/blobs"
+		}
+	case "s3":
+		if s3Bucket == "" {
+			return nil, fmt.Errorf("FATAL: S3_BUCKET environment variable not set")
+		}
+		if os.Getenv("S3_ACCESS_KEY_ID") == "" || os.Getenv("S3_SECRET_ACCESS_KEY") == "" {
+			return nil, fmt.Errorf("FATAL: S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY environment variables must be set")
+		}
+		// MinIO and most other self-hosted services need path-style addressing
+		s3UsePathStyle = os.Getenv("S3_ENDPOINT") != ""
+		if raw := os.Getenv("S3_USE_PATH_STYLE"); raw != "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("FATAL: S3_USE_PATH_STYLE must be true or false, got '%s'", raw)
+			}
+			s3UsePathStyle = v
+		}
+	default:
+		return nil, fmt.Errorf("FATAL: BLOB_STORE must be gcs, local or s3, got '%s'", blobStore)
 	}
 
 	sentryDSN := os.Getenv("SENTRY_DSN")
@@ -60,6 +130,72 @@ func LoadConfig() (*Config, error) {
 		appEnv = "development"
 	}
 
+	// EmbeddingServiceURL defaults to the docker-compose service
+	embeddingServiceURL := os.Getenv("EMBEDDING_SERVICE_URL")
+	if embeddingServiceURL == "" {
+		embeddingServiceURL = "http://embedding-service:5001/embed"
+	}
+
+	ingestionBatchSize, err := intFromEnv("INGESTION_BATCH_SIZE")
+	if err != nil {
+		return nil, err
+	}
+
+	ingestionWorkers, err := intFromEnv("INGESTION_WORKERS")
+	if err != nil {
+		return nil, err
+	}
+
+	embedBatchSize, err := intFromEnv("INGESTION_EMBED_BATCH_SIZE")
+	if err != nil {
+		return nil, err
+	}
+
+	embedWorkers, err := intFromEnv("INGESTION_EMBED_WORKERS")
+	if err != nil {
+		return nil, err
+	}
+
+	embedMaxRetries, err := intFromEnv("INGESTION_EMBED_MAX_RETRIES")
+	if err != nil {
+		return nil, err
+	}
+
+	embedRateLimit, err := floatFromEnv("INGESTION_EMBED_RATE_LIMIT")
+	if err != nil {
+		return nil, err
+	}
+
+	queueConcurrency, err := intFromEnv("INGESTION_QUEUE_CONCURRENCY")
+	if err != nil {
+		return nil, err
+	}
+
+	jobMaxAttempts, err := intFromEnv("INGESTION_JOB_MAX_ATTEMPTS")
+	if err != nil {
+		return nil, err
+	}
+
+	jobStaleSeconds, err := intFromEnv("INGESTION_JOB_STALE_SECONDS")
+	if err != nil {
+		return nil, err
+	}
+
+	jobTimeoutSeconds, err := intFromEnv("INGESTION_JOB_TIMEOUT_SECONDS")
+	if err != nil {
+		return nil, err
+	}
+
+	duplicateWindowMinutes, err := intFromEnv("INGESTION_DUPLICATE_WINDOW_MINUTES")
+	if err != nil {
+		return nil, err
+	}
+
+	configReloadSeconds, err := intFromEnv("INGESTION_CONFIG_RELOAD_SECONDS")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		DatabaseURL:   dbURL,
 		Auth0Domain:   auth0Domain,
@@ -68,5 +204,57 @@ func LoadConfig() (*Config, error) {
 		GCSBucketName: gcsBucketName,
 		SentryDSN:     sentryDSN,
 		OpenAIAPIKey:  openAIKey,
+
+		EmbeddingServiceURL: embeddingServiceURL,
+
+		BlobStore:         blobStore,
+		BlobLocalDir:      blobLocalDir,
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          os.Getenv("S3_REGION"),
+		S3Bucket:          s3Bucket,
+		S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3UsePathStyle:    s3UsePathStyle,
+
+		IngestionBatchSize:       ingestionBatchSize,
+		IngestionWorkers:         ingestionWorkers,
+		IngestionEmbedBatchSize:  embedBatchSize,
+		IngestionEmbedWorkers:    embedWorkers,
+		IngestionEmbedMaxRetries: embedMaxRetries,
+		IngestionEmbedRateLimit:  embedRateLimit,
+
+		IngestionQueueConcurrency:  queueConcurrency,
+		IngestionJobMaxAttempts:    jobMaxAttempts,
+		IngestionJobStaleSeconds:   jobStaleSeconds,
+		IngestionJobTimeoutSeconds: jobTimeoutSeconds,
+
+		IngestionDuplicateWindowMinutes: duplicateWindowMinutes,
+		IngestionConfigReloadSeconds:    configReloadSeconds,
 	}, nil
 }
+
+// intFromEnv reads an optional, non-negative integer environment variable. Unset means 0.
+func intFromEnv(key string) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("FATAL: %s must be a non-negative integer, got '%s'", key, raw)
+	}
+	return v, nil
+}
+
+// floatFromEnv reads an optional, non-negative number environment variable. Unset means 0.
+func floatFromEnv(key string) (float64, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("FATAL: %s must be a non-negative number, got '%s'", key, raw)
+	}
+	return v, nil
+}
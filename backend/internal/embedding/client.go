@@ -0,0 +1,115 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultServiceURL is the embedding service's single-text endpoint inside docker-compose.
+const DefaultServiceURL = "http://embedding-service:5001/embed"
+
+// Client talks to the embedding service. It is safe for concurrent use.
+type Client struct {
+	embedURL      string
+	embedBatchURL string
+	httpClient    *http.Client
+}
+
+// NewClient creates a client for the service whose single-text endpoint is embedURL,
+// e.g. "http://embedding-service:5001/embed". The batch endpoint lives beside it at /embed_batch.
+func NewClient(embedURL string) *Client {
+	if embedURL == "" {
+		embedURL = DefaultServiceURL
+	}
+	return &Client{
+		embedURL:      embedURL,
+		embedBatchURL: strings.TrimSuffix(embedURL, "/embed") + "/embed_batch",
+		httpClient:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// StatusError is returned when the embedding service answers with a status other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embedding service returned non-OK status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the same request could succeed later. The service rejects a request it
+// can't handle with a 4xx status, which sending it again won't change, except when it is rate limited.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode < 400 || e.StatusCode >= 500
+}
+
+type embedRequest struct {
+	Text string `json:"text"`
+}
+
+type embedResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+type embedBatchRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type embedBatchResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed generates the embedding for a single text. It satisfies interfaces.EmbedderFunc.
+func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
+	var resp embedResponse
+	if err := c.post(ctx, c.embedURL, embedRequest{Text: text}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Embedding, nil
+}
+
+// EmbedBatch generates embeddings for several texts in one request. It satisfies interfaces.BatchEmbedderFunc.
+func (c *Client) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp embedBatchResponse
+	if err := c.post(ctx, c.embedBatchURL, embedBatchRequest{Texts: texts}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding service returned %d embeddings for %d texts", len(resp.Embeddings), len(texts))
+	}
+	return resp.Embeddings, nil
+}
+
+func (c *Client) post(ctx context.Context, url string, body interface{}, out interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call embedding service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// JobHandler processes a claimed ingestion job. It records the job's final status itself; when it
+// returns an error the queue puts the job back for another attempt unless the error is permanent
+// or the job has used all its attempts. A job that isn't retried and has no final status, e.g.
+// because its handler panicked, is marked FAILED by the queue.
+type JobHandler func(ctx context.Context, job repository.IngestionJob) error
+
+// QueueOptions tunes a Queue. Zero values fall back to the defaults below.
+type QueueOptions struct {
+	Concurrency       int           // jobs this process runs at once
+	PollInterval      time.Duration // how often to look for runnable jobs when not notified
+	HeartbeatInterval time.Duration // how often a running job's heartbeat_at is refreshed
+	StaleAfter        time.Duration // a PROCESSING job without a heartbeat this long is reclaimed
+	RetryBackoff      time.Duration // delay before the first retry, doubled for each later one
+}
+
+const (
+	DefaultQueueConcurrency  = 2
+	DefaultMaxAttempts       = 3
+	DefaultPollInterval      = 5 * time.Second
+	DefaultHeartbeatInterval = 15 * time.Second
+	DefaultStaleAfter        = 2 * time.Minute
+	DefaultRetryBackoff      = 30 * time.Second
+)
+
+// permanentError marks a job failure that another attempt would not fix, e.g. a missing config.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error returned by a JobHandler so the job is not retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// ErrJobCancelled is the cause of a job context that was cancelled at a user's request.
+var ErrJobCancelled = errors.New("ingestion job cancelled by user")
+
+// errLostOwnership is the cause of a job context stopped because another worker took the job over.
+var errLostOwnership = errors.New("worker no longer owns the ingestion job")
+
+// Queue runs ingestion jobs stored in ingestion_jobs. Any number of processes can run a Queue
+// against the same database: jobs are claimed with FOR UPDATE SKIP LOCKED, kept alive with a
+// heartbeat, and reclaimed from workers that stop heartbeating.
+type Queue struct {
+	queries  repository.Querier
+	handler  JobHandler
+	opts     QueueOptions
+	workerID string
+	logger   *slog.Logger
+	wake     chan struct{}
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelCauseFunc // jobs this process is running
+}
+
+// NewQueue creates a queue that hands claimed jobs to handler.
+func NewQueue(queries repository.Querier, handler JobHandler, opts QueueOptions, logger *slog.Logger) *Queue {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultQueueConcurrency
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if opts.StaleAfter <= 0 {
+		opts.StaleAfter = DefaultStaleAfter
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+
+	hostname, _ := os.Hostname()
+	workerID := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+	return &Queue{
+		queries:  queries,
+		handler:  handler,
+		opts:     opts,
+		workerID: workerID,
+		logger:   logger.With("component", "ingestion_queue", "worker_id", workerID),
+		wake:     make(chan struct{}, 1),
+		running:  make(map[uuid.UUID]context.CancelCauseFunc),
+	}
+}
+
+// Notify tells the queue a job was just enqueued so it doesn't wait for the next poll.
+func (q *Queue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel stops a job this process is running, without waiting for its next heartbeat to notice
+// the cancel request. It reports whether the job was running here.
+func (q *Queue) Cancel(jobID uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel, ok := q.running[jobID]
+	if ok {
+		cancel(ErrJobCancelled)
+	}
+	return ok
+}
+
+// Run claims and processes jobs until ctx is cancelled, then waits for running jobs to stop.
+// Jobs interrupted by the shutdown are put back in the queue without using up an attempt.
+func (q *Queue) Run(ctx context.Context) {
+	q.logger.Info("Ingestion queue started", "concurrency", q.opts.Concurrency)
+
+	slots := make(chan struct{}, q.opts.Concurrency)
+	var wg sync.WaitGroup
+
+	poll := time.NewTicker(q.opts.PollInterval)
+	defer poll.Stop()
+	reclaim := time.NewTicker(q.opts.StaleAfter / 2)
+	defer reclaim.Stop()
+
+	q.reclaimStale(ctx)
+	for {
+		// Only this loop adds to slots, so a free slot seen here is still free when it's filled
+		for len(slots) < cap(slots) {
+			job, err := q.queries.ClaimIngestionJob(ctx, pgtype.Text{String: q.workerID, Valid: true})
+			if errors.Is(err, pgx.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					q.logger.Error("Failed to claim ingestion job", "error", err)
+				}
+				break
+			}
+
+			slots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					<-slots
+					q.Notify()
+				}()
+				q.runJob(ctx, job)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			q.logger.Info("Ingestion queue stopped")
+			return
+		case <-q.wake:
+		case <-poll.C:
+		case <-reclaim.C:
+			q.reclaimStale(ctx)
+		}
+	}
+}
+
+// runJob runs one claimed job with a heartbeat, records the attempt, then decides whether a
+// failure is retried.
+func (q *Queue) runJob(ctx context.Context, job repository.IngestionJob) {
+	jobID := uuid.UUID(job.ID.Bytes)
+	jobLogger := q.logger.With("job_id", jobID.String(), "attempt", job.Attempts, "max_attempts", job.MaxAttempts)
+	jobLogger.Info("Claimed ingestion job")
+
+	attemptID, err := q.queries.StartIngestionJobAttempt(ctx, repository.StartIngestionJobAttemptParams{
+		JobID:    job.ID,
+		WorkerID: pgtype.Text{String: q.workerID, Valid: true},
+	})
+	if err != nil {
+		jobLogger.Warn("Failed to record ingestion job attempt", "error", err)
+	}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	q.mu.Lock()
+	q.running[jobID] = cancel
+	q.mu.Unlock()
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		q.heartbeat(jobCtx, cancel, job.ID, jobLogger)
+	}()
+
+	err = q.runHandler(jobCtx, job)
+	cause := context.Cause(jobCtx)
+	cancel(nil)
+	<-heartbeatDone
+	q.mu.Lock()
+	delete(q.running, jobID)
+	q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		q.finishAttempt(attemptID, "", "", jobLogger)
+		return
+	case errors.Is(cause, ErrJobCancelled):
+		// The handler's transaction was rolled back with its context, so nothing was committed
+		jobLogger.Warn("Ingestion job cancelled by user")
+		q.markCancelled(job, jobLogger)
+		q.finishAttempt(attemptID, "CANCELLED", "Cancelled by user", jobLogger)
+		return
+	case errors.Is(cause, errLostOwnership):
+		q.finishAttempt(attemptID, "ABANDONED", "Worker lost ownership of the job", jobLogger)
+		return
+	}
+
+	// The queue's own context ending means the process is shutting down, not that the job failed
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		jobLogger.Warn("Ingestion job interrupted by shutdown, requeueing", "error", err)
+		q.finishAttempt(attemptID, "INTERRUPTED", "Interrupted by worker shutdown", jobLogger)
+		q.requeue(job, "Interrupted by worker shutdown; requeued", 0, 1, jobLogger)
+		return
+	}
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		jobLogger.Error("Ingestion job failed", "error", err, "permanent", IsPermanent(err))
+		q.markFailed(job, err.Error(), jobLogger)
+		q.finishAttempt(attemptID, "FAILED", err.Error(), jobLogger)
+		return
+	}
+
+	delay := q.opts.RetryBackoff << (job.Attempts - 1)
+	jobLogger.Warn("Ingestion job failed, will retry", "error", err, "retry_in", delay)
+	q.finishAttempt(attemptID, "FAILED", err.Error(), jobLogger)
+	q.requeue(job, fmt.Sprintf("Attempt %d of %d failed: %v", job.Attempts, job.MaxAttempts, err), delay, 0, jobLogger)
+}
+
+// runHandler calls the handler, turning a panic into a failed attempt so the worker survives it.
+func (q *Queue) runHandler(ctx context.Context, job repository.IngestionJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job handler panicked: %v", r)
+		}
+	}()
+	return q.handler(ctx, job)
+}
+
+// heartbeat refreshes the job's heartbeat_at until ctx ends. The job's context is cancelled when a
+// user asks to cancel the job, or when the job is no longer ours, e.g. because it was reclaimed as
+// stale, so its work is rolled back.
+func (q *Queue) heartbeat(ctx context.Context, cancel context.CancelCauseFunc, jobID pgtype.UUID, logger *slog.Logger) {
+	ticker := time.NewTicker(q.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelRequested, err := q.queries.HeartbeatIngestionJob(ctx, repository.HeartbeatIngestionJobParams{
+				ID:       jobID,
+				WorkerID: pgtype.Text{String: q.workerID, Valid: true},
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				logger.Warn("Lost ownership of ingestion job, stopping it")
+				cancel(errLostOwnership)
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Warn("Failed to heartbeat ingestion job", "error", err)
+				}
+				continue
+			}
+			if cancelRequested {
+				logger.Info("Cancel requested for ingestion job, stopping it")
+				cancel(ErrJobCancelled)
+				return
+			}
+		}
+	}
+}
+
+// requeue puts a job back in the queue. It uses its own context because it runs after the job's
+// context, and possibly the queue's, has ended.
+func (q *Queue) requeue(job repository.IngestionJob, reason string, delay time.Duration, refundedAttempts int32, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := q.queries.RequeueIngestionJob(ctx, repository.RequeueIngestionJobParams{
+		ErrorDetails:     pgtype.Text{String: reason, Valid: true},
+		DelaySeconds:     delay.Seconds(),
+		RefundedAttempts: refundedAttempts,
+		ID:               job.ID,
+		WorkerID:         pgtype.Text{String: q.workerID, Valid: true},
+	})
+	if err != nil {
+		logger.Error("Failed to requeue ingestion job; it will be reclaimed once stale", "error", err)
+	}
+}
+
+// finishAttempt closes the attempt row of a job run. Empty status and details copy the job's own.
+func (q *Queue) finishAttempt(attemptID int64, status, details string, logger *slog.Logger) {
+	if attemptID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := q.queries.FinishIngestionJobAttempt(ctx, repository.FinishIngestionJobAttemptParams{
+		Status:       pgtype.Text{String: status, Valid: status != ""},
+		ErrorDetails: pgtype.Text{String: details, Valid: details != ""},
+		ID:           attemptID,
+	})
+	if err != nil {
+		logger.Warn("Failed to record end of ingestion job attempt", "error", err)
+	}
+}
+
+// markCancelled records a cancelled job and drops the triage rows its unfinished run wrote, so
+// nothing of the run is left behind.
+func (q *Queue) markCancelled(job repository.IngestionJob, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := q.queries.MarkIngestionJobCancelled(ctx, repository.MarkIngestionJobCancelledParams{
+		ID:       job.ID,
+		WorkerID: pgtype.Text{String: q.workerID, Valid: true},
+	}); err != nil {
+		logger.Error("Failed to mark ingestion job cancelled; it will be cancelled once stale", "error", err)
+		return
+	}
+	if err := q.queries.DeleteIngestionErrorsForJob(ctx, job.ID); err != nil {
+		logger.Warn("Failed to delete triage rows of cancelled ingestion job", "error", err)
+	}
+}
+
+// markFailed ends a job that won't be retried, in case its handler couldn't record the failure
+// itself. It uses its own context for the same reason as requeue.
+func (q *Queue) markFailed(job repository.IngestionJob, reason string, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := q.queries.MarkIngestionJobFailed(ctx, repository.MarkIngestionJobFailedParams{
+		ErrorDetails: pgtype.Text{String: reason, Valid: true},
+		ID:           job.ID,
+		WorkerID:     pgtype.Text{String: q.workerID, Valid: true},
+	})
+	if err != nil {
+		logger.Error("Failed to mark ingestion job failed; it will be failed once stale", "error", err)
+	}
+}
+
+// reclaimStale releases jobs whose worker stopped heartbeating, e.g. after a crash.
+func (q *Queue) reclaimStale(ctx context.Context) {
+	reclaimed, err := q.queries.ReclaimStaleIngestionJobs(ctx, q.opts.StaleAfter.Seconds())
+	if err != nil {
+		if ctx.Err() == nil {
+			q.logger.Error("Failed to reclaim stale ingestion jobs", "error", err)
+		}
+		return
+	}
+	for _, job := range reclaimed {
+		q.logger.Warn("Reclaimed stale ingestion job", "job_id", uuid.UUID(job.ID.Bytes).String(), "new_status", job.Status, "attempts", job.Attempts)
+	}
+	if len(reclaimed) > 0 {
+		q.Notify()
+	}
+}
@@ -0,0 +1,246 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueueQuerier hands out a fixed list of jobs and records what the queue does with them.
+type fakeQueueQuerier struct {
+	repository.Querier
+	mu              sync.Mutex
+	jobs            []repository.IngestionJob
+	requeued        []repository.RequeueIngestionJobParams
+	attempts        []repository.FinishIngestionJobAttemptParams
+	cancelled       []pgtype.UUID
+	failed          []repository.MarkIngestionJobFailedParams
+	cancelRequested bool
+}
+
+func (f *fakeQueueQuerier) ClaimIngestionJob(ctx context.Context, workerID pgtype.Text) (repository.IngestionJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.jobs) == 0 {
+		return repository.IngestionJob{}, pgx.ErrNoRows
+	}
+	job := f.jobs[0]
+	f.jobs = f.jobs[1:]
+	job.Attempts++
+	job.LockedBy = workerID
+	return job, nil
+}
+
+func (f *fakeQueueQuerier) HeartbeatIngestionJob(ctx context.Context, arg repository.HeartbeatIngestionJobParams) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cancelRequested, nil
+}
+
+func (f *fakeQueueQuerier) StartIngestionJobAttempt(ctx context.Context, arg repository.StartIngestionJobAttemptParams) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return int64(len(f.attempts) + 1), nil
+}
+
+func (f *fakeQueueQuerier) FinishIngestionJobAttempt(ctx context.Context, arg repository.FinishIngestionJobAttemptParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, arg)
+	return nil
+}
+
+func (f *fakeQueueQuerier) MarkIngestionJobCancelled(ctx context.Context, arg repository.MarkIngestionJobCancelledParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = append(f.cancelled, arg.ID)
+	return nil
+}
+
+func (f *fakeQueueQuerier) MarkIngestionJobFailed(ctx context.Context, arg repository.MarkIngestionJobFailedParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, arg)
+	return nil
+}
+
+func (f *fakeQueueQuerier) DeleteIngestionErrorsForJob(ctx context.Context, jobID pgtype.UUID) error {
+	return nil
+}
+
+func (f *fakeQueueQuerier) RequeueIngestionJob(ctx context.Context, arg repository.RequeueIngestionJobParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requeued = append(f.requeued, arg)
+	return nil
+}
+
+func (f *fakeQueueQuerier) ReclaimStaleIngestionJobs(ctx context.Context, staleAfterSeconds float64) ([]repository.ReclaimStaleIngestionJobsRow, error) {
+	return nil, nil
+}
+
+func newTestJob(attempts, maxAttempts int32) repository.IngestionJob {
+	return repository.IngestionJob{
+		ID:          pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		ReportType:  "TEST",
+		Status:      "UPLOADED",
+		Attempts:    attempts,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// runUntilHandled runs the queue until the handler has been called for every job.
+func runUntilHandled(t *testing.T, queries *fakeQueueQuerier, handler JobHandler, jobs int) {
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	counted := func(ctx context.Context, job repository.IngestionJob) error {
+		defer wg.Done()
+		return handler(ctx, job)
+	}
+
+	queue := NewQueue(queries, counted, QueueOptions{Concurrency: 2, RetryBackoff: time.Second}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		queue.Run(ctx)
+	}()
+
+	handled := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs were not handled")
+	}
+	cancel()
+	<-done
+}
+
+func TestQueueRetriesFailedJobsWithBackoff(t *testing.T) {
+	retryable := newTestJob(1, 3) // claimed as attempt 2
+	permanent := newTestJob(0, 3)
+	exhausted := newTestJob(2, 3) // claimed as the last attempt
+	queries := &fakeQueueQuerier{jobs: []repository.IngestionJob{retryable, permanent, exhausted}}
+
+	runUntilHandled(t, queries, func(ctx context.Context, job repository.IngestionJob) error {
+		if job.ID == permanent.ID {
+			return Permanent(errors.New("no config"))
+		}
+		return errors.New("storage unavailable")
+	}, 3)
+
+	if assert.Len(t, queries.requeued, 1) {
+		requeued := queries.requeued[0]
+		assert.Equal(t, retryable.ID, requeued.ID)
+		assert.Equal(t, float64(2), requeued.DelaySeconds) // second attempt waits twice the backoff
+		assert.Equal(t, int32(0), requeued.RefundedAttempts)
+		assert.Contains(t, requeued.ErrorDetails.String, "Attempt 2 of 3 failed: storage unavailable")
+	}
+}
+
+func TestQueueRequeuesJobsThatPanic(t *testing.T) {
+	job := newTestJob(0, 3)
+	queries := &fakeQueueQuerier{jobs: []repository.IngestionJob{job}}
+
+	runUntilHandled(t, queries, func(ctx context.Context, job repository.IngestionJob) error {
+		panic("boom")
+	}, 1)
+
+	if assert.Len(t, queries.requeued, 1) {
+		assert.Contains(t, queries.requeued[0].ErrorDetails.String, "job handler panicked: boom")
+	}
+}
+
+func TestQueueFailsJobsOnTheirLastAttempt(t *testing.T) {
+	job := newTestJob(2, 3) // claimed as the last attempt
+	queries := &fakeQueueQuerier{jobs: []repository.IngestionJob{job}}
+
+	runUntilHandled(t, queries, func(ctx context.Context, job repository.IngestionJob) error {
+		panic("boom")
+	}, 1)
+
+	assert.Empty(t, queries.requeued)
+	if assert.Len(t, queries.failed, 1) {
+		assert.Equal(t, job.ID, queries.failed[0].ID)
+		assert.Equal(t, "job handler panicked: boom", queries.failed[0].ErrorDetails.String)
+	}
+}
+
+func TestQueueRefundsAttemptsOnShutdown(t *testing.T) {
+	job := newTestJob(0, 3)
+	queries := &fakeQueueQuerier{jobs: []repository.IngestionJob{job}}
+
+	started := make(chan struct{})
+	queue := NewQueue(queries, func(ctx context.Context, job repository.IngestionJob) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, QueueOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		queue.Run(ctx)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	if assert.Len(t, queries.requeued, 1) {
+		assert.Equal(t, int32(1), queries.requeued[0].RefundedAttempts)
+		assert.Equal(t, float64(0), queries.requeued[0].DelaySeconds)
+	}
+}
+
+func TestQueueCancelsJobsWithoutRequeueing(t *testing.T) {
+	for _, viaHeartbeat := range []bool{false, true} {
+		job := newTestJob(0, 3)
+		queries := &fakeQueueQuerier{jobs: []repository.IngestionJob{job}, cancelRequested: viaHeartbeat}
+
+		started := make(chan struct{})
+		queue := NewQueue(queries, func(ctx context.Context, job repository.IngestionJob) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, QueueOptions{HeartbeatInterval: 10 * time.Millisecond}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			queue.Run(ctx)
+		}()
+		<-started
+		if !viaHeartbeat {
+			assert.True(t, queue.Cancel(uuid.UUID(job.ID.Bytes)))
+		}
+		assert.Eventually(t, func() bool {
+			queries.mu.Lock()
+			defer queries.mu.Unlock()
+			return len(queries.attempts) > 0
+		}, 5*time.Second, 5*time.Millisecond)
+		cancel()
+		<-done
+
+		assert.Empty(t, queries.requeued)
+		assert.Equal(t, []pgtype.UUID{job.ID}, queries.cancelled)
+		if assert.Len(t, queries.attempts, 1) {
+			assert.Equal(t, "CANCELLED", queries.attempts[0].Status.String)
+		}
+	}
+}
@@ -2,77 +2,241 @@ package ingestion
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"fmt"
 	"io"
+	"time"
 
-	"cloud.google.com/go/storage"
 //	"github.com/jackc/pgx/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 //	"github.com/jjckrbbt/catalyst/backend/internal/logger"
 	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/jjckrbbt/catalyst/backend/internal/blobstore"
 	"github.com/jjckrbbt/catalyst/backend/internal/config"
 )
 
 type Service struct {
 	queries  repository.Querier
-	gcsClient *storage.Client
-	gcsBucket string
+	blobStore blobstore.BlobStore
 	logger *slog.Logger
 	cfg *config.Config
+	dbpool *pgxpool.Pool // job creation locks on the file's content hash in a transaction
 }
 
-func NewService(queries repository.Querier, gcsClient *storage.Client, cfg *config.Config, logger *slog.Logger) (*Service, error) {
+func NewService(queries repository.Querier, blobStore blobstore.BlobStore, cfg *config.Config, logger *slog.Logger, dbpool *pgxpool.Pool) (*Service, error) {
 	return &Service{
 		queries:	queries,
-		gcsClient:	gcsClient,
-		gcsBucket:	cfg.GCSBucketName,
+		blobStore:	blobStore,
 		logger:		logger.With("component", "ingestion_service"),
 		cfg:		cfg,
+		dbpool:		dbpool,
 	}, nil
 }
 
-func (s *Service) StartJob(ctx context.Context, file io.Reader, originalFilename, itemType string, userID int64) (*repository.IngestionJob, error) {
-	jobID := uuid.New()
-	gcsObjectKey := fmt.Sprintf("raw-reports/%s/%s-/%s", itemType, jobID.String(), originalFilename)
+// Values of ingestion_jobs.source_type
+const (
+	SourceTypeFileUpload = "FILE_UPLOAD" // uploaded through the API
+	SourceTypeDirectory  = "DIRECTORY"   // picked up from a watched directory
+)
+
+// DefaultDuplicateWindow is how long after a job starts an upload of the same content for the same
+// report type is answered with that job instead of starting another.
+const DefaultDuplicateWindow = 24 * time.Hour
+
+// DuplicateUploadError is returned when a file's content was already loaded for the report type
+// within the duplicate window. Job is the job that has it.
+type DuplicateUploadError struct {
+	Job repository.IngestionJob
+}
+
+func (e *DuplicateUploadError) Error() string {
+	return fmt.Sprintf("a file with the same content was already loaded by job %s", uuid.UUID(e.Job.ID.Bytes))
+}
+
+// StartJob stores an uploaded file and queues a job for it. Unless force is set, a file whose
+// content was already loaded for the report type within the duplicate window is not stored again
+// and a *DuplicateUploadError carrying the existing job is returned.
+func (s *Service) StartJob(ctx context.Context, file io.ReadSeeker, originalFilename, itemType string, userID int64, force bool) (*repository.IngestionJob, error) {
+	return s.startJob(ctx, uuid.New(), file, originalFilename, itemType, SourceTypeFileUpload,
+		[]byte(fmt.Sprintf(`{"filename": "%s"}`, originalFilename)), pgtype.Int8{Int64: userID, Valid: true}, force)
+}
+
+// StartSourceJob stores a file an ingestion source picked up and queues a job for it under jobID.
+// details is recorded as the job's source_details along with the filename. Like StartJob, it
+// returns a *DuplicateUploadError for content that was already loaded.
+func (s *Service) StartSourceJob(ctx context.Context, jobID uuid.UUID, file io.ReadSeeker, filename, reportType, sourceType string, details map[string]string) (*repository.IngestionJob, error) {
+	sourceDetails := map[string]string{"filename": filename}
+	for key, value := range details {
+		sourceDetails[key] = value
+	}
+	data, err := json.Marshal(sourceDetails)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source details: %w", err)
+	}
+	return s.startJob(ctx, jobID, file, filename, reportType, sourceType, data, pgtype.Int8{}, false)
+}
 
-	s.logger.InfoContext(ctx, "Starting ingestion job", "job_id", jobID, "item_type", itemType, "user_id", userID)
+func (s *Service) startJob(ctx context.Context, jobID uuid.UUID, file io.ReadSeeker, originalFilename, itemType, sourceType string, sourceDetails []byte, userID pgtype.Int8, force bool) (*repository.IngestionJob, error) {
+	blobKey := fmt.Sprintf("raw-reports/%s/%s-/%s", itemType, jobID.String(), originalFilename)
 
-	// --- Upload file to GCS ---
-	wc := s.gcsClient.Bucket(s.gcsBucket).Object(gcsObjectKey).NewWriter(ctx)
-	
-	if _, err := io.Copy(wc, file); err != nil {
-		s.logger.ErrorContext(ctx, "Failed to upload file to GCS", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to upload file to GCS: %w", err)
+	s.logger.InfoContext(ctx, "Starting ingestion job", "job_id", jobID, "item_type", itemType, "source_type", sourceType, "user_id", userID.Int64)
+
+	contentHash, err := hashContent(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
 	}
-	// Close the writer to finalize the upload
-	if err := wc.Close(); err != nil {
-		s.logger.ErrorContext(ctx, "Failed to close GCS writer", slog.Any("error", err))
-		return nil, fmt.Errorf("failed to close GCS writer: %w", err)
+	// Checked before the upload so a repeated file isn't stored, and again under the lock below
+	if !force {
+		if err := s.checkDuplicate(ctx, s.queries, itemType, contentHash); err != nil {
+			return nil, err
+		}
+	}
+
+	// --- Store the file ---
+	if err := s.blobStore.Put(ctx, blobKey, file); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to store file", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to store file: %w", err)
 	}
-	s.logger.InfoContext(ctx, "File successfully uploaded to GCS", "job_id", jobID, "gcs_object_key", gcsObjectKey)
+	s.logger.InfoContext(ctx, "File successfully stored", "job_id", jobID, "blob_key", blobKey)
 
 	// --- Create ingestion job record ---
+	tx, err := s.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := repository.New(tx)
+
+	if err := qtx.LockIngestionContentHash(ctx, repository.LockIngestionContentHashParams{ReportType: itemType, ContentHash: contentHash}); err != nil {
+		return nil, fmt.Errorf("failed to lock content hash: %w", err)
+	}
+	if !force {
+		if err := s.checkDuplicate(ctx, qtx, itemType, contentHash); err != nil {
+			// A concurrent upload of the same file got there first
+			if err := s.blobStore.Delete(ctx, blobKey); err != nil {
+				s.logger.WarnContext(ctx, "Failed to delete duplicate upload", "blob_key", blobKey, "error", err)
+			}
+			return nil, err
+		}
+	}
+
 	params := repository.CreateIngestionJobParams{
 		ID:		pgtype.UUID{Bytes: jobID, Valid: true},
-		SourceType:	"FILE_UPLOAD", 
+		SourceType:	sourceType,
 		ReportType:	itemType,
 		Status:		"UPLOADED",
-		UserID:		pgtype.Int8{Int64: userID, Valid: true},
-		SourceDetails:  []byte(fmt.Sprintf(`{"filename": "%s"}`, originalFilename)),
-		SourceUri:	pgtype.Text{String: gcsObjectKey, Valid: true},
+		UserID:		userID,
+		SourceDetails:  sourceDetails,
+		SourceUri:	pgtype.Text{String: blobstore.URI(blobKey), Valid: true},
+		MaxAttempts:	int32(s.maxAttempts()),
+		ContentHash:	pgtype.Text{String: contentHash, Valid: true},
 	}
-	createdJob, err := s.queries.CreateIngestionJob(ctx, params)
+	createdJob, err := qtx.CreateIngestionJob(ctx, params)
 	if err != nil {
 		s.logger.ErrorContext(ctx, "Failed to create ingestion job record", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to create ingestion job record: %w", err)
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit ingestion job record: %w", err)
+	}
 	s.logger.InfoContext(ctx, "Ingestion job record created", "job_id", jobID)
 
 	return &createdJob, nil
 }
 
+// checkDuplicate returns a *DuplicateUploadError if a job loaded the content for the report type
+// within the duplicate window.
+func (s *Service) checkDuplicate(ctx context.Context, queries repository.Querier, reportType, contentHash string) error {
+	existing, err := queries.FindIngestionJobByContentHash(ctx, repository.FindIngestionJobByContentHashParams{
+		ReportType:  reportType,
+		ContentHash: pgtype.Text{String: contentHash, Valid: true},
+		Since:       pgtype.Timestamptz{Time: time.Now().Add(-s.duplicateWindow()), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look for duplicate uploads: %w", err)
+	}
+	s.logger.InfoContext(ctx, "File content was already loaded", "report_type", reportType, "content_hash", contentHash, "existing_job_id", uuid.UUID(existing.ID.Bytes))
+	return &DuplicateUploadError{Job: existing}
+}
+
+// duplicateWindow is how far back uploads are checked for identical content.
+func (s *Service) duplicateWindow() time.Duration {
+	if s.cfg.IngestionDuplicateWindowMinutes > 0 {
+		return time.Duration(s.cfg.IngestionDuplicateWindowMinutes) * time.Minute
+	}
+	return DefaultDuplicateWindow
+}
+
+// hashContent returns the hex SHA-256 of the file and rewinds it.
+func hashContent(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+var (
+	// ErrJobNotCancellable is returned when cancelling a job that is no longer queued or running.
+	ErrJobNotCancellable = errors.New("only queued or running jobs can be cancelled")
+	// ErrJobNotRetryable is returned when retrying a job that has not failed or been cancelled.
+	ErrJobNotRetryable = errors.New("only failed or cancelled jobs can be retried")
+)
+
+// CancelJob cancels a queued job at once. A running job is flagged, and its worker stops it and
+// marks it CANCELLED when it next heartbeats; nothing the run processed is committed.
+func (s *Service) CancelJob(ctx context.Context, jobID uuid.UUID) (*repository.IngestionJob, error) {
+	job, err := s.queries.RequestIngestionJobCancel(ctx, pgtype.UUID{Bytes: jobID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotCancellable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel ingestion job: %w", err)
+	}
+	s.logger.InfoContext(ctx, "Ingestion job cancel requested", "job_id", jobID, "status", job.Status)
+	return &job, nil
+}
+
+// RetryJob queues a failed or cancelled job to run again from the file stored at its source_uri.
+// It runs with the config its last run used, or with the report type's current config when
+// useCurrentConfig is set. Earlier attempts stay in the job's attempt history.
+func (s *Service) RetryJob(ctx context.Context, jobID uuid.UUID, useCurrentConfig bool) (*repository.IngestionJob, error) {
+	job, err := s.queries.RetryIngestionJob(ctx, repository.RetryIngestionJobParams{
+		MaxAttempts:      int32(s.maxAttempts()),
+		UseCurrentConfig: useCurrentConfig,
+		ID:               pgtype.UUID{Bytes: jobID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotRetryable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry ingestion job: %w", err)
+	}
+	s.logger.InfoContext(ctx, "Ingestion job queued for retry", "job_id", jobID, "use_current_config", useCurrentConfig)
+	return &job, nil
+}
+
+// maxAttempts is how many times the queue may run a new job before giving up on it.
+func (s *Service) maxAttempts() int {
+	if s.cfg.IngestionJobMaxAttempts > 0 {
+		return s.cfg.IngestionJobMaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
 // UpdateJobStatus updates the status of an ingestion job
 func (s *Service) UpdateJobStatus(ctx context.Context, jobID uuid.UUID, status string, errorDetails string, rowsUpserted int64, rowsTriaged int64) error {
 	params := repository.UpdateIngestionJobStatusParams{
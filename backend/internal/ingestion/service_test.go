@@ -0,0 +1,70 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/config"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDuplicateQuerier answers duplicate lookups with job, or no rows when it has none.
+type fakeDuplicateQuerier struct {
+	repository.Querier
+	job    *repository.IngestionJob
+	lookup repository.FindIngestionJobByContentHashParams
+}
+
+func (f *fakeDuplicateQuerier) FindIngestionJobByContentHash(ctx context.Context, arg repository.FindIngestionJobByContentHashParams) (repository.IngestionJob, error) {
+	f.lookup = arg
+	if f.job == nil {
+		return repository.IngestionJob{}, pgx.ErrNoRows
+	}
+	return *f.job, nil
+}
+
+func TestHashContentRewinds(t *testing.T) {
+	file := strings.NewReader("claim_id,amount\n1,10\n")
+	hash, err := hashContent(file)
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	rest, err := io.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "claim_id,amount\n1,10\n", string(rest))
+
+	other, err := hashContent(strings.NewReader("claim_id,amount\n1,11\n"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestCheckDuplicate(t *testing.T) {
+	s := &Service{cfg: &config.Config{IngestionDuplicateWindowMinutes: 90}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx := context.Background()
+
+	queries := &fakeDuplicateQuerier{}
+	assert.NoError(t, s.checkDuplicate(ctx, queries, "CLAIMS", "abc"))
+	assert.Equal(t, "CLAIMS", queries.lookup.ReportType)
+	assert.Equal(t, "abc", queries.lookup.ContentHash.String)
+	assert.WithinDuration(t, time.Now().Add(-90*time.Minute), queries.lookup.Since.Time, time.Minute)
+
+	existing := repository.IngestionJob{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Status: "COMPLETE"}
+	queries.job = &existing
+	err := s.checkDuplicate(ctx, queries, "CLAIMS", "abc")
+	var duplicate *DuplicateUploadError
+	if assert.True(t, errors.As(err, &duplicate)) {
+		assert.Equal(t, existing, duplicate.Job)
+	}
+
+	s.cfg.IngestionDuplicateWindowMinutes = 0
+	assert.Equal(t, DefaultDuplicateWindow, s.duplicateWindow())
+}
@@ -4,3 +4,7 @@ import	"context"
 
 // EmbedderFunc defines the signature for any function that can generate embeddings
 type EmbedderFunc func(ctx context.Context, text string) ([]float32, error)
+
+// BatchEmbedderFunc generates embeddings for several texts in one call.
+// The result holds one vector per input text, in the same order.
+type BatchEmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
@@ -0,0 +1,188 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// Event types an ingestion job writes to items_events, tied to the job by ingestion_job_id
+const (
+	EventIngestionCreated     = "INGESTION_CREATED"
+	EventIngestionUpdated     = "INGESTION_UPDATED"
+	EventIngestionDeactivated = "INGESTION_DEACTIVATED"
+)
+
+// ChangeCounts is the change report of a job: what its rows did to items.
+type ChangeCounts struct {
+	Inserted    int64 `json:"inserted"`
+	Updated     int64 `json:"updated"`
+	Unchanged   int64 `json:"unchanged"`
+	Deactivated int64 `json:"deactivated"`
+}
+
+func (c *ChangeCounts) add(other ChangeCounts) {
+	c.Inserted += other.Inserted
+	c.Updated += other.Updated
+	c.Unchanged += other.Unchanged
+	c.Deactivated += other.Deactivated
+}
+
+// FieldChange is one custom_properties field a job changed. Nested fields use dotted names and a
+// field that was added or removed has a null old or new value.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// ItemUpdate is the event_data of an INGESTION_UPDATED event. Status and scope are only set when
+// the job changed them, for instance when it reactivated an item.
+type ItemUpdate struct {
+	Changes   []FieldChange `json:"changes,omitempty"`
+	OldStatus string        `json:"old_status,omitempty"`
+	NewStatus string        `json:"new_status,omitempty"`
+	OldScope  string        `json:"old_scope,omitempty"`
+	NewScope  string        `json:"new_scope,omitempty"`
+}
+
+// itemEvent is an items_events entry for an item a job changed.
+type itemEvent struct {
+	itemID    int64
+	eventType string
+	data      []byte
+}
+
+// upsertChanges sorts the items an upsert wrote into inserted, updated and unchanged ones, with
+// an event for each item that changed.
+func upsertChanges(rows []repository.UpsertItemsRow) ([]itemEvent, ChangeCounts, error) {
+	var events []itemEvent
+	var counts ChangeCounts
+	for _, row := range rows {
+		if row.Inserted {
+			counts.Inserted++
+			events = append(events, itemEvent{itemID: row.ID, eventType: EventIngestionCreated, data: []byte("{}")})
+			continue
+		}
+
+		fields, err := diffProperties(row.PreviousProperties, row.CustomProperties)
+		if err != nil {
+			return nil, ChangeCounts{}, fmt.Errorf("failed to compare properties of item '%s': %w", row.BusinessKey.String, err)
+		}
+		update := ItemUpdate{Changes: fields}
+		if row.PreviousStatus.ItemStatus != row.Status {
+			update.OldStatus, update.NewStatus = string(row.PreviousStatus.ItemStatus), string(row.Status)
+		}
+		if row.PreviousScope != row.Scope {
+			update.OldScope, update.NewScope = row.PreviousScope.String, row.Scope.String
+		}
+		if len(fields) == 0 && update.NewStatus == "" && row.PreviousScope == row.Scope {
+			counts.Unchanged++
+			continue
+		}
+
+		data, err := json.Marshal(update)
+		if err != nil {
+			return nil, ChangeCounts{}, fmt.Errorf("failed to marshal changes of item '%s': %w", row.BusinessKey.String, err)
+		}
+		counts.Updated++
+		events = append(events, itemEvent{itemID: row.ID, eventType: EventIngestionUpdated, data: data})
+	}
+	return events, counts, nil
+}
+
+// insertChanges reports the items an append_only or insert_only batch inserted. The other staged
+// items already existed and were left as they are.
+func insertChanges(rows []repository.InsertNewItemsRow, staged int) ([]itemEvent, ChangeCounts) {
+	events := make([]itemEvent, len(rows))
+	for i, row := range rows {
+		events[i] = itemEvent{itemID: row.ID, eventType: EventIngestionCreated, data: []byte("{}")}
+	}
+	return events, ChangeCounts{Inserted: int64(len(rows)), Unchanged: int64(staged - len(rows))}
+}
+
+// writeItemEvents bulk-inserts a batch's item events into items_events, tied to the job.
+func (js *jobSink) writeItemEvents(ctx context.Context, events []itemEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	jobID := pgtype.UUID{Bytes: js.jobID, Valid: true}
+	_, err := js.tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"items_events"},
+		[]string{"item_id", "event_type", "event_data", "created_by", "ingestion_job_id"},
+		pgx.CopyFromSlice(len(events), func(i int) ([]interface{}, error) {
+			return []interface{}{events[i].itemID, events[i].eventType, events[i].data, js.userID, jobID}, nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write item events: %w", err)
+	}
+	return nil
+}
+
+// diffProperties lists the custom_properties fields that differ between two JSON objects,
+// comparing nested objects field by field. Fields are sorted by name.
+func diffProperties(before, after []byte) ([]FieldChange, error) {
+	oldProps, err := decodeProperties(before)
+	if err != nil {
+		return nil, err
+	}
+	newProps, err := decodeProperties(after)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FieldChange
+	diffValues("", oldProps, newProps, &changes)
+	return changes, nil
+}
+
+func decodeProperties(data []byte) (map[string]any, error) {
+	props := map[string]any{}
+	if len(data) == 0 {
+		return props, nil
+	}
+	// Numbers stay as written so large IDs keep their digits in the report
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func diffValues(field string, oldValue, newValue any, changes *[]FieldChange) {
+	oldObject, oldIsObject := oldValue.(map[string]any)
+	newObject, newIsObject := newValue.(map[string]any)
+	if !oldIsObject || !newIsObject {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(oldObject)+len(newObject))
+	for key := range oldObject {
+		keys = append(keys, key)
+	}
+	for key := range newObject {
+		if _, ok := oldObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		nested := key
+		if field != "" {
+			nested = field + "." + key
+		}
+		diffValues(nested, oldObject[key], newObject[key], changes)
+	}
+}
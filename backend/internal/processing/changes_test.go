@@ -0,0 +1,55 @@
+package processing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProperties(t *testing.T) {
+	before := []byte(`{"amount": 12.50, "status": "open", "address": {"city": "Leeds", "zip": "LS1"}, "note": "x"}`)
+	after := []byte(`{"amount": 13, "status": "open", "address": {"city": "York", "zip": "LS1"}, "note": "x", "owner": "kim"}`)
+
+	changes, err := diffProperties(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Field: "address.city", Old: "Leeds", New: "York"},
+		{Field: "amount", Old: json.Number("12.50"), New: json.Number("13")},
+		{Field: "owner", Old: nil, New: "kim"},
+	}, changes)
+
+	changes, err = diffProperties(after, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestUpsertChangesSortsItems(t *testing.T) {
+	scope := pgtype.Text{String: "A", Valid: true}
+	active := repository.NullItemStatus{ItemStatus: repository.ItemStatusActive, Valid: true}
+	rows := []repository.UpsertItemsRow{
+		{ID: 1, Inserted: true, Scope: scope, Status: repository.ItemStatusActive, CustomProperties: []byte(`{"a": 1}`)},
+		{ID: 2, Scope: scope, Status: repository.ItemStatusActive, CustomProperties: []byte(`{"a": 2}`),
+			PreviousScope: scope, PreviousStatus: active, PreviousProperties: []byte(`{"a": 1}`)},
+		{ID: 3, Scope: scope, Status: repository.ItemStatusActive, CustomProperties: []byte(`{"a": 1}`),
+			PreviousScope: scope, PreviousStatus: active, PreviousProperties: []byte(`{"a": 1}`)},
+		// Same properties, but the job brought a deactivated item back
+		{ID: 4, Scope: scope, Status: repository.ItemStatusActive, CustomProperties: []byte(`{"a": 1}`),
+			PreviousScope: scope, PreviousStatus: repository.NullItemStatus{ItemStatus: repository.ItemStatusInactive, Valid: true}, PreviousProperties: []byte(`{"a": 1}`)},
+	}
+
+	events, counts, err := upsertChanges(rows)
+	assert.NoError(t, err)
+	assert.Equal(t, ChangeCounts{Inserted: 1, Updated: 2, Unchanged: 1}, counts)
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, EventIngestionCreated, events[0].eventType)
+		assert.Equal(t, int64(2), events[1].itemID)
+		assert.JSONEq(t, `{"changes": [{"field": "a", "old": 1, "new": 2}]}`, string(events[1].data))
+		assert.JSONEq(t, `{"old_status": "inactive", "new_status": "active"}`, string(events[2].data))
+	}
+
+	_, counts = insertChanges([]repository.InsertNewItemsRow{{ID: 5}}, 3)
+	assert.Equal(t, ChangeCounts{Inserted: 1, Unchanged: 2}, counts)
+}
@@ -1,6 +1,9 @@
 package processing
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ValidationRule defines the validation rules for a single column
 // yaml tags tell our parser how to map the YAML fields to our struct
@@ -17,10 +20,14 @@ type ProcessingAttempt struct {
 	Transforms []string       `yaml:"transforms,omitempty"`
 }
 
-// ColumnMapping defines how to map and transform a single CSV column
+// ColumnMapping defines how to map and transform a single source column.
+// For JSON sources, csv_header holds a dotted path into each record, e.g. "claim.amount" or "lines.0.sku".
+// A dotted json_field such as "metadata.section" is stored as a nested object in custom_properties;
+// set literal_json_field to keep the dots in a single top-level key instead.
 type ColumnMapping struct {
 	CSVHeader string              `yaml:"csv_header"`
 	JSONField string              `yaml:"json_field"`
+	LiteralJSONField bool         `yaml:"literal_json_field,omitempty"`
 	MergeExcessFields bool	      `yaml:"merge_excess_fields,omitempty"`
 	Attempts  []ProcessingAttempt `yaml:"attempts"`
 	Validation	ValidationRule	`yaml:"validation"`
@@ -31,32 +38,114 @@ type EmbedContent struct {
 	SourceColumns []string	`yaml:"source_columns"`
 }
 
+// DerivedField defines a field that is not read from the source but built from constants or from
+// other fields once the column transforms have run. Exactly one of constant, source_field or concat
+// is set; source_field and concat refer to json_field names, including earlier derived fields.
+// Naming an existing json_field replaces that field's value, e.g. to give it a default.
+type DerivedField struct {
+	JSONField        string         `yaml:"json_field"`
+	LiteralJSONField bool           `yaml:"literal_json_field,omitempty"`
+	Constant         *string        `yaml:"constant,omitempty"`
+	SourceField      string         `yaml:"source_field,omitempty"`
+	Concat           []string       `yaml:"concat,omitempty"`
+	Separator        string         `yaml:"separator,omitempty"` // placed between concat values
+	Default          string         `yaml:"default,omitempty"`   // used when the value is blank, before transforms run
+	Transforms       []string       `yaml:"transforms,omitempty"`
+	Validation       ValidationRule `yaml:"validation"`
+}
+
+// XLSXOptions selects where the records live in an Excel workbook
+type XLSXOptions struct {
+	SheetName        string `yaml:"sheet_name,omitempty"`
+	SheetIndex       int    `yaml:"sheet_index,omitempty"`       // 0-based, used when sheet_name is empty
+	HeaderRowOffset  int    `yaml:"header_row_offset,omitempty"` // rows above the header row to skip
+	SkipTrailingRows int    `yaml:"skip_trailing_rows,omitempty"`
+}
+
 // IngestionConfig is the top-level struct that represents a full ingestion configuration fields
 type IngestionConfig struct {
 	ReportType     string          `yaml:"report_type"`
+	// Version is an optional label the config's authors give a revision, e.g. "2024-06". It is
+	// recorded with the revision; revisions themselves are told apart by content.
+	Version        string          `yaml:"version,omitempty" json:",omitempty"`
+	SourceFormat   string          `yaml:"source_format,omitempty"`
+	XLSX           *XLSXOptions    `yaml:"xlsx,omitempty"`
 	ItemType       string          `yaml:"item_type"`
 	ScopeField     string          `yaml:"scope_field"`
 	BusinessKey    []string        `yaml:"business_key"`
 	EmbedContent    *EmbedContent  `yaml:"embed_content,omitempty"`
 	ColumnMappings []ColumnMapping `yaml:"column_mappings"`
+	DerivedFields  []DerivedField  `yaml:"derived_fields,omitempty"`
+	DuplicatePolicy string         `yaml:"duplicate_policy,omitempty"` // what to do with rows that repeat a business key; defaults to triage
+	LoadMode       string           `yaml:"load_mode,omitempty"` // how items are written; defaults to upsert
+	Snapshot       *SnapshotOptions `yaml:"snapshot,omitempty"`  // load_mode snapshot only
+	Sources        []SourceConfig   `yaml:"sources,omitempty"`   // where files are picked up from besides uploads
+	View           *ViewOptions     `yaml:"view,omitempty" json:",omitempty"` // the typed SQL view generated for the config's items
 }
 
 // Validate checks if the IngestionConfig is valid
 func (c *IngestionConfig) Validate() error {
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	return nil
+}
+
+// configFieldError is a Validate failure about one field of the config. Its path addresses the
+// field the way the linter reports it: mapping keys and sequence indexes.
+type configFieldError struct {
+	path []any
+	err  error
+}
+
+func (e *configFieldError) Error() string { return e.err.Error() }
+
+func (e *configFieldError) Unwrap() error { return e.err }
+
+// fieldErrorf returns an error about the config field at path.
+func fieldErrorf(path []any, format string, args ...any) error {
+	return &configFieldError{path: path, err: fmt.Errorf(format, args...)}
+}
+
+func (c *IngestionConfig) validate() error {
 	if c.ReportType == "" {
-		return fmt.Errorf("config validation failed: report_type is required")
+		return fieldErrorf([]any{"report_type"}, "report_type is required")
+	}
+	switch c.SourceFormat {
+	case "", SourceFormatCSV, SourceFormatNDJSON, SourceFormatJSONArray, SourceFormatXLSX:
+	default:
+		return fieldErrorf([]any{"source_format"}, "unsupported source_format '%s'", c.SourceFormat)
+	}
+	if c.XLSX != nil {
+		if c.SourceFormat != SourceFormatXLSX {
+			return fieldErrorf([]any{"xlsx"}, "xlsx options require source_format 'xlsx'")
+		}
+		if c.XLSX.SheetIndex < 0 || c.XLSX.HeaderRowOffset < 0 || c.XLSX.SkipTrailingRows < 0 {
+			return fieldErrorf([]any{"xlsx"}, "xlsx sheet_index, header_row_offset and skip_trailing_rows must not be negative")
+		}
+	}
+	switch c.DuplicatePolicy {
+	case "", DuplicatePolicyTriage, DuplicatePolicyKeepFirst, DuplicatePolicyKeepLast, DuplicatePolicyMerge:
+	default:
+		return fieldErrorf([]any{"duplicate_policy"}, "unsupported duplicate_policy '%s'", c.DuplicatePolicy)
+	}
+	if err := validateLoadMode(c); err != nil {
+		return err
+	}
+	if err := validateSources(c.Sources); err != nil {
+		return err
 	}
 	if c.ItemType == "" {
-		return fmt.Errorf("config validation failed: item_type is required")
+		return fieldErrorf([]any{"item_type"}, "item_type is required")
 	}
 	if c.ScopeField == "" {
-		return fmt.Errorf("config validation failed: scope_field is required")
+		return fieldErrorf([]any{"scope_field"}, "scope_field is required")
 	}
 	if len(c.BusinessKey) == 0 {
-		return fmt.Errorf("config validation failed: business_key must contain at least one field")
+		return fieldErrorf([]any{"business_key"}, "business_key must contain at least one field")
 	}
 	if len(c.ColumnMappings) == 0 {
-		return fmt.Errorf("config validation failed: have at least one column mapping")
+		return fieldErrorf([]any{"column_mappings"}, "have at least one column mapping")
 	}
 
 	// Create a quick lookup map of all defined CSV headers
@@ -65,9 +154,115 @@ func (c *IngestionConfig) Validate() error {
 		definedHeaders[mapping.CSVHeader] = true
 	}
 
-	// Check if the scopeFields value exists in the defined headers
-	if _, exists := definedHeaders[c.ScopeField]; !exists {
-		return fmt.Errorf("config validation failed: scope_field '%s' does not match any defined CSV headers", c.ScopeField)
+	if err := validateDerivedFields(c.ColumnMappings, c.DerivedFields); err != nil {
+		return err
+	}
+
+	// Check if the scopeFields value exists in the defined headers, or is a derived field
+	if _, exists := definedHeaders[c.ScopeField]; !exists && c.derivedField(c.ScopeField) == nil {
+		return fieldErrorf([]any{"scope_field"}, "scope_field '%s' does not match any defined CSV headers or derived fields", c.ScopeField)
+	}
+
+	return validateFieldPaths(c.ColumnMappings, c.DerivedFields)
+}
+
+// derivedField returns the last derived field stored under jsonField, or nil if there is none.
+func (c *IngestionConfig) derivedField(jsonField string) *DerivedField {
+	for i := len(c.DerivedFields) - 1; i >= 0; i-- {
+		if c.DerivedFields[i].JSONField == jsonField {
+			return &c.DerivedFields[i]
+		}
+	}
+	return nil
+}
+
+// validateDerivedFields checks that each derived field has exactly one source and only refers to
+// fields that are available by the time it runs.
+func validateDerivedFields(mappings []ColumnMapping, derived []DerivedField) error {
+	available := make(map[string]bool)
+	for _, mapping := range mappings {
+		available[mapping.JSONField] = true
+	}
+
+	for i, field := range derived {
+		if field.JSONField == "" {
+			return fieldErrorf([]any{"derived_fields", i}, "derived field is missing json_field")
+		}
+
+		sources := 0
+		if field.Constant != nil {
+			sources++
+		}
+		if field.SourceField != "" {
+			sources++
+		}
+		if len(field.Concat) > 0 {
+			sources++
+		}
+		if sources != 1 {
+			return fieldErrorf([]any{"derived_fields", i}, "derived field '%s' must set exactly one of constant, source_field or concat", field.JSONField)
+		}
+
+		refs := field.Concat
+		refPath := func(j int) []any { return []any{"derived_fields", i, "concat", j} }
+		if field.SourceField != "" {
+			refs = []string{field.SourceField}
+			refPath = func(int) []any { return []any{"derived_fields", i, "source_field"} }
+		}
+		for j, ref := range refs {
+			if !available[ref] {
+				return fieldErrorf(refPath(j), "derived field '%s' refers to '%s', which is not a json_field defined before it", field.JSONField, ref)
+			}
+		}
+
+		for k, transformCall := range field.Transforms {
+			name, _, _ := strings.Cut(transformCall, ":")
+			if _, ok := lookupTransform(name); !ok {
+				return fieldErrorf([]any{"derived_fields", i, "transforms", k}, "derived field '%s' uses unknown transform '%s'", field.JSONField, name)
+			}
+		}
+		available[field.JSONField] = true
+	}
+	return nil
+}
+
+// validateFieldPaths makes sure every json_field can be placed in the custom_properties document,
+// i.e. no path has empty segments and no field is stored where another needs a nested object.
+func validateFieldPaths(mappings []ColumnMapping, derived []DerivedField) error {
+	mappings = append([]ColumnMapping(nil), mappings...)
+	for _, field := range derived {
+		mappings = append(mappings, ColumnMapping{JSONField: field.JSONField, LiteralJSONField: field.LiteralJSONField})
+	}
+
+	// The config field each json_field comes from, for errors
+	configPath := func(i int) []any {
+		if i < len(mappings)-len(derived) {
+			return []any{"column_mappings", i, "json_field"}
+		}
+		return []any{"derived_fields", i - (len(mappings) - len(derived)), "json_field"}
+	}
+
+	paths := make(map[string]bool)
+	for i, mapping := range mappings {
+		if mapping.JSONField == "" {
+			return fieldErrorf(configPath(i), "json_field is required for csv_header '%s'", mapping.CSVHeader)
+		}
+		path := fieldPath(mapping)
+		for _, segment := range path {
+			if segment == "" {
+				return fieldErrorf(configPath(i), "json_field '%s' has an empty path segment; set literal_json_field to keep the dots in the key", mapping.JSONField)
+			}
+		}
+		paths[strings.Join(path, "\x00")] = true
+	}
+
+	for i, mapping := range mappings {
+		path := fieldPath(mapping)
+		for j := 1; j < len(path); j++ {
+			if paths[strings.Join(path[:j], "\x00")] {
+				return fieldErrorf(configPath(i), "json_field '%s' needs '%s' to be an object, but another column is stored there", mapping.JSONField, strings.Join(path[:j], "."))
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,154 @@
+package processing
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Kinds of ConfigChange
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeRemoved = "removed"
+	ConfigChangeChanged = "changed"
+)
+
+// ConfigChange is one difference between two revisions of a config. Path names the setting the
+// way the YAML does, e.g. "column_mappings[amount].validation.required"; entries of lists such as
+// column_mappings are matched by their json_field, name or path rather than their position.
+type ConfigChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// listKeys are the fields, in order of preference, that identify the entries of a config list.
+var listKeys = []string{"json_field", "name", "path"}
+
+// DiffConfigContent compares two stored config revisions, as saved by ConfigDocument.
+func DiffConfigContent(from, to []byte) ([]ConfigChange, error) {
+	var fromDoc, toDoc map[string]any
+	if err := json.Unmarshal(from, &fromDoc); err != nil {
+		return nil, fmt.Errorf("failed to read config revision: %w", err)
+	}
+	if err := json.Unmarshal(to, &toDoc); err != nil {
+		return nil, fmt.Errorf("failed to read config revision: %w", err)
+	}
+	return DiffConfigDocuments(fromDoc, toDoc), nil
+}
+
+// DiffConfigDocuments lists the settings that differ between two config documents.
+func DiffConfigDocuments(from, to map[string]any) []ConfigChange {
+	changes := []ConfigChange{}
+	diffConfigValue("", from, to, &changes)
+	return changes
+}
+
+func diffConfigValue(path string, from, to any, changes *[]ConfigChange) {
+	switch {
+	case from == nil && to == nil:
+		return
+	case from == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Kind: ConfigChangeAdded, To: to})
+		return
+	case to == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Kind: ConfigChangeRemoved, From: from})
+		return
+	}
+
+	fromMap, fromIsMap := from.(map[string]any)
+	toMap, toIsMap := to.(map[string]any)
+	if fromIsMap && toIsMap {
+		keys := make([]string, 0, len(fromMap)+len(toMap))
+		for key := range fromMap {
+			keys = append(keys, key)
+		}
+		for key := range toMap {
+			if _, ok := fromMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			diffConfigValue(child, fromMap[key], toMap[key], changes)
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]any)
+	toList, toIsList := to.([]any)
+	if fromIsList && toIsList {
+		if key := sharedListKey(fromList, toList); key != "" {
+			diffKeyedLists(path, key, fromList, toList, changes)
+			return
+		}
+		for i := 0; i < len(fromList) || i < len(toList); i++ {
+			var f, t any
+			if i < len(fromList) {
+				f = fromList[i]
+			}
+			if i < len(toList) {
+				t = toList[i]
+			}
+			diffConfigValue(fmt.Sprintf("%s[%d]", path, i), f, t, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, ConfigChange{Path: path, Kind: ConfigChangeChanged, From: from, To: to})
+	}
+}
+
+// diffKeyedLists compares two lists entry by entry, pairing entries with the same key. Entries
+// keep the order of the newer list, followed by removed ones.
+func diffKeyedLists(path, key string, from, to []any, changes *[]ConfigChange) {
+	fromByKey := make(map[string]any, len(from))
+	for _, entry := range from {
+		fromByKey[entry.(map[string]any)[key].(string)] = entry
+	}
+	seen := make(map[string]bool, len(to))
+	for _, entry := range to {
+		id := entry.(map[string]any)[key].(string)
+		seen[id] = true
+		diffConfigValue(fmt.Sprintf("%s[%s]", path, id), fromByKey[id], entry, changes)
+	}
+	for _, entry := range from {
+		if id := entry.(map[string]any)[key].(string); !seen[id] {
+			diffConfigValue(fmt.Sprintf("%s[%s]", path, id), entry, nil, changes)
+		}
+	}
+}
+
+// sharedListKey returns the first of listKeys that every entry of both lists has as a distinct,
+// non-empty string, or "" if there is none.
+func sharedListKey(from, to []any) string {
+	for _, key := range listKeys {
+		if uniqueListKey(from, key) && uniqueListKey(to, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+func uniqueListKey(list []any, key string) bool {
+	seen := make(map[string]bool, len(list))
+	for _, entry := range list {
+		m, ok := entry.(map[string]any)
+		if !ok {
+			return false
+		}
+		id, ok := m[key].(string)
+		if !ok || id == "" || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
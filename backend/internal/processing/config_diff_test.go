@@ -0,0 +1,63 @@
+package processing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfigContent(t *testing.T) {
+	content := func(config IngestionConfig) []byte {
+		doc, err := ConfigDocument(config)
+		require.NoError(t, err)
+		data, err := json.Marshal(doc)
+		require.NoError(t, err)
+		return data
+	}
+	before := IngestionConfig{
+		ReportType:  "CLAIMS",
+		ItemType:    "INSURANCE_CLAIM",
+		ScopeField:  "State",
+		BusinessKey: []string{"Claim_ID"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "Claim_ID", JSONField: "claim_id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "State", JSONField: "state"},
+			{CSVHeader: "Notes", JSONField: "notes"},
+		},
+	}
+	after := before
+	after.Version = "2"
+	after.ColumnMappings = []ColumnMapping{
+		{CSVHeader: "State", JSONField: "state"},
+		{CSVHeader: "Claim Number", JSONField: "claim_id", Validation: ValidationRule{Required: true}},
+		{CSVHeader: "Amount", JSONField: "amount"},
+	}
+
+	changes, err := DiffConfigContent(content(before), content(after))
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, ConfigChange{Path: "column_mappings[claim_id].csv_header", Kind: ConfigChangeChanged, From: "Claim_ID", To: "Claim Number"}, changes[0])
+	assert.Equal(t, "column_mappings[amount]", changes[1].Path)
+	assert.Equal(t, ConfigChangeAdded, changes[1].Kind)
+	assert.Equal(t, "Amount", changes[1].To.(map[string]any)["csv_header"])
+	assert.Equal(t, "column_mappings[notes]", changes[2].Path)
+	assert.Equal(t, ConfigChangeRemoved, changes[2].Kind)
+	assert.Equal(t, ConfigChange{Path: "version", Kind: ConfigChangeAdded, To: "2"}, changes[3])
+
+	changes, err = DiffConfigContent(content(after), content(after))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiffConfigDocumentsPositionalLists(t *testing.T) {
+	changes := DiffConfigDocuments(
+		map[string]any{"business_key": []any{"a", "b"}},
+		map[string]any{"business_key": []any{"a", "c", "d"}},
+	)
+	assert.Equal(t, []ConfigChange{
+		{Path: "business_key[1]", Kind: ConfigChangeChanged, From: "b", To: "c"},
+		{Path: "business_key[2]", Kind: ConfigChangeAdded, To: "d"},
+	}, changes)
+}
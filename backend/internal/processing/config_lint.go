@@ -0,0 +1,407 @@
+package processing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigIssue is a problem found in a config file. Line and Column locate the offending YAML node;
+// Path names it the way the YAML does, e.g. "column_mappings[2].attempts[0].transforms[1]".
+type ConfigIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i ConfigIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Column, i.Path, i.Message)
+}
+
+// ConfigIssues is the error a config with problems is rejected with.
+type ConfigIssues []ConfigIssue
+
+func (issues ConfigIssues) Error() string {
+	messages := make([]string, len(issues))
+	for i, issue := range issues {
+		messages[i] = issue.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// LintOptions configures LintConfig.
+type LintOptions struct {
+	// ItemTypes are the item types a config may load into and exists_in_items may name, as declared
+	// in the item_types.yaml files. Empty means item types aren't checked.
+	ItemTypes []ItemTypeDefinition
+}
+
+// transformArgChecks validate the arguments of transforms whose arguments can be wrong, so a bad
+// one is caught when the config is loaded rather than on the first row.
+var transformArgChecks = map[string]func(arg string) error{
+	"regex_replace": func(arg string) error {
+		_, _, err := parseRegexReplaceArg(arg)
+		return err
+	},
+	"map": func(arg string) error {
+		_, err := parseMapArg(arg)
+		return err
+	},
+	"parse_currency": func(arg string) error {
+		if arg != "" && arg != "." && arg != "," {
+			return fmt.Errorf("parse_currency argument must be '.' or ',', got '%s'", arg)
+		}
+		return nil
+	},
+}
+
+// LintConfig parses a config file and checks it more thoroughly than Validate: besides Validate's
+// checks it reports YAML errors, unknown fields, unknown transforms and bad transform arguments,
+// regexes that don't compile, business_key and embed_content fields that no json_field provides,
+// and item types that don't exist. Every problem found is returned, each with its position.
+func LintConfig(file string, data []byte, opts LintOptions) (IngestionConfig, ConfigIssues) {
+	config, _, issues := lintConfig(file, data, opts)
+	return config, issues
+}
+
+// LintConfigDir lints every config file under dir, and also reports report types declared by more
+// than one file. Unless opts gives item types, configs are checked against the ones declared in
+// dir. The error is for a directory or item_types.yaml that can't be read; problems with the
+// configs are returned as issues.
+func LintConfigDir(dir string, opts LintOptions) ([]IngestionConfig, ConfigIssues, error) {
+	paths, _, err := scanConfigDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error walking config directory %s: %w", dir, err)
+	}
+	if len(opts.ItemTypes) == 0 {
+		if opts.ItemTypes, err = LoadItemTypes(dir); err != nil {
+			return nil, nil, err
+		}
+	}
+	var configs []IngestionConfig
+	var issues ConfigIssues
+	owners := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			issues = append(issues, ConfigIssue{File: path, Message: fmt.Sprintf("failed to read config file: %v", err)})
+			continue
+		}
+		config, root, fileIssues := lintConfig(path, data, opts)
+		issues = append(issues, fileIssues...)
+		if root == nil || config.ReportType == "" {
+			continue
+		}
+		if owner, taken := owners[config.ReportType]; taken {
+			l := &configLinter{file: path, root: root}
+			l.report(fmt.Sprintf("duplicate report_type '%s', already declared in %s", config.ReportType, owner), "report_type")
+			issues = append(issues, l.issues...)
+			continue
+		}
+		owners[config.ReportType] = path
+		if len(fileIssues) == 0 {
+			configs = append(configs, config)
+		}
+	}
+	return configs, issues, nil
+}
+
+func lintConfig(file string, data []byte, opts LintOptions) (IngestionConfig, *yaml.Node, ConfigIssues) {
+	var config IngestionConfig
+	l := &configLinter{file: file, opts: opts}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		l.reportYAMLError(err)
+		return config, nil, l.issues
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		l.issues = append(l.issues, ConfigIssue{File: file, Line: max(doc.Line, 1), Column: max(doc.Column, 1), Message: "config must be a YAML mapping"})
+		return config, nil, l.issues
+	}
+	l.root = doc.Content[0]
+
+	if err := l.root.Decode(&config); err != nil {
+		l.reportYAMLError(err)
+	}
+	l.checkFields(l.root, reflect.TypeOf(config), nil)
+	if len(l.issues) > 0 {
+		// Field-level checks would only repeat these problems
+		return config, l.root, l.issues
+	}
+
+	l.checkReferences(&config)
+	if err := config.Validate(); err != nil {
+		l.reportValidation(err)
+	}
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		if l.issues[i].Line != l.issues[j].Line {
+			return l.issues[i].Line < l.issues[j].Line
+		}
+		return l.issues[i].Column < l.issues[j].Column
+	})
+	return config, l.root, l.issues
+}
+
+// configLinter collects the issues of one config file.
+type configLinter struct {
+	file   string
+	opts   LintOptions
+	root   *yaml.Node
+	issues ConfigIssues
+}
+
+// report records an issue at the node path addresses, or at the closest node that exists when
+// the path points at a missing field. Path elements are mapping keys (strings) and sequence
+// indexes (ints).
+func (l *configLinter) report(message string, path ...any) {
+	l.issues = append(l.issues, l.issueAt(message, path...))
+}
+
+// reportValidation records the error Validate returned at the field it is about, unless
+// checkReferences already reported a problem there.
+func (l *configLinter) reportValidation(err error) {
+	var fieldErr *configFieldError
+	if !errors.As(err, &fieldErr) {
+		l.report(err.Error())
+		return
+	}
+	issue := l.issueAt(fieldErr.Error(), fieldErr.path...)
+	for _, reported := range l.issues {
+		if reported.Path == issue.Path {
+			return
+		}
+	}
+	l.issues = append(l.issues, issue)
+}
+
+// issueAt builds the issue report records.
+func (l *configLinter) issueAt(message string, path ...any) ConfigIssue {
+	node := l.root
+	var name strings.Builder
+	for _, element := range path {
+		switch e := element.(type) {
+		case string:
+			if name.Len() > 0 {
+				name.WriteString(".")
+			}
+			name.WriteString(e)
+		case int:
+			fmt.Fprintf(&name, "[%d]", e)
+		}
+		if node != nil {
+			if child := childNode(node, element); child != nil {
+				node = child
+			}
+		}
+	}
+	issue := ConfigIssue{File: l.file, Path: name.String(), Message: message, Line: 1, Column: 1}
+	if node != nil {
+		issue.Line, issue.Column = node.Line, node.Column
+	}
+	return issue
+}
+
+// childNode returns the value under a mapping key or the item at a sequence index.
+func childNode(node *yaml.Node, element any) *yaml.Node {
+	switch e := element.(type) {
+	case string:
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == e {
+					return node.Content[i+1]
+				}
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && e < len(node.Content) {
+			return node.Content[e]
+		}
+	}
+	return nil
+}
+
+// yamlErrorLine matches the position in yaml.v3's error messages, e.g. "line 7: cannot unmarshal".
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+func (l *configLinter) reportYAMLError(err error) {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	for _, message := range messages {
+		issue := ConfigIssue{File: l.file, Line: 1, Column: 1, Message: message}
+		if m := yamlErrorLine.FindStringSubmatch(message); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = m[2]
+		}
+		l.issues = append(l.issues, issue)
+	}
+}
+
+// checkFields reports mapping keys that t has no field for, which are usually misspellings the
+// YAML decoder would silently ignore.
+func (l *configLinter) checkFields(node *yaml.Node, t reflect.Type, path []any) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				issuePath := append(append([]any(nil), path...), key.Value)
+				l.report(fmt.Sprintf("unknown field '%s'", key.Value), issuePath...)
+				// Point at the key rather than its value
+				l.issues[len(l.issues)-1].Line, l.issues[len(l.issues)-1].Column = key.Line, key.Column
+				continue
+			}
+			l.checkFields(node.Content[i+1], fieldType, append(append([]any(nil), path...), key.Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			l.checkFields(item, t.Elem(), append(append([]any(nil), path...), i))
+		}
+	}
+}
+
+// yamlFields maps the YAML names of a struct's fields to their types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// checkReferences reports names in the config that don't refer to anything: unknown transforms
+// and item types, regexes that don't compile, and fields no mapping provides.
+func (l *configLinter) checkReferences(c *IngestionConfig) {
+	itemTypes := make(map[string]ItemTypeDefinition, len(l.opts.ItemTypes))
+	names := make([]string, len(l.opts.ItemTypes))
+	for i, itemType := range l.opts.ItemTypes {
+		itemTypes[itemType.Name] = itemType
+		names[i] = itemType.Name
+	}
+	knownItemType := func(itemType string) bool {
+		_, ok := itemTypes[itemType]
+		return ok || len(itemTypes) == 0
+	}
+	if c.ItemType != "" && !knownItemType(c.ItemType) {
+		l.report(fmt.Sprintf("unknown item_type '%s'; expected one of %s", c.ItemType, strings.Join(names, ", ")), "item_type")
+	}
+	if itemType, ok := itemTypes[c.ItemType]; ok && c.EmbedContent != nil && itemType.EmbeddingDimensions == 0 {
+		l.report(fmt.Sprintf("item_type '%s' has no embedding_dimensions in %s, so its items can't be embedded", c.ItemType, itemType.File), "embed_content")
+	}
+	if itemType, ok := itemTypes[c.ItemType]; ok && c.EmbedContent != nil && itemType.EmbeddingDimensions != 0 && itemType.EmbeddingDimensions != ItemEmbeddingDimensions {
+		l.report(fmt.Sprintf("item_type '%s' has embedding_dimensions %d in %s, but items are embedded in %d dimensions", c.ItemType, itemType.EmbeddingDimensions, itemType.File, ItemEmbeddingDimensions), "embed_content")
+	}
+
+	jsonFields := make(map[string]bool)
+	for _, mapping := range c.ColumnMappings {
+		jsonFields[mapping.JSONField] = true
+	}
+	for _, field := range c.DerivedFields {
+		jsonFields[field.JSONField] = true
+	}
+	for i, field := range c.BusinessKey {
+		if !jsonFields[field] {
+			l.report(fmt.Sprintf("business_key field '%s' does not match any json_field", field), "business_key", i)
+		}
+	}
+	if c.EmbedContent != nil {
+		for i, column := range c.EmbedContent.SourceColumns {
+			if !jsonFields[column] {
+				l.report(fmt.Sprintf("embed_content source column '%s' does not match any json_field", column), "embed_content", "source_columns", i)
+			}
+		}
+	}
+
+	if c.View != nil {
+		overridden := make([]string, 0, len(c.View.Columns))
+		for jsonField := range c.View.Columns {
+			overridden = append(overridden, jsonField)
+		}
+		sort.Strings(overridden)
+		for _, jsonField := range overridden {
+			if !jsonFields[jsonField] {
+				l.report(fmt.Sprintf("view column for '%s' does not match any json_field", jsonField), "view", "columns", jsonField)
+			}
+		}
+		if _, err := BuildView(*c); err != nil {
+			l.report(err.Error(), "view")
+		}
+	}
+
+	checkValidation := func(rule ValidationRule, path ...any) {
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				l.report(fmt.Sprintf("invalid regex: %v", err), append(path, "regex")...)
+			}
+		}
+		if rule.ExistsInItems != "" && !knownItemType(rule.ExistsInItems) {
+			l.report(fmt.Sprintf("exists_in_items names unknown item_type '%s'", rule.ExistsInItems), append(path, "exists_in_items")...)
+		}
+	}
+	for i, mapping := range c.ColumnMappings {
+		for j, attempt := range mapping.Attempts {
+			for k, transform := range attempt.Transforms {
+				l.checkTransform(transform, "column_mappings", i, "attempts", j, "transforms", k)
+			}
+		}
+		checkValidation(mapping.Validation, "column_mappings", i, "validation")
+	}
+	for i, field := range c.DerivedFields {
+		for k, transform := range field.Transforms {
+			l.checkTransform(transform, "derived_fields", i, "transforms", k)
+		}
+		checkValidation(field.Validation, "derived_fields", i, "validation")
+	}
+}
+
+// checkTransform reports a transform call, "name" or "name:arg", that isn't registered or whose
+// argument the transform would reject.
+func (l *configLinter) checkTransform(call string, path ...any) {
+	name, arg, _ := strings.Cut(call, ":")
+	if _, ok := lookupTransform(name); !ok {
+		l.report(fmt.Sprintf("unknown transform '%s'", name), path...)
+		return
+	}
+	if check, ok := transformArgChecks[name]; ok {
+		if err := check(arg); err != nil {
+			l.report(err.Error(), path...)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package processing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintConfig(t *testing.T) {
+	data := `report_type: "CLAIMS"
+item_type: "CLAIM"
+scope_field: "State"
+business_key:
+  - "claim_id"
+  - "claim_number"
+embed_content:
+  source_columns: ["summary"]
+column_mappings:
+  - csv_header: "Claim_ID"
+    json_field: "claim_id"
+    attempts:
+      - transforms:
+          - "trim_space"
+          - "to_integr"
+  - csv_header: "State"
+    json_field: "state"
+    validation:
+      regex: "^[A-Z{2}$"
+      exists_in_items: "STATE"
+  - csv_header: "Amount"
+    json_field: "amount"
+    attempts:
+      - transforms: ["regex_replace:/[^0-9.]+/"]
+derived_fields:
+  - json_field: "summary"
+    source_field: "state"
+    transforms: ["map:CA"]
+`
+	itemTypes := []ItemTypeDefinition{{Name: "INSURANCE_CLAIM"}, {Name: "KNOWLEDGE_CHUNK"}}
+	_, issues := LintConfig("claims.yaml", []byte(data), LintOptions{ItemTypes: itemTypes})
+	got := make([]string, len(issues))
+	for i, issue := range issues {
+		got[i] = issue.String()
+	}
+	assert.Equal(t, []string{
+		"claims.yaml:2:12: item_type: unknown item_type 'CLAIM'; expected one of INSURANCE_CLAIM, KNOWLEDGE_CHUNK",
+		"claims.yaml:6:5: business_key[1]: business_key field 'claim_number' does not match any json_field",
+		"claims.yaml:15:13: column_mappings[0].attempts[0].transforms[1]: unknown transform 'to_integr'",
+		"claims.yaml:19:14: column_mappings[1].validation.regex: invalid regex: error parsing regexp: missing closing ]: `[A-Z{2}$`",
+		"claims.yaml:20:24: column_mappings[1].validation.exists_in_items: exists_in_items names unknown item_type 'STATE'",
+		"claims.yaml:24:22: column_mappings[2].attempts[0].transforms[0]: regex_replace argument '/[^0-9.]+/' must have the form /pattern/replacement/",
+		"claims.yaml:28:18: derived_fields[0].transforms[0]: map entry 'CA' must have the form key=value",
+	}, got)
+}
+
+func TestLintConfigItemTypes(t *testing.T) {
+	data := []byte(`report_type: "CLAIMS"
+item_type: "INSURANCE_CLAIM"
+scope_field: "State"
+business_key: ["state"]
+embed_content:
+  source_columns: ["state"]
+column_mappings:
+  - csv_header: "State"
+    json_field: "state"
+`)
+	_, issues := LintConfig("claims.yaml", data, LintOptions{ItemTypes: []ItemTypeDefinition{{Name: "INSURANCE_CLAIM", File: "item_types.yaml"}}})
+	require.Len(t, issues, 1)
+	assert.Equal(t, "claims.yaml:6:3: embed_content: item_type 'INSURANCE_CLAIM' has no embedding_dimensions in item_types.yaml, so its items can't be embedded", issues[0].String())
+
+	_, issues = LintConfig("claims.yaml", data, LintOptions{ItemTypes: []ItemTypeDefinition{{Name: "INSURANCE_CLAIM", EmbeddingDimensions: 384}}})
+	assert.Empty(t, issues)
+
+	_, issues = LintConfig("claims.yaml", data, LintOptions{ItemTypes: []ItemTypeDefinition{{Name: "INSURANCE_CLAIM", EmbeddingDimensions: 768, File: "item_types.yaml"}}})
+	require.Len(t, issues, 1)
+	assert.Equal(t, "claims.yaml:6:3: embed_content: item_type 'INSURANCE_CLAIM' has embedding_dimensions 768 in item_types.yaml, but items are embedded in 384 dimensions", issues[0].String())
+
+	// Without declared item types, any item type is accepted
+	_, issues = LintConfig("claims.yaml", data, LintOptions{})
+	assert.Empty(t, issues)
+}
+
+func TestLintConfigStructure(t *testing.T) {
+	data := `report_type: "CLAIMS"
+item_type: "INSURANCE_CLAIM"
+scope_field: "State"
+business_key: ["state"]
+column_mappings:
+  - csv_header: "State"
+    json_feild: "state"
+    validation:
+      required: "sometimes"
+`
+	_, issues := LintConfig("claims.yaml", []byte(data), LintOptions{})
+	require.Len(t, issues, 2)
+	assert.Equal(t, ConfigIssue{File: "claims.yaml", Line: 9, Column: 1, Message: "cannot unmarshal !!str `sometimes` into bool"}, issues[0])
+	assert.Equal(t, ConfigIssue{File: "claims.yaml", Line: 7, Column: 5, Path: "column_mappings[0].json_feild", Message: "unknown field 'json_feild'"}, issues[1])
+
+	_, issues = LintConfig("claims.yaml", []byte("report_type: CLAIMS\nitem_type: a: b\n"), LintOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, ConfigIssue{File: "claims.yaml", Line: 2, Column: 1, Message: "mapping values are not allowed in this context"}, issues[0])
+
+	// Validate's checks are reported too, at the field they are about
+	_, issues = LintConfig("claims.yaml", []byte("report_type: CLAIMS\nitem_type: INSURANCE_CLAIM\nload_mode: replace_all\n"), LintOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, ConfigIssue{File: "claims.yaml", Line: 3, Column: 12, Path: "load_mode", Message: "unsupported load_mode 'replace_all'"}, issues[0])
+
+	// An unknown derived field transform fails Validate too, but is only reported once
+	_, issues = LintConfig("claims.yaml", []byte(`report_type: CLAIMS
+item_type: INSURANCE_CLAIM
+scope_field: State
+business_key: [state]
+column_mappings:
+  - csv_header: State
+    json_field: state
+derived_fields:
+  - json_field: region
+    source_field: state
+    transforms: [to_regoin]
+`), LintOptions{})
+	require.Len(t, issues, 1)
+	assert.Equal(t, "claims.yaml:11:18: derived_fields[0].transforms[0]: unknown transform 'to_regoin'", issues[0].String())
+}
+
+func TestLintConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, "claims.yaml"), "CLAIMS", "Name")
+	writeTestConfig(t, filepath.Join(dir, "copy.yaml"), "CLAIMS", "Name")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a config"), 0o644))
+
+	configs, issues, err := LintConfigDir(dir, LintOptions{})
+	require.NoError(t, err)
+	assert.Len(t, configs, 1)
+	require.Len(t, issues, 1)
+	assert.Equal(t, filepath.Join(dir, "copy.yaml"), issues[0].File)
+	assert.Equal(t, 1, issues[0].Line)
+	assert.Contains(t, issues[0].Message, "duplicate report_type 'CLAIMS'")
+}
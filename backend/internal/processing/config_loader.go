@@ -1,72 +1,350 @@
 package processing
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-// ConfigLoader holds the loaded ingestion configurations
+// DefaultConfigReloadInterval is how often Watch checks the config directory for changes.
+const DefaultConfigReloadInterval = 10 * time.Second
+
+// ConfigLoader holds the loaded ingestion configurations. Reload swaps in a new set at once, so
+// readers see either the old or the new configs, never a mix. It is safe for concurrent use.
 type ConfigLoader struct {
-	configs map[string]IngestionConfig
+	path string
+
+	mu        sync.RWMutex
+	configs   map[string]IngestionConfig // by report type
+	owners    map[string]string          // by report type, the file each config came from
+	files     map[string]loadedFile      // by file path, the last good version of each file
+	itemTypes []ItemTypeDefinition       // declared in the item_types.yaml files
+	status    ConfigLoaderStatus
+	digest    string // of the file names, sizes and modification times Reload last saw
+
+	onReload []func()
+}
+
+// loadedFile is the last good version of a config file.
+type loadedFile struct {
+	config   IngestionConfig
+	version  string
+	loadedAt time.Time
+}
+
+// LoadedConfig describes a config the loader holds. ContentVersion is the config_version item
+// lineage records for it; Version is the label the file declares, if any.
+type LoadedConfig struct {
+	ReportType     string    `json:"report_type"`
+	ItemType       string    `json:"item_type"`
+	File           string    `json:"file"`
+	Version        string    `json:"version,omitempty"`
+	ContentVersion string    `json:"content_version"`
+	LoadedAt       time.Time `json:"loaded_at"`
+}
+
+// ConfigFileError is a config file the last reload could not use. If an earlier version of the
+// file was valid, that version stays loaded and Kept is set.
+type ConfigFileError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+	Kept  bool   `json:"kept_previous_version"`
+}
+
+// ConfigLoaderStatus reports the outcome of the last reload.
+type ConfigLoaderStatus struct {
+	Path         string            `json:"path"`
+	ReportTypes  int               `json:"report_types"`
+	LastReloadAt time.Time         `json:"last_reload_at"`
+	LastError    string            `json:"last_error,omitempty"`
+	FileErrors   []ConfigFileError `json:"file_errors,omitempty"`
 }
 
 // NewConfigLoader recursively scans a directory for YAML files, loads them, validates them
-// and returns a ConfigLoader instance.
+// and returns a ConfigLoader instance. Unlike a later reload, it fails if any file is invalid.
 func NewConfigLoader(configPath string) (*ConfigLoader, error) {
-	configs := make(map[string]IngestionConfig)
+	l := &ConfigLoader{path: configPath}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	if len(l.configs) == 0 {
+		slog.Warn("No ingestion configs were loaded.", "path", configPath)
+	}
+	return l, nil
+}
 
-	err := filepath.WalkDir(configPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+// Reload rescans the config directory and swaps in the configs it finds. A file that fails to
+// parse or validate keeps its last good version, if it had one; the returned error lists such
+// files, and Status reports them until a later reload succeeds.
+func (l *ConfigLoader) Reload() error {
+	paths, digest, err := scanConfigDir(l.path)
+	now := time.Now()
+	if err != nil {
+		err = fmt.Errorf("error walking config directory %s: %w", l.path, err)
+	}
+	var itemTypes []ItemTypeDefinition
+	if err == nil {
+		itemTypes, err = LoadItemTypes(l.path)
+	}
+	if err != nil {
+		l.mu.Lock()
+		l.status.LastReloadAt = now
+		l.status.LastError = err.Error()
+		l.mu.Unlock()
+		return err
+	}
+
+	l.mu.RLock()
+	previous := l.files
+	l.mu.RUnlock()
+
+	files := make(map[string]loadedFile, len(paths))
+	var fileErrors []ConfigFileError
+	for _, path := range paths {
+		config, err := readConfigFile(path, LintOptions{ItemTypes: itemTypes})
+		if err == nil {
+			var version string
+			if version, err = configVersion(config); err == nil {
+				file := loadedFile{config: config, version: version, loadedAt: now}
+				if prev, ok := previous[path]; ok && prev.version == version {
+					file.loadedAt = prev.loadedAt
+				}
+				files[path] = file
+				continue
+			}
 		}
+		prev, kept := previous[path]
+		if kept {
+			files[path] = prev
+		}
+		fileErrors = append(fileErrors, ConfigFileError{File: path, Error: err.Error(), Kept: kept})
+	}
 
-		if d.IsDir() || (filepath.Ext(d.Name()) != ".yaml" && filepath.Ext(d.Name()) != ".yml") {
-			return nil
+	configs, owners := make(map[string]IngestionConfig), make(map[string]string)
+	for _, path := range resolveOrder(paths, files, previous) {
+		file, ok := files[path]
+		if !ok {
+			continue
+		}
+		reportType := file.config.ReportType
+		if owner, taken := owners[reportType]; taken {
+			fileErrors = append(fileErrors, ConfigFileError{File: path, Error: fmt.Sprintf("duplicate reportType '%s' found in %s, already loaded from %s", reportType, path, owner)})
+			delete(files, path)
+			continue
 		}
-	
-		slog.Info("Loading ingestion config", "file", path)
+		configs[reportType] = file.config
+		owners[reportType] = path
+	}
+	sort.Slice(fileErrors, func(i, j int) bool { return fileErrors[i].File < fileErrors[j].File })
 
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to read config file %s: %w", path, err)
+	l.mu.Lock()
+	l.configs = configs
+	l.owners = owners
+	l.files = files
+	l.itemTypes = itemTypes
+	l.digest = digest
+	l.status = ConfigLoaderStatus{Path: l.path, ReportTypes: len(configs), LastReloadAt: now, FileErrors: fileErrors}
+	if len(fileErrors) > 0 {
+		messages := make([]string, len(fileErrors))
+		for i, fe := range fileErrors {
+			messages[i] = fe.Error
 		}
-	
-		var config IngestionConfig
-		if err := yaml.Unmarshal(data, &config); err != nil {
-			return fmt.Errorf("failed to parse YAML for %s: %w", path, err)
+		l.status.LastError = strings.Join(messages, "; ")
+	}
+	hooks := l.onReload
+	l.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	if len(fileErrors) > 0 {
+		return fmt.Errorf("%d config files could not be loaded: %s", len(fileErrors), l.status.LastError)
+	}
+	return nil
+}
+
+// OnReload registers a function to call after each reload has swapped in the new configs.
+func (l *ConfigLoader) OnReload(hook func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReload = append(l.onReload, hook)
+}
+
+// resolveOrder decides which file wins when several declare the same report type: files that
+// already provided a report type keep it, and new claims are settled by path.
+func resolveOrder(paths []string, files, previous map[string]loadedFile) []string {
+	ordered := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if prev, ok := previous[path]; ok && files[path].config.ReportType == prev.config.ReportType {
+			ordered = append(ordered, path)
+		}
+	}
+	for _, path := range paths {
+		if prev, ok := previous[path]; !ok || files[path].config.ReportType != prev.config.ReportType {
+			ordered = append(ordered, path)
 		}
-	
-		if err := config.Validate(); err != nil {
-			return fmt.Errorf("validation failed for %s: %w", path, err)
+	}
+	return ordered
+}
+
+// Watch reloads the configs whenever a file in the config directory is added, removed or
+// modified, checking every interval until ctx is cancelled. Invalid files are logged and their
+// last good versions stay in use.
+func (l *ConfigLoader) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if interval <= 0 {
+		interval = DefaultConfigReloadInterval
+	}
+	logger = logger.With("component", "config_loader", "path", l.path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 
-		if _, exists := configs[config.ReportType]; exists {
-			return fmt.Errorf("duplicate reportType '%s' found in %s", config.ReportType, path)
+		_, digest, err := scanConfigDir(l.path)
+		l.mu.RLock()
+		unchanged := err == nil && digest == l.digest
+		l.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+		if err := l.Reload(); err != nil {
+			logger.Error("Ingestion configs reloaded with errors", "error", err)
+			continue
 		}
+		logger.Info("Ingestion configs reloaded", "report_types", l.Status().ReportTypes)
+	}
+}
 
-		configs[config.ReportType] = config
+// scanConfigDir lists the config files under dir and returns them sorted, with a digest of the
+// names, sizes and modification times of all the YAML files, item types included, that changes
+// whenever a file does.
+func scanConfigDir(dir string) ([]string, string, error) {
+	var paths []string
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(d.Name()) != ".yaml" && filepath.Ext(d.Name()) != ".yml") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Item type declarations aren't configs, but a change to them is a reason to reload
+		if d.Name() != ItemTypesFile {
+			paths = append(paths, path)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
 		return nil
 	})
-
 	if err != nil {
-		return nil, fmt.Errorf("error walking config directory %s: %w", configPath, err)
+		return nil, "", err
 	}
+	return paths, hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	if len(configs) == 0 {
-		slog.Warn("No ingestion configs were loaded.", "path", configPath)
+// readConfigFile parses and lints one config file. Any problem LintConfig finds rejects the file.
+func readConfigFile(path string, opts LintOptions) (IngestionConfig, error) {
+	slog.Info("Loading ingestion config", "file", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return IngestionConfig{}, fmt.Errorf("failed to read config file %s: %w", path, err)
 	}
-
-	return &ConfigLoader{configs: configs}, nil
+	// The issues name the file, so they are returned as they are
+	config, issues := LintConfig(path, data, opts)
+	if len(issues) > 0 {
+		return config, issues
+	}
+	return config, nil
 }
 
-
 // GetConfig retrieves a validated configuration by its report type.
 func (l *ConfigLoader) GetConfig(reportType string) (IngestionConfig, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	config, ok := l.configs[reportType]
 	return config, ok
 }
+
+// sourceFile returns the file a report type's config was loaded from.
+func (l *ConfigLoader) sourceFile(reportType string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.owners[reportType]
+}
+
+// Configs returns every loaded configuration, ordered by report type.
+func (l *ConfigLoader) Configs() []IngestionConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	configs := make([]IngestionConfig, 0, len(l.configs))
+	for _, config := range l.configs {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ReportType < configs[j].ReportType })
+	return configs
+}
+
+// Loaded describes every loaded configuration, ordered by report type.
+func (l *ConfigLoader) Loaded() []LoadedConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	loaded := make([]LoadedConfig, 0, len(l.files))
+	for path, file := range l.files {
+		loaded = append(loaded, LoadedConfig{
+			ReportType:     file.config.ReportType,
+			ItemType:       file.config.ItemType,
+			File:           path,
+			Version:        file.config.Version,
+			ContentVersion: file.version,
+			LoadedAt:       file.loadedAt,
+		})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].ReportType < loaded[j].ReportType })
+	return loaded
+}
+
+// ItemTypes returns the item types declared alongside the configs, ordered by name.
+func (l *ConfigLoader) ItemTypes() []ItemTypeDefinition {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]ItemTypeDefinition(nil), l.itemTypes...)
+}
+
+// Status reports the outcome of the last reload.
+func (l *ConfigLoader) Status() ConfigLoaderStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.status
+}
+
+// ConfigDocument returns the config as the generic document its YAML describes, with the YAML
+// field names, e.g. for returning it as JSON.
+func ConfigDocument(config IngestionConfig) (map[string]any, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return doc, nil
+}
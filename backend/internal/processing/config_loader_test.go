@@ -0,0 +1,96 @@
+package processing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, path, reportType, header string) {
+	t.Helper()
+	data := fmt.Sprintf(`report_type: %q
+item_type: "INSURANCE_CLAIM"
+business_key: ["id"]
+scope_field: "ID"
+column_mappings:
+  - csv_header: "ID"
+    json_field: "id"
+  - csv_header: %q
+    json_field: "name"
+`, reportType, header)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+}
+
+func TestConfigLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	claims := filepath.Join(dir, "claims.yaml")
+	writeTestConfig(t, claims, "CLAIMS", "Name")
+
+	loader, err := NewConfigLoader(dir)
+	require.NoError(t, err)
+	first := loader.Loaded()
+	require.Len(t, first, 1)
+	assert.Equal(t, claims, first[0].File)
+
+	// An invalid edit keeps the last good version in place
+	require.NoError(t, os.WriteFile(claims, []byte("report_type: [unterminated"), 0o644))
+	assert.Error(t, loader.Reload())
+	config, ok := loader.GetConfig("CLAIMS")
+	require.True(t, ok)
+	assert.Equal(t, "Name", config.ColumnMappings[1].CSVHeader)
+	status := loader.Status()
+	require.Len(t, status.FileErrors, 1)
+	assert.Equal(t, claims, status.FileErrors[0].File)
+	assert.True(t, status.FileErrors[0].Kept)
+	assert.NotEmpty(t, status.LastError)
+
+	// A valid edit and a new file are swapped in, and the error clears
+	writeTestConfig(t, claims, "CLAIMS", "Claimant")
+	policies := filepath.Join(dir, "policies.yml")
+	writeTestConfig(t, policies, "POLICIES", "Name")
+	require.NoError(t, loader.Reload())
+	config, _ = loader.GetConfig("CLAIMS")
+	assert.Equal(t, "Claimant", config.ColumnMappings[1].CSVHeader)
+	assert.NotEqual(t, first[0].ContentVersion, loader.Loaded()[0].ContentVersion)
+	assert.Len(t, loader.Configs(), 2)
+	assert.Empty(t, loader.Status().LastError)
+
+	// A file claiming a loaded report type doesn't displace its owner
+	duplicate := filepath.Join(dir, "a_claims_copy.yaml")
+	writeTestConfig(t, duplicate, "CLAIMS", "Other")
+	assert.Error(t, loader.Reload())
+	config, _ = loader.GetConfig("CLAIMS")
+	assert.Equal(t, "Claimant", config.ColumnMappings[1].CSVHeader)
+	require.Len(t, loader.Status().FileErrors, 1)
+	assert.Equal(t, duplicate, loader.Status().FileErrors[0].File)
+
+	// Removed files are unloaded
+	require.NoError(t, os.Remove(duplicate))
+	require.NoError(t, os.Remove(policies))
+	require.NoError(t, loader.Reload())
+	_, ok = loader.GetConfig("POLICIES")
+	assert.False(t, ok)
+	assert.Len(t, loader.Configs(), 1)
+}
+
+func TestNewConfigLoaderRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, "claims.yaml"), "CLAIMS", "Name")
+	writeTestConfig(t, filepath.Join(dir, "copy.yaml"), "CLAIMS", "Name")
+
+	_, err := NewConfigLoader(dir)
+	assert.ErrorContains(t, err, "duplicate reportType 'CLAIMS'")
+}
+
+func TestConfigDocument(t *testing.T) {
+	doc, err := ConfigDocument(IngestionConfig{ReportType: "CLAIMS", ItemType: "TEST_ITEM", ColumnMappings: []ColumnMapping{{CSVHeader: "ID", JSONField: "id"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "CLAIMS", doc["report_type"])
+	mappings, ok := doc["column_mappings"].([]any)
+	require.True(t, ok)
+	assert.Equal(t, "id", mappings[0].(map[string]any)["json_field"])
+}
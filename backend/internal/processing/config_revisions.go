@@ -0,0 +1,84 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// RecordConfigRevisions stores a revision of each loaded config whose content has not been stored
+// before. It is meant to run after every config reload.
+func (s *Service) RecordConfigRevisions(ctx context.Context) error {
+	var errs []error
+	for _, config := range s.configLoader.Configs() {
+		if _, err := s.recordConfigRevision(ctx, config, s.configLoader.sourceFile(config.ReportType)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", config.ReportType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recordConfigRevision returns the stored revision with the config's content, storing a new one
+// if there is none.
+func (s *Service) recordConfigRevision(ctx context.Context, config IngestionConfig, sourceFile string) (repository.IngestionConfigRevision, error) {
+	hash, err := configHash(config)
+	if err != nil {
+		return repository.IngestionConfigRevision{}, err
+	}
+	lookup := repository.GetIngestionConfigRevisionByHashParams{ReportType: config.ReportType, ContentHash: hash}
+	revision, err := s.queries.GetIngestionConfigRevisionByHash(ctx, lookup)
+	if err == nil {
+		return revision, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return revision, fmt.Errorf("failed to look up config revision: %w", err)
+	}
+
+	doc, err := ConfigDocument(config)
+	if err != nil {
+		return revision, err
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return revision, fmt.Errorf("failed to encode config revision: %w", err)
+	}
+
+	tx, err := s.dbpool.Begin(ctx)
+	if err != nil {
+		return revision, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.queries.WithTx(tx)
+	if err := qtx.LockIngestionConfigRevisions(ctx, config.ReportType); err != nil {
+		return revision, fmt.Errorf("failed to lock config revisions: %w", err)
+	}
+
+	// Another worker may have stored the same content while this one waited for the lock
+	revision, err = qtx.GetIngestionConfigRevisionByHash(ctx, lookup)
+	if err == nil {
+		return revision, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return revision, fmt.Errorf("failed to look up config revision: %w", err)
+	}
+	revision, err = qtx.CreateIngestionConfigRevision(ctx, repository.CreateIngestionConfigRevisionParams{
+		ReportType:  config.ReportType,
+		Version:     pgtype.Text{String: config.Version, Valid: config.Version != ""},
+		ContentHash: hash,
+		Content:     content,
+		SourceFile:  pgtype.Text{String: sourceFile, Valid: sourceFile != ""},
+	})
+	if err != nil {
+		return revision, fmt.Errorf("failed to store config revision: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return revision, fmt.Errorf("failed to store config revision: %w", err)
+	}
+	s.logger.InfoContext(ctx, "Stored new config revision", "report_type", config.ReportType, "revision", revision.Revision, "version", config.Version)
+	return revision, nil
+}
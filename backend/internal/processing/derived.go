@@ -0,0 +1,73 @@
+package processing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// applyDerivedFields computes the config's derived fields in order and adds them to processedData,
+// which is keyed by json_field and already holds the transformed column values.
+func (p *GenericProcessor) applyDerivedFields(processedData map[string]interface{}) error {
+	for _, field := range p.config.DerivedFields {
+		var value interface{}
+		switch {
+		case field.Constant != nil:
+			value = *field.Constant
+		case field.SourceField != "":
+			value = processedData[field.SourceField]
+		default:
+			parts := make([]string, len(field.Concat))
+			for i, name := range field.Concat {
+				parts[i] = stringValue(processedData[name])
+			}
+			value = strings.Join(parts, field.Separator)
+		}
+
+		if isBlankValue(value) && field.Default != "" {
+			value = field.Default
+		}
+
+		if len(field.Transforms) > 0 && !isBlankValue(value) {
+			transformed, err := applyTransforms(value, field.Transforms)
+			if err != nil {
+				return fmt.Errorf("failed to compute derived field '%s' from value '%v': %w", field.JSONField, value, err)
+			}
+			value = transformed
+		}
+
+		processedData[field.JSONField] = value
+	}
+	return nil
+}
+
+// isBlankValue reports whether a processed value is missing or an empty string.
+func isBlankValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	str, ok := value.(string)
+	return ok && strings.TrimSpace(str) == ""
+}
+
+// stringValue renders a processed value as text for concatenation. Dates without a time part
+// keep the to_date default layout so they read the way they usually appear in source files.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case decimal.Decimal:
+		return v.String()
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,107 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDerivedFields(t *testing.T) {
+	source := "AGENCY_EXPORT"
+	testConfig := IngestionConfig{
+		ReportType:   "TEST_DERIVED",
+		ItemType:     "INSURANCE_CLAIM",
+		ScopeField:   "scope",
+		BusinessKey:  []string{"policy_claim"},
+		EmbedContent: &EmbedContent{SourceColumns: []string{"summary"}},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "Policy", JSONField: "policy"},
+			{CSVHeader: "Claim", JSONField: "claim"},
+			{CSVHeader: "Date_of_Loss", JSONField: "date_of_loss", Attempts: []ProcessingAttempt{{Transforms: []string{"to_date:01/02/2006"}}, {}}},
+			{CSVHeader: "Adjuster", JSONField: "adjuster", Validation: ValidationRule{Required: true}},
+		},
+		DerivedFields: []DerivedField{
+			{JSONField: "reporting_source", Constant: &source},
+			{JSONField: "policy_claim", Concat: []string{"policy", "claim"}, Separator: "/"},
+			{JSONField: "loss_year", SourceField: "date_of_loss", Transforms: []string{"format_date:2006", "to_integer"}},
+			{JSONField: "adjuster", SourceField: "adjuster", Default: "UNASSIGNED"},
+			{JSONField: "scope", SourceField: "policy", Transforms: []string{"to_uppercase"}},
+			{JSONField: "summary", Concat: []string{"claim", "date_of_loss"}, Separator: " on "},
+		},
+	}
+	assert.NoError(t, testConfig.Validate())
+
+	csvData := strings.Join([]string{
+		"Policy,Claim,Date_of_Loss,Adjuster",
+		"pol-1,CLM-9,03/15/2025,",
+		"pol-2,CLM-10,,Dana",
+	}, "\n")
+
+	var embedded []string
+	embedder := func(ctx context.Context, texts []string) ([][]float32, error) {
+		embedded = append(embedded, texts...)
+		vectors := make([][]float32, len(texts))
+		for i := range vectors {
+			vectors[i] = []float32{1}
+		}
+		return vectors, nil
+	}
+
+	sink := &recordingSink{}
+	result, err := NewGenericProcessor(testConfig).WithOptions(ProcessingOptions{Workers: 1}).Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, embedder, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.ItemsProcessed)
+	if !assert.Len(t, sink.itemBatches, 1) || !assert.Len(t, sink.itemBatches[0], 2) {
+		return
+	}
+
+	first := sink.itemBatches[0][0]
+	assert.Equal(t, "pol-1/CLM-9", first.BusinessKey.String)
+	assert.Equal(t, "POL-1", first.Scope.String)
+	assert.JSONEq(t, `{
+		"policy": "pol-1",
+		"claim": "CLM-9",
+		"date_of_loss": "2025-03-15T00:00:00Z",
+		"adjuster": "UNASSIGNED",
+		"reporting_source": "AGENCY_EXPORT",
+		"policy_claim": "pol-1/CLM-9",
+		"loss_year": 2025,
+		"scope": "POL-1",
+		"summary": "CLM-9 on 2025-03-15"
+	}`, string(first.CustomProperties))
+
+	second := sink.itemBatches[0][1]
+	assert.Contains(t, string(second.CustomProperties), `"loss_year":""`)
+	assert.Equal(t, []string{"CLM-9 on 2025-03-15", "CLM-10 on"}, embedded)
+}
+
+func TestDerivedFieldValidation(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:     "TEST_DERIVED",
+		ItemType:       "INSURANCE_CLAIM",
+		ScopeField:     "Policy",
+		BusinessKey:    []string{"policy"},
+		ColumnMappings: []ColumnMapping{{CSVHeader: "Policy", JSONField: "policy"}},
+	}
+
+	testConfig.DerivedFields = []DerivedField{{JSONField: "key", Concat: []string{"policy", "claim"}}}
+	err := testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "refers to 'claim'")
+	}
+
+	source := "X"
+	testConfig.DerivedFields = []DerivedField{{JSONField: "key", Constant: &source, SourceField: "policy"}}
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exactly one of")
+	}
+
+	testConfig.DerivedFields = []DerivedField{{JSONField: "key", SourceField: "policy", Transforms: []string{"to_shouting"}}}
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown transform 'to_shouting'")
+	}
+}
@@ -0,0 +1,377 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// Supported values for IngestionConfig.DuplicatePolicy
+const (
+	DuplicatePolicyTriage    = "triage"     // every row sharing a business key is triaged
+	DuplicatePolicyKeepFirst = "keep_first" // the first row wins, later ones are dropped
+	DuplicatePolicyKeepLast  = "keep_last"  // the last row wins, earlier ones are dropped
+	DuplicatePolicyMerge     = "merge"      // rows are combined, later non-blank values winning
+)
+
+// duplicateTracker remembers the business keys seen so far in a file, so that rows repeating a key
+// are resolved by the config's duplicate_policy instead of reaching UpsertItems twice. Only the
+// first row number of each key is kept; row lists are kept for the keys that actually repeat.
+//
+// Batches are written as they are processed, so an occurrence in an earlier batch may already be
+// loaded when its duplicate turns up. keep_last lets the later batch update the item in the same
+// transaction, and merge combines the later rows with the fields the sink loaded. Under triage the
+// sink takes the loaded item back and the earlier row is triaged with the rest. The insert modes
+// can't update an item they have just loaded, so validateLoadMode rejects keep_last and merge there.
+type duplicateTracker struct {
+	policy  string
+	seen    map[string]keyState
+	repeats map[string][]int // row numbers of the keys seen more than once, in file order
+}
+
+type keyState struct {
+	row    int  // first row with the key
+	loaded bool // an item for the key was written and hasn't been retracted
+}
+
+func newDuplicateTracker(policy string) *duplicateTracker {
+	if policy == "" {
+		policy = DuplicatePolicyTriage
+	}
+	return &duplicateTracker{
+		policy:  policy,
+		seen:    make(map[string]keyState),
+		repeats: make(map[string][]int),
+	}
+}
+
+// add records a row with the key and reports whether the key was loaded by an earlier batch.
+func (t *duplicateTracker) add(key string, row int) (loadedEarlier bool) {
+	state, seen := t.seen[key]
+	if !seen {
+		t.seen[key] = keyState{row: row}
+		return false
+	}
+	if _, repeated := t.repeats[key]; !repeated {
+		t.repeats[key] = []int{state.row}
+	}
+	t.repeats[key] = append(t.repeats[key], row)
+	return state.loaded
+}
+
+// rows returns the row numbers seen with the key.
+func (t *duplicateTracker) rows(key string) []int {
+	if rows, ok := t.repeats[key]; ok {
+		return rows
+	}
+	return []int{t.seen[key].row}
+}
+
+func (t *duplicateTracker) setLoaded(key string, loaded bool) {
+	state := t.seen[key]
+	state.loaded = loaded
+	t.seen[key] = state
+}
+
+// resolveDuplicates applies the duplicate policy to a processed batch, leaving at most one item per
+// business key. Outcomes are updated in place and stay in row order. Under triage it returns the
+// triage rows of earlier rows whose items the sink took back.
+func (p *GenericProcessor) resolveDuplicates(
+	ctx context.Context,
+	outcomes []rowOutcome,
+	dups *duplicateTracker,
+	layout *fileLayout,
+	sink BatchSink,
+) ([]TriageRow, error) {
+	lastInBatch := make(map[string]int)
+	var loadedEarlier []string
+	for i, outcome := range outcomes {
+		if outcome.item == nil {
+			continue
+		}
+		key := outcome.item.BusinessKey.String
+		loaded := dups.add(key, outcome.row.RowNumber)
+		if _, inBatch := lastInBatch[key]; !inBatch && loaded {
+			loadedEarlier = append(loadedEarlier, key)
+		}
+		lastInBatch[key] = i
+	}
+
+	var retracted []TriageRow
+	var earlierFields map[string]map[string]interface{}
+	if len(loadedEarlier) > 0 {
+		var err error
+		switch dups.policy {
+		case DuplicatePolicyTriage:
+			if retracted, err = p.retractLoaded(ctx, loadedEarlier, dups, layout, sink, outcomes[0].row.Sheet); err != nil {
+				return nil, err
+			}
+		case DuplicatePolicyMerge:
+			if earlierFields, err = p.loadedFields(ctx, loadedEarlier, sink); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	merged := make(map[string]map[string]interface{})
+	for i := range outcomes {
+		outcome := &outcomes[i]
+		if outcome.item == nil {
+			continue
+		}
+		key := outcome.item.BusinessKey.String
+		rows := dups.rows(key)
+		rowNumber := outcome.row.RowNumber
+
+		switch dups.policy {
+		case DuplicatePolicyTriage:
+			if len(rows) == 1 {
+				continue
+			}
+			*outcome = rowOutcome{triage: &TriageRow{
+				RowNumber:      rowNumber,
+				Location:       outcome.row.Location(-1),
+				OriginalRecord: createOriginalRecordMap(outcome.row.Values, layout.headers),
+				FailureReason:  fmt.Sprintf("Duplicate business key '%s': also on row(s) %s", key, joinRowNumbers(rows, rowNumber)),
+			}}
+
+		case DuplicatePolicyKeepFirst:
+			if rows[0] != rowNumber {
+				*outcome = rowOutcome{duplicate: true}
+			}
+
+		case DuplicatePolicyKeepLast:
+			if lastInBatch[key] != i {
+				*outcome = rowOutcome{duplicate: true}
+			}
+
+		case DuplicatePolicyMerge:
+			fields, seen := merged[key]
+			if !seen {
+				fields = outcome.fields
+				if earlier, ok := earlierFields[key]; ok {
+					fields = earlier
+					mergeFields(fields, outcome.fields)
+				}
+				merged[key] = fields
+			} else {
+				mergeFields(fields, outcome.fields)
+			}
+			if lastInBatch[key] != i {
+				*outcome = rowOutcome{duplicate: true}
+				continue
+			}
+			if len(rows) == 1 {
+				continue
+			}
+			item, err := p.buildItem(rowNumber, fields, layout)
+			if err != nil {
+				*outcome = rowOutcome{triage: &TriageRow{
+					RowNumber:      rowNumber,
+					Location:       outcome.row.Location(-1),
+					OriginalRecord: createOriginalRecordMap(outcome.row.Values, layout.headers),
+					FailureReason:  fmt.Sprintf("failed to merge rows %s with duplicate business key '%s': %s", joinRowNumbers(rows, -1), key, err.Error()),
+				}}
+				continue
+			}
+			outcome.item = item
+			outcome.embedText = p.embedText(fields)
+		}
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.item != nil {
+			dups.setLoaded(outcome.item.BusinessKey.String, true)
+		}
+	}
+	return retracted, nil
+}
+
+// retractLoaded has the sink take back the items earlier batches loaded for keys that turned up
+// again, and triages the rows they came from. Those rows are long gone, so their original record
+// is rebuilt from the loaded values. Keys the sink had nothing to take back for, such as rows
+// append_only skipped, are left alone.
+func (p *GenericProcessor) retractLoaded(
+	ctx context.Context,
+	keys []string,
+	dups *duplicateTracker,
+	layout *fileLayout,
+	sink BatchSink,
+	sheet string,
+) ([]TriageRow, error) {
+	loaded, err := sink.RetractItems(ctx, p.config.ItemType, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take back items loaded from earlier batches: %w", err)
+	}
+
+	var rows []TriageRow
+	for _, key := range keys {
+		dups.setLoaded(key, false)
+		props, ok := loaded[key]
+		if !ok {
+			continue
+		}
+		doc, err := decodeProperties(props)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode custom_properties of item '%s': %w", key, err)
+		}
+		record := make(map[string]string, len(layout.headers))
+		for _, header := range layout.headers {
+			record[header] = ""
+		}
+		for _, mapping := range p.config.ColumnMappings {
+			if value, ok := lookupPath(doc, fieldPath(mapping)); ok {
+				record[mapping.CSVHeader] = stringifyJSONValue(value)
+			}
+		}
+
+		earlier := SourceRecord{RowNumber: dups.seen[key].row, Sheet: sheet}
+		rows = append(rows, TriageRow{
+			RowNumber:      earlier.RowNumber,
+			Location:       earlier.Location(-1),
+			OriginalRecord: record,
+			FailureReason: fmt.Sprintf("Duplicate business key '%s': also on row(s) %s; the row was loaded from an earlier batch and has been taken back, its values are shown as they were loaded",
+				key, joinRowNumbers(dups.rows(key), earlier.RowNumber)),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].RowNumber < rows[j].RowNumber })
+	return rows, nil
+}
+
+// loadedFields reads back the fields earlier batches loaded for keys that turned up again, keyed by
+// json_field like the processed fields of a row, so later rows can be merged into them.
+func (p *GenericProcessor) loadedFields(ctx context.Context, keys []string, sink BatchSink) (map[string]map[string]interface{}, error) {
+	loaded, err := sink.LoadedItems(ctx, p.config.ItemType, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read items loaded from earlier batches: %w", err)
+	}
+	fields := make(map[string]map[string]interface{}, len(loaded))
+	for key, props := range loaded {
+		doc, err := decodeProperties(props)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode custom_properties of item '%s': %w", key, err)
+		}
+		values := make(map[string]interface{})
+		for _, mapping := range p.config.ColumnMappings {
+			if value, ok := lookupPath(doc, fieldPath(mapping)); ok {
+				values[mapping.JSONField] = value
+			}
+		}
+		for _, field := range p.config.DerivedFields {
+			if value, ok := lookupPath(doc, fieldPath(ColumnMapping{JSONField: field.JSONField, LiteralJSONField: field.LiteralJSONField})); ok {
+				values[field.JSONField] = value
+			}
+		}
+		fields[key] = values
+	}
+	return fields, nil
+}
+
+// mergeFields copies the non-blank values of a later row over the combined fields of its business key.
+func mergeFields(merged, later map[string]interface{}) {
+	for field, value := range later {
+		if isBlankValue(value) {
+			if _, exists := merged[field]; exists {
+				continue
+			}
+		}
+		merged[field] = value
+	}
+}
+
+// joinRowNumbers lists row numbers in ascending order, leaving out the given row.
+func joinRowNumbers(rows []int, except int) string {
+	sorted := append([]int(nil), rows...)
+	sort.Ints(sorted)
+	parts := make([]string, 0, len(sorted))
+	for _, row := range sorted {
+		if row != except {
+			parts = append(parts, strconv.Itoa(row))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// LoadedItems returns the custom_properties of the items with the given business keys, as this
+// run's earlier batches left them.
+func (js *jobSink) LoadedItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	rows, err := js.qtx.ListItemPropertiesByBusinessKeys(ctx, repository.ListItemPropertiesByBusinessKeysParams{
+		ItemType:     repository.ItemType(itemType),
+		BusinessKeys: businessKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up loaded items: %w", err)
+	}
+	loaded := make(map[string][]byte, len(rows))
+	for _, row := range rows {
+		loaded[row.BusinessKey.String] = row.CustomProperties
+	}
+	return loaded, nil
+}
+
+// RetractItems undoes what this run did to the items with the given business keys: items it
+// inserted are deleted, items it updated are put back as its audit rows found them, and the item
+// events and lineage it wrote for them are removed. It returns the custom_properties the run had
+// loaded for each item it took back.
+func (js *jobSink) RetractItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	jobID := pgtype.UUID{Bytes: js.jobID, Valid: true}
+	changed, err := js.qtx.ListIngestionRunItemChanges(ctx, repository.ListIngestionRunItemChangesParams{
+		JobID:        jobID,
+		AfterEventID: js.runStart.EventID,
+		ItemType:     repository.ItemType(itemType),
+		BusinessKeys: businessKeys,
+		AfterAuditID: js.runStart.AuditID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the items this run changed: %w", err)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	retracted := make(map[string][]byte, len(changed))
+	itemIDs := make([]int64, 0, len(changed))
+	var insertedIDs []int64
+	var restore repository.RestoreItemsFromAuditParams
+	for _, row := range changed {
+		retracted[row.BusinessKey.String] = row.CustomProperties
+		itemIDs = append(itemIDs, row.ID)
+		switch {
+		case row.Inserted:
+			insertedIDs = append(insertedIDs, row.ID)
+			js.changes.Inserted--
+			continue
+		case row.Updated:
+			js.changes.Updated--
+		default:
+			js.changes.Unchanged--
+		}
+		restore.ItemIds = append(restore.ItemIds, row.ID)
+		restore.OldData = append(restore.OldData, string(row.OldData))
+	}
+
+	if err := js.qtx.DeleteIngestionRunItemRecords(ctx, repository.DeleteIngestionRunItemRecordsParams{
+		ItemIds:        itemIDs,
+		JobID:          jobID,
+		AfterEventID:   js.runStart.EventID,
+		AfterLineageID: js.runStart.LineageID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to remove the events and lineage of taken back items: %w", err)
+	}
+	if len(restore.ItemIds) > 0 {
+		if _, err := js.qtx.RestoreItemsFromAudit(ctx, restore); err != nil {
+			return nil, fmt.Errorf("failed to restore taken back items: %w", err)
+		}
+	}
+	if len(insertedIDs) > 0 {
+		if _, err := js.qtx.DeleteItems(ctx, insertedIDs); err != nil {
+			return nil, fmt.Errorf("failed to delete taken back items: %w", err)
+		}
+	}
+	return retracted, nil
+}
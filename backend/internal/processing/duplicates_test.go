@@ -0,0 +1,130 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicateBusinessKeys(t *testing.T) {
+	csvData := strings.Join([]string{
+		"claim_id,state,adjuster,amount",
+		"C1,TX,Ann,100", // row 2
+		"C2,TX,Bob,200", // row 3
+		"C1,TX,,150",    // row 4
+		"C3,CA,Cy,300",  // row 5
+		"C1,NM,Dee,",    // row 6
+	}, "\n")
+
+	newConfig := func(policy string) IngestionConfig {
+		return IngestionConfig{
+			ReportType:      "TEST_DUPLICATES",
+			ItemType:        "INSURANCE_CLAIM",
+			ScopeField:      "state",
+			BusinessKey:     []string{"claim_id"},
+			DuplicatePolicy: policy,
+			ColumnMappings: []ColumnMapping{
+				{CSVHeader: "claim_id", JSONField: "claim_id"},
+				{CSVHeader: "state", JSONField: "state"},
+				{CSVHeader: "adjuster", JSONField: "adjuster"},
+				{CSVHeader: "amount", JSONField: "amount"},
+			},
+		}
+	}
+
+	run := func(t *testing.T, policy string, batchSize int) (*ProcessingResult, *recordingSink) {
+		config := newConfig(policy)
+		assert.NoError(t, config.Validate())
+		sink := &recordingSink{}
+		result, err := NewGenericProcessor(config).WithOptions(ProcessingOptions{BatchSize: batchSize}).
+			Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, nil, sink)
+		assert.NoError(t, err)
+		return result, sink
+	}
+
+	// itemsByKey flattens the written batches, checking that no batch repeats a business key.
+	itemsByKey := func(t *testing.T, sink *recordingSink) map[string][]string {
+		written := make(map[string][]string)
+		for _, batch := range sink.itemBatches {
+			inBatch := make(map[string]bool)
+			for _, item := range batch {
+				key := item.BusinessKey.String
+				assert.False(t, inBatch[key], "business key %s written twice in one batch", key)
+				inBatch[key] = true
+				written[key] = append(written[key], string(item.CustomProperties))
+			}
+		}
+		return written
+	}
+
+	t.Run("triage within a batch", func(t *testing.T) {
+		result, sink := run(t, "", 10)
+		assert.Equal(t, 3, result.RowsTriaged)
+		written := itemsByKey(t, sink)
+		assert.NotContains(t, written, "C1")
+		assert.Len(t, written, 2)
+		if assert.Len(t, sink.triage, 3) {
+			assert.Equal(t, 2, sink.triage[0].RowNumber)
+			assert.Equal(t, "Duplicate business key 'C1': also on row(s) 4, 6", sink.triage[0].FailureReason)
+			assert.Equal(t, "Duplicate business key 'C1': also on row(s) 2, 6", sink.triage[1].FailureReason)
+			assert.Equal(t, "Duplicate business key 'C1': also on row(s) 2, 4", sink.triage[2].FailureReason)
+		}
+	})
+
+	t.Run("triage across batches", func(t *testing.T) {
+		result, sink := run(t, DuplicatePolicyTriage, 2)
+		// Row 2 was loaded by the first batch and is taken back when row 4 repeats its key
+		written := itemsByKey(t, sink)
+		assert.NotContains(t, written, "C1")
+		assert.Len(t, written, 2)
+		assert.Equal(t, 2, result.ItemsProcessed)
+		assert.Equal(t, int64(2), result.RowsUpserted)
+		assert.Equal(t, 3, result.RowsTriaged)
+		if assert.Len(t, sink.triage, 3) {
+			assert.Equal(t, 2, sink.triage[0].RowNumber)
+			assert.Contains(t, sink.triage[0].FailureReason, "Duplicate business key 'C1': also on row(s) 4; the row was loaded from an earlier batch and has been taken back")
+			assert.Equal(t, map[string]string{"claim_id": "C1", "state": "TX", "adjuster": "Ann", "amount": "100"}, sink.triage[0].OriginalRecord)
+			assert.Equal(t, 4, sink.triage[1].RowNumber)
+			assert.Equal(t, "Duplicate business key 'C1': also on row(s) 2", sink.triage[1].FailureReason)
+			assert.Equal(t, 6, sink.triage[2].RowNumber)
+			assert.Equal(t, "Duplicate business key 'C1': also on row(s) 2, 4", sink.triage[2].FailureReason)
+		}
+	})
+
+	t.Run("keep first", func(t *testing.T) {
+		result, sink := run(t, DuplicatePolicyKeepFirst, 2)
+		assert.Equal(t, 2, result.DuplicateRowsDropped)
+		assert.Empty(t, sink.triage)
+		written := itemsByKey(t, sink)
+		if assert.Len(t, written["C1"], 1) {
+			assert.Contains(t, written["C1"][0], `"adjuster":"Ann"`)
+		}
+	})
+
+	t.Run("keep last", func(t *testing.T) {
+		result, sink := run(t, DuplicatePolicyKeepLast, 10)
+		assert.Equal(t, 2, result.DuplicateRowsDropped)
+		written := itemsByKey(t, sink)
+		if assert.Len(t, written["C1"], 1) {
+			assert.Contains(t, written["C1"][0], `"adjuster":"Dee"`)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		for _, batchSize := range []int{10, 2} {
+			result, sink := run(t, DuplicatePolicyMerge, batchSize)
+			assert.Empty(t, sink.triage)
+			written := itemsByKey(t, sink)["C1"]
+			// Later non-blank values win; the final write for the key holds every field.
+			assert.JSONEq(t, `{"claim_id":"C1","state":"NM","adjuster":"Dee","amount":"150"}`, written[len(written)-1])
+			assert.Equal(t, 3-len(written), result.DuplicateRowsDropped)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		config := newConfig("keep_both")
+		assert.Error(t, config.Validate())
+	})
+}
@@ -0,0 +1,243 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/embedding"
+	"github.com/jjckrbbt/catalyst/backend/internal/interfaces"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/pgvector/pgvector-go"
+	"golang.org/x/time/rate"
+)
+
+// EmbeddingOptions controls how embeddings are requested while a file is processed
+type EmbeddingOptions struct {
+	BatchSize      int           // texts per embedding request, at most MaxEmbedBatchSize
+	Workers        int           // concurrent embedding requests
+	MaxRetries     int           // retries per request after the first attempt
+	InitialBackoff time.Duration // doubled after every failed attempt
+	RateLimit      float64       // requests per second across all workers; 0 means unlimited
+}
+
+const (
+	DefaultEmbedBatchSize      = 64
+	DefaultEmbedWorkers        = 4
+	DefaultEmbedMaxRetries     = 3
+	DefaultEmbedInitialBackoff = 500 * time.Millisecond
+	MaxEmbedBatchSize          = 256 // the most texts the embedding service accepts in one request
+	maxEmbedBackoff            = 30 * time.Second
+)
+
+// PendingEmbedding is an item that was loaded without a vector because its embedding could not be
+// generated. It is recorded so the embedding can be backfilled later.
+type PendingEmbedding struct {
+	BusinessKey string
+	Text        string
+	Error       string
+}
+
+// batchEmbedder splits texts into requests for a BatchEmbedderFunc and runs them on a bounded
+// worker pool, retrying failed requests with exponential backoff under a shared rate limit.
+type batchEmbedder struct {
+	fn      interfaces.BatchEmbedderFunc
+	opts    EmbeddingOptions
+	limiter *rate.Limiter
+}
+
+func newBatchEmbedder(fn interfaces.BatchEmbedderFunc, opts EmbeddingOptions) *batchEmbedder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultEmbedBatchSize
+	}
+	if opts.BatchSize > MaxEmbedBatchSize {
+		opts.BatchSize = MaxEmbedBatchSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultEmbedWorkers
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DefaultEmbedMaxRetries
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DefaultEmbedInitialBackoff
+	}
+
+	limit := rate.Inf
+	if opts.RateLimit > 0 {
+		limit = rate.Limit(opts.RateLimit)
+	}
+	return &batchEmbedder{fn: fn, opts: opts, limiter: rate.NewLimiter(limit, 1)}
+}
+
+// embed returns one vector per text. A text whose request still fails after all retries gets a
+// nil vector and the last error in the matching position of errs.
+func (e *batchEmbedder) embed(ctx context.Context, texts []string) ([][]float32, []error) {
+	vectors := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+
+	type chunk struct{ start, end int }
+	var chunks []chunk
+	for start := 0; start < len(texts); start += e.opts.BatchSize {
+		end := start + e.opts.BatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		chunks = append(chunks, chunk{start, end})
+	}
+
+	workers := e.opts.Workers
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	work := make(chan chunk)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				result, err := e.embedWithRetry(ctx, texts[c.start:c.end])
+				for i := c.start; i < c.end; i++ {
+					if err != nil {
+						errs[i] = err
+					} else {
+						vectors[i] = result[i-c.start]
+					}
+				}
+			}
+		}()
+	}
+	for _, c := range chunks {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+
+	return vectors, errs
+}
+
+func (e *batchEmbedder) embedWithRetry(ctx context.Context, texts []string) ([][]float32, error) {
+	backoff := e.opts.InitialBackoff
+	var lastErr error
+	for attempt := 0; attempt <= e.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			slog.WarnContext(ctx, "Retrying embedding request", "attempt", attempt, "texts", len(texts), "backoff", backoff, "error", lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxEmbedBackoff {
+				backoff = maxEmbedBackoff
+			}
+		}
+
+		if err := e.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		vectors, err := e.fn(ctx, texts)
+		if err == nil && len(vectors) != len(texts) {
+			err = fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+		}
+		if err == nil {
+			return vectors, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !retryable(err) {
+			return nil, fmt.Errorf("embedding request was rejected: %w", err)
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("embedding failed after %d attempts: %w", e.opts.MaxRetries+1, lastErr)
+}
+
+// retryable reports whether another attempt at a failed embedding request could succeed. A request
+// the embedding service rejected fails the same way every time.
+func retryable(err error) bool {
+	var status *embedding.StatusError
+	return !errors.As(err, &status) || status.Retryable()
+}
+
+// EmbeddingBackfillResult summarises a BackfillEmbeddings run.
+type EmbeddingBackfillResult struct {
+	ItemsAttempted int
+	ItemsEmbedded  int
+	ItemsFailed    int
+}
+
+// BackfillEmbeddings generates the vectors of items that ingestion loaded without one. Items are
+// read in pages of batchSize, least recently tried first, and each is tried once per run; items
+// that have already failed maxAttempts times are left for someone to look at.
+func BackfillEmbeddings(ctx context.Context, queries repository.Querier, embedder interfaces.BatchEmbedderFunc, opts EmbeddingOptions, batchSize, maxAttempts int, logger *slog.Logger) (EmbeddingBackfillResult, error) {
+	var result EmbeddingBackfillResult
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	embedBatches := newBatchEmbedder(embedder, opts)
+
+	// A failed item moves to the back of the queue, so seeing one again means the pass is complete
+	tried := make(map[int64]bool)
+	for {
+		pending, err := queries.ListPendingEmbeddings(ctx, repository.ListPendingEmbeddingsParams{
+			MaxAttempts: int32(maxAttempts),
+			Limit:       int32(batchSize),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to list pending embeddings: %w", err)
+		}
+
+		var page []repository.PendingItemEmbedding
+		for _, p := range pending {
+			if !tried[p.ItemID] {
+				page = append(page, p)
+			}
+		}
+		if len(page) == 0 {
+			return result, nil
+		}
+
+		texts := make([]string, len(page))
+		for i, p := range page {
+			texts[i] = p.SourceText
+			tried[p.ItemID] = true
+		}
+		vectors, errs := embedBatches.embed(ctx, texts)
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("backfill aborted: %w", err)
+		}
+
+		for i, p := range page {
+			result.ItemsAttempted++
+			if errs[i] != nil {
+				result.ItemsFailed++
+				if err := queries.RecordPendingEmbeddingFailure(ctx, repository.RecordPendingEmbeddingFailureParams{
+					ItemID:    p.ItemID,
+					LastError: pgtype.Text{String: errs[i].Error(), Valid: true},
+				}); err != nil {
+					return result, fmt.Errorf("failed to record embedding failure for item %d: %w", p.ItemID, err)
+				}
+				continue
+			}
+			if err := queries.SetItemEmbedding(ctx, repository.SetItemEmbeddingParams{
+				ID:        p.ItemID,
+				Embedding: pgvector.NewVector(vectors[i]),
+			}); err != nil {
+				return result, fmt.Errorf("failed to store embedding for item %d: %w", p.ItemID, err)
+			}
+			if err := queries.DeletePendingEmbedding(ctx, p.ItemID); err != nil {
+				return result, fmt.Errorf("failed to clear pending embedding for item %d: %w", p.ItemID, err)
+			}
+			result.ItemsEmbedded++
+		}
+		logger.Info("Backfilled embedding batch", "attempted", result.ItemsAttempted, "embedded", result.ItemsEmbedded, "failed", result.ItemsFailed)
+	}
+}
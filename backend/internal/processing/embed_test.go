@@ -0,0 +1,156 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/embedding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchEmbedderRetriesFailedRequests(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	fn := func(ctx context.Context, texts []string) ([][]float32, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			return nil, errors.New("service unavailable")
+		}
+		vectors := make([][]float32, len(texts))
+		for i := range texts {
+			vectors[i] = []float32{float32(len(texts[i]))}
+		}
+		return vectors, nil
+	}
+
+	embedder := newBatchEmbedder(fn, EmbeddingOptions{BatchSize: 10, MaxRetries: 2, InitialBackoff: time.Millisecond})
+	vectors, errs := embedder.embed(context.Background(), []string{"a", "bb"})
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, [][]float32{{1}, {2}}, vectors)
+	assert.Equal(t, []error{nil, nil}, errs)
+}
+
+func TestBatchEmbedderSplitsIntoRequests(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	fn := func(ctx context.Context, texts []string) ([][]float32, error) {
+		mu.Lock()
+		sizes = append(sizes, len(texts))
+		mu.Unlock()
+		return make([][]float32, len(texts)), nil
+	}
+
+	embedder := newBatchEmbedder(fn, EmbeddingOptions{BatchSize: 2, Workers: 2})
+	_, errs := embedder.embed(context.Background(), []string{"a", "b", "c", "d", "e"})
+	assert.ElementsMatch(t, []int{2, 2, 1}, sizes)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestBatchEmbedderDoesNotRetryRejectedRequests(t *testing.T) {
+	for status, wantCalls := range map[int]int{413: 1, 400: 1, 429: 3, 503: 3} {
+		calls := 0
+		fn := func(ctx context.Context, texts []string) ([][]float32, error) {
+			calls++
+			return nil, &embedding.StatusError{StatusCode: status, Body: "error"}
+		}
+
+		embedder := newBatchEmbedder(fn, EmbeddingOptions{MaxRetries: 2, InitialBackoff: time.Millisecond})
+		_, errs := embedder.embed(context.Background(), []string{"a"})
+		assert.Equal(t, wantCalls, calls, "status %d", status)
+		assert.Error(t, errs[0])
+	}
+}
+
+func TestBatchEmbedderCapsBatchSize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	fn := func(ctx context.Context, texts []string) ([][]float32, error) {
+		mu.Lock()
+		sizes = append(sizes, len(texts))
+		mu.Unlock()
+		return make([][]float32, len(texts)), nil
+	}
+
+	embedder := newBatchEmbedder(fn, EmbeddingOptions{BatchSize: 1000})
+	embedder.embed(context.Background(), make([]string, 300))
+	assert.ElementsMatch(t, []int{MaxEmbedBatchSize, 300 - MaxEmbedBatchSize}, sizes)
+}
+
+func TestBatchEmbedderRejectsShortResponses(t *testing.T) {
+	fn := func(ctx context.Context, texts []string) ([][]float32, error) {
+		return [][]float32{{1}}, nil
+	}
+
+	embedder := newBatchEmbedder(fn, EmbeddingOptions{MaxRetries: 1, InitialBackoff: time.Millisecond})
+	vectors, errs := embedder.embed(context.Background(), []string{"a", "b"})
+	assert.Nil(t, vectors[0])
+	if assert.Error(t, errs[1]) {
+		assert.Contains(t, errs[1].Error(), "returned 1 vectors for 2 texts")
+	}
+}
+
+func TestProcessQueuesFailedEmbeddings(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:   "TEST_EMBED",
+		ItemType:     "TEST_ITEM",
+		ScopeField:   "team",
+		BusinessKey:  []string{"id"},
+		EmbedContent: &EmbedContent{SourceColumns: []string{"notes"}},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "id", JSONField: "id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "team", JSONField: "team"},
+			{CSVHeader: "notes", JSONField: "notes"},
+		},
+	}
+
+	csvData := strings.Join([]string{
+		"id,team,notes",
+		"1,A,first note",
+		"2,A,poison",
+		"3,B,third note",
+	}, "\n")
+
+	// Any request containing the poison text fails, so the item is loaded without a vector
+	embedder := func(ctx context.Context, texts []string) ([][]float32, error) {
+		vectors := make([][]float32, len(texts))
+		for i, text := range texts {
+			if text == "poison" {
+				return nil, errors.New("model error")
+			}
+			vectors[i] = []float32{1, 2}
+		}
+		return vectors, nil
+	}
+
+	sink := &recordingSink{}
+	processor := NewGenericProcessor(testConfig).WithOptions(ProcessingOptions{
+		Workers:   1,
+		Embedding: EmbeddingOptions{BatchSize: 1, MaxRetries: 1, InitialBackoff: time.Millisecond},
+	})
+	result, err := processor.Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, embedder, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ItemsProcessed)
+	assert.Equal(t, 1, result.EmbeddingsFailed)
+	assert.Empty(t, sink.triage)
+
+	if assert.Len(t, sink.itemBatches, 1) && assert.Len(t, sink.itemBatches[0], 3) {
+		items := sink.itemBatches[0]
+		assert.Equal(t, []float32{1, 2}, items[0].Embedding.Slice())
+		assert.Nil(t, items[1].Embedding.Slice())
+		assert.Equal(t, []float32{1, 2}, items[2].Embedding.Slice())
+	}
+
+	if assert.Len(t, sink.pending, 1) {
+		assert.Equal(t, "2", sink.pending[0].BusinessKey)
+		assert.Equal(t, "poison", sink.pending[0].Text)
+		assert.Contains(t, sink.pending[0].Error, "model error")
+	}
+}
@@ -2,12 +2,13 @@ package processing
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"strings"
+	"sync"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pgvector/pgvector-go"
@@ -21,209 +22,509 @@ type Processor interface {
 		ctx context.Context,
 		file io.Reader,
 		queries repository.Querier,
+		embedder interfaces.BatchEmbedderFunc,
+		sink BatchSink,
 	) (*ProcessingResult, error)
 }
 
-// ProcessingResult holds the outcome of a file processing operation
+// ProcessingResult holds the counters for a file processing operation.
+// Items and triage rows are handed to a BatchSink as they are produced rather than kept here.
 type ProcessingResult struct {
-	SuccessfulItems    []repository.Item
-	TriageRows         []TriageRow
-	BlankRowsDiscarded int
+	RowsRead             int
+	ItemsProcessed       int
+	RowsUpserted         int64
+	RowsTriaged          int
+	BlankRowsDiscarded   int
+	DuplicateRowsDropped int // rows dropped in favour of another row with the same business key
+	EmbeddingsFailed     int // items loaded without a vector and recorded for backfill
 }
 
 // TriageRow represents a row that failed processing and needs human review
 type TriageRow struct {
+	RowNumber      int               `json:"row_number"`
+	Location       string            `json:"location,omitempty"` // sheet and cell coordinates for spreadsheet sources
 	OriginalRecord map[string]string `json:"original_record"`
 	FailureReason  string            `json:"failure_reason"`
 }
 
-// GenericProcessor uses an IngestionConfig to process a CSV file
+// RawRecordField is the OriginalRecord key of the text of a record that couldn't be decoded.
+const RawRecordField = "_raw"
+
+// SourceRow is where in the source file an item came from.
+type SourceRow struct {
+	RowNumber int
+	Location  string // sheet and row range for spreadsheet sources
+}
+
+// BatchSink receives processed items and triage rows one batch at a time, in source row order.
+// WriteItems gets the source row of each item alongside it, for lineage. Items whose embedding
+// could not be generated are passed to WritePendingEmbeddings after the batch they belong to has
+// been written.
+//
+// A business key can turn up again after the batch that loaded it was written. LoadedItems returns
+// the custom_properties of the items the sink holds for such keys, so later rows can be merged into
+// them, and RetractItems takes back what the sink wrote for them, returning the same, so the rows
+// can be triaged instead. Keys the sink has nothing for are left out of the results.
+type BatchSink interface {
+	WriteItems(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error)
+	WriteTriage(ctx context.Context, rows []TriageRow) error
+	WritePendingEmbeddings(ctx context.Context, itemType string, pending []PendingEmbedding) error
+	LoadedItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error)
+	RetractItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error)
+}
+
+// ProcessingOptions controls how a file is streamed through the processor
+type ProcessingOptions struct {
+	BatchSize int
+	Workers   int
+	Embedding EmbeddingOptions
+}
+
+const (
+	DefaultBatchSize = 1000
+	DefaultWorkers   = 4
+)
+
+// GenericProcessor uses an IngestionConfig to process a source file
 type GenericProcessor struct {
-	config IngestionConfig
+	config  IngestionConfig
+	options ProcessingOptions
 }
 
 // NewGenericProcessor creates a new processor with a specific configuration
 func NewGenericProcessor(config IngestionConfig) *GenericProcessor {
-	return &GenericProcessor{config: config}
+	return &GenericProcessor{
+		config:  config,
+		options: ProcessingOptions{BatchSize: DefaultBatchSize, Workers: DefaultWorkers},
+	}
 }
 
-// Process is the main entry point that executes the entire ingestion logic
+// WithOptions overrides the default batch size and worker count. Zero values keep the defaults.
+func (p *GenericProcessor) WithOptions(opts ProcessingOptions) *GenericProcessor {
+	if opts.BatchSize > 0 {
+		p.options.BatchSize = opts.BatchSize
+	}
+	if opts.Workers > 0 {
+		p.options.Workers = opts.Workers
+	}
+	p.options.Embedding = opts.Embedding
+	return p
+}
+
+// fileLayout captures everything about the header row that each record needs to be processed.
+type fileLayout struct {
+	headers          []string
+	headerMap        map[string]int
+	mergeColumnIndex int
+	scopeJSONField   string
+}
+
+// rowOutcome is the result of processing a single SourceRecord. Exactly one of item, triage, blank
+// or duplicate is set. Items also carry their source row and processed fields for duplicate resolution.
+type rowOutcome struct {
+	item      *repository.Item
+	triage    *TriageRow
+	blank     bool
+	duplicate bool
+
+	row       SourceRecord
+	fields    map[string]interface{}
+	embedText string
+}
+
+// Process is the main entry point that executes the entire ingestion logic.
+// Records are read incrementally, processed by a bounded worker pool one batch at a time
+// and flushed to the sink, so memory use does not grow with the size of the file.
 func (p *GenericProcessor) Process(
 	ctx context.Context,
 	file io.Reader,
 	queries repository.Querier,
-	embedder interfaces.EmbedderFunc,
+	embedder interfaces.BatchEmbedderFunc,
+	sink BatchSink,
 ) (*ProcessingResult, error) {
-	result := &ProcessingResult{}
-	csvReader := csv.NewReader(file)
-	csvReader.TrimLeadingSpace = true
-	csvReader.FieldsPerRecord = -1 // prevents reader from crashing
-
-	headers, err := csvReader.Read()
+	reader, err := NewRecordReader(p.config, file)
 	if err != nil {
-		return nil, fmt.Errorf("error reading header row: %w", err)
+		return nil, err
 	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return p.ProcessRecords(ctx, reader, queries, embedder, sink)
+}
+
+// ProcessRecords runs records that have already been read through the same transform, validation,
+// triage and sink path as Process. It is used to reprocess rows that don't come from a file.
+func (p *GenericProcessor) ProcessRecords(
+	ctx context.Context,
+	reader RecordReader,
+	queries repository.Querier,
+	embedder interfaces.BatchEmbedderFunc,
+	sink BatchSink,
+) (*ProcessingResult, error) {
+	result := &ProcessingResult{}
+	headers := reader.Headers()
 
-	headerMap := make(map[string]int)
+	layout := &fileLayout{
+		headers:          headers,
+		headerMap:        make(map[string]int),
+		mergeColumnIndex: -1,
+	}
 	for i, h := range headers {
-		headerMap[strings.TrimSpace(h)] = i
+		layout.headerMap[strings.TrimSpace(h)] = i
 	}
 
-	numHeaders := len(headers)
-
-	mergeColumnIndex := -1
 	for _, mapping := range p.config.ColumnMappings {
 		if mapping.MergeExcessFields {
-			if idx, ok := headerMap[mapping.CSVHeader]; ok {
-				mergeColumnIndex = idx
+			if idx, ok := layout.headerMap[mapping.CSVHeader]; ok {
+				layout.mergeColumnIndex = idx
 				break // assume only one column can be merge target
 			}
 		}
 	}
 
-	allRecords, err := csvReader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read all CSV records: %w", err)
-	}
-
-	var scopeJSONField string
 	for _, mapping := range p.config.ColumnMappings {
 		if mapping.CSVHeader == p.config.ScopeField {
-			scopeJSONField = mapping.JSONField
+			layout.scopeJSONField = mapping.JSONField
 			break
 		}
 	}
-	if scopeJSONField == "" {
+	if layout.scopeJSONField == "" && p.config.derivedField(p.config.ScopeField) != nil {
+		layout.scopeJSONField = p.config.ScopeField
+	}
+	if layout.scopeJSONField == "" {
 		return nil, fmt.Errorf("config validation error: could not find a column mapping for the specified scope_field '%s'", p.config.ScopeField)
 	}
 
-RecordLoop:
-	for i, record := range allRecords {
-		if len(record) > numHeaders && mergeColumnIndex != -1 {
-			numExtraFields := len(record) - numHeaders
+	dups := newDuplicateTracker(p.config.DuplicatePolicy)
+	var embedBatches *batchEmbedder
+	if p.config.EmbedContent != nil && embedder != nil {
+		embedBatches = newBatchEmbedder(embedder, p.options.Embedding)
+	}
+	batch := make([]SourceRecord, 0, p.options.BatchSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		result.RowsRead++
+		batch = append(batch, record)
 
-			endOfMergeIndex := mergeColumnIndex + numExtraFields
-			fieldsToMerge := record[mergeColumnIndex : endOfMergeIndex+1]
-			rejoinedValue := strings.Join(fieldsToMerge, ",")
+		if len(batch) >= p.options.BatchSize {
+			if err := p.flushBatch(ctx, batch, layout, dups, queries, embedBatches, sink, result); err != nil {
+				return result, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := p.flushBatch(ctx, batch, layout, dups, queries, embedBatches, sink, result); err != nil {
+			return result, err
+		}
+	}
 
-			correctedRecord := make([]string, 0, numHeaders)
-			correctedRecord = append(correctedRecord, record[:mergeColumnIndex]...)
-			correctedRecord = append(correctedRecord, rejoinedValue)
-			correctedRecord = append(correctedRecord, record[endOfMergeIndex+1:]...)
+	slog.InfoContext(ctx, "Processing complete",
+		"rows_read", result.RowsRead,
+		"successful_items", result.ItemsProcessed,
+		"rows_upserted", result.RowsUpserted,
+		"triage_rows", result.RowsTriaged,
+		"blank_rows_discarded", result.BlankRowsDiscarded,
+		"duplicate_rows_dropped", result.DuplicateRowsDropped,
+		"embeddings_failed", result.EmbeddingsFailed,
+	)
+	return result, nil
+}
 
-			record = correctedRecord
-		}
+// flushBatch processes a batch of rows, embeds the resulting items and hands everything to the
+// sink in row order.
+func (p *GenericProcessor) flushBatch(
+	ctx context.Context,
+	batch []SourceRecord,
+	layout *fileLayout,
+	dups *duplicateTracker,
+	queries repository.Querier,
+	embedBatches *batchEmbedder,
+	sink BatchSink,
+	result *ProcessingResult,
+) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("processing aborted: %w", err)
+	}
 
-		if len(record) != numHeaders {
-			result.TriageRows = append(result.TriageRows, TriageRow{
-				OriginalRecord: createOriginalRecordMap(record, headers),
-				FailureReason:	fmt.Sprintf("Row as %d fields, but header has %d. Triage required.", len(record), numHeaders),
-			})
-			continue RecordLoop // skip to next record
+	outcomes := p.processBatch(ctx, batch, layout, queries)
+	retracted, err := p.resolveDuplicates(ctx, outcomes, dups, layout, sink)
+	if err != nil {
+		return err
+	}
+	// The items of retracted rows were counted when their batch was written
+	result.ItemsProcessed -= len(retracted)
+	result.RowsUpserted -= int64(len(retracted))
+	if p.config.loadMode() == LoadModeInsertOnly {
+		if err := p.triageExistingItems(ctx, outcomes, layout, queries); err != nil {
+			return err
 		}
+	}
 
-		if isRowBlank(record) {
+	items := make([]repository.Item, 0, len(outcomes))
+	sources := make([]SourceRow, 0, len(outcomes))
+	var embedTexts []string
+	triageRows := retracted
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.blank:
 			result.BlankRowsDiscarded++
-			continue
+		case outcome.duplicate:
+			result.DuplicateRowsDropped++
+		case outcome.triage != nil:
+			triageRows = append(triageRows, *outcome.triage)
+		case outcome.item != nil:
+			items = append(items, *outcome.item)
+			sources = append(sources, SourceRow{RowNumber: outcome.row.RowNumber, Location: outcome.row.Location(-1)})
+			embedTexts = append(embedTexts, outcome.embedText)
+		}
+	}
+
+	var pending []PendingEmbedding
+	if embedBatches != nil {
+		var err error
+		if pending, err = p.embedItems(ctx, embedBatches, items, embedTexts); err != nil {
+			return err
+		}
+		result.EmbeddingsFailed += len(pending)
+	}
+
+	if len(triageRows) > 0 {
+		if err := sink.WriteTriage(ctx, triageRows); err != nil {
+			return fmt.Errorf("failed to write triage rows: %w", err)
 		}
+		result.RowsTriaged += len(triageRows)
+	}
 
-		processedData, err := p.processRow(ctx, record, headerMap, queries)
+	if len(items) > 0 {
+		upserted, err := sink.WriteItems(ctx, items, sources)
 		if err != nil {
-			result.TriageRows = append(result.TriageRows, TriageRow{
-				OriginalRecord: createOriginalRecordMap(record, headers),
-				FailureReason:  err.Error(),
-			})
-			continue
+			return fmt.Errorf("failed to write batch of %d items: %w", len(items), err)
 		}
+		result.ItemsProcessed += len(items)
+		result.RowsUpserted += upserted
+	}
 
-		var embedding pgvector.Vector
-		if p.config.EmbedContent != nil && embedder != nil {
+	if len(pending) > 0 {
+		if err := sink.WritePendingEmbeddings(ctx, p.config.ItemType, pending); err != nil {
+			return fmt.Errorf("failed to record %d items for embedding backfill: %w", len(pending), err)
+		}
+	}
 
-			var textToEmbedBuilder strings.Builder
-			for _, colName := range p.config.EmbedContent.SourceColumns {
-				if val, ok := processedData[colName]; ok {
-					textToEmbedBuilder.WriteString(fmt.Sprintf("%v ", val))
-				}
-			}
-			textToEmbed := strings.TrimSpace(textToEmbedBuilder.String())
-
-			if textToEmbed != "" {
-				slog.Debug("Generating embedding for text", "text", textToEmbed)
-				embeddingVector, err := embedder(ctx, textToEmbed)
-				if err != nil {
-					triageRow := TriageRow{
-						OriginalRecord: createOriginalRecordMap(record, headers),
-						FailureReason: fmt.Sprintf("Row %d: failed to generate embedding: %s", i+2, err.Error()),
-					}
-					result.TriageRows = append(result.TriageRows, triageRow)
-					continue
-				}
-				embedding = pgvector.NewVector(embeddingVector)
+	slog.DebugContext(ctx, "Flushed batch", "rows", len(batch), "items", len(items), "triage_rows", len(triageRows))
+	return nil
+}
+
+// processBatch runs processRecord over a batch using at most options.Workers goroutines.
+// Outcomes are returned in the same order as the input rows.
+func (p *GenericProcessor) processBatch(
+	ctx context.Context,
+	batch []SourceRecord,
+	layout *fileLayout,
+	queries repository.Querier,
+) []rowOutcome {
+	outcomes := make([]rowOutcome, len(batch))
 
+	workers := p.options.Workers
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outcomes[i] = p.processRecord(ctx, batch[i], layout, queries)
 			}
-		}
+		}()
+	}
+	for i := range batch {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		customPropsJSON, err := json.Marshal(processedData)
-		if err != nil {
-			result.TriageRows = append(result.TriageRows, TriageRow{
-				OriginalRecord: createOriginalRecordMap(record, headers),
-				FailureReason:  fmt.Sprintf("Row %d: failed to marshal processed data to JSON: %s", i+2, err.Error()),
-			})
-			continue
-		}
+	return outcomes
+}
 
-		scopeVal, ok := processedData[scopeJSONField]
-		if !ok || scopeVal == nil {
-			result.TriageRows = append(result.TriageRows, TriageRow{
-				OriginalRecord: createOriginalRecordMap(record, headers),
-				FailureReason:  fmt.Sprintf("scope field '%s' is missing or nil", scopeJSONField),
-			})
-			continue
+// processRecord turns a single raw record into either an item, a triage row or a discarded blank row.
+func (p *GenericProcessor) processRecord(
+	ctx context.Context,
+	row SourceRecord,
+	layout *fileLayout,
+	queries repository.Querier,
+) rowOutcome {
+	record := row.Values
+	numHeaders := len(layout.headers)
+
+	triageAt := func(column int, reason string) rowOutcome {
+		return rowOutcome{triage: &TriageRow{
+			RowNumber:      row.RowNumber,
+			Location:       row.Location(column),
+			OriginalRecord: createOriginalRecordMap(record, layout.headers),
+			FailureReason:  reason,
+		}}
+	}
+	triage := func(reason string) rowOutcome {
+		return triageAt(-1, reason)
+	}
+
+	if row.Err != nil {
+		return rowOutcome{triage: &TriageRow{
+			RowNumber:      row.RowNumber,
+			Location:       row.Location(-1),
+			OriginalRecord: map[string]string{RawRecordField: row.Raw},
+			FailureReason:  row.Err.Error(),
+		}}
+	}
+
+	if len(record) > numHeaders && layout.mergeColumnIndex != -1 {
+		numExtraFields := len(record) - numHeaders
+
+		endOfMergeIndex := layout.mergeColumnIndex + numExtraFields
+		fieldsToMerge := record[layout.mergeColumnIndex : endOfMergeIndex+1]
+		rejoinedValue := strings.Join(fieldsToMerge, ",")
+
+		correctedRecord := make([]string, 0, numHeaders)
+		correctedRecord = append(correctedRecord, record[:layout.mergeColumnIndex]...)
+		correctedRecord = append(correctedRecord, rejoinedValue)
+		correctedRecord = append(correctedRecord, record[endOfMergeIndex+1:]...)
+
+		record = correctedRecord
+	}
+
+	if len(record) != numHeaders {
+		return triage(fmt.Sprintf("Row has %d fields, but header has %d. Triage required.", len(record), numHeaders))
+	}
+
+	if isRowBlank(record) {
+		return rowOutcome{blank: true}
+	}
+
+	processedData, err := p.processRow(ctx, record, layout.headerMap, queries)
+	if err != nil {
+		var colErr *columnError
+		if errors.As(err, &colErr) {
+			return triageAt(colErr.column, err.Error())
 		}
+		return triage(err.Error())
+	}
 
-		scopeString, ok := scopeVal.(string)
-		if !ok {
-			result.TriageRows = append(result.TriageRows, TriageRow{
-				OriginalRecord: createOriginalRecordMap(record, headers),
-				FailureReason:  fmt.Sprintf("scope field '%s' is not a string", scopeJSONField),
-			})
-			continue
+	item, err := p.buildItem(row.RowNumber, processedData, layout)
+	if err != nil {
+		return triage(err.Error())
+	}
+	return rowOutcome{item: item, row: row, fields: processedData, embedText: p.embedText(processedData)}
+}
+
+// buildItem assembles the item for a processed row: its custom_properties document, scope and
+// business key. Embeddings are added per batch by embedItems.
+func (p *GenericProcessor) buildItem(
+	rowNumber int,
+	processedData map[string]interface{},
+	layout *fileLayout,
+) (*repository.Item, error) {
+	customPropsJSON, err := json.Marshal(p.buildCustomProperties(processedData))
+	if err != nil {
+		return nil, fmt.Errorf("Row %d: failed to marshal processed data to JSON: %s", rowNumber, err.Error())
+	}
+
+	scopeVal, ok := processedData[layout.scopeJSONField]
+	if !ok || scopeVal == nil {
+		return nil, fmt.Errorf("scope field '%s' is missing or nil", layout.scopeJSONField)
+	}
+
+	scopeString, ok := scopeVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("scope field '%s' is not a string", layout.scopeJSONField)
+	}
+
+	// Build the business key, and if any part is missing, triage the row ONCE.
+	var businessKeyParts []string
+	for _, field := range p.config.BusinessKey {
+		val, ok := processedData[field]
+		if !ok || val == nil {
+			return nil, fmt.Errorf("business key field '%s' is missing or nil", field)
 		}
+		businessKeyParts = append(businessKeyParts, fmt.Sprintf("%v", val))
+	}
 
-		// Build the business key, and if any part is missing, triage the row ONCE and move to the next record.
-		var businessKeyParts []string
-		for _, field := range p.config.BusinessKey {
-			val, ok := processedData[field]
-			if !ok || val == nil {
-				result.TriageRows = append(result.TriageRows, TriageRow{
-					OriginalRecord: createOriginalRecordMap(record, headers),
-					FailureReason:  fmt.Sprintf("business key field '%s' is missing or nil", field),
-				})
-				continue RecordLoop // This is the key change to prevent multiple errors for one row
-			}
-			businessKeyParts = append(businessKeyParts, fmt.Sprintf("%v", val))
+	return &repository.Item{
+		ItemType:         repository.ItemType(p.config.ItemType),
+		Scope:            pgtype.Text{String: scopeString, Valid: true},
+		BusinessKey:      pgtype.Text{String: strings.Join(businessKeyParts, "-"), Valid: true},
+		Status:           "active",
+		CustomProperties: customPropsJSON,
+	}, nil
+}
+
+// embedText builds the text to embed from the embed_content source columns. It is empty when the
+// config does not embed or the columns are blank.
+func (p *GenericProcessor) embedText(processedData map[string]interface{}) string {
+	if p.config.EmbedContent == nil {
+		return ""
+	}
+	var textToEmbedBuilder strings.Builder
+	for _, colName := range p.config.EmbedContent.SourceColumns {
+		if val, ok := processedData[colName]; ok {
+			textToEmbedBuilder.WriteString(fmt.Sprintf("%v ", val))
 		}
+	}
+	return strings.TrimSpace(textToEmbedBuilder.String())
+}
 
-		item := repository.Item{
-			ItemType:         repository.ItemType(p.config.ItemType),
-			Scope:            pgtype.Text{String: scopeString, Valid: true},
-			BusinessKey:      pgtype.Text{String: strings.Join(businessKeyParts, "-"), Valid: true},
-			Status:           "active",
-			CustomProperties: customPropsJSON,
-			Embedding:	  embedding,
+// embedItems generates the embeddings for a batch of items in as few requests as the embedding
+// options allow. Items whose embedding fails are left without a vector and returned as pending.
+func (p *GenericProcessor) embedItems(ctx context.Context, embedBatches *batchEmbedder, items []repository.Item, texts []string) ([]PendingEmbedding, error) {
+	var indexes []int
+	var toEmbed []string
+	for i, text := range texts {
+		if text != "" {
+			indexes = append(indexes, i)
+			toEmbed = append(toEmbed, text)
 		}
-		result.SuccessfulItems = append(result.SuccessfulItems, item)
+	}
+	if len(toEmbed) == 0 {
+		return nil, nil
 	}
 
-	slog.InfoContext(ctx, "Processing complete",
-		"successful_items", len(result.SuccessfulItems),
-		"triage_rows", len(result.TriageRows),
-		"blank_rows_discarded", result.BlankRowsDiscarded,
-	)
-	return result, nil
+	slog.DebugContext(ctx, "Generating embeddings for batch", "texts", len(toEmbed))
+	vectors, errs := embedBatches.embed(ctx, toEmbed)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("processing aborted: %w", err)
+	}
+
+	var pending []PendingEmbedding
+	for k, i := range indexes {
+		if errs[k] != nil {
+			pending = append(pending, PendingEmbedding{
+				BusinessKey: items[i].BusinessKey.String,
+				Text:        toEmbed[k],
+				Error:       errs[k].Error(),
+			})
+			continue
+		}
+		items[i].Embedding = pgvector.NewVector(vectors[k])
+	}
+	if len(pending) > 0 {
+		slog.WarnContext(ctx, "Some items will be loaded without embeddings", "count", len(pending), "error", pending[0].Error)
+	}
+	return pending, nil
 }
 
 // processRow handles the 'attempts' logic for a single, non-blank row.
+// The result is keyed by json_field; buildCustomProperties shapes it into the stored document.
+// All columns are transformed and the derived fields computed before anything is validated,
+// so validation sees the final value of every field.
 func (p *GenericProcessor) processRow(ctx context.Context, record []string, headerMap map[string]int, queries repository.Querier) (map[string]interface{}, error) {
 	processedData := make(map[string]interface{})
 
@@ -244,7 +545,11 @@ func (p *GenericProcessor) processRow(ctx context.Context, record []string, head
 
 		if len(mapping.Attempts) > 0 {
 			for _, attempt := range mapping.Attempts {
-				val, err := applyTransforms(rawValue, attempt.Transforms)
+				transforms := attempt.Transforms
+				if p.config.SourceFormat == SourceFormatXLSX {
+					transforms = xlsxDateTransforms(transforms)
+				}
+				val, err := applyTransforms(rawValue, transforms)
 				if err == nil {
 					transformedValue = val
 					transformSuccessful = true
@@ -254,22 +559,45 @@ func (p *GenericProcessor) processRow(ctx context.Context, record []string, head
 			}
 
 			if !transformSuccessful {
-				return nil, fmt.Errorf("all transform attempts failed for column '%s' with value '%s': %w", mapping.CSVHeader, rawValue, transformError)
+				return nil, &columnError{column: colIdx, err: fmt.Errorf("all transform attempts failed for column '%s' with value '%s': %w", mapping.CSVHeader, rawValue, transformError)}
 			}
 		} else {
 			transformSuccessful = true
 		}
 
-		if err := applyValidation(ctx, queries, transformedValue, mapping.Validation); err != nil {
-			return nil, fmt.Errorf("validation failed for column '%s' with value '%v': %w", mapping.CSVHeader, transformedValue, err)
+		processedData[mapping.JSONField] = transformedValue
+	}
+
+	if err := p.applyDerivedFields(processedData); err != nil {
+		return nil, err
+	}
+
+	for _, mapping := range p.config.ColumnMappings {
+		value := processedData[mapping.JSONField]
+		if err := applyValidation(ctx, queries, value, mapping.Validation); err != nil {
+			return nil, &columnError{column: headerMap[mapping.CSVHeader], err: fmt.Errorf("validation failed for column '%s' with value '%v': %w", mapping.CSVHeader, value, err)}
 		}
+	}
 
-		processedData[mapping.JSONField] = transformedValue
+	for _, field := range p.config.DerivedFields {
+		value := processedData[field.JSONField]
+		if err := applyValidation(ctx, queries, value, field.Validation); err != nil {
+			return nil, fmt.Errorf("validation failed for derived field '%s' with value '%v': %w", field.JSONField, value, err)
+		}
 	}
 
 	return processedData, nil
 }
 
+// columnError ties a row processing failure to the source column that caused it.
+type columnError struct {
+	column int
+	err    error
+}
+
+func (e *columnError) Error() string { return e.err.Error() }
+func (e *columnError) Unwrap() error { return e.err }
+
 // --- Helper functions ---
 
 func isRowBlank(record []string) bool {
@@ -293,8 +621,8 @@ func createOriginalRecordMap(record []string, headers []string) map[string]strin
 	return rowMap
 }
 
-func applyTransforms(value string, transforms []string) (interface{}, error) {
-	var currentValue interface{} = value
+func applyTransforms(value interface{}, transforms []string) (interface{}, error) {
+	currentValue := value
 	for _, transformCall := range transforms {
 		parts := strings.SplitN(transformCall, ":", 2)
 		transformName := parts[0]
@@ -302,7 +630,7 @@ func applyTransforms(value string, transforms []string) (interface{}, error) {
 		if len(parts) > 1 {
 			arg = parts[1]
 		}
-		transformer, ok := transformRegistry[transformName]
+		transformer, ok := lookupTransform(transformName)
 		if !ok {
 			return nil, fmt.Errorf("unknown transform function: %s", transformName)
 		}
@@ -2,6 +2,8 @@ package processing
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/jjckrbbt/catalyst/backend/internal/repository"
@@ -128,3 +130,99 @@ func TestProcessRowValidation(t *testing.T) {
 		})
 	}
 }
+
+// recordingSink collects everything a processor hands to it, batch by batch.
+type recordingSink struct {
+	itemBatches [][]repository.Item
+	sources     []SourceRow
+	triage      []TriageRow
+	pending     []PendingEmbedding
+}
+
+func (s *recordingSink) WriteItems(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error) {
+	s.itemBatches = append(s.itemBatches, append([]repository.Item(nil), items...))
+	s.sources = append(s.sources, sources...)
+	return int64(len(items)), nil
+}
+
+func (s *recordingSink) WriteTriage(ctx context.Context, rows []TriageRow) error {
+	s.triage = append(s.triage, rows...)
+	return nil
+}
+
+func (s *recordingSink) WritePendingEmbeddings(ctx context.Context, itemType string, pending []PendingEmbedding) error {
+	s.pending = append(s.pending, pending...)
+	return nil
+}
+
+func (s *recordingSink) LoadedItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	loaded := make(map[string][]byte)
+	for _, batch := range s.itemBatches {
+		for _, item := range batch {
+			if slices.Contains(businessKeys, item.BusinessKey.String) {
+				loaded[item.BusinessKey.String] = item.CustomProperties
+			}
+		}
+	}
+	return loaded, nil
+}
+
+// RetractItems removes the items with the given keys from the recorded batches.
+func (s *recordingSink) RetractItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	retracted, _ := s.LoadedItems(ctx, itemType, businessKeys)
+	for i, batch := range s.itemBatches {
+		s.itemBatches[i] = slices.DeleteFunc(batch, func(item repository.Item) bool {
+			return slices.Contains(businessKeys, item.BusinessKey.String)
+		})
+	}
+	return retracted, nil
+}
+
+func TestProcessStreamsBatchesInOrder(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_STREAMING",
+		ItemType:    "TEST_ITEM",
+		ScopeField:  "department",
+		BusinessKey: []string{"employee_id"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "employee_id", JSONField: "employee_id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "department", JSONField: "department", Validation: ValidationRule{Required: true}},
+		},
+	}
+
+	csvData := strings.Join([]string{
+		"employee_id,department",
+		"1,ENG",
+		",ENG", // row 3: missing required field
+		"3,ENG",
+		",",    // row 5: blank
+		"5,OPS",
+		"6,OPS",
+		",OPS", // row 8: missing required field
+	}, "\n")
+
+	sink := &recordingSink{}
+	processor := NewGenericProcessor(testConfig).WithOptions(ProcessingOptions{BatchSize: 2, Workers: 3})
+	result, err := processor.Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, nil, sink)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 7, result.RowsRead)
+	assert.Equal(t, 4, result.ItemsProcessed)
+	assert.Equal(t, int64(4), result.RowsUpserted)
+	assert.Equal(t, 2, result.RowsTriaged)
+	assert.Equal(t, 1, result.BlankRowsDiscarded)
+
+	var keys []string
+	for _, batch := range sink.itemBatches {
+		assert.LessOrEqual(t, len(batch), 2)
+		for _, item := range batch {
+			keys = append(keys, item.BusinessKey.String)
+		}
+	}
+	assert.Equal(t, []string{"1", "3", "5", "6"}, keys)
+
+	if assert.Len(t, sink.triage, 2) {
+		assert.Equal(t, 3, sink.triage[0].RowNumber)
+		assert.Equal(t, 8, sink.triage[1].RowNumber)
+	}
+}
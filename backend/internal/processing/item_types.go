@@ -0,0 +1,156 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// ItemTypesFile is the name of the files in the config directory that declare item types. The file
+// at apps/<app>/item_types.yaml declares the app's item types; one at the top of the directory
+// declares item types every app shares.
+const ItemTypesFile = "item_types.yaml"
+
+// ItemEmbeddingDimensions is the size of the vectors items.embedding holds. An item type whose items
+// are embedded has to declare this many embedding_dimensions, since every item type shares the column.
+const ItemEmbeddingDimensions = 384
+
+var itemTypeName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// ItemTypeDefinition is an item type declared in an item_types.yaml file. Declared item types are
+// registered in item_type_registry when the server starts and whenever the configs are reloaded.
+type ItemTypeDefinition struct {
+	Name                string `yaml:"name" json:"name"`
+	DisplayName         string `yaml:"display_name" json:"display_name"`
+	EmbeddingDimensions int    `yaml:"embedding_dimensions,omitempty" json:"embedding_dimensions,omitempty"` // 0 if its items aren't embedded
+	RetentionDays       int    `yaml:"retention_days,omitempty" json:"retention_days,omitempty"`             // 0 to keep its items indefinitely
+	App                 string `yaml:"-" json:"app,omitempty"`                                               // empty for shared item types
+	File                string `yaml:"-" json:"file"`
+}
+
+type itemTypesDocument struct {
+	ItemTypes []ItemTypeDefinition `yaml:"item_types"`
+}
+
+// LoadItemTypes reads the item types declared under dir, sorted by name. The app an item type
+// belongs to comes from where its file is.
+func LoadItemTypes(dir string) ([]ItemTypeDefinition, error) {
+	var itemTypes []ItemTypeDefinition
+	declared := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != ItemTypesFile {
+			return nil
+		}
+		defs, err := readItemTypesFile(path)
+		if err != nil {
+			return err
+		}
+		app := itemTypeApp(dir, path)
+		for _, def := range defs {
+			if file, taken := declared[def.Name]; taken {
+				return fmt.Errorf("%s: item type '%s' is already declared in %s", path, def.Name, file)
+			}
+			declared[def.Name] = path
+			def.App, def.File = app, path
+			itemTypes = append(itemTypes, def)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load item types: %w", err)
+	}
+	sort.Slice(itemTypes, func(i, j int) bool { return itemTypes[i].Name < itemTypes[j].Name })
+	return itemTypes, nil
+}
+
+// readItemTypesFile parses and checks one item_types.yaml file.
+func readItemTypesFile(path string) ([]ItemTypeDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var doc itemTypesDocument
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, def := range doc.ItemTypes {
+		switch {
+		case !itemTypeName.MatchString(def.Name):
+			return nil, fmt.Errorf("%s: item type name '%s' must be upper case letters, digits and underscores", path, def.Name)
+		case strings.TrimSpace(def.DisplayName) == "":
+			return nil, fmt.Errorf("%s: item type '%s' needs a display_name", path, def.Name)
+		case def.EmbeddingDimensions < 0 || def.RetentionDays < 0:
+			return nil, fmt.Errorf("%s: item type '%s' has a negative embedding_dimensions or retention_days", path, def.Name)
+		case def.EmbeddingDimensions != 0 && def.EmbeddingDimensions != ItemEmbeddingDimensions:
+			return nil, fmt.Errorf("%s: item type '%s' has embedding_dimensions %d, but items are embedded in %d dimensions", path, def.Name, def.EmbeddingDimensions, ItemEmbeddingDimensions)
+		}
+	}
+	return doc.ItemTypes, nil
+}
+
+// itemTypeApp returns the app whose directory, apps/<app>, holds the file, or "" for a file outside
+// the apps directories.
+func itemTypeApp(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) >= 3 && parts[0] == "apps" {
+		return parts[1]
+	}
+	return ""
+}
+
+// RegisterItemTypes writes the declared item types to item_type_registry, updating the metadata of
+// ones already there. An item type registered by another app is an error rather than being taken
+// over, so two apps can't end up sharing a name by accident.
+func RegisterItemTypes(ctx context.Context, q repository.Querier, itemTypes []ItemTypeDefinition) error {
+	for _, def := range itemTypes {
+		existing, err := q.GetItemType(ctx, repository.ItemType(def.Name))
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("failed to look up item type '%s': %w", def.Name, err)
+		case existing.App.String != def.App:
+			return fmt.Errorf("item type '%s' declared in %s is already registered %s", def.Name, def.File, describeItemTypeOwner(existing.App.String))
+		}
+
+		err = q.UpsertItemType(ctx, repository.UpsertItemTypeParams{
+			Name:                repository.ItemType(def.Name),
+			DisplayName:         def.DisplayName,
+			App:                 pgtype.Text{String: def.App, Valid: def.App != ""},
+			EmbeddingDimensions: pgtype.Int4{Int32: int32(def.EmbeddingDimensions), Valid: def.EmbeddingDimensions > 0},
+			RetentionDays:       pgtype.Int4{Int32: int32(def.RetentionDays), Valid: def.RetentionDays > 0},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register item type '%s': %w", def.Name, err)
+		}
+	}
+	return nil
+}
+
+func describeItemTypeOwner(app string) string {
+	if app == "" {
+		return "as shared by every app"
+	}
+	return "by the " + app + " app"
+}
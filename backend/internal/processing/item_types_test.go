@@ -0,0 +1,119 @@
+package processing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeItemTypes(t *testing.T, path, data string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+}
+
+func TestLoadItemTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeItemTypes(t, filepath.Join(dir, ItemTypesFile), `item_types:
+  - name: "KNOWLEDGE_CHUNK"
+    display_name: "Knowledge chunk"
+    embedding_dimensions: 384
+`)
+	insurance := filepath.Join(dir, "apps", "insurance", ItemTypesFile)
+	writeItemTypes(t, insurance, `item_types:
+  - name: "INSURANCE_CLAIM"
+    display_name: "Insurance claim"
+    retention_days: 2555
+`)
+
+	itemTypes, err := LoadItemTypes(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []ItemTypeDefinition{
+		{Name: "INSURANCE_CLAIM", DisplayName: "Insurance claim", RetentionDays: 2555, App: "insurance", File: insurance},
+		{Name: "KNOWLEDGE_CHUNK", DisplayName: "Knowledge chunk", EmbeddingDimensions: 384, File: filepath.Join(dir, ItemTypesFile)},
+	}, itemTypes)
+
+	writeItemTypes(t, filepath.Join(dir, "apps", "demo", ItemTypesFile), `item_types:
+  - name: "INSURANCE_CLAIM"
+    display_name: "Claim"
+`)
+	_, err = LoadItemTypes(dir)
+	assert.ErrorContains(t, err, "item type 'INSURANCE_CLAIM' is already declared in")
+
+	for data, message := range map[string]string{
+		"item_types:\n  - name: claim\n    display_name: Claim\n":                                "item type name 'claim' must be upper case letters, digits and underscores",
+		"item_types:\n  - name: CLAIM\n":                                                         "item type 'CLAIM' needs a display_name",
+		"item_types:\n  - name: CLAIM\n    display_name: Claim\n    ttl: 3\n":                    "field ttl not found",
+		"item_types:\n  - name: CLAIM\n    display_name: Claim\n    embedding_dimensions: 768\n": "item type 'CLAIM' has embedding_dimensions 768, but items are embedded in 384 dimensions",
+	} {
+		writeItemTypes(t, filepath.Join(dir, "apps", "demo", ItemTypesFile), data)
+		_, err = LoadItemTypes(dir)
+		assert.ErrorContains(t, err, message)
+	}
+}
+
+func TestConfigLoaderChecksItemTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, filepath.Join(dir, "claims.yaml"), "CLAIMS", "Name")
+	writeItemTypes(t, filepath.Join(dir, ItemTypesFile), "item_types:\n  - name: POLICYHOLDER\n    display_name: Policyholder\n")
+
+	// The item types file isn't loaded as a config, and the config's item type isn't declared
+	_, err := NewConfigLoader(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown item_type 'INSURANCE_CLAIM'; expected one of POLICYHOLDER")
+
+	writeItemTypes(t, filepath.Join(dir, ItemTypesFile), "item_types:\n  - name: INSURANCE_CLAIM\n    display_name: Insurance claim\n")
+	loader, err := NewConfigLoader(dir)
+	require.NoError(t, err)
+	assert.Len(t, loader.Loaded(), 1)
+	require.Len(t, loader.ItemTypes(), 1)
+	assert.Equal(t, "INSURANCE_CLAIM", loader.ItemTypes()[0].Name)
+}
+
+type itemTypeQuerier struct {
+	repository.Querier
+	registered map[repository.ItemType]repository.ItemTypeRegistry
+	upserts    []repository.UpsertItemTypeParams
+}
+
+func (q *itemTypeQuerier) GetItemType(ctx context.Context, name repository.ItemType) (repository.ItemTypeRegistry, error) {
+	row, ok := q.registered[name]
+	if !ok {
+		return repository.ItemTypeRegistry{}, pgx.ErrNoRows
+	}
+	return row, nil
+}
+
+func (q *itemTypeQuerier) UpsertItemType(ctx context.Context, arg repository.UpsertItemTypeParams) error {
+	q.upserts = append(q.upserts, arg)
+	return nil
+}
+
+func TestRegisterItemTypes(t *testing.T) {
+	q := &itemTypeQuerier{registered: map[repository.ItemType]repository.ItemTypeRegistry{
+		"KNOWLEDGE_CHUNK": {Name: "KNOWLEDGE_CHUNK"},
+		"POLICYHOLDER":    {Name: "POLICYHOLDER", App: pgtype.Text{String: "insurance", Valid: true}},
+	}}
+
+	err := RegisterItemTypes(context.Background(), q, []ItemTypeDefinition{
+		{Name: "KNOWLEDGE_CHUNK", DisplayName: "Knowledge chunk", EmbeddingDimensions: 384},
+		{Name: "POLICYHOLDER", DisplayName: "Policyholder", App: "insurance", RetentionDays: 365},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []repository.UpsertItemTypeParams{
+		{Name: "KNOWLEDGE_CHUNK", DisplayName: "Knowledge chunk", EmbeddingDimensions: pgtype.Int4{Int32: 384, Valid: true}},
+		{Name: "POLICYHOLDER", DisplayName: "Policyholder", App: pgtype.Text{String: "insurance", Valid: true}, RetentionDays: pgtype.Int4{Int32: 365, Valid: true}},
+	}, q.upserts)
+
+	// Another app can't claim an item type that is already registered
+	err = RegisterItemTypes(context.Background(), q, []ItemTypeDefinition{{Name: "POLICYHOLDER", DisplayName: "Policyholder", App: "demo", File: "apps/demo/item_types.yaml"}})
+	assert.EqualError(t, err, "item type 'POLICYHOLDER' declared in apps/demo/item_types.yaml is already registered by the insurance app")
+	assert.Len(t, q.upserts, 2)
+}
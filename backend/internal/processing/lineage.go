@@ -0,0 +1,76 @@
+package processing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// configVersion identifies a config by its content: the first 12 hex digits of its configHash.
+// Jobs that ran with identical configs share a version.
+func configVersion(config IngestionConfig) (string, error) {
+	hash, err := configHash(config)
+	if err != nil {
+		return "", err
+	}
+	return hash[:12], nil
+}
+
+// configHash is the SHA-256 of a config's JSON form, in hex. Stored config revisions are keyed by it.
+func configHash(config IngestionConfig) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute config version: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeLineage records the job, file, row and config version behind each item a batch wrote.
+// itemIDs maps the business keys of the written items to their IDs; staged items that were not
+// written, such as existing items skipped by append_only, get no lineage.
+func (js *jobSink) writeLineage(ctx context.Context, itemIDs map[string]int64, items []repository.Item, sources []SourceRow) error {
+	type lineageRow struct {
+		itemID int64
+		source SourceRow
+	}
+	rows := make([]lineageRow, 0, len(itemIDs))
+	for i, item := range items {
+		if id, ok := itemIDs[item.BusinessKey.String]; ok {
+			rows = append(rows, lineageRow{itemID: id, source: sources[i]})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	jobID := pgtype.UUID{Bytes: js.jobID, Valid: true}
+	sourceURI := pgtype.Text{String: js.sourceURI, Valid: js.sourceURI != ""}
+	version := pgtype.Text{String: js.configVersion, Valid: js.configVersion != ""}
+	_, err := js.tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"item_lineage"},
+		[]string{"item_id", "job_id", "source_uri", "row_number", "source_location", "config_version"},
+		pgx.CopyFromSlice(len(rows), func(i int) ([]interface{}, error) {
+			source := rows[i].source
+			return []interface{}{
+				rows[i].itemID,
+				jobID,
+				sourceURI,
+				pgtype.Int4{Int32: int32(source.RowNumber), Valid: source.RowNumber > 0},
+				pgtype.Text{String: source.Location, Valid: source.Location != ""},
+				version,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write item lineage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemsCarryTheirSourceRows(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_LINEAGE",
+		ItemType:    "TEST_ITEM",
+		ScopeField:  "team",
+		BusinessKey: []string{"id"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "id", JSONField: "id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "team", JSONField: "team"},
+		},
+	}
+	csvData := "id,team\n1,A\n,B\n3,C\n"
+
+	sink := &recordingSink{}
+	_, err := NewGenericProcessor(testConfig).WithOptions(ProcessingOptions{BatchSize: 2, Workers: 1}).
+		Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, nil, sink)
+	assert.NoError(t, err)
+	// Row 3 is triaged, so the items come from rows 2 and 4 of the file
+	assert.Equal(t, []SourceRow{{RowNumber: 2}, {RowNumber: 4}}, sink.sources)
+}
+
+func TestConfigVersion(t *testing.T) {
+	testConfig := IngestionConfig{ReportType: "TEST_LINEAGE", ItemType: "TEST_ITEM", BusinessKey: []string{"id"}}
+	first, err := configVersion(testConfig)
+	assert.NoError(t, err)
+	assert.Len(t, first, 12)
+
+	again, _ := configVersion(testConfig)
+	assert.Equal(t, first, again)
+
+	testConfig.BusinessKey = []string{"id", "team"}
+	changed, _ := configVersion(testConfig)
+	assert.NotEqual(t, first, changed)
+}
@@ -0,0 +1,123 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// Supported values for IngestionConfig.LoadMode
+const (
+	LoadModeUpsert     = "upsert"      // new items are inserted and existing ones updated
+	LoadModeSnapshot   = "snapshot"    // as upsert, then active items missing from the file are deactivated
+	LoadModeAppendOnly = "append_only" // new items are inserted; rows for existing items are skipped
+	LoadModeInsertOnly = "insert_only" // new items are inserted; rows for existing items are triaged
+)
+
+// DefaultMaxDeactivatePercent is the share of active items a snapshot may deactivate when the config
+// doesn't set max_deactivate_percent. Setting it to 0 makes any deactivation wait for review.
+const DefaultMaxDeactivatePercent = 20
+
+// SnapshotOptions tunes load_mode snapshot, for feeds where each file is a full extract.
+type SnapshotOptions struct {
+	ScopeToFile          bool     `yaml:"scope_to_file,omitempty"`          // only deactivate items in scopes that appear in the file
+	DeactivateStatus     string   `yaml:"deactivate_status,omitempty"`      // inactive (default) or archived
+	MaxDeactivatePercent *float64 `yaml:"max_deactivate_percent,omitempty"` // abort when more of the active items would be deactivated
+}
+
+// loadMode returns the config's load_mode, defaulting to upsert.
+func (c *IngestionConfig) loadMode() string {
+	if c.LoadMode == "" {
+		return LoadModeUpsert
+	}
+	return c.LoadMode
+}
+
+// snapshotOptions returns the snapshot options with defaults filled in.
+func (c *IngestionConfig) snapshotOptions() SnapshotOptions {
+	var opts SnapshotOptions
+	if c.Snapshot != nil {
+		opts = *c.Snapshot
+	}
+	if opts.DeactivateStatus == "" {
+		opts.DeactivateStatus = string(repository.ItemStatusInactive)
+	}
+	if opts.MaxDeactivatePercent == nil {
+		maxPercent := float64(DefaultMaxDeactivatePercent)
+		opts.MaxDeactivatePercent = &maxPercent
+	}
+	return opts
+}
+
+func validateLoadMode(c *IngestionConfig) error {
+	switch c.loadMode() {
+	case LoadModeUpsert, LoadModeSnapshot:
+	case LoadModeAppendOnly, LoadModeInsertOnly:
+		// Later rows for a key can't update an item these modes have just inserted
+		if c.DuplicatePolicy == DuplicatePolicyKeepLast || c.DuplicatePolicy == DuplicatePolicyMerge {
+			return fieldErrorf([]any{"duplicate_policy"}, "load_mode '%s' can't be combined with duplicate_policy '%s'", c.LoadMode, c.DuplicatePolicy)
+		}
+	default:
+		return fieldErrorf([]any{"load_mode"}, "unsupported load_mode '%s'", c.LoadMode)
+	}
+
+	if c.Snapshot == nil {
+		return nil
+	}
+	if c.loadMode() != LoadModeSnapshot {
+		return fieldErrorf([]any{"snapshot"}, "snapshot options require load_mode 'snapshot'")
+	}
+	switch repository.ItemStatus(c.Snapshot.DeactivateStatus) {
+	case "", repository.ItemStatusInactive, repository.ItemStatusArchived:
+	default:
+		return fieldErrorf([]any{"snapshot", "deactivate_status"}, "snapshot deactivate_status must be 'inactive' or 'archived', not '%s'", c.Snapshot.DeactivateStatus)
+	}
+	if p := c.Snapshot.MaxDeactivatePercent; p != nil && (*p < 0 || *p > 100) {
+		return fieldErrorf([]any{"snapshot", "max_deactivate_percent"}, "snapshot max_deactivate_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// triageExistingItems sends rows whose business key is already in items to triage, for load_mode
+// insert_only. It runs after duplicates are resolved, so a key can't be one this job just loaded.
+func (p *GenericProcessor) triageExistingItems(ctx context.Context, outcomes []rowOutcome, layout *fileLayout, queries repository.Querier) error {
+	var keys []string
+	for _, outcome := range outcomes {
+		if outcome.item != nil {
+			keys = append(keys, outcome.item.BusinessKey.String)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	existing, err := queries.ListExistingBusinessKeys(ctx, repository.ListExistingBusinessKeysParams{
+		ItemType:     repository.ItemType(p.config.ItemType),
+		BusinessKeys: keys,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up existing business keys: %w", err)
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		exists[key.String] = true
+	}
+
+	for i := range outcomes {
+		outcome := &outcomes[i]
+		if outcome.item == nil || !exists[outcome.item.BusinessKey.String] {
+			continue
+		}
+		*outcome = rowOutcome{triage: &TriageRow{
+			RowNumber:      outcome.row.RowNumber,
+			Location:       outcome.row.Location(-1),
+			OriginalRecord: createOriginalRecordMap(outcome.row.Values, layout.headers),
+			FailureReason:  fmt.Sprintf("An item with business key '%s' already exists and load_mode is insert_only", outcome.item.BusinessKey.String),
+		}}
+	}
+	return nil
+}
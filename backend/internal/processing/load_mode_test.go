@@ -0,0 +1,104 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadModeValidation(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:     "TEST_LOAD_MODE",
+		ItemType:       "INSURANCE_CLAIM",
+		ScopeField:     "Policy",
+		BusinessKey:    []string{"policy"},
+		ColumnMappings: []ColumnMapping{{CSVHeader: "Policy", JSONField: "policy"}},
+	}
+
+	testConfig.LoadMode = "replace_all"
+	err := testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unsupported load_mode 'replace_all'")
+	}
+
+	testConfig.LoadMode = LoadModeInsertOnly
+	testConfig.DuplicatePolicy = DuplicatePolicyKeepLast
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "can't be combined with duplicate_policy")
+	}
+	testConfig.DuplicatePolicy = ""
+
+	testConfig.Snapshot = &SnapshotOptions{ScopeToFile: true}
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "require load_mode 'snapshot'")
+	}
+
+	testConfig.LoadMode = LoadModeSnapshot
+	testConfig.Snapshot = &SnapshotOptions{DeactivateStatus: "deleted"}
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "deactivate_status")
+	}
+
+	testConfig.Snapshot = &SnapshotOptions{ScopeToFile: true}
+	assert.NoError(t, testConfig.Validate())
+	opts := testConfig.snapshotOptions()
+	assert.Equal(t, "inactive", opts.DeactivateStatus)
+	if assert.NotNil(t, opts.MaxDeactivatePercent) {
+		assert.Equal(t, float64(DefaultMaxDeactivatePercent), *opts.MaxDeactivatePercent)
+	}
+
+	// 0 means no item may be deactivated without review, rather than the default
+	none, tooMany := 0.0, 120.0
+	testConfig.Snapshot = &SnapshotOptions{MaxDeactivatePercent: &none}
+	assert.NoError(t, testConfig.Validate())
+	if opts := testConfig.snapshotOptions(); assert.NotNil(t, opts.MaxDeactivatePercent) {
+		assert.Equal(t, 0.0, *opts.MaxDeactivatePercent)
+	}
+
+	testConfig.Snapshot = &SnapshotOptions{MaxDeactivatePercent: &tooMany}
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "max_deactivate_percent must be between 0 and 100")
+	}
+}
+
+func TestInsertOnlyTriagesExistingItems(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_INSERT_ONLY",
+		ItemType:    "TEST_ITEM",
+		ScopeField:  "team",
+		BusinessKey: []string{"id"},
+		LoadMode:    LoadModeInsertOnly,
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "id", JSONField: "id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "team", JSONField: "team"},
+		},
+	}
+	csvData := "id,team\n1,A\n2,A\n3,B\n"
+
+	queries := &existingKeysQuerier{existing: map[string]bool{"2": true}}
+	sink := &recordingSink{}
+	result, err := NewGenericProcessor(testConfig).Process(context.Background(), strings.NewReader(csvData), queries, nil, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.RowsRead)
+	assert.Equal(t, 2, result.ItemsProcessed)
+	assert.Equal(t, 1, result.RowsTriaged)
+
+	if assert.Len(t, sink.triage, 1) {
+		assert.Equal(t, 3, sink.triage[0].RowNumber)
+		assert.Contains(t, sink.triage[0].FailureReason, "business key '2' already exists")
+	}
+
+	// Other load modes leave existing items to the upsert
+	testConfig.LoadMode = LoadModeAppendOnly
+	queries = &existingKeysQuerier{existing: map[string]bool{"2": true}}
+	result, err = NewGenericProcessor(testConfig).Process(context.Background(), strings.NewReader(csvData), queries, nil, &recordingSink{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ItemsProcessed)
+	assert.Equal(t, 0, queries.lookups)
+}
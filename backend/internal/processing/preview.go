@@ -0,0 +1,169 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// DefaultPreviewSampleSize is how many transformed items a preview returns when the caller doesn't say.
+const DefaultPreviewSampleSize = 20
+
+// PreviewResult describes what ingesting a file would do, without anything being written.
+type PreviewResult struct {
+	ReportType           string        `json:"report_type"`
+	ItemType             string        `json:"item_type"`
+	RowsRead             int           `json:"rows_read"`
+	ItemsProcessed       int           `json:"items_processed"`
+	RowsTriaged          int           `json:"rows_triaged"`
+	BlankRowsDiscarded   int           `json:"blank_rows_discarded"`
+	DuplicateRowsDropped int           `json:"duplicate_rows_dropped"`
+	ItemsToInsert        int           `json:"items_to_insert"` // business keys not yet in items
+	ItemsToUpdate        int           `json:"items_to_update"` // business keys that already exist
+	SampleItems          []PreviewItem `json:"sample_items"`
+	Triage               []TriageRow   `json:"triage"`
+}
+
+// PreviewItem is a transformed item as it would be upserted.
+type PreviewItem struct {
+	BusinessKey      string          `json:"business_key"`
+	Scope            string          `json:"scope"`
+	Status           string          `json:"status"`
+	CustomProperties json.RawMessage `json:"custom_properties"`
+}
+
+// Preview runs a file through the config's processor and reports what would be loaded. Business keys
+// are looked up to tell inserts from updates, but nothing is written and no embeddings are generated.
+func Preview(ctx context.Context, config IngestionConfig, file io.Reader, queries repository.Querier, opts ProcessingOptions, sampleSize int) (*PreviewResult, error) {
+	if sampleSize < 0 {
+		sampleSize = DefaultPreviewSampleSize
+	}
+	sink := &previewSink{
+		queries:    queries,
+		itemType:   repository.ItemType(config.ItemType),
+		sampleSize: sampleSize,
+		written:    make(map[string]previewWrite),
+		result: &PreviewResult{
+			ReportType:  config.ReportType,
+			ItemType:    config.ItemType,
+			SampleItems: []PreviewItem{},
+			Triage:      []TriageRow{},
+		},
+	}
+
+	processed, err := NewGenericProcessor(config).WithOptions(opts).Process(ctx, file, queries, nil, sink)
+	if err != nil {
+		return nil, err
+	}
+
+	result := sink.result
+	result.RowsRead = processed.RowsRead
+	result.ItemsProcessed = processed.ItemsProcessed
+	result.RowsTriaged = processed.RowsTriaged
+	result.BlankRowsDiscarded = processed.BlankRowsDiscarded
+	result.DuplicateRowsDropped = processed.DuplicateRowsDropped
+	return result, nil
+}
+
+// previewSink collects what a processor would write. Under keep_last and merge a business key can
+// reach it more than once, so insert and update counts are per distinct key. It holds the properties
+// of every key it was given, as a job's items would, so they can be merged into or taken back.
+type previewSink struct {
+	queries    repository.Querier
+	itemType   repository.ItemType
+	sampleSize int
+	written    map[string]previewWrite
+	result     *PreviewResult
+}
+
+// previewWrite is what the preview would have written for a business key.
+type previewWrite struct {
+	props  []byte
+	exists bool // the key is already in items, so its item would be updated
+}
+
+func (ps *previewSink) WriteItems(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error) {
+	var keys []string
+	for _, item := range items {
+		if len(ps.result.SampleItems) < ps.sampleSize {
+			ps.result.SampleItems = append(ps.result.SampleItems, PreviewItem{
+				BusinessKey:      item.BusinessKey.String,
+				Scope:            item.Scope.String,
+				Status:           string(item.Status),
+				CustomProperties: json.RawMessage(item.CustomProperties),
+			})
+		}
+		key := item.BusinessKey.String
+		written, seen := ps.written[key]
+		written.props = item.CustomProperties
+		ps.written[key] = written
+		if !seen {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return int64(len(items)), nil
+	}
+
+	existing, err := ps.queries.ListExistingBusinessKeys(ctx, repository.ListExistingBusinessKeysParams{
+		ItemType:     ps.itemType,
+		BusinessKeys: keys,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up existing business keys: %w", err)
+	}
+	for _, key := range existing {
+		written := ps.written[key.String]
+		written.exists = true
+		ps.written[key.String] = written
+	}
+	ps.result.ItemsToUpdate += len(existing)
+	ps.result.ItemsToInsert += len(keys) - len(existing)
+	return int64(len(items)), nil
+}
+
+func (ps *previewSink) LoadedItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	loaded := make(map[string][]byte)
+	for _, key := range businessKeys {
+		if written, ok := ps.written[key]; ok {
+			loaded[key] = written.props
+		}
+	}
+	return loaded, nil
+}
+
+// RetractItems drops the keys from the counts and the sample, as if their items weren't written.
+func (ps *previewSink) RetractItems(ctx context.Context, itemType string, businessKeys []string) (map[string][]byte, error) {
+	retracted, err := ps.LoadedItems(ctx, itemType, businessKeys)
+	if err != nil {
+		return nil, err
+	}
+	for key := range retracted {
+		if ps.written[key].exists {
+			ps.result.ItemsToUpdate--
+		} else {
+			ps.result.ItemsToInsert--
+		}
+		delete(ps.written, key)
+	}
+	sample := ps.result.SampleItems[:0]
+	for _, item := range ps.result.SampleItems {
+		if _, ok := retracted[item.BusinessKey]; !ok {
+			sample = append(sample, item)
+		}
+	}
+	ps.result.SampleItems = sample
+	return retracted, nil
+}
+
+func (ps *previewSink) WriteTriage(ctx context.Context, rows []TriageRow) error {
+	ps.result.Triage = append(ps.result.Triage, rows...)
+	return nil
+}
+
+func (ps *previewSink) WritePendingEmbeddings(ctx context.Context, itemType string, pending []PendingEmbedding) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// existingKeysQuerier reports a fixed set of business keys as already loaded.
+type existingKeysQuerier struct {
+	mockQuerier
+	existing map[string]bool
+	lookups  int
+}
+
+func (m *existingKeysQuerier) ListExistingBusinessKeys(ctx context.Context, arg repository.ListExistingBusinessKeysParams) ([]pgtype.Text, error) {
+	m.lookups++
+	var found []pgtype.Text
+	for _, key := range arg.BusinessKeys {
+		if m.existing[key] {
+			found = append(found, pgtype.Text{String: key, Valid: true})
+		}
+	}
+	return found, nil
+}
+
+func TestPreviewReportsInsertsUpdatesAndTriage(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:      "TEST_PREVIEW",
+		ItemType:        "TEST_ITEM",
+		ScopeField:      "team",
+		BusinessKey:     []string{"id"},
+		DuplicatePolicy: DuplicatePolicyKeepLast,
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "id", JSONField: "id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "team", JSONField: "team"},
+		},
+	}
+
+	csvData := strings.Join([]string{
+		"id,team",
+		"1,A",
+		"2,A",
+		",B", // row 4: missing id
+		"3,B",
+		"1,C", // row 6: replaces row 2 under keep_last
+	}, "\n")
+
+	queries := &existingKeysQuerier{existing: map[string]bool{"1": true}}
+	result, err := Preview(context.Background(), testConfig, strings.NewReader(csvData), queries, ProcessingOptions{BatchSize: 2, Workers: 1}, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, result.RowsRead)
+	assert.Equal(t, 1, result.RowsTriaged)
+	assert.Equal(t, 2, result.ItemsToInsert)
+	assert.Equal(t, 1, result.ItemsToUpdate)
+	assert.Len(t, result.SampleItems, 2)
+	assert.Equal(t, "1", result.SampleItems[0].BusinessKey)
+	if assert.Len(t, result.Triage, 1) {
+		assert.Equal(t, 4, result.Triage[0].RowNumber)
+	}
+}
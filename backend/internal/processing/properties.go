@@ -0,0 +1,181 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// fieldPath splits a mapping's json_field into the keys it is stored under in custom_properties.
+func fieldPath(mapping ColumnMapping) []string {
+	if mapping.LiteralJSONField {
+		return []string{mapping.JSONField}
+	}
+	return strings.Split(mapping.JSONField, ".")
+}
+
+// buildCustomProperties turns the processed values, keyed by json_field, into the custom_properties
+// document, creating nested objects for dotted fields. Derived fields are written last so they
+// replace any column stored under the same json_field.
+func (p *GenericProcessor) buildCustomProperties(fields map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(fields))
+	for _, mapping := range p.config.ColumnMappings {
+		value, ok := fields[mapping.JSONField]
+		if !ok {
+			continue
+		}
+		setPath(doc, fieldPath(mapping), value)
+	}
+	for _, field := range p.config.DerivedFields {
+		setPath(doc, fieldPath(ColumnMapping{JSONField: field.JSONField, LiteralJSONField: field.LiteralJSONField}), fields[field.JSONField])
+	}
+	return doc
+}
+
+// setPath stores value under the given keys, creating intermediate objects as needed.
+// It reports false without changing doc if an intermediate key already holds a non-object value.
+func setPath(doc map[string]interface{}, path []string, value interface{}) bool {
+	node := doc
+	for _, key := range path[:len(path)-1] {
+		child, exists := node[key]
+		if !exists {
+			next := make(map[string]interface{})
+			node[key] = next
+			node = next
+			continue
+		}
+		next, ok := child.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		node = next
+	}
+	node[path[len(path)-1]] = value
+	return true
+}
+
+// hasPath reports whether a value is stored under the given keys.
+func hasPath(doc map[string]interface{}, path []string) bool {
+	_, ok := lookupPath(doc, path)
+	return ok
+}
+
+// lookupPath returns the value stored under the given keys.
+func lookupPath(doc map[string]interface{}, path []string) (interface{}, bool) {
+	var node interface{} = doc
+	for _, key := range path {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// flatKeys lists the dotted json_fields that earlier ingestions stored as literal top-level keys.
+func flatKeys(config IngestionConfig) []string {
+	var keys []string
+	for _, mapping := range config.ColumnMappings {
+		if !mapping.LiteralJSONField && strings.Contains(mapping.JSONField, ".") {
+			keys = append(keys, mapping.JSONField)
+		}
+	}
+	return keys
+}
+
+// NestFlatProperties moves values stored under literal dotted keys, e.g. "metadata.section", into
+// the nested objects the config now describes. When both forms are present the nested value is
+// newer and wins. It reports whether props was changed.
+func NestFlatProperties(config IngestionConfig, props map[string]interface{}) bool {
+	changed := false
+	for _, mapping := range config.ColumnMappings {
+		if mapping.LiteralJSONField || !strings.Contains(mapping.JSONField, ".") {
+			continue
+		}
+		value, ok := props[mapping.JSONField]
+		if !ok {
+			continue
+		}
+		path := fieldPath(mapping)
+		if !hasPath(props, path) && !setPath(props, path, value) {
+			continue
+		}
+		delete(props, mapping.JSONField)
+		changed = true
+	}
+	return changed
+}
+
+// BackfillResult summarises a BackfillNestedProperties run.
+type BackfillResult struct {
+	ItemsScanned   int
+	ItemsRewritten int
+}
+
+// BackfillNestedProperties rewrites the custom_properties of existing items of the config's
+// item type so that flat dotted keys become nested objects. Items are read in pages of batchSize
+// ordered by ID, so the backfill can be re-run safely. With dryRun set nothing is written.
+func BackfillNestedProperties(ctx context.Context, queries repository.Querier, config IngestionConfig, batchSize int, dryRun bool, logger *slog.Logger) (BackfillResult, error) {
+	var result BackfillResult
+
+	keys := flatKeys(config)
+	if len(keys) == 0 {
+		return result, nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var afterID int64
+	for {
+		rows, err := queries.ListItemsWithPropertyKeys(ctx, repository.ListItemsWithPropertyKeysParams{
+			ItemType: repository.ItemType(config.ItemType),
+			Keys:     keys,
+			AfterID:  afterID,
+			Limit:    int32(batchSize),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to list items of type %s after id %d: %w", config.ItemType, afterID, err)
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+
+		for _, row := range rows {
+			afterID = row.ID
+			result.ItemsScanned++
+
+			var props map[string]interface{}
+			if err := json.Unmarshal(row.CustomProperties, &props); err != nil {
+				return result, fmt.Errorf("failed to decode custom_properties of item %d: %w", row.ID, err)
+			}
+			if !NestFlatProperties(config, props) {
+				logger.Warn("Item has flat keys that could not be nested", "item_id", row.ID)
+				continue
+			}
+			result.ItemsRewritten++
+			if dryRun {
+				continue
+			}
+
+			updated, err := json.Marshal(props)
+			if err != nil {
+				return result, fmt.Errorf("failed to encode custom_properties of item %d: %w", row.ID, err)
+			}
+			if err := queries.SetItemCustomProperties(ctx, repository.SetItemCustomPropertiesParams{
+				ID:               row.ID,
+				CustomProperties: updated,
+			}); err != nil {
+				return result, fmt.Errorf("failed to update item %d: %w", row.ID, err)
+			}
+		}
+		logger.Info("Backfilled batch", "item_type", config.ItemType, "scanned", result.ItemsScanned, "rewritten", result.ItemsRewritten, "dry_run", dryRun)
+	}
+}
@@ -0,0 +1,93 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDottedJSONFieldsAreNested(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_NESTING",
+		ItemType:    "KNOWLEDGE_CHUNK",
+		ScopeField:  "doc_id",
+		BusinessKey: []string{"metadata.document_id", "metadata.chunk_number"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "doc_id", JSONField: "metadata.document_id"},
+			{CSVHeader: "chunk", JSONField: "metadata.chunk_number"},
+			{CSVHeader: "version", JSONField: "schema.v1", LiteralJSONField: true},
+			{CSVHeader: "text", JSONField: "chunk_text"},
+		},
+	}
+	assert.NoError(t, testConfig.Validate())
+
+	csvData := "doc_id,chunk,version,text\nPOL-1,0,yes,Coverage details\n"
+
+	sink := &recordingSink{}
+	_, err := NewGenericProcessor(testConfig).Process(context.Background(), strings.NewReader(csvData), &mockQuerier{}, nil, sink)
+	assert.NoError(t, err)
+	if !assert.Len(t, sink.itemBatches, 1) || !assert.Len(t, sink.itemBatches[0], 1) {
+		return
+	}
+	item := sink.itemBatches[0][0]
+	assert.Equal(t, "POL-1-0", item.BusinessKey.String)
+	assert.JSONEq(t, `{
+		"metadata": {"document_id": "POL-1", "chunk_number": "0"},
+		"schema.v1": "yes",
+		"chunk_text": "Coverage details"
+	}`, string(item.CustomProperties))
+}
+
+func TestConflictingJSONFieldsFailValidation(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_CONFLICT",
+		ItemType:    "KNOWLEDGE_CHUNK",
+		ScopeField:  "meta",
+		BusinessKey: []string{"metadata"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "meta", JSONField: "metadata"},
+			{CSVHeader: "section", JSONField: "metadata.section"},
+		},
+	}
+	err := testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "needs 'metadata' to be an object")
+	}
+
+	testConfig.ColumnMappings[1].JSONField = "metadata..section"
+	err = testConfig.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "empty path segment")
+	}
+}
+
+func TestNestFlatProperties(t *testing.T) {
+	testConfig := IngestionConfig{
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "doc_id", JSONField: "metadata.document_id"},
+			{CSVHeader: "section", JSONField: "metadata.section"},
+			{CSVHeader: "version", JSONField: "schema.v1", LiteralJSONField: true},
+		},
+	}
+
+	var props map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"metadata.document_id": "POL-1",
+		"metadata.section": "stale",
+		"metadata": {"section": "Exclusions"},
+		"schema.v1": "yes"
+	}`), &props))
+
+	assert.True(t, NestFlatProperties(testConfig, props))
+	rewritten, err := json.Marshal(props)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"metadata": {"document_id": "POL-1", "section": "Exclusions"},
+		"schema.v1": "yes"
+	}`, string(rewritten))
+
+	assert.False(t, NestFlatProperties(testConfig, props))
+}
@@ -0,0 +1,302 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Supported values for IngestionConfig.SourceFormat
+const (
+	SourceFormatCSV       = "csv"
+	SourceFormatNDJSON    = "ndjson"
+	SourceFormatJSONArray = "json_array"
+	SourceFormatXLSX      = "xlsx"
+)
+
+// SourceRecord is one raw record from a source file together with its position in that file.
+// Values are aligned with the Headers of the RecordReader that produced it. A record the reader
+// could find but not decode has Err set and its text in Raw instead of Values; it is triaged.
+type SourceRecord struct {
+	RowNumber int
+	Values    []string
+	Sheet     string // set for spreadsheet sources
+	Raw       string
+	Err       error
+}
+
+// Location returns an A1-style reference for the record within its sheet, or for a single cell
+// when column is 0 or greater. It is empty for sources that have no cell coordinates.
+func (r SourceRecord) Location(column int) string {
+	if r.Sheet == "" {
+		return ""
+	}
+	sheet := r.Sheet
+	if strings.ContainsAny(sheet, " '!-") {
+		sheet = "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+	}
+	if column < 0 {
+		return fmt.Sprintf("%s!%d:%d", sheet, r.RowNumber, r.RowNumber)
+	}
+	return fmt.Sprintf("%s!%s%d", sheet, columnLetters(column+1), r.RowNumber)
+}
+
+// columnLetters converts a 1-based column number to its spreadsheet name, e.g. 1 -> A, 28 -> AB.
+func columnLetters(n int) string {
+	var name []byte
+	for n > 0 {
+		n--
+		name = append([]byte{byte('A' + n%26)}, name...)
+		n /= 26
+	}
+	return string(name)
+}
+
+// RecordReader yields the records of a source file one at a time as flat string values,
+// so every source format can share the same transform, validation and triage path.
+// Readers that hold resources also implement io.Closer.
+type RecordReader interface {
+	// Headers returns the field names that each record's Values are aligned with.
+	Headers() []string
+	// Read returns the next record, or io.EOF when there are no more.
+	Read() (SourceRecord, error)
+}
+
+// NewRecordReader returns the RecordReader for the config's source_format.
+func NewRecordReader(config IngestionConfig, file io.Reader) (RecordReader, error) {
+	switch config.SourceFormat {
+	case "", SourceFormatCSV:
+		return NewCSVRecordReader(file)
+	case SourceFormatNDJSON:
+		return NewNDJSONRecordReader(file, mappedFields(config)), nil
+	case SourceFormatJSONArray:
+		return NewJSONArrayRecordReader(file, mappedFields(config))
+	case SourceFormatXLSX:
+		var opts XLSXOptions
+		if config.XLSX != nil {
+			opts = *config.XLSX
+		}
+		return NewXLSXRecordReader(file, opts)
+	default:
+		return nil, fmt.Errorf("unsupported source_format '%s'", config.SourceFormat)
+	}
+}
+
+// mappedFields lists the source fields referenced by the column mappings, in mapping order.
+func mappedFields(config IngestionConfig) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, mapping := range config.ColumnMappings {
+		if seen[mapping.CSVHeader] {
+			continue
+		}
+		seen[mapping.CSVHeader] = true
+		fields = append(fields, mapping.CSVHeader)
+	}
+	return fields
+}
+
+// --- CSV ---
+
+// CSVRecordReader reads a CSV file whose first row holds the headers.
+type CSVRecordReader struct {
+	reader    *csv.Reader
+	headers   []string
+	rowNumber int
+}
+
+// NewCSVRecordReader reads the header row and returns a reader positioned at the first record.
+func NewCSVRecordReader(file io.Reader) (*CSVRecordReader, error) {
+	csvReader := csv.NewReader(file)
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = -1 // prevents reader from crashing
+
+	headers, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header row: %w", err)
+	}
+	return &CSVRecordReader{reader: csvReader, headers: headers, rowNumber: 1}, nil
+}
+
+func (r *CSVRecordReader) Headers() []string {
+	return r.headers
+}
+
+func (r *CSVRecordReader) Read() (SourceRecord, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return SourceRecord{}, io.EOF
+	}
+	if err != nil {
+		return SourceRecord{}, fmt.Errorf("failed to read CSV record after row %d: %w", r.rowNumber, err)
+	}
+	r.rowNumber++
+	return SourceRecord{RowNumber: r.rowNumber, Values: record}, nil
+}
+
+// --- NDJSON ---
+
+// NDJSONRecordReader reads one JSON object per line. Blank lines are skipped,
+// and row numbers are the line numbers in the file. A line that isn't valid JSON is returned as
+// a record with Err set, so it is triaged and the lines after it are still read.
+type NDJSONRecordReader struct {
+	reader     *bufio.Reader
+	fields     []string
+	lineNumber int
+}
+
+// NewNDJSONRecordReader returns a reader that extracts the given field paths from each line.
+func NewNDJSONRecordReader(file io.Reader, fields []string) *NDJSONRecordReader {
+	return &NDJSONRecordReader{reader: bufio.NewReader(file), fields: fields}
+}
+
+func (r *NDJSONRecordReader) Headers() []string {
+	return r.fields
+}
+
+func (r *NDJSONRecordReader) Read() (SourceRecord, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return SourceRecord{}, fmt.Errorf("failed to read NDJSON line %d: %w", r.lineNumber+1, err)
+		}
+		if len(line) == 0 && err == io.EOF {
+			return SourceRecord{}, io.EOF
+		}
+		r.lineNumber++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err == io.EOF {
+				return SourceRecord{}, io.EOF
+			}
+			continue
+		}
+
+		var obj interface{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if decodeErr := decoder.Decode(&obj); decodeErr != nil {
+			return SourceRecord{RowNumber: r.lineNumber, Raw: string(line), Err: fmt.Errorf("invalid JSON on line %d: %w", r.lineNumber, decodeErr)}, nil
+		}
+		return SourceRecord{RowNumber: r.lineNumber, Values: extractFields(obj, r.fields)}, nil
+	}
+}
+
+// --- JSON array ---
+
+// JSONArrayRecordReader streams the elements of a top-level JSON array without loading the
+// whole document. Row numbers are the 1-based positions of the elements in the array. The decoder
+// can't find the next element after a syntax error, so a malformed element fails the file with
+// an error naming the element.
+type JSONArrayRecordReader struct {
+	decoder *json.Decoder
+	fields  []string
+	index   int
+}
+
+// NewJSONArrayRecordReader consumes the opening bracket and returns a reader positioned at the first element.
+func NewJSONArrayRecordReader(file io.Reader, fields []string) (*JSONArrayRecordReader, error) {
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error reading start of JSON array: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected a top-level JSON array, found %v", tok)
+	}
+	return &JSONArrayRecordReader{decoder: decoder, fields: fields}, nil
+}
+
+func (r *JSONArrayRecordReader) Headers() []string {
+	return r.fields
+}
+
+func (r *JSONArrayRecordReader) Read() (SourceRecord, error) {
+	if !r.decoder.More() {
+		return SourceRecord{}, io.EOF
+	}
+	r.index++
+
+	var obj interface{}
+	if err := r.decoder.Decode(&obj); err != nil {
+		return SourceRecord{}, fmt.Errorf("invalid JSON in array element %d (byte %d): %w", r.index, r.decoder.InputOffset(), err)
+	}
+	return SourceRecord{RowNumber: r.index, Values: extractFields(obj, r.fields)}, nil
+}
+
+// --- JSON helpers ---
+
+// extractFields resolves each field path against a decoded JSON value and flattens the result to strings.
+func extractFields(obj interface{}, fields []string) []string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		if v, ok := resolvePath(obj, field); ok {
+			values[i] = stringifyJSONValue(v)
+		}
+	}
+	return values
+}
+
+// resolvePath walks a dotted path such as "claim.amount" or "lines.0.sku" through nested
+// objects and arrays. A key that literally contains dots is matched before the path is split.
+func resolvePath(value interface{}, path string) (interface{}, bool) {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		if v, ok := node[path]; ok {
+			return v, true
+		}
+		head, rest, found := strings.Cut(path, ".")
+		if !found {
+			return nil, false
+		}
+		child, ok := node[head]
+		if !ok {
+			return nil, false
+		}
+		return resolvePath(child, rest)
+	case []interface{}:
+		head, rest, found := strings.Cut(path, ".")
+		idx, err := strconv.Atoi(head)
+		if err != nil || idx < 0 || idx >= len(node) {
+			return nil, false
+		}
+		if !found {
+			return node[idx], true
+		}
+		return resolvePath(node[idx], rest)
+	default:
+		return nil, false
+	}
+}
+
+// stringifyJSONValue renders a decoded JSON value the way it would have appeared in a CSV cell.
+// Objects and arrays are kept as compact JSON text.
+func stringifyJSONValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	default:
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(encoded)
+	}
+}
@@ -0,0 +1,124 @@
+package processing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSourceFormats(t *testing.T) {
+	baseConfig := IngestionConfig{
+		ReportType:  "TEST_JSON",
+		ItemType:    "TEST_ITEM",
+		ScopeField:  "claim.region",
+		BusinessKey: []string{"claim_id"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "claim.id", JSONField: "claim_id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "claim.region", JSONField: "region", Validation: ValidationRule{Required: true}},
+			{
+				CSVHeader:  "claim.amount",
+				JSONField:  "amount",
+				Attempts:   []ProcessingAttempt{{Transforms: []string{"to_decimal"}}},
+				Validation: ValidationRule{Required: true},
+			},
+			{CSVHeader: "lines.0.sku", JSONField: "first_sku"},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		format         string
+		data           string
+		expectedKeys   []string
+		expectedTriage []int
+	}{
+		{
+			name:   "NDJSON with blank lines",
+			format: SourceFormatNDJSON,
+			data: `{"claim": {"id": "C1", "region": "WEST", "amount": 10.50}, "lines": [{"sku": "A"}]}
+
+{"claim": {"id": "C2", "region": "EAST", "amount": "not-a-number"}}
+{"claim": {"id": "C3", "region": "EAST", "amount": 99}}`,
+			expectedKeys:   []string{"C1", "C3"},
+			expectedTriage: []int{3},
+		},
+		{
+			name:   "NDJSON with a malformed line",
+			format: SourceFormatNDJSON,
+			data: `{"claim": {"id": "C1", "region": "WEST", "amount": 1}}
+{"claim": {"id": "C2", "region": "WEST", "amount": 2
+{"claim": {"id": "C3", "region": "EAST", "amount": 3}}`,
+			expectedKeys:   []string{"C1", "C3"},
+			expectedTriage: []int{2},
+		},
+		{
+			name:   "JSON array",
+			format: SourceFormatJSONArray,
+			data: `[
+				{"claim": {"id": "C1", "region": "WEST", "amount": 1}},
+				{"claim": {"region": "WEST", "amount": 2}},
+				{"claim": {"id": "C3", "region": "EAST", "amount": 3}}
+			]`,
+			expectedKeys:   []string{"C1", "C3"},
+			expectedTriage: []int{2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := baseConfig
+			config.SourceFormat = tc.format
+			assert.NoError(t, config.Validate())
+
+			sink := &recordingSink{}
+			_, err := NewGenericProcessor(config).Process(context.Background(), strings.NewReader(tc.data), &mockQuerier{}, nil, sink)
+			assert.NoError(t, err)
+
+			var keys []string
+			for _, batch := range sink.itemBatches {
+				for _, item := range batch {
+					keys = append(keys, item.BusinessKey.String)
+				}
+			}
+			assert.Equal(t, tc.expectedKeys, keys)
+
+			var triageRows []int
+			for _, row := range sink.triage {
+				triageRows = append(triageRows, row.RowNumber)
+			}
+			assert.Equal(t, tc.expectedTriage, triageRows)
+		})
+	}
+}
+
+func TestMalformedJSONSources(t *testing.T) {
+	config := IngestionConfig{
+		ReportType:     "TEST_JSON",
+		ItemType:       "TEST_ITEM",
+		ScopeField:     "region",
+		BusinessKey:    []string{"id"},
+		ColumnMappings: []ColumnMapping{{CSVHeader: "id", JSONField: "id"}, {CSVHeader: "region", JSONField: "region"}},
+	}
+
+	// A bad NDJSON line is triaged with its text and the decode error
+	config.SourceFormat = SourceFormatNDJSON
+	sink := &recordingSink{}
+	_, err := NewGenericProcessor(config).Process(context.Background(), strings.NewReader("{\"id\": \"1\", \"region\": \"W\"}\nnot json\n"), &mockQuerier{}, nil, sink)
+	assert.NoError(t, err)
+	if assert.Len(t, sink.triage, 1) {
+		assert.Equal(t, map[string]string{RawRecordField: "not json"}, sink.triage[0].OriginalRecord)
+		assert.Contains(t, sink.triage[0].FailureReason, "invalid JSON on line 2")
+	}
+
+	// A JSON array can't be read past a syntax error, so the file fails naming the element
+	config.SourceFormat = SourceFormatJSONArray
+	for data, message := range map[string]string{
+		`[{"id": "1", "region": "W"}, {"id": "2", "region": }]`:   "invalid JSON in array element 2",
+		`[{"id": "1", "region": "W"}, {"id": "2", "region": "E"}`: "invalid JSON in array element 3",
+	} {
+		_, err := NewGenericProcessor(config).Process(context.Background(), strings.NewReader(data), &mockQuerier{}, nil, &recordingSink{})
+		assert.ErrorContains(t, err, message)
+	}
+}
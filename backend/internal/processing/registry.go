@@ -2,12 +2,15 @@ package processing
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 	"strconv"
+	"unicode"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jjckrbbt/catalyst/backend/internal/repository"
@@ -24,15 +27,28 @@ type ValidationFunc func(ctx context.Context, queries repository.Querier, input
 var transformRegistry = make(map[string]TransformFunc)
 var validationRegistry = make(map[string]ValidationFunc)
 
+// transformMu guards transformRegistry, which is read by processing workers while
+// app modules may still be registering their own transforms.
+var transformMu sync.RWMutex
+
 // init runs when the package is loaded, registering our built-in functions
 func init() {
 	// Register Transformations
 	transformRegistry["trim_space"] = transformTrimSpace
 	transformRegistry["to_uppercase"] = transformToUppercase
+	transformRegistry["to_lowercase"] = transformToLowercase
 	transformRegistry["to_integer"] = transformToInteger
 	transformRegistry["to_integer"] = transformToInteger
 	transformRegistry["to_decimal"] = transformToDecimal
 	transformRegistry["to_date"] = transformToDate
+	transformRegistry["format_date"] = transformFormatDate
+	transformRegistry["to_boolean"] = transformToBoolean
+	transformRegistry["parse_json"] = transformParseJSON
+	transformRegistry["parse_currency"] = transformParseCurrency
+	transformRegistry["regex_replace"] = transformRegexReplace
+	transformRegistry["split_to_array"] = transformSplitToArray
+	transformRegistry["map"] = transformMap
+	transformRegistry["default_if_blank"] = transformDefaultIfBlank
 
 	// Register Validations
 	validationRegistry["required"] = validationRequired
@@ -41,6 +57,34 @@ func init() {
 	validationRegistry["exists_in_items"] = validateExistsInItems
 }
 
+// RegisterTransform makes a transform available to ingestion configs under the given name, so app
+// modules can add their own alongside the built-in ones. Configs call it as "name" or "name:arg".
+// Registering a name that is already taken is an error.
+func RegisterTransform(name string, fn TransformFunc) error {
+	if name == "" || strings.Contains(name, ":") {
+		return fmt.Errorf("invalid transform name '%s'", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("transform '%s' has no function", name)
+	}
+
+	transformMu.Lock()
+	defer transformMu.Unlock()
+	if _, exists := transformRegistry[name]; exists {
+		return fmt.Errorf("transform '%s' is already registered", name)
+	}
+	transformRegistry[name] = fn
+	return nil
+}
+
+// lookupTransform returns the transform registered under name.
+func lookupTransform(name string) (TransformFunc, bool) {
+	transformMu.RLock()
+	defer transformMu.RUnlock()
+	fn, ok := transformRegistry[name]
+	return fn, ok
+}
+
 // --- Transformation Implementations ---
 
 func transformTrimSpace(input interface{}, arg string) (interface{}, error) {
@@ -59,6 +103,14 @@ func transformToUppercase(input interface{}, arg string) (interface{}, error) {
 	return strings.ToUpper(str), nil
 }
 
+func transformToLowercase(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("to_lowercase requires a string input")
+	}
+	return strings.ToLower(str), nil
+}
+
 func transformToInteger(input interface{}, arg string) (interface{}, error) {
 	str, ok := input.(string)
 	if !ok {
@@ -91,6 +143,8 @@ func transformToDecimal(input interface{}, arg string) (interface{}, error) {
 	return d, nil
 }
 
+// transformToDate parses a date with the layout given as its argument. Several layouts can be
+// separated by "|", e.g. "to_date:2006-01-02|01/02/2006", and the first one that fits is used.
 func transformToDate(input interface{}, arg string) (interface{}, error) {
 	layout := arg
 	if layout == "" {
@@ -101,11 +155,253 @@ func transformToDate(input interface{}, arg string) (interface{}, error) {
 	if !ok {
 		return nil, fmt.Errorf("to_date requires a string input")
 	}
-	t, err := time.Parse(layout, str)
+
+	var err error
+	for _, l := range strings.Split(layout, "|") {
+		var t time.Time
+		if t, err = time.Parse(l, str); err == nil {
+			return t, nil
+		}
+	}
+	if strings.Contains(layout, "|") {
+		return nil, fmt.Errorf("could not parse date '%s' with any of the layouts '%s'", str, layout)
+	}
+	return nil, fmt.Errorf("could not parse date '%s' with layout '%s': %w", str, layout, err)
+}
+
+// transformFormatDate renders a date produced by to_date with the given layout,
+// e.g. "format_date:2006" to take the year of a date column.
+func transformFormatDate(input interface{}, arg string) (interface{}, error) {
+	layout := arg
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+	t, ok := input.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("format_date requires a date input, apply to_date first")
+	}
+	return t.Format(layout), nil
+}
+
+// transformToBoolean accepts the usual spellings of yes and no, ignoring case. Blank values become nil.
+func transformToBoolean(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("to_boolean requires a string input")
+	}
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "":
+		return nil, nil
+	case "true", "t", "yes", "y", "1":
+		return true, nil
+	case "false", "f", "no", "n", "0":
+		return false, nil
+	default:
+		return nil, fmt.Errorf("could not parse '%s' as boolean", str)
+	}
+}
+
+// transformParseJSON decodes a JSON document so it is stored as an object or array rather than
+// as an escaped string. Blank values become nil.
+func transformParseJSON(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("parse_json requires a string input")
+	}
+	if strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(str))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("could not parse '%s' as JSON: %w", str, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("could not parse '%s' as JSON: unexpected data after the first value", str)
+	}
+	return value, nil
+}
+
+// transformParseCurrency parses amounts such as "$1,234.50", "EUR 99", "(12.00)" or "12.00-" into a
+// decimal. Currency symbols and codes may lead or trail the number, as may a single minus sign;
+// parentheses also mean negative. Anything else around or inside the number, such as "12abc34" or
+// "1e5", is an error rather than being dropped.
+// With the argument "," the comma is the decimal separator and dots group thousands, e.g. "1.234,50 €".
+func transformParseCurrency(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("parse_currency requires a string input")
+	}
+	decimalSep, groupSep := '.', ','
+	switch arg {
+	case "", ".":
+	case ",":
+		decimalSep, groupSep = ',', '.'
+	default:
+		return nil, fmt.Errorf("parse_currency decimal separator must be '.' or ',', got '%s'", arg)
+	}
+
+	clean := strings.TrimSpace(str)
+	if clean == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("could not parse '%s' as a currency amount", str)
+
+	negative := false
+	if strings.HasPrefix(clean, "(") && strings.HasSuffix(clean, ")") {
+		negative = true
+		clean = clean[1 : len(clean)-1]
+	}
+
+	// Peel currency symbols, codes and the sign off both ends, leaving just the number.
+	runes := []rune(clean)
+	signs := 0
+	isAffix := func(r rune) bool {
+		if r == '-' {
+			signs++
+			return true
+		}
+		return unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.Is(unicode.Sc, r)
+	}
+	for len(runes) > 0 && isAffix(runes[0]) {
+		runes = runes[1:]
+	}
+	for len(runes) > 0 && isAffix(runes[len(runes)-1]) {
+		runes = runes[:len(runes)-1]
+	}
+	if signs > 1 || (signs == 1 && negative) {
+		return nil, invalid
+	}
+	if signs == 1 {
+		negative = true
+	}
+
+	var digits strings.Builder
+	for _, r := range runes {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == decimalSep:
+			digits.WriteByte('.')
+		case r == groupSep, unicode.IsSpace(r):
+			// thousands separators
+		default:
+			return nil, invalid
+		}
+	}
+
+	d, err := decimal.NewFromString(digits.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", invalid, err)
+	}
+	if negative {
+		d = d.Neg()
+	}
+	return d, nil
+}
+
+// regexCache holds compiled regex_replace patterns, which are shared by all processing workers.
+var regexCache sync.Map
+
+// transformRegexReplace rewrites a value sed-style. The first character of the argument is the
+// delimiter and must not appear in the pattern, e.g. "regex_replace:/[^0-9]+//" strips non-digits
+// and "regex_replace:#(\d+)-(\d+)#$2-$1#" swaps two numbers. The replacement may use $1-style
+// references to capture groups.
+func transformRegexReplace(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("regex_replace requires a string input")
+	}
+	re, replacement, err := parseRegexReplaceArg(arg)
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(str, replacement), nil
+}
+
+// parseRegexReplaceArg splits a regex_replace argument into its compiled pattern and replacement.
+func parseRegexReplaceArg(arg string) (*regexp.Regexp, string, error) {
+	if len(arg) < 3 {
+		return nil, "", fmt.Errorf("regex_replace expects an argument like '/pattern/replacement/'")
+	}
+	delim := arg[:1]
+	parts := strings.Split(arg[1:], delim)
+	if len(parts) != 3 || parts[2] != "" {
+		return nil, "", fmt.Errorf("regex_replace argument '%s' must have the form %spattern%sreplacement%s", arg, delim, delim, delim)
+	}
+
+	if cached, ok := regexCache.Load(parts[0]); ok {
+		return cached.(*regexp.Regexp), parts[1], nil
+	}
+	re, err := regexp.Compile(parts[0])
 	if err != nil {
-		return nil, fmt.Errorf("could not parse date '%s' with layout '%s': %w", str, layout, err)
+		return nil, "", fmt.Errorf("invalid regex_replace pattern '%s': %w", parts[0], err)
+	}
+	regexCache.Store(parts[0], re)
+	return re, parts[1], nil
+}
+
+// transformSplitToArray splits a value on the separator given as its argument (default ",").
+// Elements are trimmed and empty elements dropped, so a blank value becomes an empty array.
+func transformSplitToArray(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("split_to_array requires a string input")
+	}
+	sep := arg
+	if sep == "" {
+		sep = ","
+	}
+	elements := make([]interface{}, 0)
+	for _, part := range strings.Split(str, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			elements = append(elements, part)
+		}
+	}
+	return elements, nil
+}
+
+// transformMap looks a value up in an inline table such as "map:M=Male,F=Female,*=Unknown".
+// The "*" entry is the fallback; without one, values that are not in the table are an error.
+func transformMap(input interface{}, arg string) (interface{}, error) {
+	str, ok := input.(string)
+	if !ok {
+		return nil, fmt.Errorf("map requires a string input")
+	}
+	table, err := parseMapArg(arg)
+	if err != nil {
+		return nil, err
+	}
+	if mapped, ok := table[str]; ok {
+		return mapped, nil
+	}
+	if fallback, ok := table["*"]; ok {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("value '%s' has no entry in the map table", str)
+}
+
+// parseMapArg reads the "key=value,key=value" table of the map transform.
+func parseMapArg(arg string) (map[string]string, error) {
+	table := make(map[string]string)
+	for _, entry := range strings.Split(arg, ",") {
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("map entry '%s' must have the form key=value", entry)
+		}
+		table[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return table, nil
+}
+
+// transformDefaultIfBlank replaces a blank value with the argument.
+func transformDefaultIfBlank(input interface{}, arg string) (interface{}, error) {
+	if isBlankValue(input) {
+		return arg, nil
 	}
-	return t, nil
+	return input, nil
 }
 
 // --- Validation Implementaton ---
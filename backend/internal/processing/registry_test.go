@@ -0,0 +1,98 @@
+package processing
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransforms(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		transforms    []string
+		expected      interface{}
+		errorContains string
+	}{
+		{name: "lowercase", input: "MiXeD", transforms: []string{"to_lowercase"}, expected: "mixed"},
+		{name: "boolean yes", input: " Yes ", transforms: []string{"to_boolean"}, expected: true},
+		{name: "boolean zero", input: "0", transforms: []string{"to_boolean"}, expected: false},
+		{name: "boolean blank", input: "", transforms: []string{"to_boolean"}, expected: nil},
+		{name: "boolean invalid", input: "maybe", transforms: []string{"to_boolean"}, errorContains: "as boolean"},
+		{name: "currency symbol", input: "$1,234.50", transforms: []string{"parse_currency"}, expected: decimal.RequireFromString("1234.50")},
+		{name: "currency parentheses", input: "(12.00)", transforms: []string{"parse_currency"}, expected: decimal.RequireFromString("-12")},
+		{name: "currency code", input: "EUR 1.234,50", transforms: []string{"parse_currency:,"}, expected: decimal.RequireFromString("1234.5")},
+		{name: "currency invalid", input: "12#50", transforms: []string{"parse_currency"}, errorContains: "currency amount"},
+		{name: "currency trailing code and minus", input: "12.00 USD-", transforms: []string{"parse_currency"}, expected: decimal.RequireFromString("-12")},
+		{name: "currency leading minus", input: "-$1,000", transforms: []string{"parse_currency"}, expected: decimal.RequireFromString("-1000")},
+		{name: "currency letters inside", input: "12abc34", transforms: []string{"parse_currency"}, errorContains: "currency amount"},
+		{name: "currency exponent", input: "1e5", transforms: []string{"parse_currency"}, errorContains: "currency amount"},
+		{name: "currency minus inside", input: "1-2", transforms: []string{"parse_currency"}, errorContains: "currency amount"},
+		{name: "currency two signs", input: "-12-", transforms: []string{"parse_currency"}, errorContains: "currency amount"},
+		{name: "regex replace", input: "(555) 123-4567", transforms: []string{"regex_replace:/[^0-9]+//"}, expected: "5551234567"},
+		{name: "regex groups", input: "12-34", transforms: []string{`regex_replace:#(\d+)-(\d+)#$2-$1#`}, expected: "34-12"},
+		{name: "regex bad arg", input: "x", transforms: []string{"regex_replace:/x/"}, errorContains: "must have the form"},
+		{name: "split", input: "AUTO, HOME,,LIFE", transforms: []string{"split_to_array"}, expected: []interface{}{"AUTO", "HOME", "LIFE"}},
+		{name: "split custom separator", input: "a|b", transforms: []string{"split_to_array:|"}, expected: []interface{}{"a", "b"}},
+		{name: "map hit", input: "F", transforms: []string{"map:M=Male,F=Female"}, expected: "Female"},
+		{name: "map fallback", input: "X", transforms: []string{"map:M=Male,*=Unknown"}, expected: "Unknown"},
+		{name: "map miss", input: "X", transforms: []string{"map:M=Male"}, errorContains: "no entry"},
+		{name: "default if blank", input: "  ", transforms: []string{"trim_space", "default_if_blank:N/A"}, expected: "N/A"},
+		{name: "default keeps value", input: "Gold", transforms: []string{"default_if_blank:N/A"}, expected: "Gold"},
+		{name: "date second layout", input: "03/15/2025", transforms: []string{"to_date:2006-01-02|01/02/2006"}, expected: time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "date no layout fits", input: "15.03.2025", transforms: []string{"to_date:2006-01-02|01/02/2006"}, errorContains: "any of the layouts"},
+		{name: "parse json blank", input: "", transforms: []string{"parse_json"}, expected: nil},
+		{name: "parse json trailing data", input: `{"a":1} {}`, transforms: []string{"parse_json"}, errorContains: "unexpected data"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := applyTransforms(tc.input, tc.transforms)
+			if tc.errorContains != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.errorContains)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			if expected, ok := tc.expected.(decimal.Decimal); ok {
+				assert.True(t, expected.Equal(result.(decimal.Decimal)), "got %v", result)
+				return
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestParseJSONProducesObjects(t *testing.T) {
+	result, err := applyTransforms(`{"policies": ["AUTO-1", "HOME-2"], "limit": 250000}`, []string{"parse_json"})
+	assert.NoError(t, err)
+
+	encoded, err := json.Marshal(map[string]interface{}{"Active_Policies": result})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Active_Policies": {"policies": ["AUTO-1", "HOME-2"], "limit": 250000}}`, string(encoded))
+}
+
+func TestRegisterTransform(t *testing.T) {
+	err := RegisterTransform("test_reverse", func(input interface{}, arg string) (interface{}, error) {
+		runes := []rune(input.(string))
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	})
+	assert.NoError(t, err)
+
+	result, err := applyTransforms("abc", []string{"test_reverse", "to_uppercase"})
+	assert.NoError(t, err)
+	assert.Equal(t, "CBA", result)
+
+	err = RegisterTransform("trim_space", transformTrimSpace)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already registered")
+	}
+	assert.Error(t, RegisterTransform("bad:name", transformTrimSpace))
+}
@@ -0,0 +1,203 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// EventIngestionRolledBack is written for each item a rollback restored or deactivated.
+const EventIngestionRolledBack = "INGESTION_ROLLED_BACK"
+
+var (
+	// ErrJobNotRollbackable is returned when rolling back a job that has not completed, or was
+	// already rolled back.
+	ErrJobNotRollbackable = errors.New("only completed jobs can be rolled back")
+	// ErrNoChangeRecord is returned for jobs that ran before item changes were recorded per job.
+	ErrNoChangeRecord = errors.New("job has no record of the items it changed")
+	// ErrInsertedItemsReferenced is returned when items the job inserted can't be deleted because
+	// other records, such as comments, assignments or another job's events, refer to them.
+	ErrInsertedItemsReferenced = errors.New("items the job inserted are referenced by other records; deactivate them instead")
+)
+
+// RollbackOptions controls how RollbackJob treats items changed since the job and items it inserted.
+type RollbackOptions struct {
+	Force          bool // roll back items users changed after the job too, undoing their edits
+	DeleteInserted bool // delete the items the job inserted instead of deactivating them
+}
+
+// RollbackConflict is an item that users edited after the job wrote it.
+type RollbackConflict struct {
+	ItemID        int64              `json:"item_id"`
+	LaterChanges  int64              `json:"later_changes"`
+	LastChangedBy pgtype.Int8        `json:"last_changed_by"`
+	LastChangedAt pgtype.Timestamptz `json:"last_changed_at"`
+}
+
+// RollbackConflictError lists the items that stopped a rollback that wasn't forced, and the later
+// jobs that changed the job's items.
+type RollbackConflictError struct {
+	Conflicts []RollbackConflict
+	LaterJobs []uuid.UUID
+}
+
+func (e *RollbackConflictError) Error() string {
+	return fmt.Sprintf("%d items were edited by users after the job wrote them", len(e.Conflicts))
+}
+
+// RollbackResult reports what a rollback did. Conflicts lists the items users edited after the job
+// that a forced rollback restored anyway. LaterJobs lists the ingestion jobs that changed the job's
+// items after it; restoring the items undoes those jobs' changes to them as well.
+type RollbackResult struct {
+	Restored    int64              `json:"restored"`
+	Deactivated int64              `json:"deactivated"`
+	Deleted     int64              `json:"deleted"`
+	Conflicts   []RollbackConflict `json:"conflicts,omitempty"`
+	LaterJobs   []uuid.UUID        `json:"later_jobs,omitempty"`
+}
+
+// RollbackJob undoes a completed job's changes to items in one transaction and marks the job
+// ROLLED_BACK. Items the job updated or deactivated, including through resubmitted triage rows, are
+// restored from audit.items_changes to their state before the job; items it inserted are
+// deactivated or deleted. Unless forced, it refuses when users edited any of those items since.
+// Later ingestion jobs don't stop it; they are reported in the result.
+func (s *Service) RollbackJob(ctx context.Context, jobID uuid.UUID, opts RollbackOptions, userID pgtype.Int8) (*RollbackResult, error) {
+	tx, err := s.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.queries.WithTx(tx)
+
+	job, err := qtx.GetIngestionJobForUpdate(ctx, pgtype.UUID{Bytes: jobID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job: %w", err)
+	}
+	if job.Status != "COMPLETE" && job.Status != "COMPLETE_WITH_ISSUES" {
+		return nil, ErrJobNotRollbackable
+	}
+	if !job.ItemsInserted.Valid {
+		return nil, ErrNoChangeRecord
+	}
+	if userID.Valid {
+		if err := qtx.SetAuditUser(ctx, strconv.FormatInt(userID.Int64, 10)); err != nil {
+			return nil, fmt.Errorf("failed to set audit user: %w", err)
+		}
+	}
+
+	items, err := qtx.ListIngestionJobRollbackItems(ctx, job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the items the job changed: %w", err)
+	}
+	plan := planRollback(items)
+	if len(plan.conflicts) > 0 && !opts.Force {
+		return nil, &RollbackConflictError{Conflicts: plan.conflicts, LaterJobs: plan.laterJobs}
+	}
+	result := &RollbackResult{Conflicts: plan.conflicts, LaterJobs: plan.laterJobs}
+	restoreIDs, restoreData, insertedIDs := plan.restoreIDs, plan.restoreData, plan.insertedIDs
+
+	var events []itemEvent
+	if len(restoreIDs) > 0 {
+		if result.Restored, err = qtx.RestoreItemsFromAudit(ctx, repository.RestoreItemsFromAuditParams{
+			ItemIds: restoreIDs,
+			OldData: restoreData,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to restore items: %w", err)
+		}
+		for _, id := range restoreIDs {
+			events = append(events, itemEvent{itemID: id, eventType: EventIngestionRolledBack, data: []byte(`{"action": "restored"}`)})
+		}
+	}
+	if len(insertedIDs) > 0 && opts.DeleteInserted {
+		// Deleting an item cascades to its comments, assignments and the like, so items anything
+		// but the job itself refers to are never deleted
+		referenced, err := qtx.ListReferencedItems(ctx, repository.ListReferencedItemsParams{ItemIds: insertedIDs, JobID: job.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check references to inserted items: %w", err)
+		}
+		if len(referenced) > 0 {
+			return nil, fmt.Errorf("%w (%d items, e.g. item %d)", ErrInsertedItemsReferenced, len(referenced), referenced[0])
+		}
+		if err := qtx.DeleteIngestionJobItemEvents(ctx, repository.DeleteIngestionJobItemEventsParams{ItemIds: insertedIDs, JobID: job.ID}); err != nil {
+			return nil, fmt.Errorf("failed to delete events of inserted items: %w", err)
+		}
+		if result.Deleted, err = qtx.DeleteItems(ctx, insertedIDs); err != nil {
+			// Tables added since ListReferencedItems was written may still refer to them
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+				return nil, ErrInsertedItemsReferenced
+			}
+			return nil, fmt.Errorf("failed to delete inserted items: %w", err)
+		}
+	} else if len(insertedIDs) > 0 {
+		if result.Deactivated, err = qtx.DeactivateItems(ctx, insertedIDs); err != nil {
+			return nil, fmt.Errorf("failed to deactivate inserted items: %w", err)
+		}
+		for _, id := range insertedIDs {
+			events = append(events, itemEvent{itemID: id, eventType: EventIngestionRolledBack, data: []byte(`{"action": "deactivated"}`)})
+		}
+	}
+
+	sink := &jobSink{tx: tx, jobID: jobID, userID: userID}
+	if err := sink.writeItemEvents(ctx, events); err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("Rolled back: %d items restored, %d inserted items deactivated, %d deleted.", result.Restored, result.Deactivated, result.Deleted)
+	if err := qtx.MarkIngestionJobRolledBack(ctx, repository.MarkIngestionJobRolledBackParams{
+		Message: pgtype.Text{String: message, Valid: true},
+		ID:      job.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to mark job rolled back: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit rollback: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Rolled back ingestion job", "job_id", jobID.String(),
+		"restored", result.Restored, "deactivated", result.Deactivated, "deleted", result.Deleted, "conflicts", len(result.Conflicts), "later_jobs", len(result.LaterJobs))
+	return result, nil
+}
+
+// rollbackPlan splits the items a job changed into those restored from their audited state and
+// those it inserted, noting the ones users edited since and the jobs that changed them since.
+type rollbackPlan struct {
+	restoreIDs  []int64
+	restoreData []string
+	insertedIDs []int64
+	conflicts   []RollbackConflict
+	laterJobs   []uuid.UUID
+}
+
+func planRollback(items []repository.ListIngestionJobRollbackItemsRow) rollbackPlan {
+	var plan rollbackPlan
+	seenJobs := make(map[uuid.UUID]bool)
+	for _, item := range items {
+		for _, job := range item.LaterJobs {
+			if id := uuid.UUID(job.Bytes); !seenJobs[id] {
+				seenJobs[id] = true
+				plan.laterJobs = append(plan.laterJobs, id)
+			}
+		}
+		if item.LaterChanges > 0 {
+			plan.conflicts = append(plan.conflicts, RollbackConflict{
+				ItemID:        item.ItemID,
+				LaterChanges:  item.LaterChanges,
+				LastChangedBy: item.LastChangedBy,
+				LastChangedAt: item.LastChangedAt,
+			})
+		}
+		if item.Inserted {
+			plan.insertedIDs = append(plan.insertedIDs, item.ItemID)
+		} else {
+			plan.restoreIDs = append(plan.restoreIDs, item.ItemID)
+			plan.restoreData = append(plan.restoreData, string(item.OldData))
+		}
+	}
+	return plan
+}
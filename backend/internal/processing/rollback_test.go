@@ -0,0 +1,50 @@
+package processing
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanRollback(t *testing.T) {
+	editor := pgtype.Int8{Int64: 7, Valid: true}
+	items := []repository.ListIngestionJobRollbackItemsRow{
+		{ItemID: 1, Inserted: true},
+		{ItemID: 2, OldData: []byte(`{"status": "active"}`)},
+		{ItemID: 3, OldData: []byte(`{"status": "inactive"}`), LaterChanges: 2, LastChangedBy: editor},
+	}
+
+	plan := planRollback(items)
+	assert.Equal(t, []int64{1}, plan.insertedIDs)
+	assert.Equal(t, []int64{2, 3}, plan.restoreIDs)
+	assert.Equal(t, []string{`{"status": "active"}`, `{"status": "inactive"}`}, plan.restoreData)
+	assert.Equal(t, []RollbackConflict{{ItemID: 3, LaterChanges: 2, LastChangedBy: editor}}, plan.conflicts)
+
+	assert.Empty(t, planRollback(nil).conflicts)
+}
+
+func TestPlanRollbackReportsLaterJobs(t *testing.T) {
+	secondJob := uuid.New()
+	later := pgtype.UUID{Bytes: secondJob, Valid: true}
+
+	// A second job re-ingested the same rows without changing them: its writes only touched
+	// updated_at, so the items have no later changes and the job isn't listed
+	plan := planRollback([]repository.ListIngestionJobRollbackItemsRow{
+		{ItemID: 1, OldData: []byte(`{"status": "active"}`)},
+		{ItemID: 2, OldData: []byte(`{"status": "active"}`)},
+	})
+	assert.Empty(t, plan.conflicts)
+	assert.Empty(t, plan.laterJobs)
+	assert.Equal(t, []int64{1, 2}, plan.restoreIDs)
+
+	// Changes a later job made are reported once, apart from user edits
+	plan = planRollback([]repository.ListIngestionJobRollbackItemsRow{
+		{ItemID: 1, OldData: []byte(`{"status": "active"}`), LaterJobs: []pgtype.UUID{later}},
+		{ItemID: 2, Inserted: true, LaterJobs: []pgtype.UUID{later}},
+	})
+	assert.Empty(t, plan.conflicts)
+	assert.Equal(t, []uuid.UUID{secondJob}, plan.laterJobs)
+}
@@ -0,0 +1,133 @@
+package processing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the five standard fields: minute, hour, day of month,
+// month and day of week (0-7, both 0 and 7 are Sunday). A field is "*", a value, a range "1-5", a
+// step "*/15" or "1-30/2", or a comma-separated list of those. @hourly, @daily, @weekly and
+// @monthly are accepted as shorthands. Times are matched in local time.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit i is set when value i matches
+	domAny, dowAny                bool
+}
+
+var scheduleShorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression.
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if full, ok := scheduleShorthands[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule '%s' must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule '%s' minute: %w", expr, err)
+	}
+	if s.hour, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule '%s' hour: %w", expr, err)
+	}
+	if s.dom, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule '%s' day of month: %w", expr, err)
+	}
+	if s.month, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule '%s' month: %w", expr, err)
+	}
+	if s.dow, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule '%s' day of week: %w", expr, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return &s, nil
+}
+
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", to)
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("'%s' is outside %d-%d", rangePart, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t that the schedule matches, or the zero time if it never
+// does, e.g. for February 30th.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, either one matching is enough.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
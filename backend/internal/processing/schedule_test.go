@@ -0,0 +1,42 @@
+package processing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	start := time.Date(2025, 3, 14, 10, 7, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2025, 3, 15, 2, 0, 0, 0, time.UTC)},
+		{"30 6 * * 1-5", time.Date(2025, 3, 17, 6, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 3, 16, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either may match
+		{"0 0 20 * 6", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(start))
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -3,17 +3,17 @@ package processing
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	//	"io"
+	"io"
 	"log/slog"
-	"strings"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool" // Import the pgxpool package
+	"github.com/jjckrbbt/catalyst/backend/internal/blobstore"
 	"github.com/jjckrbbt/catalyst/backend/internal/config"
 	"github.com/jjckrbbt/catalyst/backend/internal/ingestion"
 	"github.com/jjckrbbt/catalyst/backend/internal/interfaces"
@@ -25,10 +25,10 @@ type Service struct {
 	ingestionService *ingestion.Service
 	configLoader     *ConfigLoader
 	queries          *repository.Queries
-	gcsClient        *storage.Client
-	gcsBucket        string
+	blobStore        blobstore.BlobStore
 	logger           *slog.Logger
 	cfg              *config.Config
+	embedder         interfaces.BatchEmbedderFunc // used for configs with embed_content
 	// CORRECTED: Use a connection pool
 	dbpool *pgxpool.Pool
 }
@@ -38,114 +38,342 @@ func NewService(
 	ingestionService *ingestion.Service,
 	configLoader *ConfigLoader,
 	queries *repository.Queries,
-	gcsClient *storage.Client,
+	blobStore blobstore.BlobStore,
 	logger *slog.Logger,
 	cfg *config.Config,
 	dbpool *pgxpool.Pool, // CORRECTED: Expect a pool
+	embedder interfaces.BatchEmbedderFunc,
 ) *Service {
 	return &Service{
 		ingestionService: ingestionService,
 		configLoader:     configLoader,
 		queries:          queries,
-		gcsClient:        gcsClient,
-		gcsBucket:        cfg.GCSBucketName,
+		blobStore:        blobStore,
 		logger:           logger,
 		cfg:              cfg,
 		dbpool:           dbpool,
+		embedder:         embedder,
 	}
 }
 
-// RunJob is the main entry point for processing a file. It's designed to be run in a goroutine.
-func (s *Service) RunJob(ctx context.Context, jobID uuid.UUID, reportType, gcsURI string, embedder interfaces.EmbedderFunc) {
-	// ... (The beginning of this function is unchanged)
-	jobCtx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+// DefaultJobTimeout is how long one attempt of a job may run when INGESTION_JOB_TIMEOUT_SECONDS is unset.
+const DefaultJobTimeout = 15 * time.Minute
+
+// RunJob processes a claimed ingestion job. It is the ingestion queue's job handler: it records the
+// job's final status, and returns an error when the attempt failed so the queue can decide whether
+// to retry it. Errors another attempt would not fix are marked permanent.
+func (s *Service) RunJob(ctx context.Context, job repository.IngestionJob) error {
+	jobID := uuid.UUID(job.ID.Bytes)
+	reportType := job.ReportType
+	sourceURI := job.SourceUri.String
+
+	timeout := DefaultJobTimeout
+	if s.cfg.IngestionJobTimeoutSeconds > 0 {
+		timeout = time.Duration(s.cfg.IngestionJobTimeoutSeconds) * time.Second
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	procLogger := s.logger.With("job_id", jobID.String(), "report_type", reportType)
-	procLogger.InfoContext(jobCtx, "Starting asynchronous processing job")
+	procLogger := s.logger.With("job_id", jobID.String(), "report_type", reportType, "attempt", job.Attempts)
+	procLogger.InfoContext(jobCtx, "Starting processing job")
 
-	err := s.ingestionService.UpdateJobStatus(jobCtx, jobID, "PROCESSING", "", 0, 0)
+	ingestionConfig, err := s.jobConfig(jobCtx, job)
 	if err != nil {
-		procLogger.ErrorContext(jobCtx, "Failed to update job status to PROCESSING, aborting", "error", err)
-		return
+		procLogger.ErrorContext(jobCtx, "Failed to resolve job config", "error", err)
+		s.recordJobStatus(jobID, "FAILED", err.Error(), 0, 0)
+		return err
 	}
 
-	storageKey := strings.TrimPrefix(gcsURI, fmt.Sprintf("gs://%s/", s.gcsBucket))
-	reader, err := s.gcsClient.Bucket(s.gcsBucket).Object(storageKey).NewReader(jobCtx)
+	// Triage rows outlive a failed run, so a rerun starts by dropping the previous run's rows
+	if err := s.queries.DeleteIngestionErrorsForJob(jobCtx, job.ID); err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to clear triage rows of earlier runs", "error", err)
+		return fmt.Errorf("failed to clear triage rows of earlier runs: %w", err)
+	}
+
+	storageKey, err := blobstore.KeyFromURI(sourceURI)
 	if err != nil {
-		procLogger.ErrorContext(jobCtx, "Failed to create GCS reader for file", "storage_key", storageKey, "error", err)
-		_ = s.ingestionService.UpdateJobStatus(jobCtx, jobID, "FAILED", fmt.Sprintf("Failed to read file from storage: %v", err), 0, 0)
-		return
+		procLogger.ErrorContext(jobCtx, "Job has an unreadable source URI", "source_uri", sourceURI, "error", err)
+		s.recordJobStatus(jobID, "FAILED", err.Error(), 0, 0)
+		return ingestion.Permanent(err)
+	}
+	reader, err := s.blobStore.Get(jobCtx, storageKey)
+	if err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to open file from storage", "storage_key", storageKey, "error", err)
+		s.recordJobStatus(jobID, "FAILED", fmt.Sprintf("Failed to read file from storage: %v", err), 0, 0)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return ingestion.Permanent(err)
+		}
+		return fmt.Errorf("failed to read file from storage: %w", err)
 	}
 	defer reader.Close()
 
-	ingestionConfig, found := s.configLoader.GetConfig(reportType)
-	if !found {
-		errorMsg := fmt.Sprintf("No processor configuration found for report type: %s", reportType)
-		procLogger.ErrorContext(jobCtx, errorMsg)
-		_ = s.ingestionService.UpdateJobStatus(jobCtx, jobID, "FAILED", errorMsg, 0, 0)
-		return
+	tx, err := s.dbpool.Begin(jobCtx)
+	if err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to begin transaction", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, 0)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	// If we commit successfully, this does nothing. If we error out, nothing from this job is kept.
+	defer tx.Rollback(jobCtx)
 
-	processor := NewGenericProcessor(ingestionConfig)
-	result, err := processor.Process(jobCtx, reader, s.queries, embedder)
+	qtx := s.queries.WithTx(tx)
+	// Audit rows of the items this job changes are recorded against it, for rollback
+	if err := qtx.SetAuditIngestionJob(jobCtx, jobID.String()); err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to set audit ingestion job", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, 0)
+		return fmt.Errorf("failed to set audit ingestion job: %w", err)
+	}
+	runStart, err := qtx.GetIngestionRunStart(jobCtx)
+	if err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to read the ingestion run start", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, 0)
+		return fmt.Errorf("failed to read the ingestion run start: %w", err)
+	}
+	if err := qtx.CreateTempItemsStagingTable(jobCtx); err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to create temp staging table", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, 0)
+		return fmt.Errorf("failed to create temp staging table: %w", err)
+	}
+
+	snapshot := ingestionConfig.loadMode() == LoadModeSnapshot
+	if snapshot {
+		if err := qtx.CreateTempSnapshotKeysTable(jobCtx); err != nil {
+			procLogger.ErrorContext(jobCtx, "Failed to create temp snapshot keys table", "error", err)
+			s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, 0)
+			return fmt.Errorf("failed to create temp snapshot keys table: %w", err)
+		}
+	}
+
+	version, err := configVersion(ingestionConfig)
+	if err != nil {
+		s.recordJobStatus(jobID, "FAILED", err.Error(), 0, 0)
+		return ingestion.Permanent(err)
+	}
 
-	if result != nil && len(result.TriageRows) > 0 {
-		s.logTriageItems(jobCtx, jobID, result.TriageRows)
+	sink := &jobSink{
+		service:            s,
+		tx:                 tx,
+		qtx:                qtx,
+		jobID:              jobID,
+		userID:             job.UserID,
+		sourceURI:          sourceURI,
+		configVersion:      version,
+		loadMode:           ingestionConfig.loadMode(),
+		recordSnapshotKeys: snapshot,
+		runStart:           runStart,
 	}
+	processor := NewGenericProcessor(ingestionConfig).WithOptions(ProcessingOptions{
+		BatchSize: s.cfg.IngestionBatchSize,
+		Workers:   s.cfg.IngestionWorkers,
+		Embedding: EmbeddingOptions{
+			BatchSize:  s.cfg.IngestionEmbedBatchSize,
+			Workers:    s.cfg.IngestionEmbedWorkers,
+			MaxRetries: s.cfg.IngestionEmbedMaxRetries,
+			RateLimit:  s.cfg.IngestionEmbedRateLimit,
+		},
+	})
+	result, err := processor.Process(jobCtx, reader, s.queries, s.embedder, sink)
 
 	if err != nil {
 		errorMsg := err.Error()
 		rowsTriaged := int64(0)
 		if result != nil {
-			rowsTriaged = int64(len(result.TriageRows))
+			rowsTriaged = int64(result.RowsTriaged)
 		}
 		procLogger.ErrorContext(jobCtx, "Processing job finished with critical error", "error", err)
-		_ = s.ingestionService.UpdateJobStatus(jobCtx, jobID, "FAILED", errorMsg, 0, rowsTriaged)
-		return
+		s.recordJobStatus(jobID, "FAILED", errorMsg, 0, rowsTriaged)
+		// A cancelled or timed-out job may succeed on another attempt; a bad file won't
+		if jobCtx.Err() != nil {
+			return err
+		}
+		return ingestion.Permanent(err)
 	}
 
-	var rowsUpserted int64 = 0
-	if result != nil && len(result.SuccessfulItems) > 0 {
-		upsertedCount, err := s.saveSuccessfulItems(jobCtx, result.SuccessfulItems)
-		if err != nil {
-			procLogger.ErrorContext(jobCtx, "Failed to save successful items to database", "error", err)
-			_ = s.ingestionService.UpdateJobStatus(jobCtx, jobID, "FAILED", "Error saving processed data to database", 0, int64(len(result.TriageRows)))
-			return
+	if snapshot {
+		if sink.changes.Deactivated, err = s.applySnapshot(jobCtx, qtx, ingestionConfig, job); err != nil {
+			procLogger.ErrorContext(jobCtx, "Snapshot deactivation failed", "error", err)
+			s.recordJobStatus(jobID, "FAILED", err.Error(), 0, int64(result.RowsTriaged))
+			return err
 		}
-		rowsUpserted = upsertedCount
 	}
 
-	rowsTriaged := int64(len(result.TriageRows))
+	changes := sink.changes
+	if err := qtx.SetIngestionJobChangeCounts(jobCtx, repository.SetIngestionJobChangeCountsParams{
+		ItemsInserted:    pgtype.Int4{Int32: int32(changes.Inserted), Valid: true},
+		ItemsUpdated:     pgtype.Int4{Int32: int32(changes.Updated), Valid: true},
+		ItemsUnchanged:   pgtype.Int4{Int32: int32(changes.Unchanged), Valid: true},
+		ItemsDeactivated: pgtype.Int4{Int32: int32(changes.Deactivated), Valid: true},
+		ID:               job.ID,
+	}); err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to record the job's change counts", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, int64(result.RowsTriaged))
+		return fmt.Errorf("failed to record change counts: %w", err)
+	}
+
+	if err := tx.Commit(jobCtx); err != nil {
+		procLogger.ErrorContext(jobCtx, "Failed to commit processed items", "error", err)
+		s.recordJobStatus(jobID, "FAILED", "Error saving processed data to database", 0, int64(result.RowsTriaged))
+		return fmt.Errorf("failed to commit processed items: %w", err)
+	}
+
+	rowsUpserted := result.RowsUpserted
+	rowsTriaged := int64(result.RowsTriaged)
 	finalStatus := "COMPLETE"
-	finalMessage := fmt.Sprintf("Processed %d items successfully. %d rows sent for triage. %d blank rows discarded.", rowsUpserted, rowsTriaged, result.BlankRowsDiscarded)
+	finalMessage := fmt.Sprintf("Processed %d items successfully (%d inserted, %d updated, %d unchanged). %d rows sent for triage. %d blank rows discarded.",
+		rowsUpserted, changes.Inserted, changes.Updated, changes.Unchanged, rowsTriaged, result.BlankRowsDiscarded)
+	if result.DuplicateRowsDropped > 0 {
+		finalMessage += fmt.Sprintf(" %d duplicate rows dropped by the '%s' duplicate policy.", result.DuplicateRowsDropped, ingestionConfig.DuplicatePolicy)
+	}
+	if snapshot {
+		finalMessage += fmt.Sprintf(" %d items missing from the snapshot were set to %s.", changes.Deactivated, ingestionConfig.snapshotOptions().DeactivateStatus)
+	}
+	if result.EmbeddingsFailed > 0 {
+		finalMessage += fmt.Sprintf(" %d items loaded without an embedding and queued for backfill.", result.EmbeddingsFailed)
+	}
 	if rowsTriaged > 0 {
 		finalStatus = "COMPLETE_WITH_ISSUES"
 	}
-	procLogger.InfoContext(jobCtx, "Processing job completed", "status", finalStatus, "rows_upserted", rowsUpserted, "rows_for_triage", rowsTriaged)
-	_ = s.ingestionService.UpdateJobStatus(jobCtx, jobID, finalStatus, finalMessage, rowsUpserted, rowsTriaged)
+	procLogger.InfoContext(jobCtx, "Processing job completed", "status", finalStatus, "rows_upserted", rowsUpserted, "rows_for_triage", rowsTriaged, "embeddings_failed", result.EmbeddingsFailed)
+	s.recordJobStatus(jobID, finalStatus, finalMessage, rowsUpserted, rowsTriaged)
+	return nil
+}
+
+// Preview processes an uploaded file with the report type's config and reports what a job would do.
+// It does not touch storage, ingestion_jobs or items.
+func (s *Service) Preview(ctx context.Context, reportType string, file io.Reader, sampleSize int) (*PreviewResult, error) {
+	ingestionConfig, found := s.configLoader.GetConfig(reportType)
+	if !found {
+		return nil, fmt.Errorf("no processor configuration found for report type: %s", reportType)
+	}
+	return Preview(ctx, ingestionConfig, file, s.queries, ProcessingOptions{
+		BatchSize: s.cfg.IngestionBatchSize,
+		Workers:   s.cfg.IngestionWorkers,
+	}, sampleSize)
+}
+
+// recordJobStatus writes a job's final status. The write gets its own bounded context rather than the
+// job's, which is already done when the job timed out or the server is shutting down.
+func (s *Service) recordJobStatus(jobID uuid.UUID, status, message string, rowsUpserted, rowsTriaged int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.ingestionService.UpdateJobStatus(ctx, jobID, status, message, rowsUpserted, rowsTriaged)
+}
+
+// jobConfig returns the config a job runs with. A job keeps the config of its first run, so a
+// retry processes the file the same way unless it was queued to use the current config.
+// Errors another attempt would not fix are marked permanent. The job is linked to the stored
+// revision of its config.
+func (s *Service) jobConfig(ctx context.Context, job repository.IngestionJob) (IngestionConfig, error) {
+	var ingestionConfig IngestionConfig
+	var sourceFile string
+	if len(job.ConfigSnapshot) > 0 {
+		if err := json.Unmarshal(job.ConfigSnapshot, &ingestionConfig); err != nil {
+			return IngestionConfig{}, ingestion.Permanent(fmt.Errorf("failed to read the job's saved config: %w", err))
+		}
+		// Jobs saved before config revisions were stored are linked to one on their next run
+		if job.ConfigRevisionID.Valid {
+			return ingestionConfig, nil
+		}
+	} else {
+		var found bool
+		ingestionConfig, found = s.configLoader.GetConfig(job.ReportType)
+		if !found {
+			return IngestionConfig{}, ingestion.Permanent(fmt.Errorf("No processor configuration found for report type: %s", job.ReportType))
+		}
+		sourceFile = s.configLoader.sourceFile(job.ReportType)
+	}
+
+	revision, err := s.recordConfigRevision(ctx, ingestionConfig, sourceFile)
+	if err != nil {
+		return IngestionConfig{}, fmt.Errorf("failed to save the job's config: %w", err)
+	}
+	snapshot, err := json.Marshal(ingestionConfig)
+	if err != nil {
+		return IngestionConfig{}, fmt.Errorf("failed to save the job's config: %w", err)
+	}
+	if err := s.queries.SetIngestionJobConfigSnapshot(ctx, repository.SetIngestionJobConfigSnapshotParams{
+		ConfigSnapshot:   snapshot,
+		ConfigRevisionID: pgtype.Int8{Int64: revision.ID, Valid: true},
+		ID:               job.ID,
+	}); err != nil {
+		return IngestionConfig{}, fmt.Errorf("failed to save the job's config: %w", err)
+	}
+	return ingestionConfig, nil
 }
 
-func (s *Service) saveSuccessfulItems(ctx context.Context, items []repository.Item) (int64, error) {
-	// Start a new database transaction. This is crucial for data integrity.
-	tx, err := s.dbpool.Begin(ctx)
+// jobSink streams processed batches into the job's transaction. Triage rows are written
+// outside the transaction so they survive even if the job ultimately fails.
+type jobSink struct {
+	service            *Service
+	tx                 pgx.Tx
+	qtx                *repository.Queries
+	jobID              uuid.UUID
+	userID             pgtype.Int8 // created_by of the item events
+	sourceURI          string      // source_uri and config_version of the item lineage
+	configVersion      string
+	loadMode           string
+	recordSnapshotKeys bool                               // load_mode snapshot: remember loaded keys in temp_snapshot_keys
+	runStart           repository.GetIngestionRunStartRow // ids written before this run, to tell its rows from the job's earlier runs
+	changes            ChangeCounts                       // what the batches written so far did to items
+}
+
+func (js *jobSink) WriteItems(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error) {
+	rowsAffected, err := js.saveItemBatch(ctx, items, sources)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, err
 	}
-	// Defer a rollback. If we commit successfully, this does nothing. If we error out, it cleans up the mess.
-	defer tx.Rollback(ctx)
 
-	// Create a new querier that is bound to our transaction.
-	qtx := s.queries.WithTx(tx)
+	// Items that now have a vector no longer need the backfill an earlier job may have queued
+	var embedded []string
+	for _, item := range items {
+		if item.Embedding.Slice() != nil {
+			embedded = append(embedded, item.BusinessKey.String)
+		}
+	}
+	if len(embedded) > 0 {
+		if err := js.qtx.ClearPendingEmbeddings(ctx, repository.ClearPendingEmbeddingsParams{
+			ItemType:     items[0].ItemType,
+			BusinessKeys: embedded,
+		}); err != nil {
+			return 0, fmt.Errorf("failed to clear pending embeddings: %w", err)
+		}
+	}
+	return rowsAffected, nil
+}
 
-	// --- Step 1: Create the temp table using our new sqlc function ---
-	if err := qtx.CreateTempItemsStagingTable(ctx); err != nil {
-		return 0, fmt.Errorf("failed to create temp staging table: %w", err)
+// WritePendingEmbeddings queues items that were loaded without a vector for a later backfill.
+// It runs in the job's transaction, after WriteItems, so the items it refers to exist.
+func (js *jobSink) WritePendingEmbeddings(ctx context.Context, itemType string, pending []PendingEmbedding) error {
+	params := repository.FlagItemsForEmbeddingBackfillParams{
+		JobID:        pgtype.UUID{Bytes: js.jobID, Valid: true},
+		BusinessKeys: make([]string, len(pending)),
+		SourceTexts:  make([]string, len(pending)),
+		LastErrors:   make([]string, len(pending)),
+		ItemType:     repository.ItemType(itemType),
 	}
+	for i, p := range pending {
+		params.BusinessKeys[i] = p.BusinessKey
+		params.SourceTexts[i] = p.Text
+		params.LastErrors[i] = p.Error
+	}
+	if err := js.qtx.FlagItemsForEmbeddingBackfill(ctx, params); err != nil {
+		return fmt.Errorf("failed to queue %d items for embedding backfill: %w", len(pending), err)
+	}
+	return nil
+}
 
-	// --- Step 2: Use pgx.CopyFrom to bulk-insert data into the temp table ---
+func (js *jobSink) WriteTriage(ctx context.Context, rows []TriageRow) error {
+	js.service.logTriageItems(ctx, js.jobID, rows)
+	return nil
+}
 
-	_, err = tx.CopyFrom(
+// saveItemBatch copies one batch into the staging table, writes it to items as the load mode says,
+// records an item event for each item that changed and the lineage of each item written, and
+// clears the staging table for the next batch. The caller owns the transaction and is responsible
+// for committing it.
+func (js *jobSink) saveItemBatch(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error) {
+	// --- Step 1: Use pgx.CopyFrom to bulk-insert the batch into the temp table ---
+	_, err := js.tx.CopyFrom(
 		ctx,
 		pgx.Identifier{"temp_items_staging"},
 		[]string{"item_type", "scope", "business_key", "status", "custom_properties", "embedding"},
@@ -166,25 +394,92 @@ func (s *Service) saveSuccessfulItems(ctx context.Context, items []repository.It
 			}, nil
 		}),
 	)
-
 	if err != nil {
 		return 0, fmt.Errorf("failed to copy data to staging table: %w", err)
 	}
 
-	// --- Step 3: Upsert from the staging table using our existing sqlc function ---
-	rowsAffected, err := qtx.UpsertItems(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to upsert items from staging table: %w", err)
+	// --- Step 2: Upsert from the staging table, or only insert new items, and see what changed ---
+	var events []itemEvent
+	var changes ChangeCounts
+	itemIDs := make(map[string]int64, len(items))
+	switch js.loadMode {
+	case LoadModeAppendOnly, LoadModeInsertOnly:
+		inserted, err := js.qtx.InsertNewItems(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert items from staging table: %w", err)
+		}
+		for _, row := range inserted {
+			itemIDs[row.BusinessKey.String] = row.ID
+		}
+		events, changes = insertChanges(inserted, len(items))
+	default:
+		written, err := js.qtx.UpsertItems(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to upsert items from staging table: %w", err)
+		}
+		for _, row := range written {
+			itemIDs[row.BusinessKey.String] = row.ID
+		}
+		if events, changes, err = upsertChanges(written); err != nil {
+			return 0, err
+		}
+	}
+	if err := js.writeItemEvents(ctx, events); err != nil {
+		return 0, err
+	}
+	if err := js.writeLineage(ctx, itemIDs, items, sources); err != nil {
+		return 0, err
+	}
+	js.changes.add(changes)
+	if js.recordSnapshotKeys {
+		if err := js.qtx.RecordSnapshotKeys(ctx); err != nil {
+			return 0, fmt.Errorf("failed to record snapshot keys: %w", err)
+		}
 	}
 
-	// --- Step 4: If all steps succeeded, commit the transaction ---
-	if err := tx.Commit(ctx); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	// --- Step 3: Empty the staging table so the next batch starts clean ---
+	if err := js.qtx.TruncateTempItemsStaging(ctx); err != nil {
+		return 0, fmt.Errorf("failed to truncate staging table: %w", err)
 	}
 
-	return rowsAffected, nil
+	return int64(len(itemIDs)), nil
 }
 
+// applySnapshot deactivates the items a snapshot job's file no longer contains, in the job's
+// transaction. It refuses when more than max_deactivate_percent of the covered active items would
+// go, which usually means a truncated or wrong file. Items of triaged rows count as missing until
+// their rows are corrected and resubmitted, which reactivates them.
+func (s *Service) applySnapshot(ctx context.Context, qtx *repository.Queries, config IngestionConfig, job repository.IngestionJob) (int64, error) {
+	opts := config.snapshotOptions()
+	counts, err := qtx.CountSnapshotDeactivations(ctx, repository.CountSnapshotDeactivationsParams{
+		ItemType:    repository.ItemType(config.ItemType),
+		ScopeToFile: opts.ScopeToFile,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count items missing from snapshot: %w", err)
+	}
+	if counts.MissingItems == 0 {
+		return 0, nil
+	}
+	percent := float64(counts.MissingItems) * 100 / float64(counts.ActiveItems)
+	if percent > *opts.MaxDeactivatePercent {
+		return 0, ingestion.Permanent(fmt.Errorf(
+			"snapshot would deactivate %d of %d active items (%.1f%%), more than the %.1f%% allowed by max_deactivate_percent; nothing was loaded",
+			counts.MissingItems, counts.ActiveItems, percent, *opts.MaxDeactivatePercent))
+	}
+
+	deactivated, err := qtx.DeactivateItemsMissingFromSnapshot(ctx, repository.DeactivateItemsMissingFromSnapshotParams{
+		Status:      repository.ItemStatus(opts.DeactivateStatus),
+		ItemType:    repository.ItemType(config.ItemType),
+		ScopeToFile: opts.ScopeToFile,
+		CreatedBy:   job.UserID,
+		JobID:       job.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to deactivate items missing from snapshot: %w", err)
+	}
+	return deactivated, nil
+}
 
 func (s *Service) logTriageItems(ctx context.Context, jobID uuid.UUID, triageRows []TriageRow) {
 	procLogger := s.logger.With("job_id", jobID.String())
@@ -195,7 +490,7 @@ func (s *Service) logTriageItems(ctx context.Context, jobID uuid.UUID, triageRow
 	for _, row := range triageRows {
 		rowDataJSON, err := json.Marshal(row.OriginalRecord)
 		if err != nil {
-			procLogger.Error("Failed to marshal original row data for triage", "error", err, "row", row.OriginalRecord)
+			procLogger.Error("Failed to marshal original row data for triage", "error", err, "row_number", row.RowNumber)
 			continue
 		}
 
@@ -204,6 +499,8 @@ func (s *Service) logTriageItems(ctx context.Context, jobID uuid.UUID, triageRow
 			JobID:            pgJobID,
 			OriginalRowData:  rowDataJSON,
 			ReasonForFailure: row.FailureReason,
+			RowNumber:        pgtype.Int4{Int32: int32(row.RowNumber), Valid: row.RowNumber > 0},
+			SourceLocation:   pgtype.Text{String: row.Location, Valid: row.Location != ""},
 		}
 
 		_, err = s.queries.CreateIngestionError(ctx, params)
@@ -0,0 +1,386 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/ingestion"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// Supported values for SourceConfig.Type
+const (
+	SourceDirectory = "directory" // a local or mounted network directory
+)
+
+const (
+	// DefaultSourceSettleSeconds is how long a file must go unmodified before it is picked up, so
+	// files still being copied in are left for the next run.
+	DefaultSourceSettleSeconds = 60
+	// DefaultSourcePollInterval is how often the watcher checks schedules and settles finished jobs.
+	DefaultSourcePollInterval = 30 * time.Second
+)
+
+// sourceInflightDir holds picked-up files, named <job id>_<filename>, until their job finishes.
+const sourceInflightDir = ".processing"
+
+// sourceClaimTimeout is how long a picked-up file may wait for its job to be created. A file still
+// without a job after that was left by a watcher that stopped part way, and is put back to be picked
+// up again.
+const sourceClaimTimeout = time.Hour
+
+// SourceConfig declares a place files for the report type are picked up from on a schedule, in
+// addition to uploads. Each matching file becomes an ingestion job; once the job finishes the
+// file is moved to processed_dir, or to failed_dir if the job failed or was cancelled. Files
+// whose content was recently loaded go straight to failed_dir. A file picked up by a watcher that
+// stopped before creating its job is put back after sourceClaimTimeout.
+type SourceConfig struct {
+	Type          string `yaml:"type"`                     // directory
+	Path          string `yaml:"path"`                     // the directory to watch; subdirectories are ignored
+	Pattern       string `yaml:"pattern"`                  // filename glob, e.g. "claims_*.csv"
+	Schedule      string `yaml:"schedule"`                 // cron expression, e.g. "0 2 * * *"
+	ProcessedDir  string `yaml:"processed_dir,omitempty"`  // defaults to <path>/processed; relative to path
+	FailedDir     string `yaml:"failed_dir,omitempty"`     // defaults to <path>/failed; relative to path
+	SettleSeconds int    `yaml:"settle_seconds,omitempty"` // defaults to DefaultSourceSettleSeconds
+}
+
+func (s SourceConfig) processedDir() string {
+	return s.resolveDir(s.ProcessedDir, "processed")
+}
+
+func (s SourceConfig) failedDir() string {
+	return s.resolveDir(s.FailedDir, "failed")
+}
+
+func (s SourceConfig) inflightDir() string {
+	return filepath.Join(s.Path, sourceInflightDir)
+}
+
+func (s SourceConfig) resolveDir(dir, fallback string) string {
+	if dir == "" {
+		dir = fallback
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(s.Path, dir)
+}
+
+func (s SourceConfig) settleAge() time.Duration {
+	if s.SettleSeconds > 0 {
+		return time.Duration(s.SettleSeconds) * time.Second
+	}
+	return DefaultSourceSettleSeconds * time.Second
+}
+
+func validateSources(sources []SourceConfig) error {
+	for i, source := range sources {
+		if source.Type != SourceDirectory {
+			return fieldErrorf([]any{"sources", i, "type"}, "sources[%d]: unsupported type '%s'", i, source.Type)
+		}
+		if source.Path == "" {
+			return fieldErrorf([]any{"sources", i, "path"}, "sources[%d]: path is required", i)
+		}
+		if source.Pattern == "" {
+			return fieldErrorf([]any{"sources", i, "pattern"}, "sources[%d]: pattern is required", i)
+		}
+		if _, err := filepath.Match(source.Pattern, ""); err != nil {
+			return fieldErrorf([]any{"sources", i, "pattern"}, "sources[%d]: invalid pattern '%s': %w", i, source.Pattern, err)
+		}
+		schedule, err := ParseSchedule(source.Schedule)
+		if err != nil {
+			return fieldErrorf([]any{"sources", i, "schedule"}, "sources[%d]: %w", i, err)
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return fieldErrorf([]any{"sources", i, "schedule"}, "sources[%d]: schedule '%s' never matches", i, source.Schedule)
+		}
+		if source.SettleSeconds < 0 {
+			return fieldErrorf([]any{"sources", i, "settle_seconds"}, "sources[%d]: settle_seconds must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// SourceWatcher picks up files from the sources declared in ingestion configs when their schedule
+// is due, and files them away once their jobs finish. Replicas sharing a directory can each run a
+// watcher: a file is claimed by renaming it, which only one of them can do.
+type SourceWatcher struct {
+	configLoader     *ConfigLoader
+	ingestionService *ingestion.Service
+	queries          repository.Querier
+	notify           func() // wakes the job queue after jobs are created
+	logger           *slog.Logger
+	nextRun          map[string]time.Time // by sourceKey
+}
+
+// NewSourceWatcher creates a watcher for the sources of the configs loader holds.
+func NewSourceWatcher(configLoader *ConfigLoader, ingestionService *ingestion.Service, queries repository.Querier, notify func(), logger *slog.Logger) *SourceWatcher {
+	return &SourceWatcher{
+		configLoader:     configLoader,
+		ingestionService: ingestionService,
+		queries:          queries,
+		notify:           notify,
+		logger:           logger.With("component", "source_watcher"),
+		nextRun:          make(map[string]time.Time),
+	}
+}
+
+// Run checks the sources every DefaultSourcePollInterval until ctx is cancelled.
+func (w *SourceWatcher) Run(ctx context.Context) {
+	w.logger.Info("Source watcher started")
+	ticker := time.NewTicker(DefaultSourcePollInterval)
+	defer ticker.Stop()
+	for {
+		w.poll(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Source watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll files away the files of finished jobs and scans the sources whose schedule is due. A
+// source's first run is the first time its schedule matches after the watcher sees it.
+func (w *SourceWatcher) poll(ctx context.Context, now time.Time) {
+	seen := make(map[string]bool)
+	for _, config := range w.configLoader.Configs() {
+		for _, source := range config.Sources {
+			key := sourceKey(config.ReportType, source)
+			seen[key] = true
+			w.settle(ctx, source, now)
+
+			schedule, err := ParseSchedule(source.Schedule)
+			if err != nil {
+				continue // rejected when the config was loaded
+			}
+			next, known := w.nextRun[key]
+			if known && now.Before(next) {
+				continue
+			}
+			if next = schedule.Next(now); next.IsZero() {
+				continue // never matches; rejected when the config was loaded
+			}
+			w.nextRun[key] = next
+			if known {
+				w.scan(ctx, config.ReportType, source, now)
+			}
+		}
+	}
+	for key := range w.nextRun {
+		if !seen[key] {
+			delete(w.nextRun, key)
+		}
+	}
+}
+
+func sourceKey(reportType string, source SourceConfig) string {
+	return strings.Join([]string{reportType, source.Path, source.Pattern, source.Schedule}, "|")
+}
+
+// scan starts a job for each settled file in the source directory that matches its pattern.
+func (w *SourceWatcher) scan(ctx context.Context, reportType string, source SourceConfig, now time.Time) {
+	logger := w.logger.With("report_type", reportType, "path", source.Path)
+	names, err := readySourceFiles(source, now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list source directory", "error", err)
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+	if err := os.MkdirAll(source.inflightDir(), 0o755); err != nil {
+		logger.ErrorContext(ctx, "Failed to create source processing directory", "error", err)
+		return
+	}
+
+	started := 0
+	for _, name := range names {
+		jobID := uuid.New()
+		path := filepath.Join(source.Path, name)
+		claimed := filepath.Join(source.inflightDir(), jobID.String()+"_"+name)
+		// The claim time is kept as the modification time, so settle can tell abandoned claims
+		err := os.Chtimes(path, now, now)
+		if err == nil {
+			err = os.Rename(path, claimed)
+		}
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) { // otherwise another watcher claimed it first
+				logger.ErrorContext(ctx, "Failed to claim source file", "file", name, "error", err)
+			}
+			continue
+		}
+
+		if err := w.startJob(ctx, jobID, claimed, name, reportType, source); err != nil {
+			var duplicate *ingestion.DuplicateUploadError
+			if errors.As(err, &duplicate) {
+				logger.WarnContext(ctx, "Source file was already loaded", "file", name, "existing_job_id", uuid.UUID(duplicate.Job.ID.Bytes).String())
+			} else {
+				logger.ErrorContext(ctx, "Failed to start job for source file", "file", name, "error", err)
+			}
+			if err := moveSourceFile(claimed, source.failedDir(), name, jobID); err != nil {
+				logger.ErrorContext(ctx, "Failed to move source file", "file", name, "error", err)
+			}
+			continue
+		}
+		logger.InfoContext(ctx, "Started job for source file", "file", name, "job_id", jobID.String())
+		started++
+	}
+	if started > 0 {
+		w.notify()
+	}
+}
+
+func (w *SourceWatcher) startJob(ctx context.Context, jobID uuid.UUID, path, name, reportType string, source SourceConfig) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = w.ingestionService.StartSourceJob(ctx, jobID, file, name, reportType, ingestion.SourceTypeDirectory, map[string]string{
+		"directory": source.Path,
+		"pattern":   source.Pattern,
+	})
+	return err
+}
+
+// settle moves picked-up files whose jobs have finished to the processed or failed directory, and
+// puts files whose job was never created back into the source directory.
+func (w *SourceWatcher) settle(ctx context.Context, source SourceConfig, now time.Time) {
+	entries, err := os.ReadDir(source.inflightDir())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.logger.ErrorContext(ctx, "Failed to list source processing directory", "path", source.Path, "error", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		jobID, name, ok := parseClaimedName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(source.inflightDir(), entry.Name())
+		job, err := w.queries.GetIngestionJob(ctx, pgtype.UUID{Bytes: jobID, Valid: true})
+		if errors.Is(err, pgx.ErrNoRows) {
+			if !claimAbandoned(entry, now) {
+				continue // its job is still being created
+			}
+			w.logger.WarnContext(ctx, "Returning source file whose job was never created", "file", name, "job_id", jobID.String())
+			if err := moveSourceFile(path, source.Path, name, jobID); err != nil {
+				w.logger.ErrorContext(ctx, "Failed to move source file", "file", name, "job_id", jobID.String(), "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			w.logger.ErrorContext(ctx, "Failed to look up job of source file", "file", name, "job_id", jobID.String(), "error", err)
+			continue
+		}
+		dir := ""
+		switch settledAs(job.Status) {
+		case settledProcessed:
+			dir = source.processedDir()
+		case settledFailed:
+			dir = source.failedDir()
+		default:
+			continue
+		}
+		if err := moveSourceFile(path, dir, name, jobID); err != nil {
+			w.logger.ErrorContext(ctx, "Failed to move source file", "file", name, "job_id", jobID.String(), "error", err)
+		}
+	}
+}
+
+// claimAbandoned reports whether a picked-up file has waited longer than sourceClaimTimeout for its
+// job to be created.
+func claimAbandoned(entry fs.DirEntry, now time.Time) bool {
+	info, err := entry.Info()
+	if err != nil {
+		return false // moved since the listing
+	}
+	return now.Sub(info.ModTime()) > sourceClaimTimeout
+}
+
+type settlement int
+
+const (
+	settledPending settlement = iota
+	settledProcessed
+	settledFailed
+)
+
+// settledAs says where the file of a job with status belongs. Jobs that may still run keep theirs.
+func settledAs(status string) settlement {
+	switch status {
+	case "COMPLETE", "COMPLETE_WITH_ISSUES", "ROLLED_BACK":
+		return settledProcessed
+	case "FAILED", "CANCELLED":
+		return settledFailed
+	}
+	return settledPending
+}
+
+// readySourceFiles lists the files in the source directory that match its pattern and have not
+// been modified for the settle time, sorted by name.
+func readySourceFiles(source SourceConfig, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if match, _ := filepath.Match(source.Pattern, entry.Name()); !match {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the listing
+		}
+		if now.Sub(info.ModTime()) < source.settleAge() {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// parseClaimedName splits an in-flight file name into its job ID and original filename.
+func parseClaimedName(claimed string) (uuid.UUID, string, bool) {
+	id, name, ok := strings.Cut(claimed, "_")
+	if !ok || name == "" {
+		return uuid.UUID{}, "", false
+	}
+	jobID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, "", false
+	}
+	return jobID, name, true
+}
+
+// moveSourceFile moves a file into dir under its original name, prefixed with the job ID when a
+// file of that name is already there.
+func moveSourceFile(path, dir, name string, jobID uuid.UUID) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		target = filepath.Join(dir, jobID.String()+"_"+name)
+	}
+	return os.Rename(path, target)
+}
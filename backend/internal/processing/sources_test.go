@@ -0,0 +1,118 @@
+package processing
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSources(t *testing.T) {
+	valid := SourceConfig{Type: SourceDirectory, Path: "/mnt/feeds", Pattern: "claims_*.csv", Schedule: "0 2 * * *"}
+	assert.NoError(t, validateSources([]SourceConfig{valid}))
+
+	invalid := map[string]func(*SourceConfig){
+		"type":     func(s *SourceConfig) { s.Type = "sftp" },
+		"path":     func(s *SourceConfig) { s.Path = "" },
+		"pattern":  func(s *SourceConfig) { s.Pattern = "claims_[.csv" },
+		"schedule": func(s *SourceConfig) { s.Schedule = "nightly" },
+		"never":    func(s *SourceConfig) { s.Schedule = "0 0 30 2 *" },
+		"settle":   func(s *SourceConfig) { s.SettleSeconds = -1 },
+	}
+	for name, breakIt := range invalid {
+		source := valid
+		breakIt(&source)
+		assert.Error(t, validateSources([]SourceConfig{source}), name)
+	}
+}
+
+func TestReadySourceFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-5 * time.Minute)
+	for name, modified := range map[string]time.Time{
+		"claims_0102.csv": old,
+		"claims_0101.csv": old,
+		"claims_0103.csv": now, // still being written
+		"policies.csv":    old,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("a,b\n"), 0o644))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "claims_archive.csv"), 0o755))
+
+	source := SourceConfig{Type: SourceDirectory, Path: dir, Pattern: "claims_*.csv", Schedule: "@hourly"}
+	names, err := readySourceFiles(source, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claims_0101.csv", "claims_0102.csv"}, names)
+}
+
+func TestSourceFileSettlement(t *testing.T) {
+	dir := t.TempDir()
+	source := SourceConfig{Type: SourceDirectory, Path: dir, Pattern: "*.csv", Schedule: "@daily", ProcessedDir: "done"}
+	assert.Equal(t, filepath.Join(dir, "done"), source.processedDir())
+	assert.Equal(t, filepath.Join(dir, "failed"), source.failedDir())
+
+	jobID := uuid.New()
+	id, name, ok := parseClaimedName(jobID.String() + "_claims_01.csv")
+	assert.True(t, ok)
+	assert.Equal(t, jobID, id)
+	assert.Equal(t, "claims_01.csv", name)
+	_, _, ok = parseClaimedName("claims_01.csv")
+	assert.False(t, ok)
+
+	assert.Equal(t, settledProcessed, settledAs("COMPLETE_WITH_ISSUES"))
+	assert.Equal(t, settledFailed, settledAs("CANCELLED"))
+	assert.Equal(t, settledPending, settledAs("QUEUED"))
+
+	// A second file with the same name keeps the first one
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(dir, "claims_01.csv")
+		require.NoError(t, os.WriteFile(path, []byte("a,b\n"), 0o644))
+		require.NoError(t, moveSourceFile(path, source.processedDir(), "claims_01.csv", jobID))
+	}
+	assert.FileExists(t, filepath.Join(dir, "done", "claims_01.csv"))
+	assert.FileExists(t, filepath.Join(dir, "done", jobID.String()+"_claims_01.csv"))
+}
+
+type sourceJobQuerier struct {
+	repository.Querier
+}
+
+func (q *sourceJobQuerier) GetIngestionJob(ctx context.Context, id pgtype.UUID) (repository.IngestionJob, error) {
+	return repository.IngestionJob{}, pgx.ErrNoRows
+}
+
+func TestSettleReturnsAbandonedClaims(t *testing.T) {
+	dir := t.TempDir()
+	source := SourceConfig{Type: SourceDirectory, Path: dir, Pattern: "*.csv", Schedule: "@daily"}
+	require.NoError(t, os.Mkdir(source.inflightDir(), 0o755))
+	now := time.Now()
+	recent, abandoned := uuid.New().String()+"_recent.csv", uuid.New().String()+"_abandoned.csv"
+	for name, claimedAt := range map[string]time.Time{
+		recent:    now.Add(-time.Minute),
+		abandoned: now.Add(-2 * sourceClaimTimeout),
+	} {
+		path := filepath.Join(source.inflightDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte("a,b\n"), 0o644))
+		require.NoError(t, os.Chtimes(path, claimedAt, claimedAt))
+	}
+
+	w := NewSourceWatcher(nil, nil, &sourceJobQuerier{}, func() {}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	w.settle(context.Background(), source, now)
+	// A job may still be created for the recent claim; the abandoned one goes back to be picked up again
+	assert.FileExists(t, filepath.Join(source.inflightDir(), recent))
+	assert.FileExists(t, filepath.Join(dir, "abandoned.csv"))
+	assert.NoFileExists(t, filepath.Join(source.inflightDir(), abandoned))
+}
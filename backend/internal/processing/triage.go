@@ -0,0 +1,355 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jjckrbbt/catalyst/backend/internal/repository"
+)
+
+// Resolution statuses of a triage row (ingestion_errors.resolution_status)
+const (
+	TriageOpen      = "open"
+	TriageResolved  = "resolved"
+	TriageDismissed = "dismissed"
+)
+
+var (
+	// ErrTriageRowNotFound is returned when a triage row ID does not belong to the job.
+	ErrTriageRowNotFound = errors.New("triage row not found for this job")
+	// ErrTriageRowClosed is returned when resubmitting a triage row that is no longer open.
+	ErrTriageRowClosed = errors.New("triage row is not open")
+	// ErrJobNotFinished is returned when a job's triage rows are changed before the job has completed.
+	ErrJobNotFinished = errors.New("job has not completed")
+)
+
+// TriageCorrection is an edit to a triage row. OriginalRowData holds only the columns being
+// changed; the other columns keep their stored values. A nil map resubmits the row as it is.
+type TriageCorrection struct {
+	ID              uuid.UUID         `json:"id"`
+	OriginalRowData map[string]string `json:"original_row_data"`
+}
+
+// ResubmitResult reports what happened to each resubmitted triage row.
+type ResubmitResult struct {
+	Resubmitted  int              `json:"resubmitted"`
+	Resolved     int              `json:"resolved"`
+	StillOpen    int              `json:"still_open"`
+	RowsUpserted int64            `json:"rows_upserted"`
+	Changes      ChangeCounts     `json:"changes"`
+	Rows         []ResubmittedRow `json:"rows"`
+}
+
+// ResubmittedRow is the outcome for one triage row. ReasonForFailure is set when it failed again.
+type ResubmittedRow struct {
+	ID               uuid.UUID `json:"id"`
+	ResolutionStatus string    `json:"resolution_status"`
+	ReasonForFailure string    `json:"reason_for_failure,omitempty"`
+}
+
+// ResubmitTriage applies corrections to a job's open triage rows and runs them through the
+// processor again under the config the job ran with, so their lineage names the job's config
+// revision. Rows that load are marked resolved by resolvedBy; rows that fail again stay open with
+// their new data and reason. Items, triage updates and the job's counters are written in one
+// transaction.
+func (s *Service) ResubmitTriage(ctx context.Context, job repository.IngestionJob, corrections []TriageCorrection, resolvedBy pgtype.Int8) (*ResubmitResult, error) {
+	if job.Status != "COMPLETE" && job.Status != "COMPLETE_WITH_ISSUES" {
+		return nil, ErrJobNotFinished
+	}
+	ingestionConfig, err := s.jobConfig(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]pgtype.UUID, 0, len(corrections))
+	seen := make(map[uuid.UUID]bool, len(corrections))
+	for _, correction := range corrections {
+		if seen[correction.ID] {
+			return nil, fmt.Errorf("triage row %s is listed more than once", correction.ID)
+		}
+		seen[correction.ID] = true
+		ids = append(ids, pgtype.UUID{Bytes: correction.ID, Valid: true})
+	}
+
+	tx, err := s.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.queries.WithTx(tx)
+
+	stored, err := qtx.GetIngestionErrorsForUpdate(ctx, repository.GetIngestionErrorsForUpdateParams{JobID: job.ID, Ids: ids})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load triage rows: %w", err)
+	}
+	byID := make(map[uuid.UUID]repository.IngestionError, len(stored))
+	for _, row := range stored {
+		byID[uuid.UUID(row.ID.Bytes)] = row
+	}
+
+	records := make([]map[string]string, len(corrections))
+	origins := make([]SourceRow, len(corrections))
+	for i, correction := range corrections {
+		row, ok := byID[correction.ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTriageRowNotFound, correction.ID)
+		}
+		if row.ResolutionStatus != TriageOpen {
+			return nil, fmt.Errorf("%w: %s is %s", ErrTriageRowClosed, correction.ID, row.ResolutionStatus)
+		}
+		record := make(map[string]string)
+		if err := json.Unmarshal(row.OriginalRowData, &record); err != nil {
+			return nil, fmt.Errorf("triage row %s has unreadable original data: %w", correction.ID, err)
+		}
+		for column, value := range correction.OriginalRowData {
+			record[column] = value
+		}
+		records[i] = record
+		origins[i] = SourceRow{RowNumber: int(row.RowNumber.Int32), Location: row.SourceLocation.String}
+	}
+	version, err := configVersion(ingestionConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes to items from resubmitted rows belong to the job, so a rollback of the job undoes them
+	if err := qtx.SetAuditIngestionJob(ctx, uuid.UUID(job.ID.Bytes).String()); err != nil {
+		return nil, fmt.Errorf("failed to set audit ingestion job: %w", err)
+	}
+	runStart, err := qtx.GetIngestionRunStart(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ingestion run start: %w", err)
+	}
+	if err := qtx.CreateTempItemsStagingTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create temp staging table: %w", err)
+	}
+	// Item events of the corrected rows belong to the job but are credited to whoever resubmitted them
+	createdBy := resolvedBy
+	if !createdBy.Valid {
+		createdBy = job.UserID
+	}
+	// Resubmitted rows are a few corrections, not a full file, so a snapshot config loads them as upserts
+	sink := &triageSink{
+		jobSink: &jobSink{
+			service:       s,
+			tx:            tx,
+			qtx:           qtx,
+			jobID:         uuid.UUID(job.ID.Bytes),
+			userID:        createdBy,
+			sourceURI:     job.SourceUri.String,
+			configVersion: version,
+			loadMode:      ingestionConfig.loadMode(),
+			runStart:      runStart,
+		},
+		origins: origins,
+	}
+	processor := NewGenericProcessor(ingestionConfig).WithOptions(ProcessingOptions{
+		BatchSize: s.cfg.IngestionBatchSize,
+		Workers:   s.cfg.IngestionWorkers,
+		Embedding: EmbeddingOptions{
+			BatchSize:  s.cfg.IngestionEmbedBatchSize,
+			Workers:    s.cfg.IngestionEmbedWorkers,
+			MaxRetries: s.cfg.IngestionEmbedMaxRetries,
+			RateLimit:  s.cfg.IngestionEmbedRateLimit,
+		},
+	})
+	processed, err := processor.ProcessRecords(ctx, newTriageRecordReader(ingestionConfig, records), s.queries, s.embedder, sink)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ResubmitResult{
+		Resubmitted:  len(corrections),
+		RowsUpserted: processed.RowsUpserted,
+		Changes:      sink.changes,
+		Rows:         make([]ResubmittedRow, 0, len(corrections)),
+	}
+	failed := sink.byRowNumber()
+	for i, correction := range corrections {
+		params := repository.UpdateIngestionErrorResolutionParams{
+			ReasonForFailure: byID[correction.ID].ReasonForFailure,
+			ResolutionStatus: TriageResolved,
+			ResolvedBy:       resolvedBy,
+			ID:               pgtype.UUID{Bytes: correction.ID, Valid: true},
+		}
+		record := records[i]
+		// Row numbers of the triage reader are positions in corrections, counted from 1
+		if triage, ok := failed[i+1]; ok {
+			record = triage.OriginalRecord
+			params.ReasonForFailure = triage.FailureReason
+			params.ResolutionStatus = TriageOpen
+			params.ResolvedBy = pgtype.Int8{}
+			result.StillOpen++
+		} else if isRowBlank(mapValues(record)) {
+			params.ReasonForFailure = "Row is blank after correction. Dismiss it instead."
+			params.ResolutionStatus = TriageOpen
+			params.ResolvedBy = pgtype.Int8{}
+			result.StillOpen++
+		} else {
+			result.Resolved++
+		}
+
+		if params.OriginalRowData, err = json.Marshal(record); err != nil {
+			return nil, fmt.Errorf("failed to marshal corrected row data: %w", err)
+		}
+		if err := qtx.UpdateIngestionErrorResolution(ctx, params); err != nil {
+			return nil, fmt.Errorf("failed to update triage row %s: %w", correction.ID, err)
+		}
+		row := ResubmittedRow{ID: correction.ID, ResolutionStatus: params.ResolutionStatus}
+		if params.ResolutionStatus == TriageOpen {
+			row.ReasonForFailure = params.ReasonForFailure
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err := qtx.RefreshIngestionJobCounters(ctx, repository.RefreshIngestionJobCountersParams{
+		UpsertedDelta:  int32(processed.RowsUpserted),
+		InsertedDelta:  int32(sink.changes.Inserted),
+		UpdatedDelta:   int32(sink.changes.Updated),
+		UnchangedDelta: int32(sink.changes.Unchanged),
+		ID:             job.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update job counters: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit resubmitted rows: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Resubmitted triage rows", "job_id", uuid.UUID(job.ID.Bytes).String(),
+		"resubmitted", result.Resubmitted, "resolved", result.Resolved, "still_open", result.StillOpen)
+	return result, nil
+}
+
+// SetTriageResolution dismisses open triage rows, or reopens dismissed ones when status is open, and
+// updates the job's counters. It returns how many rows changed; rows already in the target status,
+// or resolved by a resubmission, are left alone.
+func (s *Service) SetTriageResolution(ctx context.Context, job repository.IngestionJob, ids []uuid.UUID, status string, resolvedBy pgtype.Int8) (int64, error) {
+	if job.Status != "COMPLETE" && job.Status != "COMPLETE_WITH_ISSUES" {
+		return 0, ErrJobNotFinished
+	}
+	params := repository.SetIngestionErrorsResolutionParams{
+		ToStatus: status,
+		JobID:    job.ID,
+		Ids:      make([]pgtype.UUID, len(ids)),
+	}
+	switch status {
+	case TriageDismissed:
+		params.FromStatus = TriageOpen
+		params.ResolvedBy = resolvedBy
+	case TriageOpen:
+		params.FromStatus = TriageDismissed
+	default:
+		return 0, fmt.Errorf("triage rows can only be set to '%s' or '%s', not '%s'", TriageDismissed, TriageOpen, status)
+	}
+	for i, id := range ids {
+		params.Ids[i] = pgtype.UUID{Bytes: id, Valid: true}
+	}
+
+	tx, err := s.dbpool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.queries.WithTx(tx)
+
+	changed, err := qtx.SetIngestionErrorsResolution(ctx, params)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update triage rows: %w", err)
+	}
+	if err := qtx.RefreshIngestionJobCounters(ctx, repository.RefreshIngestionJobCountersParams{ID: job.ID}); err != nil {
+		return 0, fmt.Errorf("failed to update job counters: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit triage resolution: %w", err)
+	}
+	return changed, nil
+}
+
+// triageSink writes resubmitted items like a job does, but keeps the rows that fail again so
+// their existing triage records can be updated instead of new ones being created.
+type triageSink struct {
+	*jobSink
+	triage  []TriageRow
+	origins []SourceRow // the source rows of the triage rows, by position in the resubmission
+}
+
+// WriteItems records the lineage of resubmitted items against the file rows they first failed on,
+// not their position in the resubmission.
+func (ts *triageSink) WriteItems(ctx context.Context, items []repository.Item, sources []SourceRow) (int64, error) {
+	original := make([]SourceRow, len(sources))
+	for i, source := range sources {
+		original[i] = ts.origins[source.RowNumber-1]
+	}
+	return ts.jobSink.WriteItems(ctx, items, original)
+}
+
+func (ts *triageSink) WriteTriage(ctx context.Context, rows []TriageRow) error {
+	ts.triage = append(ts.triage, rows...)
+	return nil
+}
+
+func (ts *triageSink) byRowNumber() map[int]TriageRow {
+	rows := make(map[int]TriageRow, len(ts.triage))
+	for _, row := range ts.triage {
+		rows[row.RowNumber] = row
+	}
+	return rows
+}
+
+// triageRecordReader replays stored triage rows as source records. Headers follow the config's
+// column mappings, then any other stored columns alphabetically; row numbers count from 1.
+type triageRecordReader struct {
+	headers []string
+	records []map[string]string
+	next    int
+}
+
+func newTriageRecordReader(config IngestionConfig, records []map[string]string) *triageRecordReader {
+	headers := mappedFields(config)
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
+	}
+	var extra []string
+	for _, record := range records {
+		for column := range record {
+			if !known[column] {
+				known[column] = true
+				extra = append(extra, column)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return &triageRecordReader{headers: append(headers, extra...), records: records}
+}
+
+func (r *triageRecordReader) Headers() []string {
+	return r.headers
+}
+
+func (r *triageRecordReader) Read() (SourceRecord, error) {
+	if r.next >= len(r.records) {
+		return SourceRecord{}, io.EOF
+	}
+	record := r.records[r.next]
+	r.next++
+	values := make([]string, len(r.headers))
+	for i, header := range r.headers {
+		values[i] = record[header]
+	}
+	return SourceRecord{RowNumber: r.next, Values: values}, nil
+}
+
+func mapValues(record map[string]string) []string {
+	values := make([]string, 0, len(record))
+	for _, value := range record {
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,46 @@
+package processing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriageRecordReaderReplaysCorrectedRows(t *testing.T) {
+	testConfig := IngestionConfig{
+		ReportType:  "TEST_TRIAGE",
+		ItemType:    "TEST_ITEM",
+		ScopeField:  "team",
+		BusinessKey: []string{"id"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "id", JSONField: "id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "team", JSONField: "team"},
+			{CSVHeader: "amount", JSONField: "amount", Validation: ValidationRule{Regex: `^[0-9.]+$`}},
+		},
+	}
+
+	// Stored triage rows after the user's edits: the first is fixed, the second still isn't
+	records := []map[string]string{
+		{"id": "1", "team": "A", "amount": "12.50", "comment": "fixed typo"},
+		{"id": "2", "team": "B", "amount": "twelve"},
+	}
+	reader := newTriageRecordReader(testConfig, records)
+	assert.Equal(t, []string{"id", "team", "amount", "comment"}, reader.Headers())
+
+	sink := &recordingSink{}
+	result, err := NewGenericProcessor(testConfig).ProcessRecords(context.Background(), reader, &mockQuerier{}, nil, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.RowsRead)
+	assert.Equal(t, 1, result.ItemsProcessed)
+
+	if assert.Len(t, sink.itemBatches, 1) && assert.Len(t, sink.itemBatches[0], 1) {
+		assert.Equal(t, "1", sink.itemBatches[0][0].BusinessKey.String)
+	}
+	if assert.Len(t, sink.triage, 1) {
+		// Row numbers are positions in the resubmitted list so failures map back to their triage row
+		assert.Equal(t, 2, sink.triage[0].RowNumber)
+		assert.Equal(t, "twelve", sink.triage[0].OriginalRecord["amount"])
+		assert.Equal(t, "", sink.triage[0].OriginalRecord["comment"])
+	}
+}
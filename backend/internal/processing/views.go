@@ -0,0 +1,601 @@
+package processing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ViewOptions names the typed SQL view generated for a config's items. Configs that set it are also
+// checked against the view's definition in their app's migrations.
+type ViewOptions struct {
+	Name    string            `yaml:"name,omitempty"`    // defaults to vw_ and the report type in lower case
+	Columns map[string]string `yaml:"columns,omitempty"` // json_field to column name, where the default won't do
+}
+
+// SQL types given to view columns, inferred from the transforms that produce each field.
+const (
+	viewTypeText    = "TEXT"
+	viewTypeInteger = "BIGINT"
+	viewTypeNumeric = "NUMERIC"
+	viewTypeDate    = "DATE"
+	viewTypeBoolean = "BOOLEAN"
+	viewTypeJSON    = "JSONB"
+)
+
+// viewCoreColumns are the items columns every generated view selects, in order. business_key and
+// scope may be renamed after the field they hold; embedding is only selected for embedded configs.
+var viewCoreColumns = []string{"id", "item_type", "business_key", "scope", "status", "embedding", "created_at", "updated_at"}
+
+var (
+	viewIdentifier      = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	repeatedUnderscores = regexp.MustCompile(`_+`)
+)
+
+// ViewColumn is a view column that reads a field from custom_properties.
+type ViewColumn struct {
+	Name string   `json:"name"`
+	Path []string `json:"path"` // keys of the field in custom_properties
+	Type string   `json:"type"`
+}
+
+// ViewDefinition is the typed view of the items one config loads.
+type ViewDefinition struct {
+	Name       string `json:"name"`
+	ReportType string `json:"report_type"`
+	ItemType   string `json:"item_type"`
+	// BusinessKey and Scope are set when the item's business_key or scope column holds a single
+	// field, which the view then selects from the column under the field's name.
+	BusinessKey *ViewColumn  `json:"business_key,omitempty"`
+	Scope       *ViewColumn  `json:"scope,omitempty"`
+	Embedding   bool         `json:"embedding"`
+	Columns     []ViewColumn `json:"columns"`
+}
+
+// ViewName returns the name of the view generated for the config.
+func ViewName(config IngestionConfig) string {
+	if config.View != nil && config.View.Name != "" {
+		return config.View.Name
+	}
+	return "vw_" + strings.ToLower(config.ReportType)
+}
+
+// BuildView works out the view for a config's items: a column for each json_field, typed from the
+// transforms that produce it, behind the core item columns.
+func BuildView(config IngestionConfig) (ViewDefinition, error) {
+	view := ViewDefinition{
+		Name:       ViewName(config),
+		ReportType: config.ReportType,
+		ItemType:   config.ItemType,
+		Embedding:  config.EmbedContent != nil,
+	}
+	if !viewIdentifier.MatchString(view.Name) {
+		return ViewDefinition{}, fmt.Errorf("view name '%s' must be lower case letters, digits and underscores", view.Name)
+	}
+	var overrides map[string]string
+	if config.View != nil {
+		overrides = config.View.Columns
+	}
+	columnName := func(jsonField string) (string, error) {
+		name, ok := overrides[jsonField]
+		if !ok {
+			return viewColumnName(jsonField), nil
+		}
+		if !viewIdentifier.MatchString(name) {
+			return "", fmt.Errorf("view column name '%s' for json_field '%s' must be lower case letters, digits and underscores", name, jsonField)
+		}
+		return name, nil
+	}
+
+	// Fields in the order custom_properties is built, each with the type its transforms leave it as.
+	// A derived field stored under an existing json_field replaces it.
+	type viewField struct {
+		jsonField string
+		path      []string
+		sqlType   string
+	}
+	var fields []viewField
+	index := make(map[string]int)
+	addField := func(mapping ColumnMapping, sqlType string) {
+		field := viewField{jsonField: mapping.JSONField, path: fieldPath(mapping), sqlType: sqlType}
+		if i, ok := index[mapping.JSONField]; ok {
+			fields[i] = field
+			return
+		}
+		index[mapping.JSONField] = len(fields)
+		fields = append(fields, field)
+	}
+	for _, mapping := range config.ColumnMappings {
+		addField(mapping, mappingViewType(mapping))
+	}
+	for _, derived := range config.DerivedFields {
+		sqlType := viewTypeText
+		if derived.SourceField != "" {
+			if i, ok := index[derived.SourceField]; ok {
+				sqlType = fields[i].sqlType
+			}
+		}
+		sqlType = transformsViewType(sqlType, derived.Transforms)
+		addField(ColumnMapping{JSONField: derived.JSONField, LiteralJSONField: derived.LiteralJSONField}, sqlType)
+	}
+
+	var businessKey, scope string
+	if len(config.BusinessKey) == 1 {
+		businessKey = config.BusinessKey[0]
+	}
+	for _, mapping := range config.ColumnMappings {
+		if mapping.CSVHeader == config.ScopeField {
+			scope = mapping.JSONField
+			break
+		}
+	}
+	if config.derivedField(config.ScopeField) != nil {
+		scope = config.ScopeField
+	}
+
+	taken := make(map[string]string)
+	claim := func(name, owner string) error {
+		if other, ok := taken[name]; ok {
+			return fmt.Errorf("view column '%s' for %s clashes with %s; name it under view.columns", name, owner, other)
+		}
+		taken[name] = owner
+		return nil
+	}
+	for _, core := range viewCoreColumns {
+		if core != "business_key" && core != "scope" {
+			taken[core] = "the core column '" + core + "'"
+		}
+	}
+
+	for _, field := range fields {
+		name, err := columnName(field.jsonField)
+		if err != nil {
+			return ViewDefinition{}, err
+		}
+		column := ViewColumn{Name: name, Path: field.path, Type: field.sqlType}
+		switch field.jsonField {
+		case businessKey:
+			column.Type = viewTypeText
+			view.BusinessKey = &column
+		case scope:
+			column.Type = viewTypeText
+			view.Scope = &column
+		default:
+			view.Columns = append(view.Columns, column)
+		}
+		if err := claim(name, "json_field '"+field.jsonField+"'"); err != nil {
+			return ViewDefinition{}, err
+		}
+	}
+	if view.BusinessKey == nil {
+		if err := claim("business_key", "the core column 'business_key'"); err != nil {
+			return ViewDefinition{}, err
+		}
+	}
+	if view.Scope == nil {
+		if err := claim("scope", "the core column 'scope'"); err != nil {
+			return ViewDefinition{}, err
+		}
+	}
+	return view, nil
+}
+
+// mappingViewType returns the SQL type of the values a column mapping stores. Attempts are
+// fallbacks for the same value, so if they end in different types the column is left as text.
+func mappingViewType(mapping ColumnMapping) string {
+	if len(mapping.Attempts) == 0 {
+		return viewTypeText
+	}
+	sqlType := transformsViewType(viewTypeText, mapping.Attempts[0].Transforms)
+	for _, attempt := range mapping.Attempts[1:] {
+		if transformsViewType(viewTypeText, attempt.Transforms) != sqlType {
+			return viewTypeText
+		}
+	}
+	return sqlType
+}
+
+// transformsViewType returns the SQL type of a value of type from after the transforms have run.
+// Transforms that only change text keep the type they're given; app transforms are assumed to
+// return text.
+func transformsViewType(from string, transforms []string) string {
+	sqlType := from
+	for _, transformCall := range transforms {
+		name, _, _ := strings.Cut(transformCall, ":")
+		switch name {
+		case "to_integer":
+			sqlType = viewTypeInteger
+		case "to_decimal", "parse_currency":
+			sqlType = viewTypeNumeric
+		case "to_date":
+			sqlType = viewTypeDate
+		case "to_boolean":
+			sqlType = viewTypeBoolean
+		case "parse_json", "split_to_array":
+			sqlType = viewTypeJSON
+		case "format_date":
+			sqlType = viewTypeText
+		case "trim_space", "to_uppercase", "to_lowercase", "regex_replace", "map", "default_if_blank":
+		default:
+			sqlType = viewTypeText
+		}
+	}
+	return sqlType
+}
+
+// viewColumnName turns a json_field into a column name: "LaunchDate" becomes launch_date and
+// "metadata.source" becomes metadata_source. Names that already use underscores between words,
+// like "PolicyHolder_ID", are only lower-cased.
+func viewColumnName(jsonField string) string {
+	splitWords := !strings.Contains(jsonField, "_")
+	runes := []rune(jsonField)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if splitWords && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := strings.Trim(repeatedUnderscores.ReplaceAllString(b.String(), "_"), "_")
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "field_" + name
+	}
+	return name
+}
+
+// CreateStatement renders the CREATE VIEW statement for the view.
+func (v ViewDefinition) CreateStatement() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE VIEW %s AS\nSELECT\n", v.Name)
+	b.WriteString("    -- Core item properties\n")
+	var lines []string
+	for _, core := range viewCoreColumns {
+		switch {
+		case core == "business_key" && v.BusinessKey != nil:
+			lines = append(lines, "item.business_key AS "+v.BusinessKey.Name)
+		case core == "scope" && v.Scope != nil:
+			lines = append(lines, "item.scope AS "+v.Scope.Name)
+		case core == "embedding" && !v.Embedding:
+		default:
+			lines = append(lines, "item."+core)
+		}
+	}
+	for i, line := range lines {
+		b.WriteString("    " + line)
+		if i < len(lines)-1 || len(v.Columns) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	if len(v.Columns) > 0 {
+		b.WriteString("\n    -- Unpacked properties from the JSONB field, typed from the config's transforms\n")
+		for i, column := range v.Columns {
+			b.WriteString("    " + column.selectExpression())
+			if i < len(v.Columns)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+	}
+	fmt.Fprintf(&b, "FROM\n    items AS item\nWHERE\n    item.item_type = %s;\n", sqlString(v.ItemType))
+	return b.String()
+}
+
+// selectExpression reads the column's field from custom_properties. JSONB fields are read as JSON
+// so arrays and objects keep their structure.
+func (c ViewColumn) selectExpression() string {
+	var access string
+	switch {
+	case len(c.Path) == 1 && c.Type == viewTypeJSON:
+		access = "item.custom_properties->" + sqlString(c.Path[0])
+	case len(c.Path) == 1:
+		access = "item.custom_properties->>" + sqlString(c.Path[0])
+	case c.Type == viewTypeJSON:
+		access = "item.custom_properties#>" + sqlString(textArrayLiteral(c.Path))
+	default:
+		access = "item.custom_properties#>>" + sqlString(textArrayLiteral(c.Path))
+	}
+	if c.Type == viewTypeJSON {
+		return fmt.Sprintf("(%s) AS %s", access, c.Name)
+	}
+	return fmt.Sprintf("(%s)::%s AS %s", access, c.Type, c.Name)
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// textArrayLiteral renders keys as a Postgres text[] literal such as {metadata,source}.
+func textArrayLiteral(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		if key == "" || strings.ContainsAny(key, `{},"\ `) || strings.EqualFold(key, "null") {
+			key = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+		}
+		quoted[i] = key
+	}
+	return "{" + strings.Join(quoted, ",") + "}"
+}
+
+// RenderViewMigration renders a goose migration that replaces the view with the generated one.
+// Rolling it back restores the previous definition, if there is one, or drops the view.
+func RenderViewMigration(view ViewDefinition, previous *ExistingView) string {
+	var b strings.Builder
+	b.WriteString("-- +goose Up\n")
+	fmt.Fprintf(&b, "-- Generated by cmd/gen-views from the %s ingestion config. Change the config and\n", view.ReportType)
+	b.WriteString("-- generate a new migration rather than editing this one.\n")
+	fmt.Fprintf(&b, "DROP VIEW IF EXISTS %s;\n\n", view.Name)
+	b.WriteString(view.CreateStatement())
+	b.WriteString("\n-- +goose Down\n")
+	fmt.Fprintf(&b, "DROP VIEW IF EXISTS %s;\n", view.Name)
+	if previous != nil {
+		fmt.Fprintf(&b, "\n-- The definition from %s\n%s\n", filepath.Base(previous.File), previous.Statement)
+	}
+	return b.String()
+}
+
+// ExistingView is a view as the migrations in a directory leave it.
+type ExistingView struct {
+	Name      string
+	File      string // the migration that last created it
+	Statement string // the CREATE VIEW statement, without comments
+	ItemType  string
+	Columns   []ViewColumn
+	// SelectsBusinessKey and SelectsScope report whether the view selects the item's business_key
+	// and scope columns.
+	SelectsBusinessKey bool
+	SelectsScope       bool
+}
+
+var (
+	viewStatementPattern = regexp.MustCompile(`(?is)\b(?:CREATE\s+(?:OR\s+REPLACE\s+)?VIEW\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w.]+)\s+AS\b.*?;|DROP\s+VIEW\s+(?:IF\s+EXISTS\s+)?([\w.,\s]+?)\s*(?:CASCADE|RESTRICT)?\s*;)`)
+	viewColumnPattern    = regexp.MustCompile(`(?i)\(?\s*(?:\w+\.)?custom_properties\s*(->>|->|#>>|#>)\s*'((?:[^']|'')*)'\s*\)?(?:\s*::\s*([a-z][a-z0-9_ ]*?(?:\s*\([^)]*\))?))?\s+AS\s+"?(\w+)"?`)
+	viewItemTypePattern  = regexp.MustCompile(`(?i)item_type\s*=\s*'([^']*)'`)
+	viewBusinessKeyRef   = regexp.MustCompile(`(?i)\b\w+\.business_key\b`)
+	viewScopeRef         = regexp.MustCompile(`(?i)\b\w+\.scope\b`)
+	sqlLineComment       = regexp.MustCompile(`--[^\n]*`)
+	goosePragmaDown      = regexp.MustCompile(`(?m)^--\s*\+goose\s+Down\b`)
+)
+
+// ReadViewDefinitions reads the views the up migrations in dir create, keyed by name. Migrations are
+// applied in file name order, so a later CREATE or DROP of the same view wins.
+func ReadViewDefinitions(dir string) (map[string]ExistingView, error) {
+	files, err := migrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	views := make(map[string]ExistingView)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		up := string(data)
+		if loc := goosePragmaDown.FindStringIndex(up); loc != nil {
+			up = up[:loc[0]]
+		}
+		up = sqlLineComment.ReplaceAllString(up, "")
+
+		for _, match := range viewStatementPattern.FindAllStringSubmatch(up, -1) {
+			if match[1] == "" {
+				for _, name := range strings.Split(match[2], ",") {
+					delete(views, strings.ToLower(strings.TrimSpace(name)))
+				}
+				continue
+			}
+			view := parseViewStatement(match[0])
+			view.Name = strings.ToLower(match[1])
+			view.File = filepath.Join(dir, file)
+			views[view.Name] = view
+		}
+	}
+	return views, nil
+}
+
+// parseViewStatement picks out the custom_properties fields a CREATE VIEW statement reads and the
+// item_type it selects.
+func parseViewStatement(statement string) ExistingView {
+	var lines []string
+	for _, line := range strings.Split(statement, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	view := ExistingView{
+		Statement:          strings.Join(lines, "\n"),
+		SelectsBusinessKey: viewBusinessKeyRef.MatchString(statement),
+		SelectsScope:       viewScopeRef.MatchString(statement),
+	}
+	if match := viewItemTypePattern.FindStringSubmatch(statement); match != nil {
+		view.ItemType = match[1]
+	}
+	for _, match := range viewColumnPattern.FindAllStringSubmatch(statement, -1) {
+		operator, key, sqlType := match[1], strings.ReplaceAll(match[2], "''", "'"), strings.TrimSpace(match[3])
+		column := ViewColumn{Name: strings.ToLower(match[4]), Path: []string{key}, Type: sqlType}
+		if strings.HasPrefix(operator, "#") {
+			column.Path = parseTextArrayLiteral(key)
+		}
+		if column.Type == "" {
+			column.Type = viewTypeText
+			if !strings.HasSuffix(operator, ">>") {
+				column.Type = viewTypeJSON
+			}
+		}
+		view.Columns = append(view.Columns, column)
+	}
+	return view
+}
+
+// parseTextArrayLiteral reads the keys back out of a literal written by textArrayLiteral.
+func parseTextArrayLiteral(literal string) []string {
+	literal = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(literal), "{"), "}")
+	var keys []string
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, r := range literal {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			keys = append(keys, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(keys, strings.TrimSpace(b.String()))
+}
+
+// migrationFiles returns the names of the .sql files in dir in the order goose applies them.
+func migrationFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		vi, _ := migrationVersion(files[i])
+		vj, _ := migrationVersion(files[j])
+		if vi != vj {
+			return vi < vj
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+// migrationVersion reads the version number goose takes from a migration's file name.
+func migrationVersion(file string) (int64, bool) {
+	prefix, _, _ := strings.Cut(file, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	return version, err == nil
+}
+
+// NextMigrationVersion returns the version for a new migration in dir: one after the highest there,
+// or the current time for an empty directory.
+func NextMigrationVersion(dir string, now time.Time) (int64, error) {
+	files, err := migrationFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, file := range files {
+		if version, ok := migrationVersion(file); ok && version > latest {
+			latest = version
+		}
+	}
+	if latest == 0 {
+		return strconv.ParseInt(now.UTC().Format("20060102150405"), 10, 64)
+	}
+	return latest + 1, nil
+}
+
+// ViewDrift is a way an existing view no longer matches the config it was written for.
+type ViewDrift struct {
+	View    string `json:"view"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d ViewDrift) String() string {
+	if d.Column == "" {
+		return fmt.Sprintf("%s: %s", d.View, d.Message)
+	}
+	return fmt.Sprintf("%s.%s: %s", d.View, d.Column, d.Message)
+}
+
+// CheckView compares an existing view with the one the config generates. Fields are matched by
+// where they live in custom_properties, so hand-written views may name their columns as they like;
+// what's reported is a field the view is missing, a column of the wrong type, a column reading a
+// field the config no longer maps, or a view of another item_type.
+func CheckView(config IngestionConfig, existing ExistingView) ([]ViewDrift, error) {
+	view, err := BuildView(config)
+	if err != nil {
+		return nil, err
+	}
+	var drift []ViewDrift
+	report := func(column, format string, args ...any) {
+		drift = append(drift, ViewDrift{View: existing.Name, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+	if existing.ItemType != view.ItemType {
+		report("", "selects item_type '%s' but the config loads '%s'", existing.ItemType, view.ItemType)
+	}
+
+	existingByPath := make(map[string]ViewColumn)
+	for _, column := range existing.Columns {
+		existingByPath[strings.Join(column.Path, ".")] = column
+	}
+	expected := make(map[string]bool)
+	check := func(column ViewColumn, coreSelected bool) {
+		key := strings.Join(column.Path, ".")
+		expected[key] = true
+		found, ok := existingByPath[key]
+		switch {
+		case ok && sqlTypeClass(found.Type) != sqlTypeClass(column.Type):
+			report(found.Name, "is %s but the config's transforms give %s", found.Type, column.Type)
+		case !ok && !coreSelected:
+			report("", "has no column for json_field '%s' (%s)", key, column.Type)
+		}
+	}
+	if view.BusinessKey != nil {
+		check(*view.BusinessKey, existing.SelectsBusinessKey)
+	}
+	if view.Scope != nil {
+		check(*view.Scope, existing.SelectsScope)
+	}
+	for _, column := range view.Columns {
+		check(column, false)
+	}
+	for _, column := range existing.Columns {
+		if !expected[strings.Join(column.Path, ".")] {
+			report(column.Name, "reads '%s', which the config no longer maps", strings.Join(column.Path, "."))
+		}
+	}
+	return drift, nil
+}
+
+// sqlTypeClass groups SQL type names that hold the same kind of value, so a hand-written VARCHAR
+// or DECIMAL(12, 2) matches the TEXT or NUMERIC a config gives.
+func sqlTypeClass(sqlType string) string {
+	name := strings.ToUpper(strings.TrimSpace(sqlType))
+	if i := strings.Index(name, "("); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	switch name {
+	case "TEXT", "VARCHAR", "CHARACTER VARYING", "CHAR", "CHARACTER", "BPCHAR":
+		return viewTypeText
+	case "SMALLINT", "INTEGER", "INT", "BIGINT", "INT2", "INT4", "INT8":
+		return viewTypeInteger
+	case "NUMERIC", "DECIMAL", "REAL", "DOUBLE PRECISION", "FLOAT4", "FLOAT8":
+		return viewTypeNumeric
+	case "BOOLEAN", "BOOL":
+		return viewTypeBoolean
+	case "JSON", "JSONB":
+		return viewTypeJSON
+	}
+	return name
+}
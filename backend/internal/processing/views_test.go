@@ -0,0 +1,176 @@
+package processing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testViewConfig() IngestionConfig {
+	constant := "web"
+	return IngestionConfig{
+		ReportType:   "CLAIMS",
+		ItemType:     "INSURANCE_CLAIM",
+		ScopeField:   "State",
+		BusinessKey:  []string{"Claim_ID"},
+		EmbedContent: &EmbedContent{SourceColumns: []string{"notes"}},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "Claim_ID", JSONField: "Claim_ID"},
+			{CSVHeader: "State", JSONField: "state", Attempts: []ProcessingAttempt{{Transforms: []string{"to_uppercase"}}}},
+			{CSVHeader: "Amount", JSONField: "ClaimAmount", Attempts: []ProcessingAttempt{{Transforms: []string{"trim_space", "parse_currency"}}}},
+			{CSVHeader: "Loss Date", JSONField: "loss.date", Attempts: []ProcessingAttempt{
+				{Transforms: []string{"to_date:2006-01-02"}},
+				{Transforms: []string{"to_date:01/02/2006"}},
+			}},
+			{CSVHeader: "Count", JSONField: "count", Attempts: []ProcessingAttempt{
+				{Transforms: []string{"to_integer"}},
+				{Transforms: []string{"trim_space"}},
+			}},
+			{CSVHeader: "Tags", JSONField: "tags", Attempts: []ProcessingAttempt{{Transforms: []string{"split_to_array:;"}}}},
+			{CSVHeader: "Notes", JSONField: "notes"},
+		},
+		DerivedFields: []DerivedField{
+			{JSONField: "loss_year", SourceField: "loss.date", Transforms: []string{"format_date:2006"}},
+			{JSONField: "channel", Constant: &constant},
+		},
+		View: &ViewOptions{Columns: map[string]string{"ClaimAmount": "amount"}},
+	}
+}
+
+func TestBuildView(t *testing.T) {
+	view, err := BuildView(testViewConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, "vw_claims", view.Name)
+	assert.Equal(t, &ViewColumn{Name: "claim_id", Path: []string{"Claim_ID"}, Type: "TEXT"}, view.BusinessKey)
+	assert.Equal(t, &ViewColumn{Name: "state", Path: []string{"state"}, Type: "TEXT"}, view.Scope)
+	assert.True(t, view.Embedding)
+	assert.Equal(t, []ViewColumn{
+		{Name: "amount", Path: []string{"ClaimAmount"}, Type: "NUMERIC"},
+		{Name: "loss_date", Path: []string{"loss", "date"}, Type: "DATE"},
+		{Name: "count", Path: []string{"count"}, Type: "TEXT"}, // the attempts disagree
+		{Name: "tags", Path: []string{"tags"}, Type: "JSONB"},
+		{Name: "notes", Path: []string{"notes"}, Type: "TEXT"},
+		{Name: "loss_year", Path: []string{"loss_year"}, Type: "TEXT"},
+		{Name: "channel", Path: []string{"channel"}, Type: "TEXT"},
+	}, view.Columns)
+
+	statement := view.CreateStatement()
+	assert.Contains(t, statement, "    item.business_key AS claim_id,\n    item.scope AS state,\n    item.status,\n    item.embedding,\n")
+	assert.Contains(t, statement, "(item.custom_properties#>>'{loss,date}')::DATE AS loss_date,")
+	assert.Contains(t, statement, "(item.custom_properties->'tags') AS tags,")
+	assert.Contains(t, statement, "(item.custom_properties->>'channel')::TEXT AS channel\nFROM")
+	assert.Contains(t, statement, "item.item_type = 'INSURANCE_CLAIM';")
+}
+
+func TestBuildViewColumnClash(t *testing.T) {
+	config := testViewConfig()
+	config.ColumnMappings = append(config.ColumnMappings, ColumnMapping{CSVHeader: "Status", JSONField: "Status"})
+	_, err := BuildView(config)
+	assert.EqualError(t, err, "view column 'status' for json_field 'Status' clashes with the core column 'status'; name it under view.columns")
+
+	config.View.Columns["Status"] = "claim_status"
+	_, err = BuildView(config)
+	assert.NoError(t, err)
+}
+
+func TestViewColumnName(t *testing.T) {
+	for field, want := range map[string]string{
+		"LaunchDate":       "launch_date",
+		"LunarModulePilot": "lunar_module_pilot",
+		"PolicyHolder_ID":  "policyholder_id",
+		"HTTPStatus":       "http_status",
+		"metadata.source":  "metadata_source",
+		"2023 Total":       "field_2023_total",
+	} {
+		assert.Equal(t, want, viewColumnName(field), field)
+	}
+}
+
+func TestReadViewDefinitionsAndCheckView(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("20250101010101_create_claims_views.sql", `-- +goose Up
+CREATE OR REPLACE VIEW vw_claims AS
+SELECT
+    item.id,
+    item.business_key AS claim_id,
+    -- typed properties
+    (item.custom_properties->>'ClaimAmount')::DECIMAL(12, 2) AS amount,
+    (item.custom_properties->>'count')::INTEGER AS count,
+    item.custom_properties->>'Adjuster' AS adjuster
+FROM items AS item
+WHERE item.item_type = 'INSURANCE_CLAIM';
+
+CREATE VIEW vw_dropped AS SELECT 1;
+
+-- +goose Down
+DROP VIEW IF EXISTS vw_claims;
+`)
+	write("20250101010102_drop_view.sql", "-- +goose Up\nDROP VIEW IF EXISTS vw_dropped;\n-- +goose Down\n")
+
+	views, err := ReadViewDefinitions(dir)
+	require.NoError(t, err)
+	require.Len(t, views, 1)
+	existing := views["vw_claims"]
+	assert.Equal(t, "INSURANCE_CLAIM", existing.ItemType)
+	assert.True(t, existing.SelectsBusinessKey)
+	assert.False(t, existing.SelectsScope)
+	assert.Equal(t, []ViewColumn{
+		{Name: "amount", Path: []string{"ClaimAmount"}, Type: "DECIMAL(12, 2)"},
+		{Name: "count", Path: []string{"count"}, Type: "INTEGER"},
+		{Name: "adjuster", Path: []string{"Adjuster"}, Type: "TEXT"},
+	}, existing.Columns)
+
+	drift, err := CheckView(testViewConfig(), existing)
+	require.NoError(t, err)
+	got := make([]string, len(drift))
+	for i, d := range drift {
+		got[i] = d.String()
+	}
+	assert.Equal(t, []string{
+		"vw_claims: has no column for json_field 'state' (TEXT)",
+		"vw_claims: has no column for json_field 'loss.date' (DATE)",
+		"vw_claims.count: is INTEGER but the config's transforms give TEXT",
+		"vw_claims: has no column for json_field 'tags' (JSONB)",
+		"vw_claims: has no column for json_field 'notes' (TEXT)",
+		"vw_claims: has no column for json_field 'loss_year' (TEXT)",
+		"vw_claims: has no column for json_field 'channel' (TEXT)",
+		"vw_claims.adjuster: reads 'Adjuster', which the config no longer maps",
+	}, got)
+}
+
+func TestRenderViewMigrationRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	config := testViewConfig()
+	view, err := BuildView(config)
+	require.NoError(t, err)
+
+	version, err := NextMigrationVersion(dir, time.Date(2025, 3, 1, 1, 1, 1, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, int64(20250301010101), version)
+
+	migration := RenderViewMigration(view, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20250301010101_generate_vw_claims.sql"), []byte(migration), 0o644))
+	version, err = NextMigrationVersion(dir, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(20250301010102), version)
+
+	views, err := ReadViewDefinitions(dir)
+	require.NoError(t, err)
+	existing, ok := views["vw_claims"]
+	require.True(t, ok)
+	drift, err := CheckView(config, existing)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+
+	// The next migration rolls back to this definition
+	next := RenderViewMigration(view, &existing)
+	assert.Contains(t, next, "-- The definition from 20250301010101_generate_vw_claims.sql\nCREATE VIEW vw_claims AS\n")
+}
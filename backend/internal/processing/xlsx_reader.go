@@ -0,0 +1,329 @@
+package processing
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Built-in Excel number format IDs that render a serial number as a date or time.
+var builtInDateNumFmts = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// XLSXRecordReader reads the rows of a single worksheet. Cell values are taken raw rather than
+// with the workbook's number formats applied, so numbers arrive without thousands separators or
+// currency symbols, and date-formatted cells are rendered as ISO 8601 ("2006-01-02", or
+// "2006-01-02T15:04:05" when there is a time part) whatever the cell's number format is. For xlsx
+// configs to_date accepts those forms besides its own layouts (see xlsxDateTransforms), so a config
+// shared with CSV exports of the same sheet can keep the layout the exports use.
+//
+// The workbook itself is opened in memory, since xlsx files are zip archives and need random access.
+type XLSXRecordReader struct {
+	file       *excelize.File
+	rows       *excelize.Rows
+	sheet      string
+	headers    []string
+	rowNumber  int
+	date1904   bool
+	dateStyles map[int]bool
+
+	// Rows are held back until enough non-blank rows follow them that they cannot be trailing summary rows.
+	skipTrailing    int
+	pending         []SourceRecord
+	pendingNonBlank int
+	exhausted       bool
+}
+
+// NewXLSXRecordReader opens the workbook, selects the configured sheet and reads its header row.
+func NewXLSXRecordReader(file io.Reader, opts XLSXOptions) (*XLSXRecordReader, error) {
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx workbook: %w", err)
+	}
+
+	sheet, err := selectSheet(f, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read sheet '%s': %w", sheet, err)
+	}
+
+	r := &XLSXRecordReader{
+		file:         f,
+		rows:         rows,
+		sheet:        sheet,
+		dateStyles:   make(map[int]bool),
+		skipTrailing: opts.SkipTrailingRows,
+	}
+	if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		r.date1904 = *props.Date1904
+	}
+
+	for i := 0; i <= opts.HeaderRowOffset; i++ {
+		if !rows.Next() {
+			r.Close()
+			return nil, fmt.Errorf("error reading header row: sheet '%s' has only %d rows", sheet, i)
+		}
+		r.rowNumber++
+	}
+	headers, err := rows.Columns(excelize.Options{RawCellValue: true})
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("error reading header row: %w", err)
+	}
+	r.headers = trimTrailingBlanks(headers)
+	if len(r.headers) == 0 {
+		r.Close()
+		return nil, fmt.Errorf("error reading header row: row %d of sheet '%s' is empty", r.rowNumber, sheet)
+	}
+
+	return r, nil
+}
+
+// selectSheet resolves the sheet to read by name, falling back to its 0-based position in the workbook.
+func selectSheet(f *excelize.File, opts XLSXOptions) (string, error) {
+	sheets := f.GetSheetList()
+	if opts.SheetName != "" {
+		for _, name := range sheets {
+			if name == opts.SheetName {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("sheet '%s' not found in workbook (sheets: %s)", opts.SheetName, strings.Join(sheets, ", "))
+	}
+	if opts.SheetIndex < 0 || opts.SheetIndex >= len(sheets) {
+		return "", fmt.Errorf("sheet_index %d is out of range, workbook has %d sheets", opts.SheetIndex, len(sheets))
+	}
+	return sheets[opts.SheetIndex], nil
+}
+
+func (r *XLSXRecordReader) Headers() []string {
+	return r.headers
+}
+
+func (r *XLSXRecordReader) Read() (SourceRecord, error) {
+	for {
+		if len(r.pending) > 0 && r.nonBlankAfterHead() >= r.skipTrailing {
+			head := r.pending[0]
+			r.pending = r.pending[1:]
+			if !isRowBlank(head.Values) {
+				r.pendingNonBlank--
+			}
+			return head, nil
+		}
+		if r.exhausted {
+			// Whatever is still pending is the trailing summary block.
+			return SourceRecord{}, io.EOF
+		}
+
+		record, ok, err := r.nextRow()
+		if err != nil {
+			return SourceRecord{}, err
+		}
+		if !ok {
+			r.exhausted = true
+			continue
+		}
+		r.pending = append(r.pending, record)
+		if !isRowBlank(record.Values) {
+			r.pendingNonBlank++
+		}
+	}
+}
+
+// Close releases the workbook and any temporary files excelize created for it.
+func (r *XLSXRecordReader) Close() error {
+	if r.rows != nil {
+		r.rows.Close()
+	}
+	return r.file.Close()
+}
+
+func (r *XLSXRecordReader) nonBlankAfterHead() int {
+	if isRowBlank(r.pending[0].Values) {
+		return r.pendingNonBlank
+	}
+	return r.pendingNonBlank - 1
+}
+
+// nextRow reads the next physical row of the sheet. Missing rows come back as blank records.
+func (r *XLSXRecordReader) nextRow() (SourceRecord, bool, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return SourceRecord{}, false, fmt.Errorf("failed to read sheet '%s' after row %d: %w", r.sheet, r.rowNumber, err)
+		}
+		return SourceRecord{}, false, nil
+	}
+	r.rowNumber++
+
+	cells, err := r.rows.Columns(excelize.Options{RawCellValue: true})
+	if err != nil {
+		return SourceRecord{}, false, fmt.Errorf("failed to read row %d of sheet '%s': %w", r.rowNumber, r.sheet, err)
+	}
+
+	// Excel omits empty trailing cells, so pad short rows out to the header width.
+	cells = trimTrailingBlanks(cells)
+	values := make([]string, len(r.headers))
+	if len(cells) > len(values) {
+		values = make([]string, len(cells))
+	}
+	for i, raw := range cells {
+		value, err := r.cellValue(i, raw)
+		if err != nil {
+			return SourceRecord{}, false, err
+		}
+		values[i] = value
+	}
+
+	return SourceRecord{RowNumber: r.rowNumber, Values: values, Sheet: r.sheet}, true, nil
+}
+
+// cellValue normalises a raw cell value using the cell's type and number format.
+func (r *XLSXRecordReader) cellValue(column int, raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	serial, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw, nil
+	}
+
+	cellName, err := excelize.CoordinatesToCellName(column+1, r.rowNumber)
+	if err != nil {
+		return "", err
+	}
+	cellType, err := r.file.GetCellType(r.sheet, cellName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read type of cell %s!%s: %w", r.sheet, cellName, err)
+	}
+	switch cellType {
+	case excelize.CellTypeBool:
+		if raw == "1" {
+			return "true", nil
+		}
+		return "false", nil
+	case excelize.CellTypeNumber, excelize.CellTypeUnset:
+	default:
+		return raw, nil
+	}
+
+	styleID, err := r.file.GetCellStyle(r.sheet, cellName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read style of cell %s!%s: %w", r.sheet, cellName, err)
+	}
+	if !r.isDateStyle(styleID) {
+		return raw, nil
+	}
+
+	t, err := excelize.ExcelDateToTime(serial, r.date1904)
+	if err != nil {
+		return raw, nil
+	}
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format("2006-01-02"), nil
+	}
+	return t.Format("2006-01-02T15:04:05"), nil
+}
+
+// xlsxDateLayouts are the forms cellValue renders date cells in.
+var xlsxDateLayouts = []string{"2006-01-02", "2006-01-02T15:04:05"}
+
+// xlsxDateTransforms adds xlsxDateLayouts to the layouts of any to_date call among the transforms,
+// so date cells parse whichever layout the config gives. Text cells holding dates still have to
+// match the config's layouts. The transforms are returned as they are when there is no to_date.
+func xlsxDateTransforms(transforms []string) []string {
+	var out []string
+	for i, transformCall := range transforms {
+		name, arg, _ := strings.Cut(transformCall, ":")
+		if name != "to_date" {
+			if out != nil {
+				out = append(out, transformCall)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]string, 0, len(transforms)), transforms[:i]...)
+		}
+		if arg == "" {
+			arg = "2006-01-02"
+		}
+		layouts := strings.Split(arg, "|")
+		for _, layout := range xlsxDateLayouts {
+			if !slices.Contains(layouts, layout) {
+				layouts = append(layouts, layout)
+			}
+		}
+		out = append(out, "to_date:"+strings.Join(layouts, "|"))
+	}
+	if out == nil {
+		return transforms
+	}
+	return out
+}
+
+// isDateStyle reports whether a cell style formats its value as a date or time. Results are cached per style.
+func (r *XLSXRecordReader) isDateStyle(styleID int) bool {
+	if isDate, ok := r.dateStyles[styleID]; ok {
+		return isDate
+	}
+	isDate := false
+	if style, err := r.file.GetStyle(styleID); err == nil && style != nil {
+		if style.CustomNumFmt != nil {
+			isDate = isDateFormatCode(*style.CustomNumFmt)
+		} else {
+			isDate = builtInDateNumFmts[style.NumFmt]
+		}
+	}
+	r.dateStyles[styleID] = isDate
+	return isDate
+}
+
+// isDateFormatCode reports whether a custom number format code contains date or time tokens,
+// ignoring quoted literals, escaped characters and bracketed sections such as colours or locales.
+func isDateFormatCode(code string) bool {
+	inQuotes, inBrackets := false, false
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case ch == '\\', ch == '_', ch == '*':
+			// Escapes, padding and fill characters apply to the character that follows them.
+			i++
+		case ch == '[':
+			inBrackets = true
+		case ch == ']':
+			inBrackets = false
+		case inBrackets:
+		default:
+			switch ch {
+			case 'd', 'D', 'm', 'M', 'y', 'Y', 'h', 'H', 's', 'S':
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func trimTrailingBlanks(values []string) []string {
+	end := len(values)
+	for end > 0 && strings.TrimSpace(values[end-1]) == "" {
+		end--
+	}
+	return values[:end]
+}
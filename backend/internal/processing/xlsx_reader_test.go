@@ -0,0 +1,83 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXSourceFormat(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	require.NoError(t, f.SetSheetName("Sheet1", "Claims"))
+
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	require.NoError(t, err)
+	moneyStyle, err := f.NewStyle(&excelize.Style{NumFmt: 4})
+	require.NoError(t, err)
+
+	rows := [][]interface{}{
+		{"Monthly claims extract"},
+		{"Claim_ID", "Region", "Amount", "Date_of_Loss"},
+		{"C1", "WEST", 1234.5, 45658},
+		{"C2", "EAST", "n/a", 45659},
+		{"C3", "EAST", 10, 45660},
+		{"TOTAL", "", 1244.5},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		require.NoError(t, f.SetSheetRow("Claims", cell, &row))
+	}
+	require.NoError(t, f.SetCellStyle("Claims", "C3", "C6", moneyStyle))
+	require.NoError(t, f.SetCellStyle("Claims", "D3", "D5", dateStyle))
+
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf))
+
+	config := IngestionConfig{
+		ReportType:   "TEST_XLSX",
+		SourceFormat: SourceFormatXLSX,
+		XLSX:         &XLSXOptions{SheetName: "Claims", HeaderRowOffset: 1, SkipTrailingRows: 1},
+		ItemType:     "TEST_ITEM",
+		ScopeField:   "Region",
+		BusinessKey:  []string{"claim_id"},
+		ColumnMappings: []ColumnMapping{
+			{CSVHeader: "Claim_ID", JSONField: "claim_id", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "Region", JSONField: "region", Validation: ValidationRule{Required: true}},
+			{CSVHeader: "Amount", JSONField: "amount", Attempts: []ProcessingAttempt{{Transforms: []string{"to_decimal"}}}},
+			// The layout of CSV exports of the sheet; date cells parse whatever the layout is
+			{CSVHeader: "Date_of_Loss", JSONField: "date_of_loss", Attempts: []ProcessingAttempt{{Transforms: []string{"to_date:01/02/2006"}}}},
+		},
+	}
+	require.NoError(t, config.Validate())
+
+	sink := &recordingSink{}
+	result, err := NewGenericProcessor(config).Process(context.Background(), &buf, &mockQuerier{}, nil, sink)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.RowsRead)
+
+	require.Len(t, sink.itemBatches, 1)
+	require.Len(t, sink.itemBatches[0], 2)
+
+	var first map[string]interface{}
+	require.NoError(t, json.Unmarshal(sink.itemBatches[0][0].CustomProperties, &first))
+	assert.Equal(t, "1234.5", first["amount"])
+	assert.Equal(t, "2025-01-01T00:00:00Z", first["date_of_loss"])
+
+	require.Len(t, sink.triage, 1)
+	assert.Equal(t, 4, sink.triage[0].RowNumber)
+	assert.Equal(t, "Claims!C4", sink.triage[0].Location)
+}
+
+func TestXLSXDateTransforms(t *testing.T) {
+	assert.Equal(t, []string{"trim_space", "to_decimal"}, xlsxDateTransforms([]string{"trim_space", "to_decimal"}))
+	assert.Equal(t,
+		[]string{"trim_space", "to_date:01/02/2006|2006-01-02|2006-01-02T15:04:05", "format_date:2006"},
+		xlsxDateTransforms([]string{"trim_space", "to_date:01/02/2006", "format_date:2006"}))
+	assert.Equal(t, []string{"to_date:2006-01-02|2006-01-02T15:04:05"}, xlsxDateTransforms([]string{"to_date"}))
+}
@@ -79,11 +79,13 @@ INSERT INTO ingestion_jobs (
 	report_type,
 	status, 
 	user_id,
-	source_uri
+	source_uri,
+	max_attempts,
+	content_hash
 ) VALUES (
-	$1, $2, $3, $4, $5, $6, $7
+	$1, $2, $3, $4, $5, $6, $7, $8, $9
 )
-RETURNING id, source_type, source_details, report_type, status, started_at, completed_at, error_details, user_id, source_uri, rows_upserted, rows_triaged
+RETURNING id, source_type, source_details, report_type, status, started_at, completed_at, error_details, user_id, source_uri, rows_upserted, rows_triaged, attempts, max_attempts, run_after, locked_by, locked_at, heartbeat_at, cancel_requested_at, config_snapshot, items_inserted, items_updated, items_unchanged, items_deactivated, content_hash, config_revision_id
 `
 
 type CreateIngestionJobParams struct {
@@ -94,6 +96,8 @@ type CreateIngestionJobParams struct {
 	Status        string      `json:"status"`
 	UserID        pgtype.Int8 `json:"user_id"`
 	SourceUri     pgtype.Text `json:"source_uri"`
+	MaxAttempts   int32       `json:"max_attempts"`
+	ContentHash   pgtype.Text `json:"content_hash"`
 }
 
 // Inserts a new file ingestion job record.
@@ -106,6 +110,8 @@ func (q *Queries) CreateIngestionJob(ctx context.Context, arg CreateIngestionJob
 		arg.Status,
 		arg.UserID,
 		arg.SourceUri,
+		arg.MaxAttempts,
+		arg.ContentHash,
 	)
 	var i IngestionJob
 	err := row.Scan(
@@ -121,6 +127,20 @@ func (q *Queries) CreateIngestionJob(ctx context.Context, arg CreateIngestionJob
 		&i.SourceUri,
 		&i.RowsUpserted,
 		&i.RowsTriaged,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAfter,
+		&i.LockedBy,
+		&i.LockedAt,
+		&i.HeartbeatAt,
+		&i.CancelRequestedAt,
+		&i.ConfigSnapshot,
+		&i.ItemsInserted,
+		&i.ItemsUpdated,
+		&i.ItemsUnchanged,
+		&i.ItemsDeactivated,
+		&i.ContentHash,
+		&i.ConfigRevisionID,
 	)
 	return i, err
 }
@@ -183,14 +203,14 @@ INSERT INTO items_events (
 ) VALUES (
 	$1, $2, $3, $4
 )
-RETURNING id, item_id, event_type, event_data, created_by, created_at
+RETURNING id, item_id, event_type, event_data, created_by, created_at, ingestion_job_id
 `
 
 type CreateItemEventParams struct {
-	ItemID    int64  `json:"item_id"`
-	EventType string `json:"event_type"`
-	EventData []byte `json:"event_data"`
-	CreatedBy int64  `json:"created_by"`
+	ItemID    int64       `json:"item_id"`
+	EventType string      `json:"event_type"`
+	EventData []byte      `json:"event_data"`
+	CreatedBy pgtype.Int8 `json:"created_by"`
 }
 
 // Inserts a new event record for a specific time
@@ -209,6 +229,7 @@ func (q *Queries) CreateItemEvent(ctx context.Context, arg CreateItemEventParams
 		&i.EventData,
 		&i.CreatedBy,
 		&i.CreatedAt,
+		&i.IngestionJobID,
 	)
 	return i, err
 }
@@ -224,6 +245,17 @@ func (q *Queries) CreateTempItemsStagingTable(ctx context.Context) error {
 	return err
 }
 
+const createTempSnapshotKeysTable = `-- name: CreateTempSnapshotKeysTable :exec
+CREATE TEMP TABLE temp_snapshot_keys (business_key TEXT PRIMARY KEY, scope TEXT) ON COMMIT DROP
+`
+
+// Creates a temporary table of the business keys and scopes a snapshot job has loaded, so items
+// missing from the file can be found before the transaction commits
+func (q *Queries) CreateTempSnapshotKeysTable(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, createTempSnapshotKeysTable)
+	return err
+}
+
 const createUserFromAuthProvider = `-- name: CreateUserFromAuthProvider :one
 INSERT INTO "users" (
 	auth_provider_subject,
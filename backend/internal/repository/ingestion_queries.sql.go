@@ -16,11 +16,13 @@ INSERT INTO ingestion_errors (
     id,
     job_id,
     original_row_data,
-    reason_for_failure
+    reason_for_failure,
+    row_number,
+    source_location
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6
 )
-RETURNING id, job_id, timestamp, original_row_data, reason_for_failure
+RETURNING id, job_id, timestamp, original_row_data, reason_for_failure, row_number, source_location, resolution_status, resolved_by, resolved_at
 `
 
 type CreateIngestionErrorParams struct {
@@ -28,6 +30,8 @@ type CreateIngestionErrorParams struct {
 	JobID            pgtype.UUID `json:"job_id"`
 	OriginalRowData  []byte      `json:"original_row_data"`
 	ReasonForFailure string      `json:"reason_for_failure"`
+	RowNumber        pgtype.Int4 `json:"row_number"`
+	SourceLocation   pgtype.Text `json:"source_location"`
 }
 
 // Inserts a new ingestion error record for a row that failed processing.
@@ -37,6 +41,8 @@ func (q *Queries) CreateIngestionError(ctx context.Context, arg CreateIngestionE
 		arg.JobID,
 		arg.OriginalRowData,
 		arg.ReasonForFailure,
+		arg.RowNumber,
+		arg.SourceLocation,
 	)
 	var i IngestionError
 	err := row.Scan(
@@ -45,6 +51,11 @@ func (q *Queries) CreateIngestionError(ctx context.Context, arg CreateIngestionE
 		&i.Timestamp,
 		&i.OriginalRowData,
 		&i.ReasonForFailure,
+		&i.RowNumber,
+		&i.SourceLocation,
+		&i.ResolutionStatus,
+		&i.ResolvedBy,
+		&i.ResolvedAt,
 	)
 	return i, err
 }
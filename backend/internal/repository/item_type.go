@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ItemType names an item type in item_type_registry. It used to be a Postgres enum, which sqlc
+// generated this type for; apps now register their own item types, so sqlc.yaml maps the item_type
+// columns to this hand-written type instead.
+type ItemType string
+
+// ErrUnknownItemType is returned by ItemType.Validate for item types that aren't registered.
+var ErrUnknownItemType = errors.New("unknown item type")
+
+func (e *ItemType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ItemType(s)
+	case string:
+		*e = ItemType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ItemType: %T", src)
+	}
+	return nil
+}
+
+// Validate checks that the item type is registered. Writing items of an unregistered type fails on
+// the items.item_type foreign key anyway; Validate lets callers reject them with a clearer error.
+func (e ItemType) Validate(ctx context.Context, q Querier) error {
+	if _, err := q.GetItemType(ctx, e); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w '%s'", ErrUnknownItemType, e)
+		}
+		return fmt.Errorf("failed to look up item type '%s': %w", e, err)
+	}
+	return nil
+}
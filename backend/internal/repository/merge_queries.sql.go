@@ -7,8 +7,40 @@ package repository
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countSnapshotDeactivations = `-- name: CountSnapshotDeactivations :one
+SELECT
+	COUNT(*) AS active_items,
+	COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM temp_snapshot_keys k WHERE k.business_key = i.business_key)) AS missing_items
+FROM items i
+WHERE
+	i.item_type = $1
+	AND i.status = 'active'
+	AND (NOT $2::bool OR i.scope IN (SELECT scope FROM temp_snapshot_keys))
+`
+
+type CountSnapshotDeactivationsParams struct {
+	ItemType    ItemType `json:"item_type"`
+	ScopeToFile bool     `json:"scope_to_file"`
+}
+
+type CountSnapshotDeactivationsRow struct {
+	ActiveItems  int64 `json:"active_items"`
+	MissingItems int64 `json:"missing_items"`
+}
+
+// Counts the active items a snapshot covers and how many of them are missing from its file.
+// With scope_to_file only items in the scopes the file contained are covered.
+func (q *Queries) CountSnapshotDeactivations(ctx context.Context, arg CountSnapshotDeactivationsParams) (CountSnapshotDeactivationsRow, error) {
+	row := q.db.QueryRow(ctx, countSnapshotDeactivations, arg.ItemType, arg.ScopeToFile)
+	var i CountSnapshotDeactivationsRow
+	err := row.Scan(&i.ActiveItems, &i.MissingItems)
+	return i, err
+}
+
 const deactivateItemsBySource = `-- name: DeactivateItemsBySource :exec
 UPDATE items SET status = 'inactive'
 WHERE item_type= $1 AND custom_properties->>'reporting_source' = $2
@@ -24,31 +56,329 @@ func (q *Queries) DeactivateItemsBySource(ctx context.Context, arg DeactivateIte
 	return err
 }
 
-const upsertItems = `-- name: UpsertItems :execrows
+const deactivateItemsMissingFromSnapshot = `-- name: DeactivateItemsMissingFromSnapshot :execrows
+WITH deactivated AS (
+	UPDATE items i
+	SET
+		status = $1,
+		updated_at = NOW()
+	WHERE
+		i.item_type = $2
+		AND i.status = 'active'
+		AND (NOT $3::bool OR i.scope IN (SELECT scope FROM temp_snapshot_keys))
+		AND NOT EXISTS (SELECT 1 FROM temp_snapshot_keys k WHERE k.business_key = i.business_key)
+	RETURNING i.id
+)
+INSERT INTO items_events (item_id, event_type, event_data, created_by, ingestion_job_id)
+SELECT
+	id,
+	'INGESTION_DEACTIVATED',
+	jsonb_build_object('old_status', 'active', 'new_status', $1::text),
+	$4,
+	$5
+FROM deactivated
+`
+
+type DeactivateItemsMissingFromSnapshotParams struct {
+	Status      ItemStatus  `json:"status"`
+	ItemType    ItemType    `json:"item_type"`
+	ScopeToFile bool        `json:"scope_to_file"`
+	CreatedBy   pgtype.Int8 `json:"created_by"`
+	JobID       pgtype.UUID `json:"job_id"`
+}
+
+// Sets the status of the active items a snapshot covers that were missing from its file, and
+// records an INGESTION_DEACTIVATED event for each of them
+func (q *Queries) DeactivateItemsMissingFromSnapshot(ctx context.Context, arg DeactivateItemsMissingFromSnapshotParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deactivateItemsMissingFromSnapshot,
+		arg.Status,
+		arg.ItemType,
+		arg.ScopeToFile,
+		arg.CreatedBy,
+		arg.JobID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteIngestionRunItemRecords = `-- name: DeleteIngestionRunItemRecords :exec
+WITH deleted_events AS (
+	DELETE FROM items_events
+	WHERE
+		item_id = ANY($1::bigint[])
+		AND ingestion_job_id = $2
+		AND id > $3::bigint
+)
+DELETE FROM item_lineage
+WHERE
+	item_id = ANY($1::bigint[])
+	AND job_id = $2
+	AND id > $4::bigint
+`
+
+type DeleteIngestionRunItemRecordsParams struct {
+	ItemIds        []int64     `json:"item_ids"`
+	JobID          pgtype.UUID `json:"job_id"`
+	AfterEventID   int64       `json:"after_event_id"`
+	AfterLineageID int64       `json:"after_lineage_id"`
+}
+
+// Removes the item events and lineage the current run of a job wrote for the given items
+func (q *Queries) DeleteIngestionRunItemRecords(ctx context.Context, arg DeleteIngestionRunItemRecordsParams) error {
+	_, err := q.db.Exec(ctx, deleteIngestionRunItemRecords,
+		arg.ItemIds,
+		arg.JobID,
+		arg.AfterEventID,
+		arg.AfterLineageID,
+	)
+	return err
+}
+
+const getIngestionRunStart = `-- name: GetIngestionRunStart :one
+SELECT
+	(SELECT COALESCE(MAX(audit_id), 0) FROM audit.items_changes)::bigint AS audit_id,
+	(SELECT COALESCE(MAX(id), 0) FROM items_events)::bigint AS event_id,
+	(SELECT COALESCE(MAX(id), 0) FROM item_lineage)::bigint AS lineage_id
+`
+
+type GetIngestionRunStartRow struct {
+	AuditID   int64 `json:"audit_id"`
+	EventID   int64 `json:"event_id"`
+	LineageID int64 `json:"lineage_id"`
+}
+
+// Returns the latest audit, item event and lineage ids before an ingestion run writes anything, so
+// the rows the run goes on to write can be told from those of the job's earlier runs
+func (q *Queries) GetIngestionRunStart(ctx context.Context) (GetIngestionRunStartRow, error) {
+	row := q.db.QueryRow(ctx, getIngestionRunStart)
+	var i GetIngestionRunStartRow
+	err := row.Scan(&i.AuditID, &i.EventID, &i.LineageID)
+	return i, err
+}
+
+const insertNewItems = `-- name: InsertNewItems :many
 INSERT INTO items (
 	item_type, scope, business_key, status, custom_properties, embedding
 )
 SELECT
 	item_type,
-	scope, 
+	scope,
 	business_key,
 	'active',
 	custom_properties,
 	embedding
 FROM temp_items_staging
-ON CONFLICT (item_type, business_key) DO UPDATE SET 
-	status = EXCLUDED.status,
-	scope = EXCLUDED.scope,
-	custom_properties = items.custom_properties || EXCLUDED.custom_properties,
-	embedding = EXCLUDED.embedding,
-	updated_at = NOW()
+ON CONFLICT (item_type, business_key) DO NOTHING
+RETURNING id, business_key
 `
 
-// Insert new records from staging, or update existing ones based on business key
-func (q *Queries) UpsertItems(ctx context.Context) (int64, error) {
-	result, err := q.db.Exec(ctx, upsertItems)
+type InsertNewItemsRow struct {
+	ID          int64       `json:"id"`
+	BusinessKey pgtype.Text `json:"business_key"`
+}
+
+// Inserts records from staging whose business key is not in items yet, leaving existing items as they are
+func (q *Queries) InsertNewItems(ctx context.Context) ([]InsertNewItemsRow, error) {
+	rows, err := q.db.Query(ctx, insertNewItems)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return result.RowsAffected(), nil
+	defer rows.Close()
+	var items []InsertNewItemsRow
+	for rows.Next() {
+		var i InsertNewItemsRow
+		if err := rows.Scan(&i.ID, &i.BusinessKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIngestionRunItemChanges = `-- name: ListIngestionRunItemChanges :many
+SELECT DISTINCT ON (i.id)
+	i.id,
+	i.business_key,
+	(a.operation = 'I')::bool AS inserted,
+	a.old_data,
+	i.custom_properties,
+	EXISTS (
+		SELECT 1 FROM items_events e
+		WHERE
+			e.item_id = i.id
+			AND e.ingestion_job_id = $1
+			AND e.id > $2::bigint
+			AND e.event_type = 'INGESTION_UPDATED'
+	) AS updated
+FROM items i
+JOIN audit.items_changes a ON a.target_id = i.id
+WHERE
+	i.item_type = $3
+	AND i.business_key = ANY($4::text[])
+	AND a.ingestion_job_id = $1
+	AND a.audit_id > $5::bigint
+ORDER BY i.id, a.audit_id
+`
+
+type ListIngestionRunItemChangesParams struct {
+	JobID        pgtype.UUID `json:"job_id"`
+	AfterEventID int64       `json:"after_event_id"`
+	ItemType     ItemType    `json:"item_type"`
+	BusinessKeys []string    `json:"business_keys"`
+	AfterAuditID int64       `json:"after_audit_id"`
+}
+
+type ListIngestionRunItemChangesRow struct {
+	ID               int64       `json:"id"`
+	BusinessKey      pgtype.Text `json:"business_key"`
+	Inserted         bool        `json:"inserted"`
+	OldData          []byte      `json:"old_data"`
+	CustomProperties []byte      `json:"custom_properties"`
+	Updated          bool        `json:"updated"`
+}
+
+// Finds the items with the given business keys that the current run of a job changed, with the
+// state each had before the run and the properties the run left it with. updated says whether the
+// run recorded an INGESTION_UPDATED event for the item.
+func (q *Queries) ListIngestionRunItemChanges(ctx context.Context, arg ListIngestionRunItemChangesParams) ([]ListIngestionRunItemChangesRow, error) {
+	rows, err := q.db.Query(ctx, listIngestionRunItemChanges,
+		arg.JobID,
+		arg.AfterEventID,
+		arg.ItemType,
+		arg.BusinessKeys,
+		arg.AfterAuditID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIngestionRunItemChangesRow
+	for rows.Next() {
+		var i ListIngestionRunItemChangesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.BusinessKey,
+			&i.Inserted,
+			&i.OldData,
+			&i.CustomProperties,
+			&i.Updated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordSnapshotKeys = `-- name: RecordSnapshotKeys :exec
+INSERT INTO temp_snapshot_keys (business_key, scope)
+SELECT DISTINCT business_key, scope FROM temp_items_staging
+ON CONFLICT (business_key) DO NOTHING
+`
+
+// Remembers the business keys and scopes of the staged batch for a snapshot job
+func (q *Queries) RecordSnapshotKeys(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, recordSnapshotKeys)
+	return err
+}
+
+const truncateTempItemsStaging = `-- name: TruncateTempItemsStaging :exec
+TRUNCATE temp_items_staging
+`
+
+// Empties the staging table between batches of a streamed ingestion job
+func (q *Queries) TruncateTempItemsStaging(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, truncateTempItemsStaging)
+	return err
+}
+
+const upsertItems = `-- name: UpsertItems :many
+WITH previous AS (
+	SELECT i.id, i.scope, i.status, i.custom_properties
+	FROM items i
+	JOIN temp_items_staging s ON s.item_type = i.item_type AND s.business_key = i.business_key
+), upserted AS (
+	INSERT INTO items (
+		item_type, scope, business_key, status, custom_properties, embedding
+	)
+	SELECT
+		item_type,
+		scope, 
+		business_key,
+		'active',
+		custom_properties,
+		embedding
+	FROM temp_items_staging
+	ON CONFLICT (item_type, business_key) DO UPDATE SET 
+		status = EXCLUDED.status,
+		scope = EXCLUDED.scope,
+		custom_properties = items.custom_properties || EXCLUDED.custom_properties,
+		embedding = COALESCE(EXCLUDED.embedding, items.embedding),
+		updated_at = NOW()
+	RETURNING id, business_key, scope, status, custom_properties
+)
+SELECT
+	u.id,
+	u.business_key,
+	u.scope,
+	u.status,
+	u.custom_properties,
+	(p.id IS NULL)::bool AS inserted,
+	p.scope AS previous_scope,
+	p.status AS previous_status,
+	p.custom_properties AS previous_properties
+FROM upserted u
+LEFT JOIN previous p ON p.id = u.id
+`
+
+type UpsertItemsRow struct {
+	ID                 int64          `json:"id"`
+	BusinessKey        pgtype.Text    `json:"business_key"`
+	Scope              pgtype.Text    `json:"scope"`
+	Status             ItemStatus     `json:"status"`
+	CustomProperties   []byte         `json:"custom_properties"`
+	Inserted           bool           `json:"inserted"`
+	PreviousScope      pgtype.Text    `json:"previous_scope"`
+	PreviousStatus     NullItemStatus `json:"previous_status"`
+	PreviousProperties []byte         `json:"previous_properties"`
+}
+
+// Insert new records from staging, or update existing ones based on business key.
+// Returns each written item with its scope, status and properties from before the write.
+func (q *Queries) UpsertItems(ctx context.Context) ([]UpsertItemsRow, error) {
+	rows, err := q.db.Query(ctx, upsertItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertItemsRow
+	for rows.Next() {
+		var i UpsertItemsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.BusinessKey,
+			&i.Scope,
+			&i.Status,
+			&i.CustomProperties,
+			&i.Inserted,
+			&i.PreviousScope,
+			&i.PreviousStatus,
+			&i.PreviousProperties,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
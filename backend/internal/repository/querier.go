@@ -6,6 +6,8 @@ package repository
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
@@ -14,7 +16,26 @@ type Querier interface {
 	AssignRoleToUser(ctx context.Context, arg AssignRoleToUserParams) error
 	// Grants a user access to a specific scope
 	AssignScopeToUser(ctx context.Context, arg AssignScopeToUserParams) error
+	// Claims the oldest runnable job for a worker. SKIP LOCKED lets several workers poll at once
+	// without ever handing out the same job twice.
+	ClaimIngestionJob(ctx context.Context, workerID pgtype.Text) (IngestionJob, error)
+	// Removes the backfill records of items that have since been loaded with an embedding
+	ClearPendingEmbeddings(ctx context.Context, arg ClearPendingEmbeddingsParams) error
+	// Counts a job's triage rows matching the ListIngestionErrors search
+	CountIngestionErrors(ctx context.Context, arg CountIngestionErrorsParams) (int64, error)
+	// Counts the item events matching the ListIngestionJobChanges filter
+	CountIngestionJobChanges(ctx context.Context, arg CountIngestionJobChangesParams) (int64, error)
+	// Counts the ingestion jobs matching the ListIngestionJobs filters
+	CountIngestionJobs(ctx context.Context, arg CountIngestionJobsParams) (int64, error)
+	// Counts the lineage rows of an item
+	CountItemLineage(ctx context.Context, itemID int64) (int64, error)
+	// Counts the active items a snapshot covers and how many of them are missing from its file.
+	// With scope_to_file only items in the scopes the file contained are covered.
+	CountSnapshotDeactivations(ctx context.Context, arg CountSnapshotDeactivationsParams) (CountSnapshotDeactivationsRow, error)
 	CreateComment(ctx context.Context, arg CreateCommentParams) (CreateCommentRow, error)
+	// Stores a new revision of a report type's config, numbered after the latest one. Callers hold
+	// LockIngestionConfigRevisions so two writers can't take the same number.
+	CreateIngestionConfigRevision(ctx context.Context, arg CreateIngestionConfigRevisionParams) (IngestionConfigRevision, error)
 	// Inserts a new ingestion error record for a row that failed processing.
 	CreateIngestionError(ctx context.Context, arg CreateIngestionErrorParams) (IngestionError, error)
 	// Inserts a new file ingestion job record.
@@ -27,20 +48,123 @@ type Querier interface {
 	// Creates a temporary table for staging items during ingest
 	// This table is dropped on commit
 	CreateTempItemsStagingTable(ctx context.Context) error
+	// Creates a temporary table of the business keys and scopes a snapshot job has loaded, so items
+	// missing from the file can be found before the transaction commits
+	CreateTempSnapshotKeysTable(ctx context.Context) error
 	// Creates a new user record from the authentication provider's details
 	CreateUserFromAuthProvider(ctx context.Context, arg CreateUserFromAuthProviderParams) (User, error)
+	// Sets the given items to inactive
+	DeactivateItems(ctx context.Context, itemIds []int64) (int64, error)
 	DeactivateItemsBySource(ctx context.Context, arg DeactivateItemsBySourceParams) error
+	// Sets the status of the active items a snapshot covers that were missing from its file, and
+	// records an INGESTION_DEACTIVATED event for each of them
+	DeactivateItemsMissingFromSnapshot(ctx context.Context, arg DeactivateItemsMissingFromSnapshotParams) (int64, error)
+	// Clears the triage rows of a job before it runs again, so only the latest run's rows remain
+	DeleteIngestionErrorsForJob(ctx context.Context, jobID pgtype.UUID) error
+	// Removes the events a job wrote for items that are about to be deleted
+	DeleteIngestionJobItemEvents(ctx context.Context, arg DeleteIngestionJobItemEventsParams) error
+	// Removes the item events and lineage the current run of a job wrote for the given items
+	DeleteIngestionRunItemRecords(ctx context.Context, arg DeleteIngestionRunItemRecordsParams) error
+	// Deletes the given items. Fails if other records still refer to them.
+	DeleteItems(ctx context.Context, itemIds []int64) (int64, error)
+	// Removes an item's backfill record once its embedding is stored
+	DeletePendingEmbedding(ctx context.Context, itemID int64) error
+	// Returns the latest job of the report type started since the given time for a file with this
+	// content. Failed, cancelled and rolled back jobs don't count, so such a file can be loaded again.
+	FindIngestionJobByContentHash(ctx context.Context, arg FindIngestionJobByContentHashParams) (IngestionJob, error)
+	// Closes an attempt, copying the job's counters. A null status or error_details copies those from
+	// the job too, which is how a handler's own final status is recorded.
+	FinishIngestionJobAttempt(ctx context.Context, arg FinishIngestionJobAttemptParams) error
+	// Records items that were loaded without an embedding so the vector can be generated later
+	FlagItemsForEmbeddingBackfill(ctx context.Context, arg FlagItemsForEmbeddingBackfillParams) error
 	// Fetch the event history for a specific item, newest first
 	GetEventsForItem(ctx context.Context, itemID int64) ([]ItemsEvent, error)
+	GetIngestionConfigRevision(ctx context.Context, arg GetIngestionConfigRevisionParams) (IngestionConfigRevision, error)
+	// Finds the stored revision of a report type's config with the given content
+	GetIngestionConfigRevisionByHash(ctx context.Context, arg GetIngestionConfigRevisionByHashParams) (IngestionConfigRevision, error)
+	// Locks the given triage rows of a job while they are corrected and resubmitted
+	GetIngestionErrorsForUpdate(ctx context.Context, arg GetIngestionErrorsForUpdateParams) ([]IngestionError, error)
+	// Fetch a single ingestion job
+	GetIngestionJob(ctx context.Context, id pgtype.UUID) (IngestionJob, error)
+	// Locks a job while it is rolled back
+	GetIngestionJobForUpdate(ctx context.Context, id pgtype.UUID) (IngestionJob, error)
+	// Returns the latest audit, item event and lineage ids before an ingestion run writes anything, so
+	// the rows the run goes on to write can be told from those of the job's earlier runs
+	GetIngestionRunStart(ctx context.Context) (GetIngestionRunStartRow, error)
 	// Fetch a single item for update
 	GetItemForUpdate(ctx context.Context, id int64) (Item, error)
+	GetItemType(ctx context.Context, name ItemType) (ItemTypeRegistry, error)
+	GetLatestIngestionConfigRevision(ctx context.Context, reportType string) (IngestionConfigRevision, error)
 	// Fetch a single user by their external auth provider ID
 	GetUserByAuthProviderSubject(ctx context.Context, authProviderSubject string) (User, error)
+	// Records that a worker is still processing a job and reports whether a user asked to cancel it.
+	// No rows means the worker no longer owns the job.
+	HeartbeatIngestionJob(ctx context.Context, arg HeartbeatIngestionJobParams) (bool, error)
+	// Inserts records from staging whose business key is not in items yet, leaving existing items as they are
+	InsertNewItems(ctx context.Context) ([]InsertNewItemsRow, error)
 	// Checks for the existence of an item by its type and business key. Returns 1 if it exists, 0 otherwise.
 	ItemExistsByBusinessKey(ctx context.Context, arg ItemExistsByBusinessKeyParams) (int32, error)
 	ListCommentsForItem(ctx context.Context, itemID int64) ([]ListCommentsForItemRow, error)
+	// Returns which of the given business keys already exist for an item type
+	ListExistingBusinessKeys(ctx context.Context, arg ListExistingBusinessKeysParams) ([]pgtype.Text, error)
+	// Lists a report type's config revisions, newest first, with how many jobs ran with each
+	ListIngestionConfigRevisions(ctx context.Context, reportType string) ([]ListIngestionConfigRevisionsRow, error)
+	// Lists the original columns of a job's triage rows matching the ListIngestionErrors search
+	ListIngestionErrorColumns(ctx context.Context, arg ListIngestionErrorColumnsParams) ([]string, error)
+	// Pages through a job's triage rows in source order. search matches the failure reason or any cell.
+	ListIngestionErrors(ctx context.Context, arg ListIngestionErrorsParams) ([]IngestionError, error)
+	// Lists every run of a job, oldest first
+	ListIngestionJobAttempts(ctx context.Context, jobID pgtype.UUID) ([]IngestionJobAttempt, error)
+	// Pages through the item events a job wrote, in the order it wrote them
+	ListIngestionJobChanges(ctx context.Context, arg ListIngestionJobChangesParams) ([]ListIngestionJobChangesRow, error)
+	// Finds the items a job changed and the state each had before the job, from the audit rows its
+	// transactions recorded against it. Items the job wrote without changing them have no item event
+	// and are left out. later_changes counts the edits users made to an item since and later_jobs lists
+	// the ingestion jobs that changed it since. Writes that only touched updated_at or the embedding,
+	// such as a re-ingest of unchanged rows or an embedding backfill, don't count.
+	ListIngestionJobRollbackItems(ctx context.Context, jobID pgtype.UUID) ([]ListIngestionJobRollbackItemsRow, error)
+	// Finds the items with the given business keys that the current run of a job changed, with the
+	// state each had before the run and the properties the run left it with. updated says whether the
+	// run recorded an INGESTION_UPDATED event for the item.
+	ListIngestionRunItemChanges(ctx context.Context, arg ListIngestionRunItemChangesParams) ([]ListIngestionRunItemChangesRow, error)
+	// Pages through ingestion jobs, newest first, with optional filters
+	ListIngestionJobs(ctx context.Context, arg ListIngestionJobsParams) ([]IngestionJob, error)
+	// Pages through the jobs and source rows that wrote an item, newest first
+	ListItemLineage(ctx context.Context, arg ListItemLineageParams) ([]ListItemLineageRow, error)
+	// Returns the custom_properties of the items of a type with the given business keys
+	ListItemPropertiesByBusinessKeys(ctx context.Context, arg ListItemPropertiesByBusinessKeysParams) ([]ListItemPropertiesByBusinessKeysRow, error)
+	ListItemTypes(ctx context.Context) ([]ItemTypeRegistry, error)
+	// Pages through items of a type whose custom_properties has any of the given top-level keys
+	ListItemsWithPropertyKeys(ctx context.Context, arg ListItemsWithPropertyKeysParams) ([]ListItemsWithPropertyKeysRow, error)
+	// Fetches the items waiting for an embedding backfill, least recently tried first
+	ListPendingEmbeddings(ctx context.Context, arg ListPendingEmbeddingsParams) ([]PendingItemEmbedding, error)
+	// Returns those of the given items that other records refer to: comments, status history,
+	// assignments, contacts, notifications, or events and lineage not written by the job. Deleting
+	// items cascades to most of these, so they are checked before a job's inserted items are deleted.
+	ListReferencedItems(ctx context.Context, arg ListReferencedItemsParams) ([]int64, error)
 	// Fetch all available roles in system
 	ListRoles(ctx context.Context) ([]Role, error)
+	// Serializes storing revisions of one report type's config until the transaction ends.
+	LockIngestionConfigRevisions(ctx context.Context, reportType string) error
+	// Serializes job creation for one report type and file content until the transaction ends.
+	LockIngestionContentHash(ctx context.Context, arg LockIngestionContentHashParams) error
+	// Ends a job the worker stopped because a user cancelled it. Nothing it processed was committed.
+	MarkIngestionJobCancelled(ctx context.Context, arg MarkIngestionJobCancelledParams) error
+	// Fails a job on its last attempt when the handler didn't record a final status, e.g. because it
+	// panicked. A status the handler recorded is kept.
+	MarkIngestionJobFailed(ctx context.Context, arg MarkIngestionJobFailedParams) error
+	// Records that a job's changes to items were undone
+	MarkIngestionJobRolledBack(ctx context.Context, arg MarkIngestionJobRolledBackParams) error
+	// Releases jobs whose worker stopped heartbeating. Jobs a user asked to cancel are cancelled, jobs
+	// with attempts left go back in the queue and the rest are failed. Their open attempts are closed.
+	ReclaimStaleIngestionJobs(ctx context.Context, staleAfterSeconds float64) ([]ReclaimStaleIngestionJobsRow, error)
+	// Notes another failed backfill attempt for an item
+	RecordPendingEmbeddingFailure(ctx context.Context, arg RecordPendingEmbeddingFailureParams) error
+	// Remembers the business keys and scopes of the staged batch for a snapshot job
+	RecordSnapshotKeys(ctx context.Context) error
+	// Brings a job's counters in line with its triage rows after some were resolved or dismissed.
+	// A finished job is COMPLETE once no triage rows are open and COMPLETE_WITH_ISSUES otherwise.
+	RefreshIngestionJobCounters(ctx context.Context, arg RefreshIngestionJobCountersParams) error
 	// Removes all roles from a user. Useful when completely re-assigning roles
 	RemoveAllRolesFromUser(ctx context.Context, userID int64) error
 	// Removes all scope access from a user
@@ -49,19 +173,54 @@ type Querier interface {
 	RemoveRoleFromUser(ctx context.Context, arg RemoveRoleFromUserParams) error
 	//Revokes a user's access from a specific scope.
 	RemoveScopeFromUser(ctx context.Context, arg RemoveScopeFromUserParams) error
+	// Cancels a queued job straight away, or flags a running one for its worker to stop.
+	RequestIngestionJobCancel(ctx context.Context, id pgtype.UUID) (IngestionJob, error)
+	// Puts a job a worker could not finish back in the queue to be retried after a delay.
+	// refunded_attempts gives back the attempt of a job that was interrupted rather than failed.
+	RequeueIngestionJob(ctx context.Context, arg RequeueIngestionJobParams) error
+	// Puts items back to the state captured in their audit old_data
+	RestoreItemsFromAudit(ctx context.Context, arg RestoreItemsFromAuditParams) (int64, error)
+	// Puts a failed or cancelled job back in the queue with a fresh set of attempts. Clearing the
+	// config snapshot makes the next run use the report type's current config.
+	RetryIngestionJob(ctx context.Context, arg RetryIngestionJobParams) (IngestionJob, error)
+	// Attributes the audit rows of the current transaction to an ingestion job
+	SetAuditIngestionJob(ctx context.Context, jobID string) error
+	// Attributes the audit rows of the current transaction to a user
+	SetAuditUser(ctx context.Context, userID string) error
 	// Sets the embedding for a specific comment after its been created
 	SetCommentEmbedding(ctx context.Context, arg SetCommentEmbeddingParams) error
+	// Moves triage rows of a job from one resolution status to another, e.g. to dismiss or reopen them
+	SetIngestionErrorsResolution(ctx context.Context, arg SetIngestionErrorsResolutionParams) (int64, error)
+	// Records the config a job runs with, so a retry can run it the same way
+	// Records how many items a job inserted, updated, left unchanged or deactivated
+	SetIngestionJobChangeCounts(ctx context.Context, arg SetIngestionJobChangeCountsParams) error
+	// Records the config a job runs with, and its stored revision, so a retry can run it the same way
+	SetIngestionJobConfigSnapshot(ctx context.Context, arg SetIngestionJobConfigSnapshotParams) error
+	// Replaces the custom_properties of an item without touching its other fields
+	SetItemCustomProperties(ctx context.Context, arg SetItemCustomPropertiesParams) error
+	// Stores a backfilled embedding on an item
+	SetItemEmbedding(ctx context.Context, arg SetItemEmbeddingParams) error
 	// Updates only the is_admin status of a specific user
 	// This is a priviliged action and should be protected at API layer
 	SetUserAdminStatus(ctx context.Context, arg SetUserAdminStatusParams) (User, error)
+	// Records that a worker started running a job. Attempt numbers keep counting across retries.
+	StartIngestionJobAttempt(ctx context.Context, arg StartIngestionJobAttemptParams) (int64, error)
+	// Empties the staging table between batches of a streamed ingestion job
+	TruncateTempItemsStaging(ctx context.Context) error
+	// Saves the corrected data of a resubmitted triage row and whether the resubmission resolved it
+	UpdateIngestionErrorResolution(ctx context.Context, arg UpdateIngestionErrorResolutionParams) error
 	// Updates the status and details of an ingestion job
 	UpdateIngestionJobStatus(ctx context.Context, arg UpdateIngestionJobStatusParams) error
 	// Updates the mutable fields of a specific item
 	UpdateItem(ctx context.Context, arg UpdateItemParams) (Item, error)
 	// Updates a user's mutable details
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
-	//Insert new records from staging, or update existing ones based on business key
-	UpsertItems(ctx context.Context) (int64, error)
+	// Registers an item type, or updates the metadata of one that is already registered. Rows that
+	// wouldn't change are left alone so updated_at shows when the metadata last changed.
+	UpsertItemType(ctx context.Context, arg UpsertItemTypeParams) error
+	//Insert new records from staging, or update existing ones based on business key.
+	//Returns each written item with its scope, status and properties from before the write.
+	UpsertItems(ctx context.Context) ([]UpsertItemsRow, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,8 +11,21 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countItemLineage = `-- name: CountItemLineage :one
+SELECT COUNT(*) FROM item_lineage
+WHERE item_id = $1
+`
+
+// Counts the lineage rows of an item
+func (q *Queries) CountItemLineage(ctx context.Context, itemID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countItemLineage, itemID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const getEventsForItem = `-- name: GetEventsForItem :many
-SELECT id, item_id, event_type, event_data, created_by, created_at FROM "items_events"
+SELECT id, item_id, event_type, event_data, created_by, created_at, ingestion_job_id FROM "items_events"
 WHERE item_id = $1
 ORDER BY created_at DESC
 `
@@ -34,6 +47,7 @@ func (q *Queries) GetEventsForItem(ctx context.Context, itemID int64) ([]ItemsEv
 			&i.EventData,
 			&i.CreatedBy,
 			&i.CreatedAt,
+			&i.IngestionJobID,
 		); err != nil {
 			return nil, err
 		}
@@ -145,3 +159,186 @@ func (q *Queries) ListCommentsForItem(ctx context.Context, itemID int64) ([]List
 	}
 	return items, nil
 }
+
+const listExistingBusinessKeys = `-- name: ListExistingBusinessKeys :many
+SELECT business_key FROM "items"
+WHERE item_type = $1
+AND business_key = ANY($2::text[])
+`
+
+type ListExistingBusinessKeysParams struct {
+	ItemType     ItemType `json:"item_type"`
+	BusinessKeys []string `json:"business_keys"`
+}
+
+// Returns which of the given business keys already exist for an item type
+func (q *Queries) ListExistingBusinessKeys(ctx context.Context, arg ListExistingBusinessKeysParams) ([]pgtype.Text, error) {
+	rows, err := q.db.Query(ctx, listExistingBusinessKeys, arg.ItemType, arg.BusinessKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.Text
+	for rows.Next() {
+		var business_key pgtype.Text
+		if err := rows.Scan(&business_key); err != nil {
+			return nil, err
+		}
+		items = append(items, business_key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listItemLineage = `-- name: ListItemLineage :many
+SELECT
+	l.id,
+	l.job_id,
+	j.report_type,
+	j.status AS job_status,
+	l.source_uri,
+	l.row_number,
+	l.source_location,
+	l.config_version,
+	l.recorded_at
+FROM item_lineage l
+LEFT JOIN ingestion_jobs j ON j.id = l.job_id
+WHERE l.item_id = $1
+ORDER BY l.recorded_at DESC, l.id DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListItemLineageParams struct {
+	ItemID int64 `json:"item_id"`
+	Limit  int32 `json:"limit"`
+	Offset int32 `json:"offset"`
+}
+
+type ListItemLineageRow struct {
+	ID             int64              `json:"id"`
+	JobID          pgtype.UUID        `json:"job_id"`
+	ReportType     pgtype.Text        `json:"report_type"`
+	JobStatus      pgtype.Text        `json:"job_status"`
+	SourceUri      pgtype.Text        `json:"source_uri"`
+	RowNumber      pgtype.Int4        `json:"row_number"`
+	SourceLocation pgtype.Text        `json:"source_location"`
+	ConfigVersion  pgtype.Text        `json:"config_version"`
+	RecordedAt     pgtype.Timestamptz `json:"recorded_at"`
+}
+
+// Pages through the jobs and source rows that wrote an item, newest first
+func (q *Queries) ListItemLineage(ctx context.Context, arg ListItemLineageParams) ([]ListItemLineageRow, error) {
+	rows, err := q.db.Query(ctx, listItemLineage, arg.ItemID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListItemLineageRow
+	for rows.Next() {
+		var i ListItemLineageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.JobID,
+			&i.ReportType,
+			&i.JobStatus,
+			&i.SourceUri,
+			&i.RowNumber,
+			&i.SourceLocation,
+			&i.ConfigVersion,
+			&i.RecordedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listItemPropertiesByBusinessKeys = `-- name: ListItemPropertiesByBusinessKeys :many
+SELECT business_key, custom_properties FROM "items"
+WHERE item_type = $1
+AND business_key = ANY($2::text[])
+`
+
+type ListItemPropertiesByBusinessKeysParams struct {
+	ItemType     ItemType `json:"item_type"`
+	BusinessKeys []string `json:"business_keys"`
+}
+
+type ListItemPropertiesByBusinessKeysRow struct {
+	BusinessKey      pgtype.Text `json:"business_key"`
+	CustomProperties []byte      `json:"custom_properties"`
+}
+
+// Returns the custom_properties of the items of a type with the given business keys
+func (q *Queries) ListItemPropertiesByBusinessKeys(ctx context.Context, arg ListItemPropertiesByBusinessKeysParams) ([]ListItemPropertiesByBusinessKeysRow, error) {
+	rows, err := q.db.Query(ctx, listItemPropertiesByBusinessKeys, arg.ItemType, arg.BusinessKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListItemPropertiesByBusinessKeysRow
+	for rows.Next() {
+		var i ListItemPropertiesByBusinessKeysRow
+		if err := rows.Scan(&i.BusinessKey, &i.CustomProperties); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listItemsWithPropertyKeys = `-- name: ListItemsWithPropertyKeys :many
+SELECT id, custom_properties FROM "items"
+WHERE item_type = $1
+AND custom_properties ?| $2::text[]
+AND id > $3
+ORDER BY id
+LIMIT $4
+`
+
+type ListItemsWithPropertyKeysParams struct {
+	ItemType ItemType `json:"item_type"`
+	Keys     []string `json:"keys"`
+	AfterID  int64    `json:"after_id"`
+	Limit    int32    `json:"limit"`
+}
+
+type ListItemsWithPropertyKeysRow struct {
+	ID               int64  `json:"id"`
+	CustomProperties []byte `json:"custom_properties"`
+}
+
+// Pages through items of a type whose custom_properties has any of the given top-level keys
+func (q *Queries) ListItemsWithPropertyKeys(ctx context.Context, arg ListItemsWithPropertyKeysParams) ([]ListItemsWithPropertyKeysRow, error) {
+	rows, err := q.db.Query(ctx, listItemsWithPropertyKeys,
+		arg.ItemType,
+		arg.Keys,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListItemsWithPropertyKeysRow
+	for rows.Next() {
+		var i ListItemsWithPropertyKeysRow
+		if err := rows.Scan(&i.ID, &i.CustomProperties); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -31,6 +31,25 @@ func (q *Queries) SetCommentEmbedding(ctx context.Context, arg SetCommentEmbeddi
 	return err
 }
 
+const setItemCustomProperties = `-- name: SetItemCustomProperties :exec
+UPDATE items
+SET
+	custom_properties = $2
+WHERE
+	id = $1
+`
+
+type SetItemCustomPropertiesParams struct {
+	ID               int64  `json:"id"`
+	CustomProperties []byte `json:"custom_properties"`
+}
+
+// Replaces the custom_properties of an item without touching its other fields
+func (q *Queries) SetItemCustomProperties(ctx context.Context, arg SetItemCustomPropertiesParams) error {
+	_, err := q.db.Exec(ctx, setItemCustomProperties, arg.ID, arg.CustomProperties)
+	return err
+}
+
 const updateIngestionJobStatus = `-- name: UpdateIngestionJobStatus :exec
 UPDATE ingestion_jobs
 SET
@@ -12,6 +12,9 @@ print("Model loaded successfully.")
 
 app = Flask(__name__)
 
+# Upper bound on texts per /embed_batch request, to keep a single request's memory in check.
+MAX_BATCH_SIZE = 256
+
 
 @app.route('/embed', methods=['POST'])
 def embed():
@@ -31,5 +34,29 @@ def embed():
         return jsonify({"error": "Failed to generate embedding"}), 500
 
 
+@app.route('/embed_batch', methods=['POST'])
+def embed_batch():
+    try:
+        data = request.get_json()
+        if not data or 'texts' not in data:
+            return jsonify({"error": "Request body must be JSON with a 'texts' key"}), 400
+
+        texts = data['texts']
+        if not isinstance(texts, list) or not all(isinstance(t, str) for t in texts):
+            return jsonify({"error": "'texts' must be a list of strings"}), 400
+        if len(texts) > MAX_BATCH_SIZE:
+            return jsonify({"error": f"At most {MAX_BATCH_SIZE} texts can be embedded per request"}), 413
+        if not texts:
+            return jsonify({"embeddings": []})
+
+        embeddings = model.encode(texts).tolist()
+
+        return jsonify({"embeddings": embeddings})
+
+    except Exception as e:
+        print(f"An error occurred: {e}")
+        return jsonify({"error": "Failed to generate embeddings"}), 500
+
+
 if __name__ == '__main__':
     app.run(host='0.0.0.0', port=5001)
@@ -42,13 +42,13 @@ LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
 -- Searches semantically the knowledge base
 SELECT
     (
-    COALESCE(custom_properties->>'metadata.section', 'General Information') ||
+    COALESCE(custom_properties->'metadata'->>'section', 'General Information') ||
     ' from ' ||
-    COALESCE(custom_properties->>'metadata.document_name', 'Unknown Document')
+    COALESCE(custom_properties->'metadata'->>'document_name', 'Unknown Document')
     ) AS source,
     COALESCE((custom_properties->>'chunk_text')::TEXT, '') AS text,
     embedding <=> @embedding::vector AS similarity_score,
-    custom_properties->>'metadata.source_custom_properties' AS structured_metadata
+    custom_properties->'metadata'->>'source_custom_properties' AS structured_metadata
 FROM items
 WHERE
     item_type = 'KNOWLEDGE_CHUNK' AND embedding IS NOT NULL
@@ -2,3 +2,4 @@
 -- it should NOT be included in database migration sequence
 
 CREATE TABLE public.temp_items_staging (LIKE public.items INCLUDING DEFAULTS);
+CREATE TABLE public.temp_snapshot_keys (business_key TEXT PRIMARY KEY, scope TEXT);
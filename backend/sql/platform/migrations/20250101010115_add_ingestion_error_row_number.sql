@@ -0,0 +1,9 @@
+-- +goose Up
+-- Record which row of the source file each triaged record came from
+ALTER TABLE "ingestion_errors" ADD COLUMN "row_number" INTEGER;
+
+CREATE INDEX idx_ingestion_errors_job_row ON "ingestion_errors" (job_id, row_number);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_ingestion_errors_job_row;
+ALTER TABLE "ingestion_errors" DROP COLUMN IF EXISTS "row_number";
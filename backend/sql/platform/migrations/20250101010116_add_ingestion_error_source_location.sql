@@ -0,0 +1,6 @@
+-- +goose Up
+-- Spreadsheet sources record the sheet and cell coordinates of each triaged record
+ALTER TABLE "ingestion_errors" ADD COLUMN "source_location" TEXT;
+
+-- +goose Down
+ALTER TABLE "ingestion_errors" DROP COLUMN IF EXISTS "source_location";
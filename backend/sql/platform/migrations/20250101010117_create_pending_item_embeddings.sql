@@ -0,0 +1,17 @@
+-- +goose Up
+-- Items that were loaded without an embedding because generating it failed during ingestion.
+-- The text that should have been embedded is kept so the vector can be backfilled later.
+CREATE TABLE "pending_item_embeddings" (
+	"item_id" BIGINT PRIMARY KEY REFERENCES "items"("id") ON DELETE CASCADE,
+	"job_id" UUID REFERENCES "ingestion_jobs"("id") ON DELETE SET NULL,
+	"source_text" TEXT NOT NULL,
+	"last_error" TEXT,
+	"attempts" INTEGER NOT NULL DEFAULT 1,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	"updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_pending_item_embeddings_updated_at ON "pending_item_embeddings" (updated_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS "pending_item_embeddings";
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Turns ingestion_jobs into a durable work queue. Jobs in UPLOADED status are waiting to run;
+-- a worker claims one by moving it to PROCESSING and keeps heartbeat_at fresh while it works,
+-- so jobs held by a crashed worker can be found and handed to another.
+ALTER TABLE "ingestion_jobs"
+	ADD COLUMN "attempts" INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN "max_attempts" INTEGER NOT NULL DEFAULT 3,
+	ADD COLUMN "run_after" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN "locked_by" TEXT,
+	ADD COLUMN "locked_at" TIMESTAMPTZ,
+	ADD COLUMN "heartbeat_at" TIMESTAMPTZ;
+
+CREATE INDEX idx_ingestion_jobs_queued ON "ingestion_jobs" (run_after) WHERE status = 'UPLOADED';
+CREATE INDEX idx_ingestion_jobs_processing ON "ingestion_jobs" (heartbeat_at) WHERE status = 'PROCESSING';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_ingestion_jobs_processing;
+DROP INDEX IF EXISTS idx_ingestion_jobs_queued;
+ALTER TABLE "ingestion_jobs"
+	DROP COLUMN IF EXISTS "heartbeat_at",
+	DROP COLUMN IF EXISTS "locked_at",
+	DROP COLUMN IF EXISTS "locked_by",
+	DROP COLUMN IF EXISTS "run_after",
+	DROP COLUMN IF EXISTS "max_attempts",
+	DROP COLUMN IF EXISTS "attempts";
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Triage rows can be corrected and resubmitted, or dismissed. Each records who closed it and when.
+ALTER TABLE "ingestion_errors"
+	ADD COLUMN "resolution_status" VARCHAR(20) NOT NULL DEFAULT 'open'
+		CHECK ("resolution_status" IN ('open', 'resolved', 'dismissed')),
+	ADD COLUMN "resolved_by" BIGINT REFERENCES "users"("id"),
+	ADD COLUMN "resolved_at" TIMESTAMPTZ;
+
+CREATE INDEX idx_ingestion_errors_job_status ON "ingestion_errors" (job_id, resolution_status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_ingestion_errors_job_status;
+ALTER TABLE "ingestion_errors"
+	DROP COLUMN IF EXISTS "resolved_at",
+	DROP COLUMN IF EXISTS "resolved_by",
+	DROP COLUMN IF EXISTS "resolution_status";
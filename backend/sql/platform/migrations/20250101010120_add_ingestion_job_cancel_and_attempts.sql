@@ -0,0 +1,28 @@
+-- +goose Up
+-- Lets a job be cancelled while it runs and retried after it fails or is cancelled.
+-- cancel_requested_at is picked up by the worker's heartbeat; config_snapshot is the config the
+-- job last ran with, so a retry can use it again rather than the config as it is now.
+ALTER TABLE "ingestion_jobs"
+	ADD COLUMN "cancel_requested_at" TIMESTAMPTZ,
+	ADD COLUMN "config_snapshot" JSONB;
+
+-- One row per time a worker ran a job, kept across retries
+CREATE TABLE "ingestion_job_attempts" (
+	"id" BIGSERIAL PRIMARY KEY,
+	"job_id" UUID NOT NULL REFERENCES "ingestion_jobs"("id") ON DELETE CASCADE,
+	"attempt" INTEGER NOT NULL,
+	"worker_id" TEXT,
+	"started_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	"finished_at" TIMESTAMPTZ,
+	"status" VARCHAR(50) NOT NULL DEFAULT 'PROCESSING',
+	"error_details" TEXT,
+	"rows_upserted" INTEGER,
+	"rows_triaged" INTEGER,
+	UNIQUE ("job_id", "attempt")
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS "ingestion_job_attempts";
+ALTER TABLE "ingestion_jobs"
+	DROP COLUMN IF EXISTS "config_snapshot",
+	DROP COLUMN IF EXISTS "cancel_requested_at";
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Change report of an ingestion job. The counters say how many items the job inserted, updated,
+-- left unchanged or deactivated; each changed item gets an items_events entry tied to the job.
+-- A job started without a user writes its events without one.
+ALTER TABLE "ingestion_jobs"
+	ADD COLUMN "items_inserted" INTEGER,
+	ADD COLUMN "items_updated" INTEGER,
+	ADD COLUMN "items_unchanged" INTEGER,
+	ADD COLUMN "items_deactivated" INTEGER;
+
+ALTER TABLE "items_events"
+	ADD COLUMN "ingestion_job_id" UUID REFERENCES "ingestion_jobs"("id") ON DELETE SET NULL,
+	ALTER COLUMN "created_by" DROP NOT NULL;
+
+-- Index for listing the events an ingestion job wrote
+CREATE INDEX idx_item_events_ingestion_job_id ON "items_events" (ingestion_job_id) WHERE ingestion_job_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_item_events_ingestion_job_id;
+DELETE FROM "items_events" WHERE created_by IS NULL;
+ALTER TABLE "items_events"
+	DROP COLUMN IF EXISTS "ingestion_job_id",
+	ALTER COLUMN "created_by" SET NOT NULL;
+ALTER TABLE "ingestion_jobs"
+	DROP COLUMN IF EXISTS "items_deactivated",
+	DROP COLUMN IF EXISTS "items_unchanged",
+	DROP COLUMN IF EXISTS "items_updated",
+	DROP COLUMN IF EXISTS "items_inserted";
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Lineage of items: a row each time an ingestion job writes an item, kept across re-ingestions,
+-- so an item's values can be traced to the job, file and row they came from and to the version
+-- of the config that mapped them. The job reference is cleared if the job is deleted.
+CREATE TABLE "item_lineage" (
+	"id" BIGSERIAL PRIMARY KEY,
+	"item_id" BIGINT NOT NULL REFERENCES "items"("id") ON DELETE CASCADE,
+	"job_id" UUID REFERENCES "ingestion_jobs"("id") ON DELETE SET NULL,
+	"source_uri" TEXT,
+	"row_number" INTEGER,
+	"source_location" TEXT,
+	"config_version" TEXT,
+	"recorded_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for listing an item's lineage, newest first
+CREATE INDEX idx_item_lineage_item_id ON "item_lineage" (item_id, recorded_at DESC);
+-- Index for finding the items a job wrote
+CREATE INDEX idx_item_lineage_job_id ON "item_lineage" (job_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS "item_lineage";
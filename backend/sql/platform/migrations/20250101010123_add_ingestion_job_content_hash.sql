@@ -0,0 +1,11 @@
+-- +goose Up
+-- SHA-256 of the file a job loads, so an upload of the same content for the same report type
+-- can be recognised and answered with the job that already has it.
+ALTER TABLE "ingestion_jobs" ADD COLUMN "content_hash" TEXT;
+
+-- Index for finding recent jobs of a report type by content
+CREATE INDEX idx_ingestion_jobs_content_hash ON "ingestion_jobs" (report_type, content_hash, started_at DESC) WHERE content_hash IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_ingestion_jobs_content_hash;
+ALTER TABLE "ingestion_jobs" DROP COLUMN IF EXISTS "content_hash";
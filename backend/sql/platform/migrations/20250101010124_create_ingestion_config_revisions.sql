@@ -0,0 +1,23 @@
+-- +goose Up
+-- Every revision of an ingestion config that has been loaded, so the mapping behind data already in
+-- items stays known after a config file changes. revision counts up per report type; content is
+-- the parsed config keyed by its YAML names.
+CREATE TABLE "ingestion_config_revisions" (
+	"id" BIGSERIAL PRIMARY KEY,
+	"report_type" TEXT NOT NULL,
+	"revision" INTEGER NOT NULL,
+	"version" TEXT,
+	"content_hash" TEXT NOT NULL,
+	"content" JSONB NOT NULL,
+	"source_file" TEXT,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE ("report_type", "revision"),
+	UNIQUE ("report_type", "content_hash")
+);
+
+-- The config revision a job ran with
+ALTER TABLE "ingestion_jobs" ADD COLUMN "config_revision_id" BIGINT REFERENCES "ingestion_config_revisions"("id");
+
+-- +goose Down
+ALTER TABLE "ingestion_jobs" DROP COLUMN IF EXISTS "config_revision_id";
+DROP TABLE IF EXISTS "ingestion_config_revisions";
@@ -0,0 +1,105 @@
+-- +goose Up
+-- Item types move from the item_type enum into a registry table, so an app can bring its own
+-- item types with its configs instead of needing a platform migration. Apps register theirs at
+-- startup from item_types.yaml; the types the enum had are registered here so existing items keep
+-- a valid item_type.
+
+CREATE TABLE item_type_registry (
+	"name" TEXT PRIMARY KEY CHECK ("name" ~ '^[A-Z][A-Z0-9_]*$'),
+	"display_name" TEXT NOT NULL,
+	"app" TEXT, -- the app that registered it; NULL for item types shared by every app
+	"embedding_dimensions" INTEGER CHECK ("embedding_dimensions" > 0), -- NULL if its items aren't embedded
+	"retention_days" INTEGER CHECK ("retention_days" > 0), -- NULL to keep its items indefinitely
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	"updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO item_type_registry (name, display_name, app, embedding_dimensions) VALUES
+	('KNOWLEDGE_CHUNK', 'Knowledge chunk', NULL, 384),
+	('PARK_VISITATION', 'Park visitation', 'demo', NULL),
+	('MISSION_FACTS', 'Mission facts', 'demo', NULL),
+	('POLICYHOLDER', 'Policyholder', 'insurance', NULL),
+	('INSURANCE_CLAIM', 'Insurance claim', 'insurance', 384);
+
+-- A column can't change type while views select it, so the app views over items are set aside
+-- and recreated once items.item_type is text. Their item_type comparisons are cast to the enum,
+-- which goes away; they compare text instead.
+-- +goose StatementBegin
+DO $$
+DECLARE
+	dependent RECORD;
+BEGIN
+	CREATE TEMP TABLE item_type_dependent_views ON COMMIT DROP AS
+	SELECT DISTINCT c.oid, c.oid::regclass::text AS name, pg_get_viewdef(c.oid) AS definition
+	FROM pg_class c
+	JOIN pg_rewrite r ON r.ev_class = c.oid
+	JOIN pg_depend d ON d.objid = r.oid
+	WHERE c.relkind = 'v' AND d.refobjid = 'items'::regclass;
+
+	FOR dependent IN SELECT name FROM item_type_dependent_views ORDER BY oid DESC LOOP
+		EXECUTE format('DROP VIEW %s', dependent.name);
+	END LOOP;
+END $$;
+-- +goose StatementEnd
+
+ALTER TABLE items ALTER COLUMN item_type TYPE TEXT USING item_type::TEXT;
+ALTER TABLE items ADD CONSTRAINT items_item_type_fkey
+	FOREIGN KEY (item_type) REFERENCES item_type_registry (name) ON UPDATE CASCADE;
+DROP TYPE item_type;
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+	dependent RECORD;
+BEGIN
+	FOR dependent IN SELECT name, definition FROM item_type_dependent_views ORDER BY oid LOOP
+		EXECUTE format('CREATE VIEW %s AS %s', dependent.name,
+			rtrim(replace(dependent.definition, '::item_type', '::text'), ';'));
+	END LOOP;
+END $$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- Rolling back fails if items use item types the enum didn't have.
+CREATE TYPE item_type AS ENUM (
+	'KNOWLEDGE_CHUNK',
+	'PARK_VISITATION',
+	'MISSION_FACTS',
+	'POLICYHOLDER',
+	'INSURANCE_CLAIM'
+);
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+	dependent RECORD;
+BEGIN
+	CREATE TEMP TABLE item_type_dependent_views ON COMMIT DROP AS
+	SELECT DISTINCT c.oid, c.oid::regclass::text AS name, pg_get_viewdef(c.oid) AS definition
+	FROM pg_class c
+	JOIN pg_rewrite r ON r.ev_class = c.oid
+	JOIN pg_depend d ON d.objid = r.oid
+	WHERE c.relkind = 'v' AND d.refobjid = 'items'::regclass;
+
+	FOR dependent IN SELECT name FROM item_type_dependent_views ORDER BY oid DESC LOOP
+		EXECUTE format('DROP VIEW %s', dependent.name);
+	END LOOP;
+END $$;
+-- +goose StatementEnd
+
+ALTER TABLE items DROP CONSTRAINT items_item_type_fkey;
+ALTER TABLE items ALTER COLUMN item_type TYPE item_type USING item_type::item_type;
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+	dependent RECORD;
+BEGIN
+	FOR dependent IN SELECT name, definition FROM item_type_dependent_views ORDER BY oid LOOP
+		EXECUTE format('CREATE VIEW %s AS %s', dependent.name,
+			rtrim(regexp_replace(dependent.definition, '(item_type = ''[^'']*'')::text', '\1::item_type', 'g'), ';'));
+	END LOOP;
+END $$;
+-- +goose StatementEnd
+
+DROP TABLE IF EXISTS item_type_registry;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Audit rows of item changes record the ingestion job that made them. Jobs set app.ingestion_job_id
+-- for their transaction and the column defaults to it, so the audit trigger doesn't need to know.
+-- Rollback finds a job's changes by this column instead of by matching timestamps.
+ALTER TABLE audit.items_changes ADD COLUMN ingestion_job_id UUID;
+ALTER TABLE audit.items_changes
+	ALTER COLUMN ingestion_job_id SET DEFAULT NULLIF(current_setting('app.ingestion_job_id', true), '')::uuid;
+
+-- Changes from before now are attributed the way rollback used to find them: by the timestamp
+-- their audit rows share with the job's item events.
+UPDATE audit.items_changes a
+SET ingestion_job_id = e.ingestion_job_id
+FROM (
+	SELECT DISTINCT item_id, created_at, ingestion_job_id
+	FROM items_events
+	WHERE
+		ingestion_job_id IS NOT NULL
+		AND event_type IN ('INGESTION_CREATED', 'INGESTION_UPDATED', 'INGESTION_DEACTIVATED')
+) e
+WHERE e.item_id = a.target_id AND e.created_at = a.changed_at;
+
+-- Index for finding the changes a job made
+CREATE INDEX idx_audit_items_ingestion_job_id ON audit.items_changes (ingestion_job_id) WHERE ingestion_job_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS audit.idx_audit_items_ingestion_job_id;
+ALTER TABLE audit.items_changes DROP COLUMN IF EXISTS ingestion_job_id;
@@ -0,0 +1,61 @@
+-- name: CreateIngestionConfigRevision :one
+-- Stores a new revision of a report type's config, numbered after the latest one. Callers hold
+-- LockIngestionConfigRevisions so two writers can't take the same number.
+INSERT INTO ingestion_config_revisions (
+	report_type,
+	revision,
+	version,
+	content_hash,
+	content,
+	source_file
+)
+SELECT
+	@report_type::text,
+	COALESCE(MAX(revision), 0) + 1,
+	sqlc.narg(version),
+	@content_hash::text,
+	@content::jsonb,
+	sqlc.narg(source_file)
+FROM ingestion_config_revisions
+WHERE report_type = @report_type::text
+RETURNING *;
+
+-- name: GetIngestionConfigRevision :one
+SELECT * FROM ingestion_config_revisions
+WHERE
+	report_type = sqlc.arg(report_type)
+	AND revision = sqlc.arg(revision);
+
+-- name: GetIngestionConfigRevisionByHash :one
+-- Finds the stored revision of a report type's config with the given content
+SELECT * FROM ingestion_config_revisions
+WHERE
+	report_type = sqlc.arg(report_type)
+	AND content_hash = sqlc.arg(content_hash);
+
+-- name: GetLatestIngestionConfigRevision :one
+SELECT * FROM ingestion_config_revisions
+WHERE
+	report_type = sqlc.arg(report_type)
+ORDER BY revision DESC
+LIMIT 1;
+
+-- name: ListIngestionConfigRevisions :many
+-- Lists a report type's config revisions, newest first, with how many jobs ran with each
+SELECT
+	r.id,
+	r.report_type,
+	r.revision,
+	r.version,
+	r.content_hash,
+	r.source_file,
+	r.created_at,
+	(SELECT COUNT(*) FROM ingestion_jobs j WHERE j.config_revision_id = r.id)::bigint AS job_count
+FROM ingestion_config_revisions r
+WHERE
+	r.report_type = sqlc.arg(report_type)
+ORDER BY r.revision DESC;
+
+-- name: LockIngestionConfigRevisions :exec
+-- Serializes storing revisions of one report type's config until the transaction ends.
+SELECT pg_advisory_xact_lock(hashtextextended('ingestion_config_revisions:' || @report_type::text, 0));
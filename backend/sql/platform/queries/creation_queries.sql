@@ -35,9 +35,11 @@ INSERT INTO ingestion_jobs (
 	report_type,
 	status, 
 	user_id,
-	source_uri
+	source_uri,
+	max_attempts,
+	content_hash
 ) VALUES (
-	$1, $2, $3, $4, $5, $6, $7
+	$1, $2, $3, $4, $5, $6, $7, $8, $9
 )
 RETURNING *;
 
@@ -46,6 +48,11 @@ RETURNING *;
 -- This table is dropped on commit
 CREATE TEMP TABLE temp_items_staging (LIKE items INCLUDING DEFAULTS) ON COMMIT DROP;
 
+-- name: CreateTempSnapshotKeysTable :exec
+-- Creates a temporary table of the business keys and scopes a snapshot job has loaded, so items
+-- missing from the file can be found before the transaction commits
+CREATE TEMP TABLE temp_snapshot_keys (business_key TEXT PRIMARY KEY, scope TEXT) ON COMMIT DROP;
+
 -- name: CreateItemEvent :one
 -- Inserts a new event record for a specific time
 INSERT INTO items_events (
@@ -0,0 +1,53 @@
+-- name: FlagItemsForEmbeddingBackfill :exec
+-- Records items that were loaded without an embedding so the vector can be generated later
+INSERT INTO pending_item_embeddings (item_id, job_id, source_text, last_error)
+SELECT i.id, sqlc.arg(job_id), p.source_text, p.last_error
+FROM unnest(
+	sqlc.arg(business_keys)::text[],
+	sqlc.arg(source_texts)::text[],
+	sqlc.arg(last_errors)::text[]
+) AS p(business_key, source_text, last_error)
+JOIN items i ON i.item_type = sqlc.arg(item_type) AND i.business_key = p.business_key
+ON CONFLICT (item_id) DO UPDATE SET
+	job_id = EXCLUDED.job_id,
+	source_text = EXCLUDED.source_text,
+	last_error = EXCLUDED.last_error,
+	attempts = pending_item_embeddings.attempts + 1,
+	updated_at = NOW();
+
+-- name: ClearPendingEmbeddings :exec
+-- Removes the backfill records of items that have since been loaded with an embedding
+DELETE FROM pending_item_embeddings p
+USING items i
+WHERE p.item_id = i.id
+AND i.item_type = sqlc.arg(item_type)
+AND i.business_key = ANY(sqlc.arg(business_keys)::text[]);
+
+-- name: ListPendingEmbeddings :many
+-- Fetches the items waiting for an embedding backfill, least recently tried first
+SELECT * FROM pending_item_embeddings
+WHERE attempts < sqlc.arg(max_attempts)
+ORDER BY updated_at
+LIMIT sqlc.arg('limit');
+
+-- name: SetItemEmbedding :exec
+-- Stores a backfilled embedding on an item
+UPDATE items
+SET
+	embedding = $2
+WHERE
+	id = $1;
+
+-- name: DeletePendingEmbedding :exec
+-- Removes an item's backfill record once its embedding is stored
+DELETE FROM pending_item_embeddings WHERE item_id = $1;
+
+-- name: RecordPendingEmbeddingFailure :exec
+-- Notes another failed backfill attempt for an item
+UPDATE pending_item_embeddings
+SET
+	last_error = $2,
+	attempts = attempts + 1,
+	updated_at = NOW()
+WHERE
+	item_id = $1;
@@ -4,9 +4,11 @@ INSERT INTO ingestion_errors (
     id,
     job_id,
     original_row_data,
-    reason_for_failure
+    reason_for_failure,
+    row_number,
+    source_location
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6
 )
 RETURNING *;
 
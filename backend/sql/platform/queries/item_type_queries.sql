@@ -0,0 +1,28 @@
+-- name: GetItemType :one
+SELECT * FROM item_type_registry
+WHERE name = $1;
+
+-- name: ListItemTypes :many
+SELECT * FROM item_type_registry
+ORDER BY name;
+
+-- name: UpsertItemType :exec
+-- Registers an item type, or updates the metadata of one that is already registered. Rows that
+-- wouldn't change are left alone so updated_at shows when the metadata last changed.
+INSERT INTO item_type_registry (
+	name,
+	display_name,
+	app,
+	embedding_dimensions,
+	retention_days
+) VALUES (
+	$1, $2, $3, $4, $5
+)
+ON CONFLICT (name) DO UPDATE SET
+	display_name = EXCLUDED.display_name,
+	app = EXCLUDED.app,
+	embedding_dimensions = EXCLUDED.embedding_dimensions,
+	retention_days = EXCLUDED.retention_days,
+	updated_at = NOW()
+WHERE (item_type_registry.display_name, item_type_registry.app, item_type_registry.embedding_dimensions, item_type_registry.retention_days)
+	IS DISTINCT FROM (EXCLUDED.display_name, EXCLUDED.app, EXCLUDED.embedding_dimensions, EXCLUDED.retention_days);
@@ -0,0 +1,228 @@
+-- name: ListIngestionJobs :many
+-- Pages through ingestion jobs, newest first, with optional filters
+SELECT * FROM ingestion_jobs
+WHERE
+	(sqlc.narg('report_type')::text IS NULL OR report_type = sqlc.narg('report_type'))
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+AND (sqlc.narg('user_id')::bigint IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.narg('started_after')::timestamptz IS NULL OR started_at >= sqlc.narg('started_after'))
+AND (sqlc.narg('started_before')::timestamptz IS NULL OR started_at < sqlc.narg('started_before'))
+ORDER BY started_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountIngestionJobs :one
+-- Counts the ingestion jobs matching the ListIngestionJobs filters
+SELECT COUNT(*) FROM ingestion_jobs
+WHERE
+	(sqlc.narg('report_type')::text IS NULL OR report_type = sqlc.narg('report_type'))
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+AND (sqlc.narg('user_id')::bigint IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.narg('started_after')::timestamptz IS NULL OR started_at >= sqlc.narg('started_after'))
+AND (sqlc.narg('started_before')::timestamptz IS NULL OR started_at < sqlc.narg('started_before'));
+
+-- name: GetIngestionJob :one
+-- Fetch a single ingestion job
+SELECT * FROM ingestion_jobs
+WHERE id = $1 LIMIT 1;
+
+-- name: FindIngestionJobByContentHash :one
+-- Returns the latest job of the report type started since the given time for a file with this
+-- content. Failed, cancelled and rolled back jobs don't count, so such a file can be loaded again.
+SELECT * FROM ingestion_jobs
+WHERE report_type = @report_type
+AND content_hash = @content_hash
+AND started_at >= @since
+AND status NOT IN ('FAILED', 'CANCELLED', 'ROLLED_BACK')
+ORDER BY started_at DESC
+LIMIT 1;
+
+-- name: LockIngestionContentHash :exec
+-- Serializes job creation for one report type and file content until the transaction ends.
+SELECT pg_advisory_xact_lock(hashtextextended(@report_type::text || ':' || @content_hash::text, 0));
+
+-- name: ListIngestionErrors :many
+-- Pages through a job's triage rows in source order. search matches the failure reason or any cell.
+SELECT * FROM ingestion_errors
+WHERE
+	job_id = sqlc.arg(job_id)
+AND (
+	sqlc.narg('search')::text IS NULL
+	OR reason_for_failure ILIKE '%' || sqlc.narg('search') || '%'
+	OR original_row_data::text ILIKE '%' || sqlc.narg('search') || '%'
+)
+AND (sqlc.narg('resolution_status')::text IS NULL OR resolution_status = sqlc.narg('resolution_status'))
+ORDER BY row_number NULLS LAST, timestamp, id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: ListIngestionErrorColumns :many
+-- Lists the original columns of a job's triage rows matching the ListIngestionErrors search
+SELECT DISTINCT jsonb_object_keys(original_row_data)::text AS column_name
+FROM ingestion_errors
+WHERE
+	job_id = sqlc.arg(job_id)
+AND jsonb_typeof(original_row_data) = 'object'
+AND (
+	sqlc.narg('search')::text IS NULL
+	OR reason_for_failure ILIKE '%' || sqlc.narg('search') || '%'
+	OR original_row_data::text ILIKE '%' || sqlc.narg('search') || '%'
+)
+AND (sqlc.narg('resolution_status')::text IS NULL OR resolution_status = sqlc.narg('resolution_status'))
+ORDER BY column_name;
+
+-- name: CountIngestionErrors :one
+-- Counts a job's triage rows matching the ListIngestionErrors search
+SELECT COUNT(*) FROM ingestion_errors
+WHERE
+	job_id = sqlc.arg(job_id)
+AND (
+	sqlc.narg('search')::text IS NULL
+	OR reason_for_failure ILIKE '%' || sqlc.narg('search') || '%'
+	OR original_row_data::text ILIKE '%' || sqlc.narg('search') || '%'
+)
+AND (sqlc.narg('resolution_status')::text IS NULL OR resolution_status = sqlc.narg('resolution_status'));
+
+-- name: GetIngestionErrorsForUpdate :many
+-- Locks the given triage rows of a job while they are corrected and resubmitted
+SELECT * FROM ingestion_errors
+WHERE
+	job_id = sqlc.arg(job_id)
+AND id = ANY(sqlc.arg(ids)::uuid[])
+ORDER BY row_number NULLS LAST, timestamp, id
+FOR UPDATE;
+
+-- name: UpdateIngestionErrorResolution :exec
+-- Saves the corrected data of a resubmitted triage row and whether the resubmission resolved it
+UPDATE ingestion_errors
+SET
+	original_row_data = sqlc.arg(original_row_data),
+	reason_for_failure = sqlc.arg(reason_for_failure),
+	resolution_status = sqlc.arg(resolution_status),
+	resolved_by = sqlc.narg(resolved_by),
+	resolved_at = CASE WHEN sqlc.arg(resolution_status)::text = 'open' THEN NULL ELSE NOW() END
+WHERE
+	id = sqlc.arg(id);
+
+-- name: SetIngestionErrorsResolution :execrows
+-- Moves triage rows of a job from one resolution status to another, e.g. to dismiss or reopen them
+UPDATE ingestion_errors
+SET
+	resolution_status = sqlc.arg(to_status),
+	resolved_by = sqlc.narg(resolved_by),
+	resolved_at = CASE WHEN sqlc.arg(to_status)::text = 'open' THEN NULL ELSE NOW() END
+WHERE
+	job_id = sqlc.arg(job_id)
+AND id = ANY(sqlc.arg(ids)::uuid[])
+AND resolution_status = sqlc.arg(from_status);
+
+-- name: RefreshIngestionJobCounters :exec
+-- Brings a job's counters in line with its triage rows after some were resolved or dismissed.
+-- A finished job is COMPLETE once no triage rows are open and COMPLETE_WITH_ISSUES otherwise.
+UPDATE ingestion_jobs j
+SET
+	rows_upserted = COALESCE(j.rows_upserted, 0) + sqlc.arg(upserted_delta)::int,
+	items_inserted = COALESCE(j.items_inserted, 0) + sqlc.arg(inserted_delta)::int,
+	items_updated = COALESCE(j.items_updated, 0) + sqlc.arg(updated_delta)::int,
+	items_unchanged = COALESCE(j.items_unchanged, 0) + sqlc.arg(unchanged_delta)::int,
+	rows_triaged = open_errors.count,
+	status = CASE
+		WHEN j.status NOT IN ('COMPLETE', 'COMPLETE_WITH_ISSUES') THEN j.status
+		WHEN open_errors.count = 0 THEN 'COMPLETE'
+		ELSE 'COMPLETE_WITH_ISSUES'
+	END
+FROM (
+	SELECT COUNT(*)::int AS count FROM ingestion_errors
+	WHERE job_id = sqlc.arg(id) AND resolution_status = 'open'
+) AS open_errors
+WHERE
+	j.id = sqlc.arg(id);
+
+-- name: RequestIngestionJobCancel :one
+-- Cancels a queued job straight away, or flags a running one for its worker to stop.
+UPDATE ingestion_jobs
+SET
+	status = CASE WHEN status = 'UPLOADED' THEN 'CANCELLED' ELSE status END,
+	error_details = CASE WHEN status = 'UPLOADED' THEN 'Cancelled by user before it ran' ELSE error_details END,
+	completed_at = CASE WHEN status = 'UPLOADED' THEN NOW() ELSE completed_at END,
+	cancel_requested_at = NOW()
+WHERE
+	id = sqlc.arg(id)
+	AND status IN ('UPLOADED', 'PROCESSING')
+RETURNING *;
+
+-- name: RetryIngestionJob :one
+-- Puts a failed or cancelled job back in the queue with a fresh set of attempts. Clearing the
+-- config snapshot makes the next run use the report type's current config.
+UPDATE ingestion_jobs
+SET
+	status = 'UPLOADED',
+	attempts = 0,
+	max_attempts = sqlc.arg(max_attempts),
+	run_after = NOW(),
+	cancel_requested_at = NULL,
+	completed_at = NULL,
+	error_details = NULL,
+	rows_upserted = NULL,
+	rows_triaged = NULL,
+	config_snapshot = CASE WHEN sqlc.arg(use_current_config)::bool THEN NULL ELSE config_snapshot END,
+	config_revision_id = CASE WHEN sqlc.arg(use_current_config)::bool THEN NULL ELSE config_revision_id END
+WHERE
+	id = sqlc.arg(id)
+	AND status IN ('FAILED', 'CANCELLED')
+RETURNING *;
+
+-- name: SetIngestionJobConfigSnapshot :exec
+-- Records the config a job runs with, and its stored revision, so a retry can run it the same way
+UPDATE ingestion_jobs
+SET
+	config_snapshot = sqlc.arg(config_snapshot),
+	config_revision_id = sqlc.arg(config_revision_id)
+WHERE
+	id = sqlc.arg(id);
+
+-- name: ListIngestionJobAttempts :many
+-- Lists every run of a job, oldest first
+SELECT * FROM ingestion_job_attempts
+WHERE
+	job_id = sqlc.arg(job_id)
+ORDER BY attempt;
+
+-- name: DeleteIngestionErrorsForJob :exec
+-- Clears the triage rows of a job before it runs again, so only the latest run's rows remain
+DELETE FROM ingestion_errors
+WHERE
+	job_id = sqlc.arg(job_id);
+
+-- name: SetIngestionJobChangeCounts :exec
+-- Records how many items a job inserted, updated, left unchanged or deactivated
+UPDATE ingestion_jobs
+SET
+	items_inserted = sqlc.arg(items_inserted),
+	items_updated = sqlc.arg(items_updated),
+	items_unchanged = sqlc.arg(items_unchanged),
+	items_deactivated = sqlc.arg(items_deactivated)
+WHERE
+	id = sqlc.arg(id);
+
+-- name: ListIngestionJobChanges :many
+-- Pages through the item events a job wrote, in the order it wrote them
+SELECT
+	e.id,
+	e.item_id,
+	i.business_key,
+	e.event_type,
+	e.event_data,
+	e.created_at
+FROM items_events e
+JOIN items i ON i.id = e.item_id
+WHERE
+	e.ingestion_job_id = sqlc.arg(job_id)
+AND (sqlc.narg('event_type')::text IS NULL OR e.event_type = sqlc.narg('event_type'))
+ORDER BY e.id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountIngestionJobChanges :one
+-- Counts the item events matching the ListIngestionJobChanges filter
+SELECT COUNT(*) FROM items_events
+WHERE
+	ingestion_job_id = sqlc.arg(job_id)
+AND (sqlc.narg('event_type')::text IS NULL OR event_type = sqlc.narg('event_type'));
@@ -2,22 +2,154 @@
 UPDATE items SET status = 'inactive'
 WHERE item_type= $1 AND custom_properties->>'reporting_source' = $2;
 
--- name: UpsertItems :execrows
---Insert new records from staging, or update existing ones based on business key
+-- name: UpsertItems :many
+--Insert new records from staging, or update existing ones based on business key.
+--Returns each written item with its scope, status and properties from before the write.
+WITH previous AS (
+	SELECT i.id, i.scope, i.status, i.custom_properties
+	FROM items i
+	JOIN temp_items_staging s ON s.item_type = i.item_type AND s.business_key = i.business_key
+), upserted AS (
+	INSERT INTO items (
+		item_type, scope, business_key, status, custom_properties, embedding
+	)
+	SELECT
+		item_type,
+		scope, 
+		business_key,
+		'active',
+		custom_properties,
+		embedding
+	FROM temp_items_staging
+	ON CONFLICT (item_type, business_key) DO UPDATE SET 
+		status = EXCLUDED.status,
+		scope = EXCLUDED.scope,
+		custom_properties = items.custom_properties || EXCLUDED.custom_properties,
+		embedding = COALESCE(EXCLUDED.embedding, items.embedding),
+		updated_at = NOW()
+	RETURNING id, business_key, scope, status, custom_properties
+)
+SELECT
+	u.id,
+	u.business_key,
+	u.scope,
+	u.status,
+	u.custom_properties,
+	(p.id IS NULL)::bool AS inserted,
+	p.scope AS previous_scope,
+	p.status AS previous_status,
+	p.custom_properties AS previous_properties
+FROM upserted u
+LEFT JOIN previous p ON p.id = u.id;
+
+-- name: TruncateTempItemsStaging :exec
+-- Empties the staging table between batches of a streamed ingestion job
+TRUNCATE temp_items_staging;
+
+-- name: InsertNewItems :many
+-- Inserts records from staging whose business key is not in items yet, leaving existing items as they are
 INSERT INTO items (
 	item_type, scope, business_key, status, custom_properties, embedding
 )
 SELECT
 	item_type,
-	scope, 
+	scope,
 	business_key,
 	'active',
 	custom_properties,
 	embedding
 FROM temp_items_staging
-ON CONFLICT (item_type, business_key) DO UPDATE SET 
-	status = EXCLUDED.status,
-	scope = EXCLUDED.scope,
-	custom_properties = items.custom_properties || EXCLUDED.custom_properties,
-	embedding = EXCLUDED.embedding,
-	updated_at = NOW();
+ON CONFLICT (item_type, business_key) DO NOTHING
+RETURNING id, business_key;
+
+-- name: RecordSnapshotKeys :exec
+-- Remembers the business keys and scopes of the staged batch for a snapshot job
+INSERT INTO temp_snapshot_keys (business_key, scope)
+SELECT DISTINCT business_key, scope FROM temp_items_staging
+ON CONFLICT (business_key) DO NOTHING;
+
+-- name: CountSnapshotDeactivations :one
+-- Counts the active items a snapshot covers and how many of them are missing from its file.
+-- With scope_to_file only items in the scopes the file contained are covered.
+SELECT
+	COUNT(*) AS active_items,
+	COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM temp_snapshot_keys k WHERE k.business_key = i.business_key)) AS missing_items
+FROM items i
+WHERE
+	i.item_type = sqlc.arg(item_type)
+	AND i.status = 'active'
+	AND (NOT sqlc.arg(scope_to_file)::bool OR i.scope IN (SELECT scope FROM temp_snapshot_keys));
+
+-- name: DeactivateItemsMissingFromSnapshot :execrows
+-- Sets the status of the active items a snapshot covers that were missing from its file, and
+-- records an INGESTION_DEACTIVATED event for each of them
+WITH deactivated AS (
+	UPDATE items i
+	SET
+		status = sqlc.arg(status),
+		updated_at = NOW()
+	WHERE
+		i.item_type = sqlc.arg(item_type)
+		AND i.status = 'active'
+		AND (NOT sqlc.arg(scope_to_file)::bool OR i.scope IN (SELECT scope FROM temp_snapshot_keys))
+		AND NOT EXISTS (SELECT 1 FROM temp_snapshot_keys k WHERE k.business_key = i.business_key)
+	RETURNING i.id
+)
+INSERT INTO items_events (item_id, event_type, event_data, created_by, ingestion_job_id)
+SELECT
+	id,
+	'INGESTION_DEACTIVATED',
+	jsonb_build_object('old_status', 'active', 'new_status', sqlc.arg(status)::text),
+	sqlc.narg(created_by),
+	sqlc.arg(job_id)
+FROM deactivated;
+
+-- name: GetIngestionRunStart :one
+-- Returns the latest audit, item event and lineage ids before an ingestion run writes anything, so
+-- the rows the run goes on to write can be told from those of the job's earlier runs
+SELECT
+	(SELECT COALESCE(MAX(audit_id), 0) FROM audit.items_changes)::bigint AS audit_id,
+	(SELECT COALESCE(MAX(id), 0) FROM items_events)::bigint AS event_id,
+	(SELECT COALESCE(MAX(id), 0) FROM item_lineage)::bigint AS lineage_id;
+
+-- name: ListIngestionRunItemChanges :many
+-- Finds the items with the given business keys that the current run of a job changed, with the
+-- state each had before the run and the properties the run left it with. updated says whether the
+-- run recorded an INGESTION_UPDATED event for the item.
+SELECT DISTINCT ON (i.id)
+	i.id,
+	i.business_key,
+	(a.operation = 'I')::bool AS inserted,
+	a.old_data,
+	i.custom_properties,
+	EXISTS (
+		SELECT 1 FROM items_events e
+		WHERE
+			e.item_id = i.id
+			AND e.ingestion_job_id = sqlc.arg(job_id)
+			AND e.id > sqlc.arg(after_event_id)::bigint
+			AND e.event_type = 'INGESTION_UPDATED'
+	) AS updated
+FROM items i
+JOIN audit.items_changes a ON a.target_id = i.id
+WHERE
+	i.item_type = sqlc.arg(item_type)
+	AND i.business_key = ANY(sqlc.arg(business_keys)::text[])
+	AND a.ingestion_job_id = sqlc.arg(job_id)
+	AND a.audit_id > sqlc.arg(after_audit_id)::bigint
+ORDER BY i.id, a.audit_id;
+
+-- name: DeleteIngestionRunItemRecords :exec
+-- Removes the item events and lineage the current run of a job wrote for the given items
+WITH deleted_events AS (
+	DELETE FROM items_events
+	WHERE
+		item_id = ANY(sqlc.arg(item_ids)::bigint[])
+		AND ingestion_job_id = sqlc.arg(job_id)
+		AND id > sqlc.arg(after_event_id)::bigint
+)
+DELETE FROM item_lineage
+WHERE
+	item_id = ANY(sqlc.arg(item_ids)::bigint[])
+	AND job_id = sqlc.arg(job_id)
+	AND id > sqlc.arg(after_lineage_id)::bigint;
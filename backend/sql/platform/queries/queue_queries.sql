@@ -0,0 +1,147 @@
+-- name: ClaimIngestionJob :one
+-- Claims the oldest runnable job for a worker. SKIP LOCKED lets several workers poll at once
+-- without ever handing out the same job twice.
+UPDATE ingestion_jobs
+SET
+	status = 'PROCESSING',
+	attempts = attempts + 1,
+	locked_by = sqlc.arg(worker_id),
+	locked_at = NOW(),
+	heartbeat_at = NOW(),
+	completed_at = NULL
+WHERE id = (
+	SELECT j.id FROM ingestion_jobs j
+	WHERE j.status = 'UPLOADED'
+	AND j.run_after <= NOW()
+	ORDER BY j.run_after
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: HeartbeatIngestionJob :one
+-- Records that a worker is still processing a job and reports whether a user asked to cancel it.
+-- No rows means the worker no longer owns the job.
+UPDATE ingestion_jobs
+SET
+	heartbeat_at = NOW()
+WHERE
+	id = sqlc.arg(id)
+	AND locked_by = sqlc.arg(worker_id)
+	AND status = 'PROCESSING'
+RETURNING (cancel_requested_at IS NOT NULL)::bool AS cancel_requested;
+
+-- name: RequeueIngestionJob :exec
+-- Puts a job a worker could not finish back in the queue to be retried after a delay.
+-- refunded_attempts gives back the attempt of a job that was interrupted rather than failed.
+UPDATE ingestion_jobs
+SET
+	status = 'UPLOADED',
+	error_details = sqlc.arg(error_details),
+	run_after = NOW() + make_interval(secs => sqlc.arg(delay_seconds)::float8),
+	attempts = GREATEST(attempts - sqlc.arg(refunded_attempts)::int, 0),
+	completed_at = NULL,
+	locked_by = NULL,
+	locked_at = NULL,
+	heartbeat_at = NULL
+WHERE
+	id = sqlc.arg(id)
+	AND locked_by = sqlc.arg(worker_id);
+
+-- name: ReclaimStaleIngestionJobs :many
+-- Releases jobs whose worker stopped heartbeating. Jobs a user asked to cancel are cancelled, jobs
+-- with attempts left go back in the queue and the rest are failed. Their open attempts are closed.
+WITH reclaimed AS (
+	UPDATE ingestion_jobs
+	SET
+		status = CASE
+			WHEN cancel_requested_at IS NOT NULL THEN 'CANCELLED'
+			WHEN attempts < max_attempts THEN 'UPLOADED'
+			ELSE 'FAILED'
+		END,
+		error_details = CASE
+			WHEN cancel_requested_at IS NOT NULL THEN 'Cancelled by user'
+			WHEN attempts < max_attempts THEN 'Worker ' || COALESCE(locked_by, 'unknown') || ' stopped responding; job requeued'
+			ELSE 'Worker ' || COALESCE(locked_by, 'unknown') || ' stopped responding after ' || attempts || ' attempts'
+		END,
+		completed_at = CASE WHEN cancel_requested_at IS NULL AND attempts < max_attempts THEN NULL ELSE NOW() END,
+		run_after = NOW(),
+		locked_by = NULL,
+		locked_at = NULL,
+		heartbeat_at = NULL
+	WHERE
+		status = 'PROCESSING'
+		AND COALESCE(heartbeat_at, started_at) < NOW() - make_interval(secs => sqlc.arg(stale_after_seconds)::float8)
+	RETURNING id, status, attempts
+), abandoned AS (
+	UPDATE ingestion_job_attempts a
+	SET
+		finished_at = NOW(),
+		status = 'ABANDONED',
+		error_details = 'Worker stopped responding'
+	FROM reclaimed r
+	WHERE
+		a.job_id = r.id
+		AND a.finished_at IS NULL
+)
+SELECT id, status, attempts FROM reclaimed;
+
+-- name: StartIngestionJobAttempt :one
+-- Records that a worker started running a job. Attempt numbers keep counting across retries.
+INSERT INTO ingestion_job_attempts (
+	job_id,
+	attempt,
+	worker_id
+) VALUES (
+	sqlc.arg(job_id),
+	(SELECT COALESCE(MAX(attempt), 0) + 1 FROM ingestion_job_attempts WHERE job_id = sqlc.arg(job_id)),
+	sqlc.arg(worker_id)
+)
+RETURNING id;
+
+-- name: FinishIngestionJobAttempt :exec
+-- Closes an attempt, copying the job's counters. A null status or error_details copies those from
+-- the job too, which is how a handler's own final status is recorded.
+UPDATE ingestion_job_attempts a
+SET
+	finished_at = NOW(),
+	status = COALESCE(sqlc.narg(status), j.status),
+	error_details = COALESCE(sqlc.narg(error_details), j.error_details),
+	rows_upserted = j.rows_upserted,
+	rows_triaged = j.rows_triaged
+FROM ingestion_jobs j
+WHERE
+	a.id = sqlc.arg(id)
+	AND j.id = a.job_id;
+
+-- name: MarkIngestionJobCancelled :exec
+-- Ends a job the worker stopped because a user cancelled it. Nothing it processed was committed.
+UPDATE ingestion_jobs
+SET
+	status = 'CANCELLED',
+	error_details = 'Cancelled by user',
+	completed_at = NOW(),
+	rows_upserted = NULL,
+	rows_triaged = NULL,
+	locked_by = NULL,
+	locked_at = NULL,
+	heartbeat_at = NULL
+WHERE
+	id = sqlc.arg(id)
+	AND locked_by = sqlc.arg(worker_id);
+
+-- name: MarkIngestionJobFailed :exec
+-- Fails a job on its last attempt when the handler didn't record a final status, e.g. because it
+-- panicked. A status the handler recorded is kept.
+UPDATE ingestion_jobs
+SET
+	status = 'FAILED',
+	error_details = sqlc.arg(error_details),
+	completed_at = NOW(),
+	locked_by = NULL,
+	locked_at = NULL,
+	heartbeat_at = NULL
+WHERE
+	id = sqlc.arg(id)
+	AND locked_by = sqlc.arg(worker_id)
+	AND status = 'PROCESSING';
@@ -36,3 +36,47 @@ ORDER BY
 	c.created_at ASC;
 
 
+
+-- name: ListExistingBusinessKeys :many
+-- Returns which of the given business keys already exist for an item type
+SELECT business_key FROM "items"
+WHERE item_type = sqlc.arg(item_type)
+AND business_key = ANY(sqlc.arg(business_keys)::text[]);
+
+-- name: ListItemPropertiesByBusinessKeys :many
+-- Returns the custom_properties of the items of a type with the given business keys
+SELECT business_key, custom_properties FROM "items"
+WHERE item_type = sqlc.arg(item_type)
+AND business_key = ANY(sqlc.arg(business_keys)::text[]);
+
+-- name: ListItemsWithPropertyKeys :many
+-- Pages through items of a type whose custom_properties has any of the given top-level keys
+SELECT id, custom_properties FROM "items"
+WHERE item_type = sqlc.arg(item_type)
+AND custom_properties ?| sqlc.arg(keys)::text[]
+AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg('limit');
+
+-- name: ListItemLineage :many
+-- Pages through the jobs and source rows that wrote an item, newest first
+SELECT
+	l.id,
+	l.job_id,
+	j.report_type,
+	j.status AS job_status,
+	l.source_uri,
+	l.row_number,
+	l.source_location,
+	l.config_version,
+	l.recorded_at
+FROM item_lineage l
+LEFT JOIN ingestion_jobs j ON j.id = l.job_id
+WHERE l.item_id = sqlc.arg(item_id)
+ORDER BY l.recorded_at DESC, l.id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountItemLineage :one
+-- Counts the lineage rows of an item
+SELECT COUNT(*) FROM item_lineage
+WHERE item_id = sqlc.arg(item_id);
@@ -0,0 +1,137 @@
+-- name: GetIngestionJobForUpdate :one
+-- Locks a job while it is rolled back
+SELECT * FROM ingestion_jobs
+WHERE id = sqlc.arg(id)
+FOR UPDATE;
+
+-- name: ListIngestionJobRollbackItems :many
+-- Finds the items a job changed and the state each had before the job, from the audit rows its
+-- transactions recorded against it. Items the job wrote without changing them have no item event
+-- and are left out. later_changes counts the edits users made to an item since and later_jobs lists
+-- the ingestion jobs that changed it since. Writes that only touched updated_at or the embedding,
+-- such as a re-ingest of unchanged rows or an embedding backfill, don't count.
+WITH job_writes AS (
+	SELECT DISTINCT e.item_id
+	FROM items_events e
+	WHERE
+		e.ingestion_job_id = sqlc.arg(job_id)
+		AND e.event_type IN ('INGESTION_CREATED', 'INGESTION_UPDATED', 'INGESTION_DEACTIVATED')
+), job_changes AS (
+	SELECT a.target_id, a.audit_id, a.operation, a.old_data
+	FROM audit.items_changes a
+	JOIN job_writes w ON w.item_id = a.target_id
+	WHERE a.ingestion_job_id = sqlc.arg(job_id)
+), first_changes AS (
+	SELECT DISTINCT ON (target_id) target_id, operation, old_data
+	FROM job_changes
+	ORDER BY target_id, audit_id
+), last_changes AS (
+	SELECT target_id, MAX(audit_id) AS audit_id
+	FROM job_changes
+	GROUP BY target_id
+), changes_since AS (
+	SELECT a.target_id, a.audit_id, a.changed_by, a.changed_at, a.ingestion_job_id
+	FROM audit.items_changes a
+	JOIN last_changes l ON l.target_id = a.target_id
+	WHERE
+		a.audit_id > l.audit_id
+		AND (a.old_data - 'updated_at' - 'embedding') IS DISTINCT FROM (a.new_data - 'updated_at' - 'embedding')
+)
+SELECT
+	f.target_id AS item_id,
+	(f.operation = 'I')::bool AS inserted,
+	f.old_data,
+	(
+		SELECT COUNT(*) FROM changes_since c
+		WHERE c.target_id = f.target_id AND c.ingestion_job_id IS NULL
+	) AS later_changes,
+	ARRAY(
+		SELECT DISTINCT c.ingestion_job_id FROM changes_since c
+		WHERE c.target_id = f.target_id AND c.ingestion_job_id IS NOT NULL
+		ORDER BY c.ingestion_job_id
+	)::uuid[] AS later_jobs,
+	latest.changed_by AS last_changed_by,
+	latest.changed_at AS last_changed_at
+FROM first_changes f
+LEFT JOIN LATERAL (
+	SELECT c.changed_by, c.changed_at
+	FROM changes_since c
+	WHERE c.target_id = f.target_id AND c.ingestion_job_id IS NULL
+	ORDER BY c.audit_id DESC
+	LIMIT 1
+) latest ON true
+ORDER BY f.target_id;
+
+-- name: SetAuditIngestionJob :exec
+-- Attributes the audit rows of the current transaction to an ingestion job
+SELECT set_config('app.ingestion_job_id', sqlc.arg(job_id)::text, true);
+
+-- name: SetAuditUser :exec
+-- Attributes the audit rows of the current transaction to a user
+SELECT set_config('app.user_id', sqlc.arg(user_id)::text, true);
+
+-- name: RestoreItemsFromAudit :execrows
+-- Puts items back to the state captured in their audit old_data
+UPDATE items i
+SET
+	scope = r.old_data->>'scope',
+	status = (r.old_data->>'status')::item_status,
+	custom_properties = r.old_data->'custom_properties',
+	embedding = (r.old_data->>'embedding')::vector,
+	updated_at = NOW()
+FROM (
+	SELECT
+		UNNEST(sqlc.arg(item_ids)::bigint[]) AS id,
+		UNNEST(sqlc.arg(old_data)::text[])::jsonb AS old_data
+) AS r
+WHERE i.id = r.id;
+
+-- name: DeactivateItems :execrows
+-- Sets the given items to inactive
+UPDATE items
+SET
+	status = 'inactive',
+	updated_at = NOW()
+WHERE
+	id = ANY(sqlc.arg(item_ids)::bigint[])
+	AND status <> 'inactive';
+
+-- name: ListReferencedItems :many
+-- Returns those of the given items that other records refer to: comments, status history,
+-- assignments, contacts, notifications, or events and lineage not written by the job. Deleting
+-- items cascades to most of these, so they are checked before a job's inserted items are deleted.
+SELECT i.id
+FROM items i
+WHERE
+	i.id = ANY(sqlc.arg(item_ids)::bigint[])
+	AND (
+		EXISTS (SELECT 1 FROM comments c WHERE c.item_id = i.id)
+		OR EXISTS (SELECT 1 FROM status_history h WHERE h.item_id = i.id)
+		OR EXISTS (SELECT 1 FROM item_assignments a WHERE a.item_id = i.id)
+		OR EXISTS (SELECT 1 FROM item_contacts ic WHERE ic.item_id = i.id)
+		OR EXISTS (SELECT 1 FROM notifications n WHERE n.source_item_id = i.id)
+		OR EXISTS (SELECT 1 FROM items_events e WHERE e.item_id = i.id AND e.ingestion_job_id IS DISTINCT FROM sqlc.arg(job_id))
+		OR EXISTS (SELECT 1 FROM item_lineage l WHERE l.item_id = i.id AND l.job_id IS DISTINCT FROM sqlc.arg(job_id))
+	)
+ORDER BY i.id;
+
+-- name: DeleteIngestionJobItemEvents :exec
+-- Removes the events a job wrote for items that are about to be deleted
+DELETE FROM items_events
+WHERE
+	item_id = ANY(sqlc.arg(item_ids)::bigint[])
+	AND ingestion_job_id = sqlc.arg(job_id);
+
+-- name: DeleteItems :execrows
+-- Deletes the given items. Fails if other records still refer to them.
+DELETE FROM items
+WHERE id = ANY(sqlc.arg(item_ids)::bigint[]);
+
+-- name: MarkIngestionJobRolledBack :exec
+-- Records that a job's changes to items were undone
+UPDATE ingestion_jobs
+SET
+	status = 'ROLLED_BACK',
+	error_details = sqlc.arg(message)
+WHERE
+	id = sqlc.arg(id);
@@ -41,3 +41,11 @@ WHERE
 	id = $1;
 
 
+-- name: SetItemCustomProperties :exec
+-- Replaces the custom_properties of an item without touching its other fields
+UPDATE items
+SET
+	custom_properties = $2
+WHERE
+	id = $1;
+